@@ -0,0 +1,90 @@
+#version 430 core
+
+//----------------------------------------------------------------------------//
+// uniforms                                                                   //
+//----------------------------------------------------------------------------//
+uniform int uStepSize = 1;
+
+//----------------------------------------------------------------------------//
+// textures                                                                   //
+//----------------------------------------------------------------------------//
+// filtered color in rgb and its variance in a
+layout(binding=7) uniform sampler2D inputTexture;
+
+//----------------------------------------------------------------------------//
+// output color                                                               //
+//----------------------------------------------------------------------------//
+layout (location = 0) out vec4 outColor;
+
+//----------------------------------------------------------------------------//
+// includes                                                                   //
+//----------------------------------------------------------------------------//
+#include "denoise.glsl"
+
+// weights of the 5x5 B3 spline kernel of the à-trous wavelet transform
+const float kernel[5] = float[](1.0 / 16.0, 1.0 / 4.0, 3.0 / 8.0, 1.0 / 4.0, 1.0 / 16.0);
+
+// weights of the 3x3 gaussian the variance is prefiltered with, indexed by
+// the distance to the center in x plus the distance in y
+const float gaussian[3] = float[](1.0 / 4.0, 1.0 / 8.0, 1.0 / 16.0);
+
+// PrefilterVariance returns the variance at p blurred with a 3x3 gaussian,
+// which makes the luminance weights more robust.
+float PrefilterVariance(in ivec2 p) {
+    float sum = 0.0, weights = 0.0;
+    for(int ky = -1; ky <= 1; ky++) {
+        for(int kx = -1; kx <= 1; kx++) {
+            ivec2 q = p + ivec2(kx, ky);
+            if (!InsideViewport(q) || IsBackground(q)) {
+                continue;
+            }
+            float g = gaussian[abs(kx) + abs(ky)];
+            sum += g * texelFetch(inputTexture, q, 0).a;
+            weights += g;
+        }
+    }
+    return weights == 0.0 ? 0.0 : sum / weights;
+}
+
+// applies one iteration of the edge-avoiding à-trous filter. the variance is
+// filtered with the squared weights, such that it stays the variance of the
+// filtered color.
+void main() {
+    ivec2 p = ivec2(gl_FragCoord.xy);
+    vec4 center = texelFetch(inputTexture, p, 0);
+    Surface s = LoadSurface(p);
+    if (s.background) {
+        outColor = center;
+        return;
+    }
+
+    float lp = Luminance(center.rgb);
+    float stddev = sqrt(PrefilterVariance(p));
+
+    vec3 sumColor = vec3(0);
+    float sumWeight = 0.0, sumVariance = 0.0;
+    for(int ky = -2; ky <= 2; ky++) {
+        for(int kx = -2; kx <= 2; kx++) {
+            ivec2 offset = ivec2(kx, ky) * uStepSize;
+            ivec2 q = p + offset;
+            if (!InsideViewport(q) || IsBackground(q)) {
+                continue;
+            }
+
+            vec4 tap = texelFetch(inputTexture, q, 0);
+            float weight = kernel[kx + 2] * kernel[ky + 2] *
+                SurfaceWeight(s, LoadSurface(q), vec2(offset)) *
+                LuminanceWeight(lp, Luminance(tap.rgb), stddev);
+
+            sumColor += weight * tap.rgb;
+            sumWeight += weight;
+            sumVariance += weight * weight * tap.a;
+        }
+    }
+
+    if (sumWeight == 0.0) {
+        outColor = center;
+        return;
+    }
+    outColor = vec4(sumColor / sumWeight, sumVariance / (sumWeight * sumWeight));
+}
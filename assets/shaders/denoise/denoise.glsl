@@ -0,0 +1,123 @@
+// constants of the denoiser, see the Go package denoise which is the CPU
+// reference of these shaders.
+#define DENOISE_MIN_HISTORY 4.0
+#define DENOISE_VARIANCE_RADIUS 3
+#define DENOISE_REPROJECTION_DEPTH 0.05
+#define DENOISE_REPROJECTION_NORMAL 0.9
+#define DENOISE_WEIGHT_EPS 1e-6
+
+// g-buffer of the pbr pass
+layout(binding=0) uniform sampler2D colorTexture;
+layout(binding=1) uniform sampler2D albedoTexture;
+layout(binding=2) uniform sampler2D normalTexture;
+layout(binding=3) uniform sampler2D metallicTexture;
+layout(binding=4) uniform sampler2D roughnessTexture;
+layout(binding=5) uniform sampler2D aoTexture;
+layout(binding=6) uniform sampler2D depthTexture;
+
+// options of the denoiser
+uniform float uSigmaNormal = 128.0;
+uniform float uSigmaDepth = 1.0;
+uniform float uSigmaMaterial = 0.1;
+uniform float uSigmaLuminance = 4.0;
+uniform float uSigmaColor = 0.1;
+uniform bool  uVariance = true;
+
+// Surface is the decoded g-buffer of one pixel. gradient is the change of the
+// depth per pixel in x and y direction and material holds the albedo,
+// metallic, roughness and ambient occlusion.
+struct Surface {
+    vec3  normal;
+    float depth;
+    vec2  gradient;
+    vec3  albedo;
+    vec3  material;
+    bool  background;
+};
+
+// Luminance returns the relative luminance of the linear color c.
+float Luminance(in vec3 c) {
+    return dot(c, vec3(0.2126, 0.7152, 0.0722));
+}
+
+// InsideViewport returns true if the pixel p lies within the g-buffer.
+bool InsideViewport(in ivec2 p) {
+    ivec2 size = textureSize(depthTexture, 0);
+    return all(greaterThanEqual(p, ivec2(0))) && all(lessThan(p, size));
+}
+
+// IsBackground returns true if no geometry has been rendered at pixel p.
+bool IsBackground(in ivec2 p) {
+    return texelFetch(depthTexture, p, 0).r >= 1.0;
+}
+
+// DepthDerivative returns the one sided difference of the depth at p in the
+// direction dir with the smaller magnitude, ignoring background pixels.
+float DepthDerivative(in ivec2 p, in ivec2 dir) {
+    float z = texelFetch(depthTexture, p, 0).r;
+    float d = 1e30;
+    for(int side = -1; side <= 1; side += 2) {
+        ivec2 q = p + side * dir;
+        if (!InsideViewport(q) || IsBackground(q)) {
+            continue;
+        }
+        float diff = float(side) * (texelFetch(depthTexture, q, 0).r - z);
+        if (abs(diff) < abs(d)) {
+            d = diff;
+        }
+    }
+    return d == 1e30 ? 0.0 : d;
+}
+
+// LoadSurface decodes the g-buffer at pixel p.
+Surface LoadSurface(in ivec2 p) {
+    Surface s;
+    s.depth = texelFetch(depthTexture, p, 0).r;
+    s.background = s.depth >= 1.0;
+    vec3 n = texelFetch(normalTexture, p, 0).rgb * 2.0 - 1.0;
+    s.normal = length(n) > 0.0 ? normalize(n) : vec3(0);
+    s.albedo = texelFetch(albedoTexture, p, 0).rgb;
+    s.material = vec3(
+        texelFetch(metallicTexture, p, 0).r,
+        texelFetch(roughnessTexture, p, 0).r,
+        texelFetch(aoTexture, p, 0).r
+    );
+    s.gradient = vec2(0);
+    if (!s.background) {
+        s.gradient = vec2(DepthDerivative(p, ivec2(1, 0)), DepthDerivative(p, ivec2(0, 1)));
+    }
+    return s;
+}
+
+// SurfaceWeight returns the edge stopping weight between the surfaces p and q
+// that are offset pixels apart, which is the product of the normal, depth and
+// material weights.
+float SurfaceWeight(in Surface p, in Surface q, in vec2 offset) {
+    float wn = pow(max(dot(p.normal, q.normal), 0.0), uSigmaNormal);
+
+    float dz = abs(p.depth - q.depth);
+    float wz = exp(-dz / (uSigmaDepth * abs(dot(p.gradient, offset)) + DENOISE_WEIGHT_EPS));
+
+    vec3 da = abs(p.albedo - q.albedo);
+    vec3 dm = abs(p.material - q.material);
+    float wm = 1.0;
+    if (uSigmaMaterial > 0.0) {
+        wm = exp(-(da.x + da.y + da.z + dm.x + dm.y + dm.z) / uSigmaMaterial);
+    }
+
+    return wn * wz * wm;
+}
+
+// LuminanceWeight returns the weight of the luminance difference between lp
+// and lq. stddev is the filtered standard deviation of the luminance at the
+// center pixel, which is only used for variance guided weights.
+float LuminanceWeight(in float lp, in float lq, in float stddev) {
+    float dl = abs(lp - lq);
+    if (uVariance) {
+        return exp(-dl / (uSigmaLuminance * stddev + DENOISE_WEIGHT_EPS));
+    }
+    if (uSigmaColor <= 0.0) {
+        return 1.0;
+    }
+    return exp(-dl / uSigmaColor);
+}
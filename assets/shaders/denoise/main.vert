@@ -0,0 +1,10 @@
+#version 430 core
+
+layout(location = 0) in vec3 pos;
+layout(location = 1) in vec2 uv;
+layout(location = 2) in vec3 normal;
+
+// the quad lies in the x-z plane and covers the whole viewport
+void main(){
+    gl_Position = vec4(pos.x, pos.z, 0.0, 1.0);
+}
@@ -0,0 +1,93 @@
+#version 430 core
+
+//----------------------------------------------------------------------------//
+// uniforms                                                                   //
+//----------------------------------------------------------------------------//
+uniform mat4  uInvViewProjection;
+uniform mat4  uPrevViewProjection;
+uniform mat4  uPrevInvViewProjection;
+uniform bool  uHistory = false;
+uniform float uAlpha = 0.2;
+
+//----------------------------------------------------------------------------//
+// textures                                                                   //
+//----------------------------------------------------------------------------//
+layout(binding=7) uniform sampler2D historyColorTexture;
+layout(binding=8) uniform sampler2D historyMomentsTexture;
+layout(binding=9) uniform sampler2D historySurfaceTexture;
+
+//----------------------------------------------------------------------------//
+// output color                                                               //
+//----------------------------------------------------------------------------//
+layout (location = 0) out vec4 outColor;
+layout (location = 1) out vec4 outMoments;
+layout (location = 2) out vec4 outSurface;
+
+//----------------------------------------------------------------------------//
+// includes                                                                   //
+//----------------------------------------------------------------------------//
+#include "denoise.glsl"
+
+// Unproject returns the world space position at the window coordinates
+// (x,y) with the depth z for the inverse of the view projection matrix.
+vec3 Unproject(in vec2 xy, in float z, in mat4 invViewProjection) {
+    vec2 size = vec2(textureSize(depthTexture, 0));
+    vec4 ndc = vec4(2.0 * xy / size - 1.0, 2.0 * z - 1.0, 1.0);
+    vec4 p = invViewProjection * ndc;
+    return p.xyz / p.w;
+}
+
+// PreviousPixel finds the pixel that showed the surface s at pixel p in the
+// previous frame. The previous pixel is only valid if its reconstructed
+// position is close to the position of s and its normal is similar.
+bool PreviousPixel(in ivec2 p, in Surface s, out ivec2 previous) {
+    if (s.background) {
+        return false;
+    }
+
+    vec3 position = Unproject(vec2(p) + 0.5, s.depth, uInvViewProjection);
+    vec4 clip = uPrevViewProjection * vec4(position, 1.0);
+    if (clip.w <= 0.0) {
+        return false;
+    }
+    vec2 size = vec2(textureSize(depthTexture, 0));
+    previous = ivec2(floor((clip.xy / clip.w + 1.0) / 2.0 * size));
+    if (!InsideViewport(previous)) {
+        return false;
+    }
+
+    vec4 q = texelFetch(historySurfaceTexture, previous, 0);
+    if (q.w >= 1.0 || dot(s.normal, q.xyz) < DENOISE_REPROJECTION_NORMAL) {
+        return false;
+    }
+    vec3 prevPosition = Unproject(vec2(previous) + 0.5, q.w, uPrevInvViewProjection);
+    return distance(prevPosition, position) <= DENOISE_REPROJECTION_DEPTH * clip.w;
+}
+
+// blends the history of the previous frame with the noisy color and its
+// luminance moments
+void main() {
+    ivec2 p = ivec2(gl_FragCoord.xy);
+    Surface s = LoadSurface(p);
+
+    vec3 color = texelFetch(colorTexture, p, 0).rgb;
+    float l = Luminance(color);
+    vec2 moments = vec2(l, l * l);
+    float len = 1.0;
+
+    ivec2 previous;
+    if (uHistory && PreviousPixel(p, s, previous)) {
+        vec3 history = texelFetch(historyColorTexture, previous, 0).rgb;
+        vec3 historyMoments = texelFetch(historyMomentsTexture, previous, 0).xyz;
+
+        // short histories are blended with the average of all frames
+        len = historyMoments.z + 1.0;
+        float alpha = max(uAlpha, 1.0 / len);
+        color = mix(history, color, alpha);
+        moments = mix(historyMoments.xy, moments, alpha);
+    }
+
+    outColor = vec4(color, 1.0);
+    outMoments = vec4(moments, len, 0.0);
+    outSurface = vec4(s.normal, s.depth);
+}
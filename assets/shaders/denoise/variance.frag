@@ -0,0 +1,64 @@
+#version 430 core
+
+//----------------------------------------------------------------------------//
+// textures                                                                   //
+//----------------------------------------------------------------------------//
+layout(binding=7) uniform sampler2D integratedTexture;
+layout(binding=8) uniform sampler2D momentsTexture;
+
+//----------------------------------------------------------------------------//
+// output color                                                               //
+//----------------------------------------------------------------------------//
+layout (location = 0) out vec4 outColor;
+
+//----------------------------------------------------------------------------//
+// includes                                                                   //
+//----------------------------------------------------------------------------//
+#include "denoise.glsl"
+
+// SpatialVariance estimates the variance of the luminance at p from the
+// surrounding pixels that belong to the same surface.
+float SpatialVariance(in ivec2 p, in Surface s) {
+    float m1 = 0.0, m2 = 0.0, weights = 0.0;
+    int r = DENOISE_VARIANCE_RADIUS;
+    for(int ky = -r; ky <= r; ky++) {
+        for(int kx = -r; kx <= r; kx++) {
+            ivec2 q = p + ivec2(kx, ky);
+            if (!InsideViewport(q) || IsBackground(q)) {
+                continue;
+            }
+
+            float weight = SurfaceWeight(s, LoadSurface(q), vec2(kx, ky));
+            float l = Luminance(texelFetch(integratedTexture, q, 0).rgb);
+            m1 += weight * l;
+            m2 += weight * l * l;
+            weights += weight;
+        }
+    }
+    if (weights == 0.0) {
+        return 0.0;
+    }
+    m1 /= weights;
+    m2 /= weights;
+    return max(m2 - m1 * m1, 0.0);
+}
+
+// estimates the variance from the temporal moments or spatially if the
+// history is too short
+void main() {
+    ivec2 p = ivec2(gl_FragCoord.xy);
+    vec3 color = texelFetch(integratedTexture, p, 0).rgb;
+
+    float variance = 0.0;
+    Surface s = LoadSurface(p);
+    if (uVariance && !s.background) {
+        vec3 moments = texelFetch(momentsTexture, p, 0).xyz;
+        if (moments.z >= DENOISE_MIN_HISTORY) {
+            variance = max(moments.y - moments.x * moments.x, 0.0);
+        } else {
+            variance = SpatialVariance(p, s);
+        }
+    }
+
+    outColor = vec4(color, variance);
+}
@@ -15,6 +15,11 @@ in Vertex {
 uniform vec3  uCameraPos;
 uniform int   uSamples = 10;
 uniform float uGlobalRoughness = 0.1;
+uniform vec3  uEta   = vec3(1);   // complex ior for the conductor fresnel
+uniform vec3  uKappa = vec3(0);
+uniform bool  uEnvImportance = false;
+uniform bool  uPrefiltered = false;      // split sum instead of sampling the specular
+uniform float uPrefilteredMaxMip = 0;
 
 //----------------------------------------------------------------------------//
 // textures                                                                   //
@@ -25,6 +30,8 @@ layout(binding=2) uniform sampler2D   normalTexture;
 layout(binding=3) uniform sampler2D   metallicTexture;
 layout(binding=4) uniform sampler2D   roughnessTexture;
 layout(binding=5) uniform sampler2D   aoTexture;
+layout(binding=13) uniform samplerCube prefilteredMap;
+layout(binding=14) uniform sampler2D   brdfLut;
 
 //----------------------------------------------------------------------------//
 // output color                                                               //
@@ -41,6 +48,8 @@ layout (location = 5) out vec3 outAo;
 //----------------------------------------------------------------------------//
 #include "../shared/tonemapping.glsl"
 #include "pbr.glsl"
+#include "../shared/envsampling.glsl"
+#include "../shared/prefiltered.glsl"
 
 vec3 CalculateDiffuseIntegral(PbrMaterial pbr, Microfacet micro) {
     vec3 irradiance = vec3(0);
@@ -99,6 +108,23 @@ vec3 CalculateThemSeparately(PbrMaterial pbr, Microfacet micro) {
     return Lo;
 }
 
+vec3 CalculateSplitSum(PbrMaterial pbr, Microfacet micro) {
+    // the diffuse integral is sampled and scaled like in CalculateThemTogether
+    vec3 Ld = PI * CalculateDiffuseIntegral(pbr, micro);
+
+    // the specular integral is split into the prefiltered environment and the
+    // environment brdf of the lookup table
+    vec3 Ls = SplitSumSpecular(prefilteredMap, brdfLut, micro.n, micro.v,
+                               pbr.f0, pbr.roughness, uPrefilteredMaxMip);
+
+    // add them together
+    vec3 Ks = FresnelSchlick(micro.v, micro.n, pbr.f0, pbr.roughness);
+    vec3 Kd = (vec3(1) - Ks) * (1-pbr.metallic);
+    vec3 Lo = (Kd*Ld + pbr.metallic*Ls) * pbr.ao;
+
+    return Lo;
+}
+
 vec3 CalculateThemTogether(PbrMaterial pbr, Microfacet micro) {
     // initialize diffuse and specular term
     vec3 Ld = vec3(0);
@@ -165,13 +191,72 @@ vec3 CalculateBrdfTogether(PbrMaterial pbr, Microfacet micro) {
     return Lo;
 }
 
+// GgxPdf returns the pdf of ImportanceSamplingGGX choosing the light direction
+// micro.l with the half vector micro.h.
+float GgxPdf(in PbrMaterial pbr, in Microfacet micro) {
+    float d = NormalDistributionGGX(micro.n, micro.h, pbr.roughness);
+    float nDotH = max(dot(micro.n, micro.h), 0.0);
+    float vDotH = max(dot(micro.v, micro.h), EPS);
+    return d * nDotH / (4 * vDotH);
+}
+
+// CalculateBrdfMIS estimates the integral of Brdf times the incoming radiance
+// by combining samples of the GGX distribution with samples of the luminance
+// of the environment using multiple importance sampling. Small and bright
+// light sources like the sun are found by the environment samples while the
+// GGX samples handle glossy reflections.
+vec3 CalculateBrdfMIS(PbrMaterial pbr, Microfacet micro) {
+    // initialize outgoing radiance
+    vec3 Lo = vec3(0);
+
+    for(int s = 0; s < uSamples; s++) {
+        vec2 xi = HammersleySampling(s, uSamples);
+
+        // sample the brdf
+        micro.h = ImportanceSamplingGGX(xi, micro.n, pbr.roughness);
+        micro.l = reflect(-micro.v, micro.h);
+        float nDotL = CosTheta(micro);
+        if (nDotL > 0) {
+            float pdfBrdf = GgxPdf(pbr, micro);
+            float pdfEnv  = EnvironmentImportancePdf(micro.l);
+            float w = PowerHeuristic(pdfBrdf, pdfEnv);
+            if (pdfBrdf > 0) {
+                Lo += Brdf(pbr, micro) * Li(i.pos, micro.l) * nDotL * w / pdfBrdf;
+            }
+        }
+
+        // sample the environment. the swapped sample decorrelates both
+        // strategies.
+        float pdfEnv;
+        micro.l = SampleEnvironmentImportance(xi.yx, pdfEnv);
+        micro.h = normalize(micro.l + micro.v);
+        nDotL = CosTheta(micro);
+        if (nDotL > 0 && pdfEnv > 0) {
+            float pdfBrdf = GgxPdf(pbr, micro);
+            float w = PowerHeuristic(pdfEnv, pdfBrdf);
+            Lo += Brdf(pbr, micro) * Li(i.pos, micro.l) * nDotL * w / pdfEnv;
+        }
+    }
+
+    // put everything together
+    Lo *= pbr.ao / uSamples;
+    return Lo;
+}
+
 void main(){
     // setup parameters
     PbrMaterial pbr   = MakePbrMaterial();
     Microfacet  micro = MakeMicroFacet(pbr, i.pos, i.normal);
 
     //vec3 Lo = CalculateThemSeparately(pbr, micro);
-    vec3 Lo = CalculateBrdfTogether(pbr, micro);
+    vec3 Lo;
+    if (uPrefiltered) {
+        Lo = CalculateSplitSum(pbr, micro);
+    } else if (uEnvImportance) {
+        Lo = CalculateBrdfMIS(pbr, micro);
+    } else {
+        Lo = CalculateBrdfTogether(pbr, micro);
+    }
 
     // normalize and map color to LDR then apply gamma function
     vec3 colorLDR = ReinhardTonemapping(Lo);
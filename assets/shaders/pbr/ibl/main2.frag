@@ -15,6 +15,8 @@ in Vertex {
 uniform vec3  uCameraPos;
 uniform int   uSamples = 10;
 uniform float uGlobalRoughness = 0.1;
+uniform vec3  uEta   = vec3(1);   // complex ior for the conductor fresnel
+uniform vec3  uKappa = vec3(0);
 
 //----------------------------------------------------------------------------//
 // textures                                                                   //
@@ -1,5 +1,6 @@
 #include "../shared/constants.glsl"
 #include "../shared/brdf.glsl"
+#include "../shared/microfacet.glsl"
 #include "../shared/environment.glsl"
 #include "../shared/normal.glsl"
 #include "../shared/random.glsl"
@@ -50,7 +51,9 @@ vec3 diffuse(in PbrMaterial pbr, in Microfacet micro) {
     return pbr.albedo / PI;
 }
 
-// specular calculates the specular fraction of the surface
+// specular calculates the specular fraction of the surface using the variants
+// selected by NDF, GEOMETRY and FRESNEL of microfacet.glsl. schlick's fresnel
+// keeps the roughness term of the image based lighting.
 vec3 specular(in PbrMaterial pbr, in Microfacet micro) {
     vec3 v = micro.v;
     vec3 l = micro.l;
@@ -58,9 +61,13 @@ vec3 specular(in PbrMaterial pbr, in Microfacet micro) {
     vec3 h = micro.h;
 
     // calculate brdf
-    float d = NormalDistributionGGX(n, h, pbr.a);
-    float g = GeometrySmith(l, v, n, pbr.k);
+    float d = MicrofacetD(n, h, pbr.a);
+    float g = MicrofacetG(l, v, n, pbr.a, pbr.k);
+#if FRESNEL == FRESNEL_SCHLICK
     vec3  f = FresnelSchlick(v, n, pbr.f0, pbr.roughness);
+#else
+    vec3  f = MicrofacetF(v, n, pbr.f0, uEta, uKappa);
+#endif
 
     // calculate normalization
     float ndotl = max(dot(n, l), 0);
@@ -0,0 +1,138 @@
+// traversal of the bounding volume hierarchy of pkg/bvh. the nodes and
+// triangles are uploaded with BVH.MakeSSBOs and have to be bound to the
+// bindings BVH_NODE_BINDING and BVH_TRIANGLE_BINDING. the builder limits the
+// depth of the hierarchy to MAX_DEPTH, thus a path has at most MAX_DEPTH+1
+// nodes. the traversal needs one stack entry per node of the path, thus the
+// stack can't overflow.
+#ifndef BVH_NODE_BINDING
+#define BVH_NODE_BINDING 0
+#endif
+#ifndef BVH_TRIANGLE_BINDING
+#define BVH_TRIANGLE_BINDING 1
+#endif
+#define BVH_STACK_SIZE 65 // MAX_DEPTH+1 of pkg/bvh
+
+struct BvhNode {
+    vec4 min;   // w holds the offset as int bits
+    vec4 max;   // w holds the triangle count as int bits
+};
+
+struct BvhTriangle {
+    vec4 v0;    // w holds the index in the original triangle soup as int bits
+    vec4 v1;
+    vec4 v2;
+};
+
+layout(std430, binding = BVH_NODE_BINDING) readonly buffer BvhNodes {
+    BvhNode bvhNodes[];
+};
+
+layout(std430, binding = BVH_TRIANGLE_BINDING) readonly buffer BvhTriangles {
+    BvhTriangle bvhTriangles[];
+};
+
+struct BvhHit {
+    float t;
+    vec3  barycentric;
+    int   index;
+};
+
+// BvhSlab returns the entry distance of the ray into the box or -1 on a miss.
+float BvhSlab(vec3 o, vec3 invdir, vec3 bmin, vec3 bmax, float tmin, float tmax) {
+    vec3 t0 = (bmin - o) * invdir;
+    vec3 t1 = (bmax - o) * invdir;
+    vec3 tn = min(t0, t1);
+    vec3 tf = max(t0, t1);
+    float tnear = max(max(tn.x, tn.y), max(tn.z, tmin));
+    float tfar  = min(min(tf.x, tf.y), min(tf.z, tmax));
+    return (tnear <= tfar) ? tnear : -1;
+}
+
+// BvhIntersectTriangle intersects the ray with the triangle using the
+// algorithm of Möller and Trumbore.
+bool BvhIntersectTriangle(vec3 o, vec3 d, BvhTriangle tri, float tmin, float tmax, out float t, out vec3 bary) {
+    vec3 e1 = tri.v1.xyz - tri.v0.xyz;
+    vec3 e2 = tri.v2.xyz - tri.v0.xyz;
+    vec3 p  = cross(d, e2);
+    float det = dot(e1, p);
+    if (abs(det) < 1e-12) return false;
+    float invdet = 1 / det;
+
+    vec3 s  = o - tri.v0.xyz;
+    float u = dot(s, p) * invdet;
+    if (u < 0 || u > 1) return false;
+    vec3 q  = cross(s, e1);
+    float v = dot(d, q) * invdet;
+    if (v < 0 || u + v > 1) return false;
+
+    t    = dot(e2, q) * invdet;
+    bary = vec3(1 - u - v, u, v);
+    return t >= tmin && t <= tmax;
+}
+
+// BvhClosestHit returns the closest intersection of the ray with the
+// triangles of the hierarchy. The index of the hit is -1 on a miss.
+BvhHit BvhClosestHit(vec3 o, vec3 d, float tmin, float tmax) {
+    BvhHit hit;
+    hit.t     = tmax;
+    hit.index = -1;
+    if (bvhNodes.length() == 0) return hit;
+
+    vec3 invdir = 1 / d;
+    int stack[BVH_STACK_SIZE];
+    int sp = 0;
+    stack[sp++] = 0;
+    while (sp > 0) {
+        int idx = stack[--sp];
+        BvhNode node = bvhNodes[idx];
+        if (BvhSlab(o, invdir, node.min.xyz, node.max.xyz, tmin, hit.t) < 0) continue;
+
+        int offset = floatBitsToInt(node.min.w);
+        int count  = floatBitsToInt(node.max.w);
+        if (count > 0) {
+            for (int i = offset; i < offset + count; i++) {
+                float t;
+                vec3  bary;
+                BvhTriangle tri = bvhTriangles[i];
+                if (BvhIntersectTriangle(o, d, tri, tmin, hit.t, t, bary)) {
+                    hit.t           = t;
+                    hit.barycentric = bary;
+                    hit.index       = floatBitsToInt(tri.v0.w);
+                }
+            }
+        } else {
+            stack[sp++] = offset;
+            stack[sp++] = idx + 1;
+        }
+    }
+
+    return hit;
+}
+
+// BvhAnyHit returns true if the ray intersects any triangle of the hierarchy.
+bool BvhAnyHit(vec3 o, vec3 d, float tmin, float tmax) {
+    if (bvhNodes.length() == 0) return false;
+    vec3 invdir = 1 / d;
+    int stack[BVH_STACK_SIZE];
+    int sp = 0;
+    stack[sp++] = 0;
+    while (sp > 0) {
+        int idx = stack[--sp];
+        BvhNode node = bvhNodes[idx];
+        if (BvhSlab(o, invdir, node.min.xyz, node.max.xyz, tmin, tmax) < 0) continue;
+
+        int offset = floatBitsToInt(node.min.w);
+        int count  = floatBitsToInt(node.max.w);
+        if (count > 0) {
+            for (int i = offset; i < offset + count; i++) {
+                float t;
+                vec3  bary;
+                if (BvhIntersectTriangle(o, d, bvhTriangles[i], tmin, tmax, t, bary)) return true;
+            }
+        } else {
+            stack[sp++] = offset;
+            stack[sp++] = idx + 1;
+        }
+    }
+    return false;
+}
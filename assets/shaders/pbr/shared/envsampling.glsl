@@ -0,0 +1,128 @@
+#include "constants.glsl"
+
+// cdfs of the luminance of the environment cube map as created by
+// envmap.CubemapSampler.Textures. the faces are stacked on top of each other,
+// thus the conditional cdf has one row per row of each face and the marginal
+// cdf one texel per row. texel i holds the upper end of segment i.
+layout(binding=6) uniform sampler2D envConditionalCdf;
+layout(binding=7) uniform sampler2D envMarginalCdf;
+
+// sampleCdf finds the segment of the cdf in the specified row of the texture
+// that contains u and returns the continuous position in [0,1] as well as the
+// pdf of that position.
+float sampleCdf(sampler2D cdf, int row, float u, out float pdf) {
+    int n = textureSize(cdf, 0).x;
+
+    // binary search for the first upper end that is bigger than u
+    int lo = 0;
+    int hi = n - 1;
+    while (lo < hi) {
+        int mid = (lo + hi) / 2;
+        if (texelFetch(cdf, ivec2(mid, row), 0).r > u) {
+            hi = mid;
+        } else {
+            lo = mid + 1;
+        }
+    }
+
+    // position within the segment
+    float c0 = (lo > 0) ? texelFetch(cdf, ivec2(lo-1, row), 0).r : 0.0;
+    float c1 = texelFetch(cdf, ivec2(lo, row), 0).r;
+    float du = (c1 > c0) ? (u - c0) / (c1 - c0) : 0.5;
+
+    pdf = (c1 - c0) * n;
+    return (lo + clamp(du, 0, 1)) / n;
+}
+
+// cdfPdf returns the pdf of the position x in [0,1] of the cdf in the
+// specified row of the texture.
+float cdfPdf(sampler2D cdf, int row, float x) {
+    int n = textureSize(cdf, 0).x;
+    int i = clamp(int(x * n), 0, n - 1);
+    float c0 = (i > 0) ? texelFetch(cdf, ivec2(i-1, row), 0).r : 0.0;
+    float c1 = texelFetch(cdf, ivec2(i, row), 0).r;
+    return (c1 - c0) * n;
+}
+
+// cubeFaceDirection returns the direction of the point (s,t) in [-1,1] on the
+// specified face following the opengl cube map conventions.
+vec3 cubeFaceDirection(int face, float s, float t) {
+    vec3 dir;
+    if      (face == 0) dir = vec3( 1, -t, -s);
+    else if (face == 1) dir = vec3(-1, -t,  s);
+    else if (face == 2) dir = vec3( s,  1,  t);
+    else if (face == 3) dir = vec3( s, -1, -t);
+    else if (face == 4) dir = vec3( s, -t,  1);
+    else                dir = vec3(-s, -t, -1);
+    return normalize(dir);
+}
+
+// cubeDirectionToFace returns the face the direction points to and the
+// position (s,t) in [-1,1] on that face.
+int cubeDirectionToFace(vec3 dir, out vec2 st) {
+    vec3 a = abs(dir);
+    int face;
+    float ma;
+    if (a.x >= a.y && a.x >= a.z) {
+        ma = a.x;
+        face = (dir.x > 0) ? 0 : 1;
+        st = (dir.x > 0) ? vec2(-dir.z, -dir.y) : vec2(dir.z, -dir.y);
+    } else if (a.y >= a.z) {
+        ma = a.y;
+        face = (dir.y > 0) ? 2 : 3;
+        st = (dir.y > 0) ? vec2(dir.x, dir.z) : vec2(dir.x, -dir.z);
+    } else {
+        ma = a.z;
+        face = (dir.z > 0) ? 4 : 5;
+        st = (dir.z > 0) ? vec2(dir.x, -dir.y) : vec2(-dir.x, -dir.y);
+    }
+    st /= max(ma, EPS);
+    return face;
+}
+
+// cubeSolidAnglePdf converts the pdf over the stacked faces into the pdf with
+// respect to the solid angle.
+float cubeSolidAnglePdf(float pdf, vec2 st) {
+    float d = 1 + dot(st, st);
+    return pdf / 24.0 * d * sqrt(d);
+}
+
+// SampleEnvironmentImportance maps the uniform random numbers xi onto a
+// direction that is distributed according to the luminance of the
+// environment and returns its pdf with respect to the solid angle.
+vec3 SampleEnvironmentImportance(vec2 xi, out float pdf) {
+    // choose the row of the stacked faces and the position within the row
+    float pdfy, pdfx;
+    float y = sampleCdf(envMarginalCdf, 0, xi.y, pdfy);
+    int rows = textureSize(envMarginalCdf, 0).x;
+    int row = clamp(int(y * rows), 0, rows - 1);
+    float x = sampleCdf(envConditionalCdf, row, xi.x, pdfx);
+
+    // turn the position into a direction
+    int face = min(int(y * 6), 5);
+    vec2 st = vec2(2*x - 1, 2*(y*6 - face) - 1);
+    pdf = cubeSolidAnglePdf(pdfx * pdfy, st);
+    return cubeFaceDirection(face, st.x, st.y);
+}
+
+// EnvironmentImportancePdf returns the pdf of SampleEnvironmentImportance
+// choosing the direction dir.
+float EnvironmentImportancePdf(vec3 dir) {
+    vec2 st;
+    int face = cubeDirectionToFace(dir, st);
+    float x = (st.x + 1) / 2;
+    float y = (face + (st.y + 1) / 2) / 6;
+
+    int rows = textureSize(envMarginalCdf, 0).x;
+    int row = clamp(int(y * rows), 0, rows - 1);
+    float pdf = cdfPdf(envMarginalCdf, 0, y) * cdfPdf(envConditionalCdf, row, x);
+    return cubeSolidAnglePdf(pdf, st);
+}
+
+// PowerHeuristic weights a sample of the strategy with the pdf pdfa against
+// another strategy with the pdf pdfb.
+float PowerHeuristic(float pdfa, float pdfb) {
+    float a = pdfa * pdfa;
+    float b = pdfb * pdfb;
+    return (a + b > 0) ? a / (a + b) : 0;
+}
@@ -0,0 +1,164 @@
+// Lobes of the principled material extensions: clearcoat, sheen, anisotropy
+// and thin-walled transmission. The lobes follow the Filament material model
+// and are mirrored by the Go package brdf. Expects PI to be defined by the
+// including shader.
+
+//--------------------------------------------------------------------------//
+// clearcoat                                                                //
+//--------------------------------------------------------------------------//
+
+// VisibilityKelemen is the visibility term of Kelemen which is cheap enough
+// for the clear coat layer. It already includes the 1 / (4 (n.l) (n.v)).
+float VisibilityKelemen(vec3 l, vec3 h) {
+    float lDoth = max(dot(l, h), 1e-4);
+    return 0.25 / (lDoth * lDoth);
+}
+
+// ClearcoatFresnel returns the fresnel of the clear coat layer, which is a
+// dielectric with an ior of 1.5, scaled by the clear coat intensity.
+float ClearcoatFresnel(vec3 v, vec3 h, float clearcoat) {
+    float vDoth = max(dot(v, h), 0);
+    return (0.04 + 0.96 * pow(1 - vDoth, 5)) * clearcoat;
+}
+
+// ClearcoatLobe returns the specular lobe of the clear coat layer with the
+// perceptual roughness clearcoatRoughness.
+float ClearcoatLobe(vec3 l, vec3 v, vec3 n, float clearcoat, float clearcoatRoughness) {
+    vec3  h  = normalize(l + v);
+    float a  = clearcoatRoughness * clearcoatRoughness;
+    float nh = max(dot(n, h), 0);
+    float a2 = a * a;
+    float d  = nh * nh * (a2 - 1) + 1;
+    float D  = a2 / (PI * d * d);
+    return D * VisibilityKelemen(l, h) * ClearcoatFresnel(v, h, clearcoat);
+}
+
+//--------------------------------------------------------------------------//
+// sheen                                                                    //
+//--------------------------------------------------------------------------//
+
+// NormalDistributionCharlie is the charlie sheen distribution of Estevez and
+// Kulla for the roughness parameter a.
+float NormalDistributionCharlie(vec3 n, vec3 h, float a) {
+    float invA  = 1 / max(a, 1e-3);
+    float cos2h = max(dot(n, h), 0);
+    cos2h *= cos2h;
+    float sin2h = max(1 - cos2h, 1e-7);
+    return (2 + invA) * pow(sin2h, invA * 0.5) / (2 * PI);
+}
+
+// VisibilityNeubelt is the visibility term of Neubelt and Pettineo for cloth.
+float VisibilityNeubelt(float nDotL, float nDotV) {
+    return 1 / max(4 * (nDotL + nDotV - nDotL * nDotV), 1e-4);
+}
+
+// SheenLobe returns the sheen lobe with the specified color and perceptual
+// roughness.
+vec3 SheenLobe(vec3 l, vec3 v, vec3 n, vec3 sheenColor, float sheenRoughness) {
+    vec3  h = normalize(l + v);
+    float D = NormalDistributionCharlie(n, h, sheenRoughness * sheenRoughness);
+    float V = VisibilityNeubelt(max(dot(n, l), 0), max(dot(n, v), 0));
+    return sheenColor * D * V;
+}
+
+//--------------------------------------------------------------------------//
+// anisotropy                                                               //
+//--------------------------------------------------------------------------//
+
+// AnisotropicFrame returns the tangent and bitangent of the normal rotated by
+// the angle rotation in radians around the normal.
+void AnisotropicFrame(vec3 n, float rotation, out vec3 t, out vec3 b) {
+    vec3 up = (abs(n.y) < 0.999) ? vec3(0, 1, 0) : vec3(1, 0, 0);
+    vec3 t0 = normalize(cross(up, n));
+    vec3 b0 = cross(n, t0);
+    t = cos(rotation) * t0 + sin(rotation) * b0;
+    b = cross(n, t);
+}
+
+// AnisotropicRoughness returns the roughness along the tangent and the
+// bitangent for the anisotropy in [-1,1].
+vec2 AnisotropicRoughness(float a, float anisotropy) {
+    float at = max(a * (1 + anisotropy), 1e-3);
+    float ab = max(a * (1 - anisotropy), 1e-3);
+    return vec2(at, ab);
+}
+
+// NormalDistributionAnisotropicGGX is the anisotropic GGX distribution with
+// the roughness at along the tangent t and ab along the bitangent b.
+float NormalDistributionAnisotropicGGX(vec3 n, vec3 h, vec3 t, vec3 b, float at, float ab) {
+    float tDoth = dot(t, h);
+    float bDoth = dot(b, h);
+    float nDoth = max(dot(n, h), 0);
+    float a2 = at * ab;
+    vec3  d  = vec3(ab * tDoth, at * bDoth, a2 * nDoth);
+    float d2 = dot(d, d);
+    float w2 = a2 / d2;
+    return a2 * w2 * w2 / PI;
+}
+
+// VisibilityAnisotropicSmithGGXCorrelated is the height-correlated smith
+// visibility for the anisotropic GGX distribution. It already includes the
+// 1 / (4 (n.l) (n.v)).
+float VisibilityAnisotropicSmithGGXCorrelated(vec3 l, vec3 v, vec3 n, vec3 t, vec3 b, float at, float ab) {
+    float nDotL = max(dot(n, l), 0);
+    float nDotV = max(dot(n, v), 0);
+    float lambdaV = nDotL * length(vec3(at * dot(t, v), ab * dot(b, v), nDotV));
+    float lambdaL = nDotV * length(vec3(at * dot(t, l), ab * dot(b, l), nDotL));
+    return 0.5 / max(lambdaV + lambdaL, 1e-6);
+}
+
+// AnisotropicSpecular returns the anisotropic specular lobe without fresnel.
+float AnisotropicSpecular(vec3 l, vec3 v, vec3 n, float a, float anisotropy, float rotation) {
+    vec3 t, b;
+    AnisotropicFrame(n, rotation, t, b);
+    vec2 ar = AnisotropicRoughness(a, anisotropy);
+
+    vec3  h = normalize(l + v);
+    float D = NormalDistributionAnisotropicGGX(n, h, t, b, ar.x, ar.y);
+    float V = VisibilityAnisotropicSmithGGXCorrelated(l, v, n, t, b, ar.x, ar.y);
+    return D * V;
+}
+
+//--------------------------------------------------------------------------//
+// transmission                                                             //
+//--------------------------------------------------------------------------//
+
+// IorToF0 returns the reflectance at normal incidence of a dielectric with the
+// index of refraction ior.
+float IorToF0(float ior) {
+    float r = (ior - 1) / (ior + 1);
+    return r * r;
+}
+
+// ThinWalledDirection mirrors the light direction l, which comes from behind
+// the surface, onto the side of the normal. For a thin-walled surface the
+// refraction of entering and leaving the surface cancel out, thus the light
+// continues in its direction and the transmission lobe can be evaluated like
+// a reflection lobe with the mirrored direction.
+vec3 ThinWalledDirection(vec3 l, vec3 n) {
+    return l - 2 * dot(n, l) * n;
+}
+
+// TransmissionLobe returns the thin-walled transmission lobe for light coming
+// from behind the surface. The lobe is a GGX lobe with the roughness parameter
+// a tinted by the albedo and weighted by the energy not reflected by the
+// surface.
+vec3 TransmissionLobe(vec3 l, vec3 v, vec3 n, vec3 albedo, float a, float transmission, float ior) {
+    vec3  lt    = ThinWalledDirection(l, n);
+    vec3  h     = normalize(lt + v);
+    float nDotL = max(dot(n, lt), 0);
+    float nDotV = max(dot(n, v), 0);
+
+    float nh = max(dot(n, h), 0);
+    float a2 = a * a;
+    float d  = nh * nh * (a2 - 1) + 1;
+    float D  = a2 / (PI * d * d);
+
+    float lambdaV = nDotL * sqrt(nDotV * nDotV * (1 - a2) + a2);
+    float lambdaL = nDotV * sqrt(nDotL * nDotL * (1 - a2) + a2);
+    float V = 0.5 / max(lambdaV + lambdaL, 1e-6);
+
+    float f0 = IorToF0(ior);
+    float F  = f0 + (1 - f0) * pow(1 - nDotV, 5);
+    return transmission * albedo * (1 - F) * D * V;
+}
@@ -0,0 +1,197 @@
+// Selectable variants of the terms of the microfacet BRDF. The variants are
+// chosen at compile time by defining NDF, GEOMETRY and FRESNEL, e.g. with
+// shader.MakeWithDefines. The values match the constants of the Go package
+// brdf. Expects PI to be defined by the including shader.
+
+// normal distribution functions
+#define NDF_GGX         0
+#define NDF_BECKMANN    1
+#define NDF_BLINN_PHONG 2
+
+// geometry terms
+#define GEOMETRY_SMITH_SEPARABLE  0
+#define GEOMETRY_SMITH_CORRELATED 1
+#define GEOMETRY_KELEMEN          2
+#define GEOMETRY_IMPLICIT         3
+
+// fresnel terms
+#define FRESNEL_SCHLICK    0
+#define FRESNEL_DIELECTRIC 1
+#define FRESNEL_CONDUCTOR  2
+
+// default to the model that had been used before the variants existed
+#ifndef NDF
+#define NDF NDF_GGX
+#endif
+#ifndef GEOMETRY
+#define GEOMETRY GEOMETRY_SMITH_SEPARABLE
+#endif
+#ifndef FRESNEL
+#define FRESNEL FRESNEL_SCHLICK
+#endif
+
+//--------------------------------------------------------------------------//
+// normal distribution functions                                            //
+//--------------------------------------------------------------------------//
+
+// NormalDistributionGGXVariant uses trowbridge-reitz ggx normal distribution
+// function with the roughness parameter a.
+float NormalDistributionGGXVariant(vec3 n, vec3 h, float a) {
+    float angle = max(dot(n, h), 0);
+    float a2 = a * a;
+    float d = (angle*angle) * (a2-1) + 1;
+
+    return a2 / (PI * d * d);
+}
+
+// NormalDistributionBeckmann is the beckmann normal distribution function for
+// the roughness parameter a.
+float NormalDistributionBeckmann(vec3 n, vec3 h, float a) {
+    float nDoth = max(dot(n, h), 1e-4);
+    float a2 = max(a * a, 1e-6);
+    float cos2 = nDoth * nDoth;
+    return exp((cos2 - 1) / (a2 * cos2)) / (PI * a2 * cos2 * cos2);
+}
+
+// NormalDistributionBlinnPhong is the normalized blinn-phong normal
+// distribution function. The roughness parameter a is mapped to the phong
+// exponent 2/a^2 - 2 which makes it similar to beckmann.
+float NormalDistributionBlinnPhong(vec3 n, vec3 h, float a) {
+    float nDoth = max(dot(n, h), 0);
+    float a2 = max(a * a, 1e-6);
+    float exponent = 2 / a2 - 2;
+    return (exponent + 2) / (2 * PI) * pow(nDoth, exponent);
+}
+
+//--------------------------------------------------------------------------//
+// geometry terms                                                           //
+//--------------------------------------------------------------------------//
+
+// GeometrySmithSeparable is the separable smith geometry term using the
+// schlick-ggx approximation with the remapped roughness k.
+float GeometrySmithSeparable(vec3 l, vec3 v, vec3 n, float k) {
+    float nDotl = max(dot(n, l), 0);
+    float nDotv = max(dot(n, v), 0);
+    float ggx1 = nDotl / (nDotl * (1.0 - k) + k);
+    float ggx2 = nDotv / (nDotv * (1.0 - k) + k);
+    return ggx1 * ggx2;
+}
+
+// GeometrySmithCorrelated is the height-correlated smith geometry term for
+// GGX with the roughness parameter a.
+float GeometrySmithCorrelated(vec3 l, vec3 v, vec3 n, float a) {
+    float nDotl = max(dot(n, l), 0);
+    float nDotv = max(dot(n, v), 0);
+    float a2 = a * a;
+    float ggxv = nDotl * sqrt(nDotv * nDotv * (1 - a2) + a2);
+    float ggxl = nDotv * sqrt(nDotl * nDotl * (1 - a2) + a2);
+    float denom = ggxv + ggxl;
+    return (denom > 0) ? 2 * nDotl * nDotv / denom : 0;
+}
+
+// GeometryKelemen is the geometry term of Kelemen and Szirmay-Kalos.
+float GeometryKelemen(vec3 l, vec3 v, vec3 n) {
+    vec3 h = normalize(l + v);
+    float nDotl = max(dot(n, l), 0);
+    float nDotv = max(dot(n, v), 0);
+    float vDoth = max(dot(v, h), 1e-4);
+    return nDotl * nDotv / (vDoth * vDoth);
+}
+
+// GeometryImplicit cancels out the denominator of the microfacet BRDF.
+float GeometryImplicit(vec3 l, vec3 v, vec3 n) {
+    return max(dot(n, l), 0) * max(dot(n, v), 0);
+}
+
+//--------------------------------------------------------------------------//
+// fresnel terms                                                            //
+//--------------------------------------------------------------------------//
+
+// F0ToIor returns the index of refraction of a dielectric with the base
+// reflectivity f0 when the light comes from air.
+vec3 F0ToIor(vec3 f0) {
+    vec3 s = sqrt(clamp(f0, vec3(0), vec3(0.99)));
+    return (1 + s) / (1 - s);
+}
+
+// FresnelDielectric is the exact fresnel reflectance for unpolarized light
+// hitting a dielectric with the relative index of refraction eta.
+float FresnelDielectric(float cosTheta, float eta) {
+    float c = cosTheta;
+    float g2 = eta * eta - 1 + c * c;
+    // total internal reflection
+    if (g2 < 0) {
+        return 1;
+    }
+    float g = sqrt(g2);
+    float a = (g - c) / (g + c);
+    float b = (c * (g + c) - 1) / (c * (g - c) + 1);
+    return 0.5 * a * a * (1 + b * b);
+}
+
+// FresnelConductor is the exact fresnel reflectance for unpolarized light
+// hitting a conductor with the complex index of refraction eta + i*k.
+vec3 FresnelConductor(float cosTheta, vec3 eta, vec3 k) {
+    float c2 = cosTheta * cosTheta;
+    float s2 = 1 - c2;
+    vec3 eta2 = eta * eta;
+    vec3 k2 = k * k;
+
+    vec3 t0 = eta2 - k2 - s2;
+    vec3 a2b2 = sqrt(t0 * t0 + 4 * eta2 * k2);
+    vec3 t1 = a2b2 + c2;
+    vec3 a = sqrt(max(0.5 * (a2b2 + t0), vec3(0)));
+    vec3 t2 = 2 * a * cosTheta;
+    vec3 rs = (t1 - t2) / (t1 + t2);
+
+    vec3 t3 = c2 * a2b2 + s2 * s2;
+    vec3 t4 = t2 * s2;
+    vec3 rp = rs * (t3 - t4) / (t3 + t4);
+
+    return 0.5 * (rp + rs);
+}
+
+//--------------------------------------------------------------------------//
+// selected variants                                                        //
+//--------------------------------------------------------------------------//
+
+// MicrofacetD evaluates the selected normal distribution function.
+float MicrofacetD(vec3 n, vec3 h, float a) {
+#if NDF == NDF_BECKMANN
+    return NormalDistributionBeckmann(n, h, a);
+#elif NDF == NDF_BLINN_PHONG
+    return NormalDistributionBlinnPhong(n, h, a);
+#else
+    return NormalDistributionGGXVariant(n, h, a);
+#endif
+}
+
+// MicrofacetG evaluates the selected geometry term. a is the roughness
+// parameter and k the remapped roughness of the separable smith term.
+float MicrofacetG(vec3 l, vec3 v, vec3 n, float a, float k) {
+#if GEOMETRY == GEOMETRY_SMITH_CORRELATED
+    return GeometrySmithCorrelated(l, v, n, a);
+#elif GEOMETRY == GEOMETRY_KELEMEN
+    return GeometryKelemen(l, v, n);
+#elif GEOMETRY == GEOMETRY_IMPLICIT
+    return GeometryImplicit(l, v, n);
+#else
+    return GeometrySmithSeparable(l, v, n, k);
+#endif
+}
+
+// MicrofacetF evaluates the selected fresnel term using the angle between v
+// and n. eta and k are the complex index of refraction used for conductors.
+vec3 MicrofacetF(vec3 v, vec3 n, vec3 f0, vec3 eta, vec3 k) {
+    float vdotn = max(dot(v, n), 0);
+#if FRESNEL == FRESNEL_DIELECTRIC
+    vec3 ior = F0ToIor(f0);
+    return vec3(FresnelDielectric(vdotn, ior.r),
+                FresnelDielectric(vdotn, ior.g),
+                FresnelDielectric(vdotn, ior.b));
+#elif FRESNEL == FRESNEL_CONDUCTOR
+    return FresnelConductor(vdotn, eta, k);
+#else
+    return f0 + (vec3(1) - f0) * pow(1 - vdotn, 5);
+#endif
+}
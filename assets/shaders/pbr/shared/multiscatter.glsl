@@ -0,0 +1,36 @@
+// Multiple scattering compensation after Kulla and Conty "Revisiting
+// Physically Based Shading at Imageworks". The single scattering specular
+// lobe loses the energy of light bouncing several times between microfacets,
+// which darkens rough metals. The albedo tables are generated by
+// brdf.MakeMultiscatterTables. The directional albedo table is sampled with
+// vec2(n.v, roughness) and the average albedo table with vec2(roughness, 0.5).
+// Expects PI to be defined by the including shader.
+
+// MultiscatterBrdf returns the multiple scattering lobe that is added to the
+// single scattering specular brdf for direct lighting.
+vec3 MultiscatterBrdf(sampler2D albedoTable, sampler2D averageAlbedoTable,
+                      float nDotL, float nDotV, float roughness, vec3 f0) {
+    float eo   = texture(albedoTable, vec2(nDotV, roughness)).r;
+    float ei   = texture(albedoTable, vec2(nDotL, roughness)).r;
+    float eavg = texture(averageAlbedoTable, vec2(roughness, 0.5)).r;
+    if (eavg >= 1) {
+        return vec3(0);
+    }
+
+    // colored fresnel is approximated with the average of schlick's fresnel
+    vec3 favg = f0 + (vec3(1) - f0) / 21.0;
+    vec3 tint = favg * favg * eavg / (vec3(1) - favg * (1 - eavg));
+
+    return tint * (1 - eo) * (1 - ei) / (PI * (1 - eavg));
+}
+
+// MultiscatterCompensation returns the factor that scales the single
+// scattering specular lobe for image based lighting to account for the
+// missing energy, following Fdez-Aguera "A Multiple-Scattering Microfacet
+// Model for Real-Time Image-based Lighting". The albedo table has to be
+// generated with the k of the image based lighting brdf, see
+// brdf.MakeIBLMultiscatterTables.
+vec3 MultiscatterCompensation(sampler2D albedoTable, float nDotV, float roughness, vec3 f0) {
+    float ess = max(texture(albedoTable, vec2(nDotV, roughness)).r, 1e-4);
+    return vec3(1) + f0 * (1 / ess - 1);
+}
@@ -0,0 +1,21 @@
+// PrefilteredRadiance returns the radiance of the prefiltered specular
+// environment in the reflection direction r. The mip levels of the cube map
+// store the GGX prefiltered environment with the roughness increasing
+// linearly from 0 at the base level to 1 at level maxMip.
+vec3 PrefilteredRadiance(samplerCube prefiltered, vec3 r, float roughness, float maxMip) {
+    return textureLod(prefiltered, r, roughness * maxMip).rgb;
+}
+
+// SplitSumSpecular returns the specular image based lighting using the split
+// sum approximation. The first integral is read from the prefiltered
+// environment and the second integral from the environment BRDF lookup table,
+// which stores the scale and bias applied to f0.
+vec3 SplitSumSpecular(samplerCube prefiltered, sampler2D brdfLut, vec3 n, vec3 v,
+                      vec3 f0, float roughness, float maxMip) {
+    float nDotV = max(dot(n, v), 0.0);
+    vec3  r     = reflect(-v, n);
+
+    vec3 radiance = PrefilteredRadiance(prefiltered, r, roughness, maxMip);
+    vec2 brdf     = texture(brdfLut, vec2(nDotV, roughness)).rg;
+    return radiance * (f0 * brdf.x + brdf.y);
+}
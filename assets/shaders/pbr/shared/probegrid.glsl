@@ -0,0 +1,132 @@
+#include "sh.glsl"
+
+// layout of a probe in the 3D texture, see the Go package lightprobe. each
+// probe occupies PROBE_GRID_TEXELS texels along x, the first 9 hold the
+// irradiance coefficients and the remaining 4 the distance moments.
+#define PROBE_GRID_IRRADIANCE_TEXELS 9
+#define PROBE_GRID_VISIBILITY_TEXELS 4
+#define PROBE_GRID_TEXELS 13
+#define PROBE_GRID_VISIBILITY_BIAS 0.1
+#define PROBE_GRID_MIN_WEIGHT 1e-6
+
+layout(binding=12) uniform sampler3D probeGrid;
+
+// bounds of the grid, the probes lie on its corners
+uniform vec3 uProbeGridMin;
+uniform vec3 uProbeGridMax;
+
+// ProbeGridResolution returns the number of probes along each axis.
+ivec3 ProbeGridResolution() {
+    ivec3 size = textureSize(probeGrid, 0);
+    return ivec3(size.x / PROBE_GRID_TEXELS, size.y, size.z);
+}
+
+// ProbeGridPosition returns the world space position of a probe. Along axes
+// with a single probe it is centered.
+vec3 ProbeGridPosition(in ivec3 probe, in ivec3 resolution) {
+    vec3 t = vec3(probe) / vec3(max(resolution - 1, ivec3(1)));
+    t = mix(vec3(0.5), t, greaterThan(resolution, ivec3(1)));
+    return mix(uProbeGridMin, uProbeGridMax, t);
+}
+
+// ProbeGridEvaluate returns the irradiance of a probe for the normal n without
+// clamping negative values.
+vec3 ProbeGridEvaluate(in ivec3 probe, in vec3 n) {
+    float basis[9];
+    SHBasis(n, basis);
+
+    vec3 irradiance = vec3(0);
+    for(int i = 0; i < PROBE_GRID_IRRADIANCE_TEXELS; i++) {
+        ivec3 texel = ivec3(probe.x * PROBE_GRID_TEXELS + i, probe.yz);
+        irradiance += texelFetch(probeGrid, texel, 0).rgb * basis[i];
+    }
+    return irradiance;
+}
+
+// ProbeGridMoments returns the mean and the mean squared distance of a probe
+// to the surfaces in the direction dir.
+vec2 ProbeGridMoments(in ivec3 probe, in vec3 dir) {
+    float basis[9];
+    SHBasis(dir, basis);
+
+    vec2 moments = vec2(0);
+    for(int i = 0; i < PROBE_GRID_VISIBILITY_TEXELS; i++) {
+        ivec3 texel = ivec3(probe.x * PROBE_GRID_TEXELS + PROBE_GRID_IRRADIANCE_TEXELS + i, probe.yz);
+        moments += texelFetch(probeGrid, texel, 0).rg * basis[i];
+    }
+    return moments;
+}
+
+// ProbeGridChebyshev returns the upper bound of the probability that a surface
+// at the specified distance is visible given the distance moments.
+float ProbeGridChebyshev(in vec2 moments, in float dist) {
+    if(dist <= moments.x) {
+        return 1.0;
+    }
+    float variance = abs(moments.y - moments.x * moments.x);
+    float d = dist - moments.x;
+    float p = variance / (variance + d * d);
+    return max(p * p * p, 0.0);
+}
+
+// ProbeGridWeight returns the visibility weight of the probe at the position
+// probePos for the point pos with the normal n and the biased point.
+float ProbeGridWeight(in ivec3 probe, in vec3 probePos, in vec3 pos, in vec3 biased, in vec3 n) {
+    // smooth backface test
+    vec3 toProbe = probePos - pos;
+    float weight = 1.0;
+    if(length(toProbe) > 0.0) {
+        float wrap = (dot(normalize(toProbe), n) + 1.0) / 2.0;
+        weight = wrap * wrap + 0.2;
+    }
+
+    // chebyshev test of the distance moments
+    vec3 toPoint = biased - probePos;
+    float dist = length(toPoint);
+    if(dist > 0.0) {
+        vec2 moments = ProbeGridMoments(probe, toPoint / dist);
+        weight *= ProbeGridChebyshev(moments, dist);
+    }
+
+    return max(weight, PROBE_GRID_MIN_WEIGHT);
+}
+
+// ProbeGridIrradiance returns the irradiance at the world space position pos
+// for the normalized normal n by interpolating the 8 surrounding probes.
+// Besides the trilinear weights each probe is weighted by how much it lies in
+// front of the surface and by how likely it sees the point, which prevents
+// light from leaking through walls. It mirrors Grid.IrradianceAt of the Go
+// package lightprobe.
+vec3 ProbeGridIrradiance(in vec3 pos, in vec3 n) {
+    ivec3 resolution = ProbeGridResolution();
+    vec3 size = uProbeGridMax - uProbeGridMin;
+    vec3 spacing = size / vec3(max(resolution - 1, ivec3(1)));
+    float bias = PROBE_GRID_VISIBILITY_BIAS * min(spacing.x, min(spacing.y, spacing.z));
+    vec3 biased = pos + n * bias;
+
+    // find the cell of the grid and the position within the cell
+    vec3 last = vec3(resolution - 1);
+    vec3 g = clamp((pos - uProbeGridMin) / max(size, vec3(1e-6)) * last, vec3(0), last);
+    ivec3 base = clamp(ivec3(floor(g)), ivec3(0), max(resolution - 2, ivec3(0)));
+    vec3 t = clamp(g - vec3(base), vec3(0), vec3(1));
+
+    vec3 sum = vec3(0);
+    float weights = 0.0;
+    for(int corner = 0; corner < 8; corner++) {
+        ivec3 offset = ivec3(corner & 1, (corner >> 1) & 1, (corner >> 2) & 1);
+        ivec3 probe = min(base + offset, resolution - 1);
+        vec3 tri = mix(vec3(1) - t, t, vec3(offset));
+        float trilinear = tri.x * tri.y * tri.z;
+
+        vec3 probePos = ProbeGridPosition(probe, resolution);
+        float weight = ProbeGridWeight(probe, probePos, pos, biased, n) * trilinear;
+
+        sum += ProbeGridEvaluate(probe, n) * weight;
+        weights += weight;
+    }
+
+    if(weights <= 0.0) {
+        return vec3(0);
+    }
+    return max(sum / weights, vec3(0));
+}
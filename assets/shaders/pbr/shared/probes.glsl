@@ -0,0 +1,131 @@
+// reflection probes, see pkg/scene/probe
+#define MAX_PROBES 4
+#define PROBE_SHAPE_BOX    0
+#define PROBE_SHAPE_SPHERE 1
+
+// ProbeVolume is either an axis aligned box or a sphere with the radius
+// extent.x.
+struct ProbeVolume {
+    int  shape;
+    vec3 center;
+    vec3 extent;
+};
+
+// Probe is a cube map captured at position. Its weight fades out over the
+// distance blend towards the border of the influence volume, while the
+// reflections are projected onto the proxy volume.
+struct Probe {
+    vec3        position;
+    float       blend;
+    ProbeVolume influence;
+    ProbeVolume proxy;
+};
+
+uniform int   uProbeCount = 0;
+uniform Probe uProbes[MAX_PROBES];
+
+layout(binding=8) uniform samplerCube probeCubemaps[MAX_PROBES];
+
+// RayBoxIntersection calculates the distance along the ray with origin o and
+// direction dir to the border of the axis aligned box. For rays starting
+// inside of the box it is the distance to the exit point. Returns false if
+// the ray misses the box or the box lies behind the ray.
+bool RayBoxIntersection(vec3 boxMin, vec3 boxMax, vec3 o, vec3 dir, out float t) {
+    vec3 tMin = (boxMin - o) / dir;
+    vec3 tMax = (boxMax - o) / dir;
+    vec3 t1 = min(tMin, tMax);
+    vec3 t2 = max(tMin, tMax);
+    float tNear = max(max(t1.x, t1.y), t1.z);
+    float tFar  = min(min(t2.x, t2.y), t2.z);
+
+    t = (tNear >= 0) ? tNear : tFar;
+    return tNear <= tFar && tFar >= 0;
+}
+
+// RaySphereIntersection calculates the distance along the ray with origin o
+// and normalized direction dir to the border of the sphere like
+// RayBoxIntersection.
+bool RaySphereIntersection(vec3 center, float radius, vec3 o, vec3 dir, out float t) {
+    vec3  oc = o - center;
+    float b  = dot(oc, dir);
+    float c  = dot(oc, oc) - radius*radius;
+    float discriminant = b*b - c;
+    t = 0.0;
+    if (discriminant < 0) {
+        return false;
+    }
+
+    float sq = sqrt(discriminant);
+    float tNear = -b - sq;
+    float tFar  = -b + sq;
+    t = (tNear >= 0) ? tNear : tFar;
+    return tFar >= 0;
+}
+
+// RayVolumeIntersection intersects the ray with the box or sphere.
+bool RayVolumeIntersection(ProbeVolume volume, vec3 o, vec3 dir, out float t) {
+    if (volume.shape == PROBE_SHAPE_SPHERE) {
+        return RaySphereIntersection(volume.center, volume.extent.x, o, dir, t);
+    }
+    return RayBoxIntersection(volume.center - volume.extent,
+        volume.center + volume.extent, o, dir, t);
+}
+
+// VolumeDistance returns the distance of pos to the border of the volume,
+// which is positive inside of the volume.
+float VolumeDistance(ProbeVolume volume, vec3 pos) {
+    vec3 d = pos - volume.center;
+    if (volume.shape == PROBE_SHAPE_SPHERE) {
+        return volume.extent.x - length(d);
+    }
+    vec3 dist = volume.extent - abs(d);
+    return min(min(dist.x, dist.y), dist.z);
+}
+
+// ProbeWeight returns the influence of the probe at pos in [0,1].
+float ProbeWeight(Probe probe, vec3 pos) {
+    float d = VolumeDistance(probe.influence, pos);
+    if (probe.blend <= 0) {
+        return (d >= 0) ? 1.0 : 0.0;
+    }
+    return clamp(d / probe.blend, 0.0, 1.0);
+}
+
+// ProbeLookupDirection returns the parallax corrected direction for looking
+// up the cube map of the probe. If the ray misses the proxy the direction
+// isn't corrected.
+vec3 ProbeLookupDirection(Probe probe, vec3 pos, vec3 dir) {
+    float t;
+    if (!RayVolumeIntersection(probe.proxy, pos, dir, t)) {
+        return dir;
+    }
+
+    vec3 lookup = pos + t*dir - probe.position;
+    return (dot(lookup, lookup) > 0) ? normalize(lookup) : dir;
+}
+
+// SampleProbes blends the parallax corrected lookups of all probes at pos in
+// direction wi. If the weights sum up to more than 1 they are normalized,
+// otherwise the remaining weight is returned in distantWeight.
+vec3 SampleProbes(vec3 wi, vec3 pos, out float distantWeight) {
+    float weights[MAX_PROBES];
+    float sum = 0;
+    for (int p = 0; p < MAX_PROBES; p++) {
+        weights[p] = (p < uProbeCount) ? ProbeWeight(uProbes[p], pos) : 0.0;
+        sum += weights[p];
+    }
+    float norm = (sum > 1) ? 1.0 / sum : 1.0;
+
+    // only branch on the uniform probe count to keep the implicit derivatives
+    // of the cube map lookups defined
+    vec3 color = vec3(0);
+    for (int p = 0; p < MAX_PROBES; p++) {
+        if (p < uProbeCount) {
+            vec3 dir = ProbeLookupDirection(uProbes[p], pos, wi);
+            color += weights[p] * norm * texture(probeCubemaps[p], dir).rgb;
+        }
+    }
+
+    distantWeight = max(1 - sum, 0);
+    return color;
+}
@@ -17,6 +17,22 @@ vec2 HammersleySampling(uint i, uint N) {
 	return vec2(float(i)/float(N), radicalInverseVanDerCorpus(i));
 }
 
+// PcgHash is a stateless hash with the quality of a single step of the PCG
+// random number generator, which is useful to seed random numbers per pixel.
+uint PcgHash(uint v) {
+	uint state = v * 747796405u + 2891336453u;
+	uint word = ((state >> ((state >> 28u) + 4u)) ^ state) * 277803737u;
+	return (word >> 22u) ^ word;
+}
+
+// R2Sequence returns the i-th point of the additive recurrence based on the
+// plastic number, which is a low discrepancy sequence without a fixed number
+// of samples.
+vec2 R2Sequence(uint i) {
+	const vec2 alpha = vec2(0.75487766624669276, 0.56984029099805327);
+	return fract(0.5 + alpha * float(i));
+}
+
 vec3 ImportanceSamplingGGX(vec2 xi, vec3 n, float a) {
 	float phi = 2 * PI * xi.x;
 	float cosTheta = sqrt((1 - xi.y) / (1 + (a*a - 1) * xi.y));
@@ -0,0 +1,35 @@
+#include "constants.glsl"
+
+// SHBasis evaluates the 9 real spherical harmonics basis functions of order 3
+// for the normalized direction n. The order of the basis functions matches the
+// Go package sh.
+void SHBasis(in vec3 n, out float basis[9]) {
+    basis[0] = 0.282095;
+    basis[1] = 0.488603 * n.y;
+    basis[2] = 0.488603 * n.z;
+    basis[3] = 0.488603 * n.x;
+    basis[4] = 1.092548 * n.x * n.y;
+    basis[5] = 1.092548 * n.y * n.z;
+    basis[6] = 0.315392 * (3 * n.z * n.z - 1);
+    basis[7] = 1.092548 * n.x * n.z;
+    basis[8] = 0.546274 * (n.x * n.x - n.y * n.y);
+}
+
+// SHIrradiance returns the irradiance for the normal n. The coefficients have
+// to be convolved with the cosine lobe already, e.g. by sh.Convolve.
+vec3 SHIrradiance(in vec3 coeffs[9], in vec3 n) {
+    float basis[9];
+    SHBasis(normalize(n), basis);
+
+    vec3 irradiance = vec3(0);
+    for(int i = 0; i < 9; i++) {
+        irradiance += coeffs[i] * basis[i];
+    }
+    return max(irradiance, vec3(0));
+}
+
+// SHDiffuse returns the outgoing radiance of a lambertian surface with the
+// specified albedo lit by the irradiance encoded in the coefficients.
+vec3 SHDiffuse(in vec3 coeffs[9], in vec3 n, in vec3 albedo) {
+    return albedo / PI * SHIrradiance(coeffs, n);
+}
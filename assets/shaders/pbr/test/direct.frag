@@ -18,6 +18,30 @@ uniform vec3  uLightColor = vec3(10);
 uniform vec3  uAlbedo;
 uniform float uMetallic;
 uniform float uRoughness;
+uniform float uDielectricF0 = 0.04; // reflectivity of the non-metallic part
+uniform vec3  uEta   = vec3(1);   // complex ior for the conductor fresnel
+uniform vec3  uKappa = vec3(0);
+uniform bool  uMultiscatter = false;
+
+// material extensions
+uniform bool  uClearcoatEnabled    = false;
+uniform float uClearcoat           = 1;
+uniform float uClearcoatRoughness  = 0.1;
+uniform bool  uSheenEnabled        = false;
+uniform vec3  uSheenColor          = vec3(1);
+uniform float uSheenRoughness      = 0.5;
+uniform bool  uAnisotropyEnabled   = false;
+uniform float uAnisotropy          = 0.5;
+uniform float uAnisotropyRotation  = 0;
+uniform bool  uTransmissionEnabled = false;
+uniform float uTransmission        = 1;
+uniform float uIor                 = 1.5;
+
+//--------------------------------------------------------------------------//
+// textures                                                                 //
+//--------------------------------------------------------------------------//
+layout(binding=0) uniform sampler2D albedoTable;
+layout(binding=1) uniform sampler2D averageAlbedoTable;
 
 //--------------------------------------------------------------------------//
 // output color                                                             //
@@ -163,6 +187,10 @@ vec3 FresnelSchlick(vec3 v, vec3 n, vec3 f0, float roughness) {
     return f0 + (max(vec3(1 - roughness), f0) - f0) * pow(1 - vdotn, 5);
 }
 
+#include "../shared/microfacet.glsl"
+#include "../shared/multiscatter.glsl"
+#include "../shared/extensions.glsl"
+
 //--------------------------------------------------------------------------//
 // pbr                                                                      //
 //--------------------------------------------------------------------------//
@@ -174,6 +202,15 @@ struct PbrMaterial {
     vec3  f0;
     float a;
     float k;
+    // extensions, a value of 0 disables the lobe
+    float clearcoat;
+    float clearcoatRoughness;
+    vec3  sheenColor;
+    float sheenRoughness;
+    float anisotropy;
+    float anisotropyRotation;
+    float transmission;
+    float ior;
 };
 
 struct Microfacet {
@@ -189,9 +226,24 @@ PbrMaterial MakePbrMaterial() {
     pbr.albedo    = uAlbedo;
     pbr.metallic  = uMetallic;
     pbr.roughness = uRoughness;
-    pbr.f0        = mix(vec3(0.04), pbr.albedo, pbr.metallic);
+    pbr.f0        = mix(vec3(uDielectricF0), pbr.albedo, pbr.metallic);
     pbr.a         = pbr.roughness * pbr.roughness;
     pbr.k         = ((pbr.roughness+1) * (pbr.roughness+1)) / 8.0;
+
+    // material extensions
+    pbr.clearcoat          = uClearcoatEnabled ? uClearcoat : 0;
+    pbr.clearcoatRoughness = uClearcoatRoughness;
+    pbr.sheenColor         = uSheenEnabled ? uSheenColor : vec3(0);
+    pbr.sheenRoughness     = uSheenRoughness;
+    pbr.anisotropy         = uAnisotropyEnabled ? uAnisotropy : 0;
+    pbr.anisotropyRotation = uAnisotropyRotation;
+    pbr.transmission       = uTransmissionEnabled ? uTransmission : 0;
+    pbr.ior                = uIor;
+
+    // a transmissive dielectric reflects according to its ior
+    if (pbr.transmission > 0) {
+        pbr.f0 = mix(vec3(IorToF0(pbr.ior)), pbr.albedo, pbr.metallic);
+    }
     return pbr;
 }
 
@@ -218,9 +270,9 @@ vec3 specular(in PbrMaterial pbr, in Microfacet micro) {
     vec3 h = micro.h;
 
     // calculate brdf
-    float d = NormalDistributionGGX(n, h, pbr.a);
-    float g = GeometrySmith(l, v, n, pbr.k);
-    vec3  f = FresnelSchlick(v, n, pbr.f0);
+    float d = MicrofacetD(n, h, pbr.a);
+    float g = MicrofacetG(l, v, n, pbr.a, pbr.k);
+    vec3  f = MicrofacetF(v, n, pbr.f0, uEta, uKappa);
 
     // calculate normalization
     float ndotl = max(dot(n, l), 0);
@@ -236,29 +288,80 @@ vec3 Li(vec3 pos) {
     return uLightColor / (dist*dist);
 }
 
+// MultiscatterF0 returns the reflectance at normal incidence which tints the
+// multiple scattering lobe.
+vec3 MultiscatterF0(in PbrMaterial pbr) {
+#if FRESNEL == FRESNEL_CONDUCTOR
+    return FresnelConductor(1, uEta, uKappa);
+#else
+    return pbr.f0;
+#endif
+}
+
 // Brdf calculates the Cook-Torrance BRDF for the given material and surface
 // properties.
 vec3 Brdf(in PbrMaterial pbr, in Microfacet micro) {
-    vec3 F = FresnelSchlick(micro.v, micro.n, pbr.f0);
+    vec3 F = MicrofacetF(micro.v, micro.n, pbr.f0, uEta, uKappa);
     vec3 kD = (vec3(1) - F) * (1-pbr.metallic);
 
     vec3 diffuseColor  = mix(diffuse(pbr), vec3(0), uMetallic);
     vec3 specularColor = specular(pbr, micro);
 
-    return specularColor + kD * diffuseColor;
+    // replace the isotropic lobe by the anisotropic one
+    if (pbr.anisotropy != 0) {
+        specularColor = F * AnisotropicSpecular(micro.l, micro.v, micro.n,
+            pbr.a, pbr.anisotropy, pbr.anisotropyRotation);
+    }
+
+    // the transmitted light isn't diffusely reflected
+    diffuseColor *= 1 - pbr.transmission;
+
+    // add the energy lost by the single scattering lobe
+    if (uMultiscatter) {
+        float nDotL = max(dot(micro.n, micro.l), 0);
+        float nDotV = max(dot(micro.n, micro.v), 0);
+        specularColor += MultiscatterBrdf(albedoTable, averageAlbedoTable,
+            nDotL, nDotV, pbr.roughness, MultiscatterF0(pbr));
+    }
+
+    vec3 color = specularColor + kD * diffuseColor;
+
+    // sheen on top of the base layer
+    if (pbr.sheenColor != vec3(0)) {
+        color += SheenLobe(micro.l, micro.v, micro.n, pbr.sheenColor, pbr.sheenRoughness);
+    }
+
+    // the clear coat layer absorbs the energy it reflects from the layers below
+    if (pbr.clearcoat > 0) {
+        float Fc = ClearcoatFresnel(micro.v, micro.h, pbr.clearcoat);
+        color = color * (1 - Fc) + ClearcoatLobe(micro.l, micro.v, micro.n,
+            pbr.clearcoat, pbr.clearcoatRoughness);
+    }
+
+    return color;
+}
+
+// Btdf calculates the thin-walled transmission for light coming from behind
+// the surface.
+vec3 Btdf(in PbrMaterial pbr, in Microfacet micro) {
+    if (pbr.transmission <= 0) {
+        return vec3(0);
+    }
+    return (1 - pbr.metallic) * TransmissionLobe(micro.l, micro.v, micro.n,
+        pbr.albedo, pbr.a, pbr.transmission, pbr.ior);
 }
 
 // CalcD calculates the normal distribution for debugging.
 vec3 CalcD(in PbrMaterial pbr, in Microfacet micro) {
-    return vec3(NormalDistributionGGX(micro.n, micro.h, pbr.a));
+    return vec3(MicrofacetD(micro.n, micro.h, pbr.a));
 }
 // CalcG calculates the geometric distibution for debugging.
 vec3 CalcG(in PbrMaterial pbr, in Microfacet micro) {
-    return vec3(GeometrySmith(micro.l, micro.v, micro.n, pbr.k));
+    return vec3(MicrofacetG(micro.l, micro.v, micro.n, pbr.a, pbr.k));
 }
 // CalcF calculates the surface reflectance for debugging.
 vec3 CalcF(in PbrMaterial pbr, in Microfacet micro) {
-    return FresnelSchlick(micro.v, micro.n, pbr.f0);                             // replaced h with n
+    return MicrofacetF(micro.v, micro.n, pbr.f0, uEta, uKappa);                  // replaced h with n
 }
 
 //--------------------------------------------------------------------------//
@@ -274,10 +377,11 @@ void main(){
     Microfacet micro = MakeMicroFacet(pbr, i.pos, n);
 
     // cosine angle
-    float nDotL = max(dot(micro.l, micro.n), 0.0);
+    float nDotL = dot(micro.l, micro.n);
 
-    // calculate resulting color
-    vec3 Lo = PI * Brdf(pbr, micro) * nDotL * Li(i.pos);
+    // calculate resulting color, light from behind can only be transmitted
+    vec3 f  = (nDotL >= 0) ? Brdf(pbr, micro) : Btdf(pbr, micro);
+    vec3 Lo = PI * f * abs(nDotL) * Li(i.pos);
 
     // add some ambient lighting
     float ao = 1;
@@ -15,6 +15,13 @@ in Vertex {
 uniform vec3  uCameraPos;
 uniform int   uSamples = 10;
 uniform float uGlobalRoughness = 0.1;
+uniform float uDielectricF0 = 0.04; // reflectivity of the non-metallic part
+uniform vec3  uEta   = vec3(1);   // complex ior for the conductor fresnel
+uniform vec3  uKappa = vec3(0);
+uniform bool  uMultiscatter = false;
+uniform bool  uSunEnabled = false; // sun extracted from the environment map
+uniform vec3  uSunDir = vec3(0, 1, 0);
+uniform vec3  uSunIrradiance = vec3(0);
 
 //----------------------------------------------------------------------------//
 // textures                                                                   //
@@ -25,6 +32,7 @@ layout(binding=2) uniform sampler2D   normalTexture;
 layout(binding=3) uniform sampler2D   metallicTexture;
 layout(binding=4) uniform sampler2D   roughnessTexture;
 layout(binding=5) uniform sampler2D   aoTexture;
+layout(binding=6) uniform sampler2D   albedoTable;
 
 //--------------------------------------------------------------------------//
 // output color                                                             //
@@ -97,35 +105,7 @@ vec3 InvGamma(in vec3 color) {
 // environment sampling                                                     //
 //--------------------------------------------------------------------------//
 
-// cube dimensions
-const vec3 cubeMin    = vec3(-50);
-const vec3 cubeMax    = vec3(50);
-const vec3 cubeCenter = vec3(0);
-
-// RayBoxIntersection calculates the intersection between a ray and an axis 
-// aligned box. 
-vec3 RayBoxIntersection(const vec3 boxMin, const vec3 boxMax, const vec3 o, const vec3 dir) {
-	vec3 d = (1) * dir;
-	
-	vec3 tMin = (boxMin - o) / d;
-    vec3 tMax = (boxMax - o) / d;
-    vec3 t1 = min(tMin, tMax);
-    vec3 t2 = max(tMin, tMax);
-    float tNear = max(max(t1.x, t1.y), t1.z);
-    float tFar = min(min(t2.x, t2.y), t2.z);
-
-	float t = (tNear >= 0) ? tNear : tFar;
-
-	return o + t * d;
-}
-
-// SampleEnvironment returns the color of the cubemap of the intersection point
-// pos in direction wi.
-vec3 SampleEnvironment(in vec3 wi, in vec3 pos) {
-    vec3 intersection = RayBoxIntersection(cubeMin, cubeMax, pos, wi);
-    vec3 envLookupDir = normalize(intersection - cubeCenter);
-    return vec3(texture(cubemap, envLookupDir));
-}
+#include "../shared/environment.glsl"
 
 //--------------------------------------------------------------------------//
 // normal                                                                   //
@@ -204,6 +184,9 @@ vec3 FresnelSchlick(vec3 v, vec3 n, vec3 f0, float roughness) {
     return f0 + (max(vec3(1 - roughness), f0) - f0) * pow(1 - vdotn, 5);
 }
 
+#include "../shared/microfacet.glsl"
+#include "../shared/multiscatter.glsl"
+
 //--------------------------------------------------------------------------//
 // pbr                                                                      //
 //--------------------------------------------------------------------------//
@@ -235,7 +218,7 @@ PbrMaterial MakePbrMaterial() {
     pbr.roughness = texture(roughnessTexture,   i.uv).x;
     pbr.roughness = max(pbr.roughness, uGlobalRoughness);
     pbr.ao        = texture(aoTexture,          i.uv).x;
-    pbr.f0        = mix(vec3(0.04), pbr.albedo, pbr.metallic);
+    pbr.f0        = mix(vec3(uDielectricF0), pbr.albedo, pbr.metallic);
     pbr.a         = pbr.roughness;
     //pbr.a         = pbr.roughness * pbr.roughness;
     pbr.k         = (pbr.a * pbr.a) / 2.0;
@@ -265,9 +248,13 @@ vec3 specular(in PbrMaterial pbr, in Microfacet micro) {
     vec3 h = micro.h;
 
     // calculate brdf
-    float d = NormalDistributionGGX(n, h, pbr.a);
-    float g = GeometrySmith(l, v, n, pbr.k);
+    float d = MicrofacetD(n, h, pbr.a);
+    float g = MicrofacetG(l, v, n, pbr.a, pbr.k);
+#if FRESNEL == FRESNEL_SCHLICK
     vec3  f = FresnelSchlick(v, n, pbr.f0, pbr.roughness);
+#else
+    vec3  f = MicrofacetF(v, n, pbr.f0, uEta, uKappa);
+#endif
 
     // calculate normalization
     float ndotl = max(dot(n, l), 0);
@@ -297,20 +284,26 @@ vec3 Brdf(in PbrMaterial pbr, inout Microfacet micro) {
     vec3 Fs = specular(pbr, micro);
     vec3 Fd = diffuse(pbr, micro);
 
+    // compensate the energy lost by the single scattering lobe
+    if (uMultiscatter) {
+        float nDotV = max(dot(micro.n, micro.v), 0);
+        Fs *= MultiscatterCompensation(albedoTable, nDotV, pbr.roughness, pbr.f0);
+    }
+
     return PI * Kd * Fd + pbr.metallic * Fs;
 }
 
 // CalcD calculates the normal distribution for debugging.
 vec3 CalcD(in PbrMaterial pbr, in Microfacet micro) {
-    return vec3(NormalDistributionGGX(micro.n, micro.h, pbr.a));
+    return vec3(MicrofacetD(micro.n, micro.h, pbr.a));
 }
 // CalcG calculates the geometric distibution for debugging.
 vec3 CalcG(in PbrMaterial pbr, in Microfacet micro) {
-    return vec3(GeometrySmith(micro.l, micro.v, micro.n, pbr.k));
+    return vec3(MicrofacetG(micro.l, micro.v, micro.n, pbr.a, pbr.k));
 }
 // CalcF calculates the surface reflectance for debugging.
 vec3 CalcF(in PbrMaterial pbr, in Microfacet micro) {
-    return FresnelSchlick(micro.v, micro.n, pbr.f0);                             // replaced h with n
+    return MicrofacetF(micro.v, micro.n, pbr.f0, uEta, uKappa);                  // replaced h with n
 }
 
 //--------------------------------------------------------------------------//
@@ -385,6 +378,24 @@ vec3 CalculateBrdfTogether(PbrMaterial pbr, Microfacet micro) {
     return Lo;
 }
 
+// CalculateSun returns the radiance reflected from the sun that was extracted
+// from the environment map, using the same weighting of the diffuse and
+// specular part as Brdf.
+vec3 CalculateSun(PbrMaterial pbr, Microfacet micro) {
+    micro.l = uSunDir;
+    micro.h = normalize(micro.v + micro.l);
+
+    float nDotL = CosTheta(micro);
+    if (nDotL <= 0) {
+        return vec3(0);
+    }
+
+    vec3 Ks = FresnelSchlick(micro.v, micro.n, pbr.f0, pbr.roughness);
+    vec3 Kd = (vec3(1) - Ks) * (1-pbr.metallic);
+    vec3 f  = Kd * diffuse(pbr, micro) + pbr.metallic * specular(pbr, micro);
+    return f * uSunIrradiance * nDotL * pbr.ao;
+}
+
 void main(){
     // renormalize normal after rasterization
     vec3 n = normalize(i.normal);                                                // added to fix grid artifacts
@@ -395,6 +406,9 @@ void main(){
 
     //vec3 Lo = CalculateThemSeparately(pbr, micro);
     vec3 Lo = CalculateBrdfTogether(pbr, micro);
+    if (uSunEnabled) {
+        Lo += CalculateSun(pbr, micro);
+    }
 
     // normalize and map color to LDR then apply gamma function
     vec3 colorLDR = ReinhardTonemapping(Lo);
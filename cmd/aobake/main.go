@@ -0,0 +1,97 @@
+// aobake is a utility program that bakes an ambient occlusion map and a bent
+// normal map for a mesh with texture coordinates. The texels are rasterized in
+// uv space and rays are cast from each texel into the hemisphere around the
+// surface normal. Both maps are dilated to prevent seams and written as png
+// images, the ambient occlusion as ao.png like the material textures expect.
+// Meshes with overlapping or missing texture coordinates can be unwrapped
+// automatically before baking.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/adrianderstroff/pbr/pkg/bake"
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/io/obj"
+	"github.com/adrianderstroff/pbr/pkg/unwrap"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+)
+
+const (
+	MESH_PATH = "./assets/objects/gun.obj"
+	OUT_PATH  = "./"
+
+	RESOLUTION int = 1024
+)
+
+func main() {
+	defaults := bake.MakeDefaultAOOptions()
+
+	mesh := flag.String("obj", MESH_PATH, "obj file of the mesh")
+	out := flag.String("out", OUT_PATH, "directory of the baked ao.png and bent.png")
+	width := flag.Int("width", RESOLUTION, "width of the textures")
+	height := flag.Int("height", RESOLUTION, "height of the textures")
+	samples := flag.Int("samples", defaults.Samples, "number of rays per texel")
+	length := flag.Float64("length", float64(defaults.RayLength), "distance up to which hits occlude a texel, 0 is unlimited")
+	bias := flag.Float64("bias", float64(defaults.Bias), "offset of the rays along the surface normal")
+	padding := flag.Int("padding", defaults.Padding, "number of texels the baked texels are dilated by")
+	smooth := flag.Bool("smooth", false, "generate smooth normals if the mesh has none")
+	unwrapped := flag.Bool("unwrap", false, "bake into automatically unwrapped texture coordinates instead of the ones of the mesh")
+	flag.Parse()
+
+	// load the mesh
+	geometry, err := obj.LoadGeometry(*mesh, false, *smooth)
+	if err != nil {
+		panic(err)
+	}
+	uv := "uv"
+	if *unwrapped {
+		options := unwrap.MakeDefaultOptions()
+		options.Resolution = cgm.Maxi(*width, *height)
+		stats, err := unwrap.Unwrap(&geometry, options)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(stats)
+		uv = unwrap.ATTRIBUTE
+	}
+	surface, err := bake.MakeSurfaceWithUV(&geometry, uv)
+	if err != nil {
+		panic(err)
+	}
+	start := time.Now()
+	hierarchy := surface.BVH()
+	fmt.Printf("built bvh with %v nodes in %v\n", len(hierarchy.Nodes), time.Since(start))
+
+	options := bake.AOOptions{
+		Samples:   *samples,
+		RayLength: float32(*length),
+		Bias:      float32(*bias),
+		Padding:   *padding,
+	}
+	start = time.Now()
+	ao, bent, err := bake.BakeAO(&surface, &hierarchy, *width, *height, options)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("baked %vx%v texels in %v\n", *width, *height, time.Since(start))
+
+	if err := saveLDR(&ao, filepath.Join(*out, "ao.png")); err != nil {
+		panic(err)
+	}
+	if err := saveLDR(&bent, filepath.Join(*out, "bent.png")); err != nil {
+		panic(err)
+	}
+}
+
+// saveLDR writes the float image as 8 bit png.
+func saveLDR(img *image2d.Image2D, path string) error {
+	ldr, err := bake.ToLDR(img)
+	if err != nil {
+		return err
+	}
+	return ldr.SaveToPath(path)
+}
@@ -19,6 +19,8 @@ const (
 
 	WIDTH  int = 800
 	HEIGHT int = 600
+
+	SEED uint64 = 42
 )
 
 func main() {
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"math"
+
 	"github.com/adrianderstroff/pbr/pkg/core/gl"
 	"github.com/adrianderstroff/pbr/pkg/core/shader"
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/adrianderstroff/pbr/pkg/sampling"
 	"github.com/adrianderstroff/pbr/pkg/scene/camera"
 	"github.com/adrianderstroff/pbr/pkg/view/mesh/cylinder"
 	"github.com/adrianderstroff/pbr/pkg/view/mesh/sphere"
@@ -27,19 +31,19 @@ func MakeRenderPass(shaderpath string, raycount int) RenderPass {
 	flatshader.AddRenderable(sphere)
 
 	// make cube aabb
-	aabb := AABB{mgl32.Vec3{-25, -25, -25}, mgl32.Vec3{25, 25, 25}}
+	aabb := geom.AABB{Min: mgl32.Vec3{-25, -25, -25}, Max: mgl32.Vec3{25, 25, 25}}
 
 	// create random numbers
-	noise := MakeNoise()
-	rand1 := noise.MakeNoiseSlice(100)
-	rand2 := noise.MakeNoiseSlice(100)
+	rng := sampling.MakeDefaultPCG(SEED)
+	rand1 := rng.Float32Slice(100)
+	rand2 := rng.Float32Slice(100)
 
 	// intersect sphere
 	pos := mgl32.Vec3{0, 0, 2}
 	dir := pos.Mul(-1).Normalize()
-	ray := Ray{pos, dir}
-	rsphere := Sphere{mgl32.Vec3{0, 0, 0}, 1}
-	hitinfo, didhit := intersectSphere(&ray, &rsphere, 0, 1000)
+	ray := geom.Ray{Origin: pos, Direction: dir}
+	rsphere := geom.Sphere{Center: mgl32.Vec3{0, 0, 0}, Radius: 1}
+	hitinfo, didhit := rsphere.Intersect(&ray, 0, 1000)
 
 	// send cosine distributed rays and intersect them with the cube map
 	if didhit {
@@ -51,17 +55,21 @@ func MakeRenderPass(shaderpath string, raycount int) RenderPass {
 			//fmt.Println(fmt.Sprintf("%f, %f", r1, r2))
 
 			// reflect ray
-			refl := cosineDistribution(&hitinfo, r1, r2, 1)
-			reflray := Ray{hitinfo.p, refl}
+			refl := hitinfo.ToWorld(sampling.CosineHemisphere(mgl32.Vec2{r1, r2}))
+			reflray := geom.Ray{Origin: hitinfo.P, Direction: refl}
 
-			end := hitinfo.p.Add(refl.Mul(1))
+			end := hitinfo.P.Add(refl.Mul(1))
 
 			// calculate intersection with bounding box
-			pbox := intersectAABB(&reflray, &aabb)
+			boxhit, ok := aabb.Intersect(&reflray, 0, float32(math.Inf(1)))
+			if !ok {
+				continue
+			}
+			pbox := boxhit.P
 
-			cylinder1 := cylinder.Make(pos, hitinfo.p, 0.12, gl.TRIANGLES)
-			cylinder2 := cylinder.Make(hitinfo.p, end, 0.10, gl.TRIANGLES)
-			cylinder3 := cylinder.Make(hitinfo.p, pbox, 0.05, gl.TRIANGLES)
+			cylinder1 := cylinder.Make(pos, hitinfo.P, 0.12, gl.TRIANGLES)
+			cylinder2 := cylinder.Make(hitinfo.P, end, 0.10, gl.TRIANGLES)
+			cylinder3 := cylinder.Make(hitinfo.P, pbox, 0.05, gl.TRIANGLES)
 			flatshader.AddRenderable(cylinder1)
 			flatshader.AddRenderable(cylinder2)
 			flatshader.AddRenderable(cylinder3)
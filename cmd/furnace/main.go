@@ -0,0 +1,212 @@
+// furnace is a utility program that checks the energy conservation of the
+// combined diffuse and specular BRDF. The model flag selects the BRDF, either
+// Brdf of ibl/pbr.glsl, which is PI * Kd * Fd + metallic * Fs with a =
+// roughness^2 and k = a^2/2, or Brdf of test/direct.frag. It sweeps the
+// roughness, the metalness and the view angle, integrates the BRDF over the
+// hemisphere under a uniform white environment and writes the resulting
+// directional albedo as a CSV file and a heatmap image. The heatmap contains
+// one tile per metalness with the view angle increasing to the right and the
+// roughness increasing downwards. Combinations that reflect more energy than they receive or less
+// than the specified threshold are reported and the program exits with a
+// non-zero status if there are any.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/adrianderstroff/pbr/pkg/brdf"
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	ROUGHNESS_STEPS int     = 16
+	METALLIC_STEPS  int     = 5
+	ANGLE_STEPS     int     = 32
+	SAMPLES         int     = 2048
+	MIN_ROUGHNESS   float32 = 0.05
+	MAX_ANGLE       float32 = 89
+	MIN_ALBEDO      float32 = 0.5
+	MAX_ALBEDO      float32 = 1.0
+	TOLERANCE       float32 = 0.005 // allows for the noise of the integration
+	CELL_SIZE       int     = 8
+	TILE_GAP        int     = 4
+)
+
+// Result is the directional albedo of a single parameter combination.
+type Result struct {
+	Roughness float32
+	Metallic  float32
+	Angle     float32 // view angle in degrees
+	Albedo    float32
+}
+
+func main() {
+	out := flag.String("out", ".", "directory of furnace.csv and furnace.png")
+	albedo := flag.Float64("albedo", 1.0, "gray albedo of the material")
+	samples := flag.Int("samples", SAMPLES, "number of samples per integration")
+	roughnesssteps := flag.Int("roughness", ROUGHNESS_STEPS, "number of roughness values")
+	metallicsteps := flag.Int("metallic", METALLIC_STEPS, "number of metalness values")
+	anglesteps := flag.Int("angles", ANGLE_STEPS, "number of view angles")
+	min := flag.Float64("min", float64(MIN_ALBEDO), "report directional albedos below this threshold")
+	max := flag.Float64("max", float64(MAX_ALBEDO), "report directional albedos above this threshold")
+	tolerance := flag.Float64("tolerance", float64(TOLERANCE), "tolerance of both thresholds for the integration noise")
+	model := flag.String("model", "ibl", "brdf to integrate, ibl for ibl/pbr.glsl or direct for test/direct.frag")
+	flag.Parse()
+
+	integrate := brdf.IBLMaterialAlbedo
+	switch *model {
+	case "ibl":
+	case "direct":
+		integrate = brdf.MaterialAlbedo
+	default:
+		panic(fmt.Sprintf("unsupported model %v", *model))
+	}
+	fmt.Printf("integrating the %v brdf\n", *model)
+
+	// sweep all parameter combinations
+	roughnesses := linspace(MIN_ROUGHNESS, 1, *roughnesssteps)
+	metallics := linspace(0, 1, *metallicsteps)
+	angles := linspace(0, MAX_ANGLE, *anglesteps)
+	results := sweep(integrate, float32(*albedo), roughnesses, metallics, angles, *samples)
+
+	// report the violations
+	lo := float32(*min - *tolerance)
+	hi := float32(*max + *tolerance)
+	flagged := 0
+	for _, r := range results {
+		if r.Albedo > hi || r.Albedo < lo {
+			fmt.Printf("roughness %.3f metallic %.3f angle %5.2f: albedo %.4f\n",
+				r.Roughness, r.Metallic, r.Angle, r.Albedo)
+			flagged++
+		}
+	}
+	fmt.Printf("%v of %v combinations outside of [%v, %v]\n", flagged, len(results), *min, *max)
+
+	if err := saveCSV(filepath.Join(*out, "furnace.csv"), results); err != nil {
+		panic(err)
+	}
+	heatmap := makeHeatmap(results, len(roughnesses), len(metallics), len(angles), lo, hi)
+	if err := heatmap.SaveToPath(filepath.Join(*out, "furnace.png")); err != nil {
+		panic(err)
+	}
+
+	if flagged > 0 {
+		os.Exit(1)
+	}
+}
+
+// sweep integrates the brdf for all parameter combinations in parallel. The
+// results are ordered by metalness, roughness and view angle.
+func sweep(integrate func(mat *brdf.Material, nDotV float32, samples int) mgl32.Vec3,
+	albedo float32, roughnesses, metallics, angles []float32, samples int) []Result {
+	results := make([]Result, 0, len(roughnesses)*len(metallics)*len(angles))
+	for _, m := range metallics {
+		for _, r := range roughnesses {
+			for _, a := range angles {
+				results = append(results, Result{Roughness: r, Metallic: m, Angle: a})
+			}
+		}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r := &results[i]
+				mat := brdf.MakeMaterial(mgl32.Vec3{albedo, albedo, albedo}, r.Metallic, r.Roughness)
+				nDotV := cgm.Cos32(mgl32.DegToRad(r.Angle))
+				r.Albedo = integrate(&mat, nDotV, samples).X()
+			}
+		}()
+	}
+	for i := range results {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// saveCSV writes the results as comma separated values.
+func saveCSV(path string, results []Result) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fmt.Fprintln(file, "roughness,metallic,angle,ndotv,albedo")
+	for _, r := range results {
+		nDotV := cgm.Cos32(mgl32.DegToRad(r.Angle))
+		_, err := fmt.Fprintf(file, "%v,%v,%v,%v,%v\n", r.Roughness, r.Metallic, r.Angle, nDotV, r.Albedo)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeHeatmap creates an image with one tile per metalness. Albedos within
+// [min,max] are shown in gray, albedos above max in red and albedos below min
+// in blue.
+func makeHeatmap(results []Result, roughnesses, metallics, angles int, min, max float32) image2d.Image2D {
+	tilewidth := angles * CELL_SIZE
+	tileheight := roughnesses * CELL_SIZE
+	width := metallics*tilewidth + (metallics-1)*TILE_GAP
+	heatmap, err := image2d.Make(width, tileheight, 3)
+	if err != nil {
+		panic(err)
+	}
+
+	for i, r := range results {
+		m := i / (roughnesses * angles)
+		row := (i / angles) % roughnesses
+		col := i % angles
+
+		color := heat(r.Albedo, min, max)
+		for y := 0; y < CELL_SIZE; y++ {
+			for x := 0; x < CELL_SIZE; x++ {
+				px := m*(tilewidth+TILE_GAP) + col*CELL_SIZE + x
+				py := row*CELL_SIZE + y
+				heatmap.SetRGB(px, py, color[0], color[1], color[2])
+			}
+		}
+	}
+
+	return heatmap
+}
+
+// heat maps the albedo onto a color.
+func heat(albedo, min, max float32) [3]uint8 {
+	gray := uint8(cgm.Clamp(albedo, 0, 1) * 255)
+	switch {
+	case albedo > max:
+		return [3]uint8{255, 0, 0}
+	case albedo < min:
+		return [3]uint8{0, 0, gray/2 + 127}
+	}
+	return [3]uint8{gray, gray, gray}
+}
+
+// linspace returns n evenly spaced values between start and end.
+func linspace(start, end float32, n int) []float32 {
+	if n <= 1 {
+		return []float32{start}
+	}
+	values := make([]float32, n)
+	for i := range values {
+		values[i] = cgm.Lerp(start, end, float32(i)/float32(n-1))
+	}
+	return values
+}
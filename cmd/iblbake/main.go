@@ -0,0 +1,196 @@
+// iblbake is a utility program that turns an equirectangular hdr image into
+// all assets needed for image based lighting. It runs entirely on the CPU and
+// creates the cube map faces, the spherical harmonics and irradiance cube map,
+// the prefiltered specular mip chain and the BRDF lookup table together with a
+// manifest describing the outputs. The BRDF lookup table is written as a
+// portable float map to keep the full float precision.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adrianderstroff/pbr/pkg/envmap"
+	"github.com/adrianderstroff/pbr/pkg/ibl"
+	"github.com/adrianderstroff/pbr/pkg/sh"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+)
+
+const (
+	IN_PATH  = "./assets/images/textures/hdr/the_sky_is_on_fire_16k.hdr"
+	OUT_PATH = "./assets/images/ibl/sky/"
+
+	CUBEMAP_RES    int = 1024
+	IRRADIANCE_RES int = 32
+	SPECULAR_RES   int = 256
+	SPECULAR_MIPS  int = 6
+	SAMPLES        int = 1024
+	LUT_RES        int = 512
+	LUT_SAMPLES    int = 1024
+
+	EXTENSION     = ".hdr"
+	LUT_EXTENSION = ".pfm"
+)
+
+// Manifest describes all files written by iblbake. All paths are relative to
+// the directory of the manifest. The spherical harmonics are the coefficients
+// of the irradiance, that is the radiance convolved with the cosine lobe, such
+// that they can be passed to SHIrradiance of shared/sh.glsl directly.
+type Manifest struct {
+	Source     string        `json:"source"`
+	Cubemap    CubemapAsset  `json:"cubemap"`
+	SH         string        `json:"sh"`
+	SHOrder    int           `json:"shOrder"`
+	Irradiance CubemapAsset  `json:"irradiance"`
+	Specular   SpecularAsset `json:"specular"`
+	BrdfLut    LutAsset      `json:"brdfLut"`
+}
+
+// CubemapAsset lists the six faces of a cube map in the order right, left,
+// top, bottom, front and back.
+type CubemapAsset struct {
+	Resolution int      `json:"resolution"`
+	Faces      []string `json:"faces"`
+}
+
+// SpecularAsset describes the prefiltered specular mip chain. Levels[i] lists
+// the faces of mip level i which has been prefiltered with Roughness[i].
+type SpecularAsset struct {
+	Resolution int        `json:"resolution"`
+	Samples    int        `json:"samples"`
+	Roughness  []float32  `json:"roughness"`
+	Levels     [][]string `json:"levels"`
+}
+
+// LutAsset describes the BRDF lookup table.
+type LutAsset struct {
+	Resolution int    `json:"resolution"`
+	Samples    int    `json:"samples"`
+	Path       string `json:"path"`
+}
+
+func main() {
+	in := flag.String("in", IN_PATH, "equirectangular hdr image")
+	out := flag.String("out", OUT_PATH, "output directory")
+	res := flag.Int("res", CUBEMAP_RES, "resolution of the cube map faces")
+	irrres := flag.Int("irrres", IRRADIANCE_RES, "resolution of the irradiance cube map faces")
+	specres := flag.Int("specres", SPECULAR_RES, "resolution of the base level of the prefiltered specular cube map")
+	mips := flag.Int("mips", SPECULAR_MIPS, "number of mip levels of the prefiltered specular cube map")
+	samples := flag.Int("samples", SAMPLES, "number of samples per texel of the prefiltered specular cube map")
+	lutres := flag.Int("lutres", LUT_RES, "resolution of the BRDF lookup table")
+	lutsamples := flag.Int("lutsamples", LUT_SAMPLES, "number of samples per texel of the BRDF lookup table")
+	flag.Parse()
+
+	if err := bake(*in, *out, *res, *irrres, *specres, *mips, *samples, *lutres, *lutsamples); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// bake creates all assets and writes them together with the manifest into the
+// output directory.
+func bake(in, out string, res, irrres, specres, mips, samples, lutres, lutsamples int) error {
+	dir := filepath.Clean(out) + "/"
+	for _, sub := range []string{"cubemap/", "irradiance/", "specular/"} {
+		if err := os.MkdirAll(dir+sub, 0755); err != nil {
+			return err
+		}
+	}
+	manifest := Manifest{Source: in, SHOrder: sh.ORDER_3}
+
+	// turn the equirectangular image into a cube map
+	start := time.Now()
+	equirect, err := image2d.MakeFromPath(in)
+	if err != nil {
+		return err
+	}
+	cubemap, err := envmap.MakeCubemapFromEquirect(&equirect, res)
+	if err != nil {
+		return err
+	}
+	if err := cubemap.SaveToDir(dir+"cubemap/", EXTENSION); err != nil {
+		return err
+	}
+	manifest.Cubemap = makeCubemapAsset("cubemap/", res)
+	logStep("cube map", start)
+
+	// diffuse irradiance as spherical harmonics and as cube map
+	start = time.Now()
+	coeffs, err := sh.ProjectCubemap(&cubemap, sh.ORDER_3)
+	if err != nil {
+		return err
+	}
+	// shared/sh.glsl expects coefficients that are convolved already
+	convolved := coeffs.Convolve()
+	if err := convolved.SaveToPath(dir + "sh.json"); err != nil {
+		return err
+	}
+	irradiance, err := sh.MakeIrradianceCubemap(&coeffs, irrres)
+	if err != nil {
+		return err
+	}
+	if err := irradiance.SaveToDir(dir+"irradiance/", EXTENSION); err != nil {
+		return err
+	}
+	manifest.SH = "sh.json"
+	manifest.Irradiance = makeCubemapAsset("irradiance/", irrres)
+	logStep("irradiance", start)
+
+	// prefiltered specular environment
+	start = time.Now()
+	levels, err := ibl.MakePrefilteredMipChain(&cubemap, specres, mips, samples)
+	if err != nil {
+		return err
+	}
+	if err := ibl.SavePrefilteredMipChain(levels, dir+"specular/", EXTENSION); err != nil {
+		return err
+	}
+	manifest.Specular = SpecularAsset{Resolution: specres, Samples: samples}
+	for level := 0; level < mips; level++ {
+		faces := make([]string, 6)
+		for f := range faces {
+			faces[f] = ibl.PrefilteredFacePath("specular/", f, level, EXTENSION)
+		}
+		manifest.Specular.Levels = append(manifest.Specular.Levels, faces)
+		manifest.Specular.Roughness = append(manifest.Specular.Roughness, ibl.LevelRoughness(level, mips))
+	}
+	logStep("specular", start)
+
+	// environment brdf lookup table
+	start = time.Now()
+	lut, err := ibl.MakeBrdfLut(lutres, lutsamples)
+	if err != nil {
+		return err
+	}
+	if err := lut.SaveToPath(dir + "brdflut" + LUT_EXTENSION); err != nil {
+		return err
+	}
+	manifest.BrdfLut = LutAsset{Resolution: lutres, Samples: lutsamples, Path: "brdflut" + LUT_EXTENSION}
+	logStep("brdf lut", start)
+
+	// write the manifest
+	data, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dir+"manifest.json", data, 0644)
+}
+
+// makeCubemapAsset lists the faces of a cube map saved with SaveToDir.
+func makeCubemapAsset(dir string, res int) CubemapAsset {
+	faces := make([]string, 6)
+	for i, name := range envmap.FaceNames {
+		faces[i] = dir + name + EXTENSION
+	}
+	return CubemapAsset{Resolution: res, Faces: faces}
+}
+
+// logStep prints the duration of a baking step.
+func logStep(name string, start time.Time) {
+	fmt.Printf("baked %-10v in %v\n", name, time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,71 @@
+// imgstats is a utility program that prints the statistics of an image, like
+// the range of the luminance, percentiles and a suggested exposure.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+)
+
+const (
+	HISTOGRAM_BINS  int = 16
+	HISTOGRAM_WIDTH int = 50
+)
+
+func main() {
+	bins := flag.Int("bins", HISTOGRAM_BINS, "number of bins of the luminance histogram")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: imgstats [-bins n] image...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	for _, path := range flag.Args() {
+		img, err := image2d.MakeFromPath(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, path+": "+err.Error())
+			continue
+		}
+
+		fmt.Println(path + " " + img.String())
+		fmt.Println(img.Statistics())
+
+		// print the luminance distribution in log space as it spans several
+		// orders of magnitude for hdr images
+		hist, err := img.Histogram(image2d.CHANNEL_LUMINANCE, *bins, true)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		printHistogram(&hist)
+		fmt.Println()
+	}
+}
+
+// printHistogram prints the histogram as horizontal bars.
+func printHistogram(hist *image2d.Histogram) {
+	maxcount := 0
+	for _, count := range hist.Bins {
+		if count > maxcount {
+			maxcount = count
+		}
+	}
+	if maxcount == 0 {
+		return
+	}
+
+	fmt.Println("log luminance histogram")
+	for i, count := range hist.Bins {
+		lo, hi := hist.BinRange(i)
+		bar := strings.Repeat("#", count*HISTOGRAM_WIDTH/maxcount)
+		fmt.Printf("[%10.4g, %10.4g) %8v %v\n", lo, hi, count, bar)
+	}
+}
@@ -0,0 +1,215 @@
+// merlfit is a utility program that fits the parameters of the Cook-Torrance
+// BRDF of pkg/brdf to measured BRDFs of the MERL database. For each material
+// it prints the fitted albedo, metalness, roughness and F0 along with the fit
+// error and saves a comparison plot. The upper row of the plot shows a sphere
+// lit by a directional light and the lower row the brdf over the half angle
+// (vertical) and the difference angle (horizontal) for a difference azimuth of
+// 90 degrees. Each row shows the measured brdf, the fitted brdf and their
+// difference.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrianderstroff/pbr/pkg/brdf"
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/io/merl"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	ITERATIONS     int     = 300
+	THETA_D_STRIDE int     = 3
+	PHI_D_STRIDE   int     = 6
+	PLOT_SIZE      int     = 128
+	EXPOSURE       float32 = 1.0
+)
+
+// direction of the light of the sphere plot
+var lightdir = mgl32.Vec3{-1, 1, 1}.Normalize()
+
+func main() {
+	out := flag.String("out", ".", "directory of the comparison plots")
+	iterations := flag.Int("iterations", ITERATIONS, "iterations of each optimization run")
+	thetadstride := flag.Int("thetadstride", THETA_D_STRIDE, "use every n-th difference angle for the fit")
+	phidstride := flag.Int("phidstride", PHI_D_STRIDE, "use every n-th difference azimuth for the fit")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: merlfit [-out dir] [-iterations n] file.binary...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	fmt.Printf("%-24v %-22v %8v %9v %6v %10v\n", "material", "albedo", "metallic",
+		"roughness", "f0", "rms error")
+	for _, path := range flag.Args() {
+		measured, err := merl.Load(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+
+		samples := collectSamples(&measured, *thetadstride, *phidstride)
+		params, fiterr := brdf.Fit(samples, *iterations)
+
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		a := params.Albedo
+		fmt.Printf("%-24v (%5.3f, %5.3f, %5.3f) %8.3f %9.3f %6.3f %10.5f\n", name,
+			a.X(), a.Y(), a.Z(), params.Metallic, params.Roughness, params.F0, fiterr)
+
+		plot := makePlot(&measured, &params)
+		plotpath := filepath.Join(*out, name+".png")
+		if err := plot.SaveToPath(plotpath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
+
+// collectSamples gathers the valid cells of the measured brdf. All half
+// angles are used as they resolve the specular peak, while the difference
+// angles are subsampled with the specified strides.
+func collectSamples(measured *merl.BRDF, thetadstride, phidstride int) []brdf.FitSample {
+	samples := []brdf.FitSample{}
+	for th := 0; th < merl.THETA_H_RES; th++ {
+		for td := 0; td < merl.THETA_D_RES; td += thetadstride {
+			for pd := 0; pd < merl.PHI_D_RES; pd += phidstride {
+				value, valid := measured.Cell(th, td, pd)
+				if !valid {
+					continue
+				}
+
+				thetaH, thetaD, phiD := merl.CellAngles(th, td, pd)
+				l, v := merl.StdCoords(thetaH, 0, thetaD, phiD)
+				if l.Z() <= 0 || v.Z() <= 0 {
+					continue
+				}
+				samples = append(samples, brdf.FitSample{L: l, V: v, Value: value})
+			}
+		}
+	}
+	return samples
+}
+
+// makePlot creates the comparison plot of the measured and the fitted brdf.
+func makePlot(measured *merl.BRDF, params *brdf.FitParameters) image2d.Image2D {
+	plot, err := image2d.Make(3*PLOT_SIZE, 2*PLOT_SIZE, 3)
+	if err != nil {
+		panic(err)
+	}
+
+	for y := 0; y < PLOT_SIZE; y++ {
+		for x := 0; x < PLOT_SIZE; x++ {
+			// sphere lit by the directional light
+			m, f, ok := sphereRadiance(measured, params, x, y)
+			if ok {
+				setPixel(&plot, x, y, tonemap(m))
+				setPixel(&plot, x+PLOT_SIZE, y, tonemap(f))
+				setPixel(&plot, x+2*PLOT_SIZE, y, heat(relativeError(m, f)))
+			}
+
+			// half and difference angle slice with the specular peak at the top
+			thetaH := (float32(y) + 0.5) / float32(PLOT_SIZE) * (math.Pi / 2)
+			thetaD := (float32(x) + 0.5) / float32(PLOT_SIZE) * (math.Pi / 2)
+			l, v := merl.StdCoords(thetaH, 0, thetaD, math.Pi/2)
+			if l.Z() <= 0 || v.Z() <= 0 {
+				continue
+			}
+			m, valid := measured.Lookup(thetaH, thetaD, math.Pi/2)
+			if !valid {
+				continue
+			}
+			f = params.Evaluate(l, v)
+			setPixel(&plot, x, y+PLOT_SIZE, logscale(m))
+			setPixel(&plot, x+PLOT_SIZE, y+PLOT_SIZE, logscale(f))
+			setPixel(&plot, x+2*PLOT_SIZE, y+PLOT_SIZE, heat(relativeError(m, f)))
+		}
+	}
+
+	return plot
+}
+
+// sphereRadiance returns the measured and fitted radiance of the pixel of an
+// orthographically viewed unit sphere. It returns false outside the sphere.
+func sphereRadiance(measured *merl.BRDF, params *brdf.FitParameters, x, y int) (mgl32.Vec3, mgl32.Vec3, bool) {
+	sx := 2*(float32(x)+0.5)/float32(PLOT_SIZE) - 1
+	sy := 1 - 2*(float32(y)+0.5)/float32(PLOT_SIZE)
+	r2 := sx*sx + sy*sy
+	if r2 >= 1 {
+		return mgl32.Vec3{}, mgl32.Vec3{}, false
+	}
+	n := mgl32.Vec3{sx, sy, cgm.Sqrt32(1 - r2)}
+	v := mgl32.Vec3{0, 0, 1}
+
+	// transform into the local frame of the surface. the brdfs are isotropic
+	// thus the orientation of the tangent doesn't matter.
+	up := mgl32.Vec3{1, 0, 0}
+	if cgm.Abs32(n.Y()) < 0.999 {
+		up = mgl32.Vec3{0, 1, 0}
+	}
+	t := up.Cross(n).Normalize()
+	b := n.Cross(t)
+	toLocal := func(d mgl32.Vec3) mgl32.Vec3 {
+		return mgl32.Vec3{d.Dot(t), d.Dot(b), d.Dot(n)}
+	}
+	ll := toLocal(lightdir)
+	lv := toLocal(v)
+	if ll.Z() <= 0 {
+		return mgl32.Vec3{}, mgl32.Vec3{}, true
+	}
+
+	m, valid := measured.Evaluate(ll, lv)
+	if !valid {
+		m = mgl32.Vec3{}
+	}
+	f := params.Evaluate(ll, lv)
+	return m.Mul(ll.Z() * EXPOSURE), f.Mul(ll.Z() * EXPOSURE), true
+}
+
+// relativeError returns the difference of the luminance relative to the
+// measured luminance.
+func relativeError(measured, fitted mgl32.Vec3) float32 {
+	lm := luminance(measured)
+	lf := luminance(fitted)
+	return cgm.Abs32(lf-lm) / cgm.Max32(lm, 1e-3)
+}
+
+func luminance(c mgl32.Vec3) float32 {
+	return 0.2126*c.X() + 0.7152*c.Y() + 0.0722*c.Z()
+}
+
+// tonemap applies the reinhard operator and the srgb gamma.
+func tonemap(c mgl32.Vec3) mgl32.Vec3 {
+	for i := 0; i < 3; i++ {
+		v := c[i] / (1 + c[i])
+		c[i] = float32(math.Pow(float64(v), 1/2.2))
+	}
+	return c
+}
+
+// logscale maps brdf values between 0.01 and 1000 logarithmically onto [0,1].
+func logscale(c mgl32.Vec3) mgl32.Vec3 {
+	for i := 0; i < 3; i++ {
+		v := math.Log10(math.Max(float64(c[i]), 1e-2))
+		c[i] = cgm.Clamp(float32((v+2)/5), 0, 1)
+	}
+	return c
+}
+
+// heat maps a relative error in [0,1] from black over red to yellow.
+func heat(e float32) mgl32.Vec3 {
+	e = cgm.Clamp(e, 0, 1)
+	return mgl32.Vec3{cgm.Clamp(2*e, 0, 1), cgm.Clamp(2*e-1, 0, 1), 0}
+}
+
+func setPixel(img *image2d.Image2D, x, y int, c mgl32.Vec3) {
+	img.SetRGB(x, y, uint8(c.X()*255), uint8(c.Y()*255), uint8(c.Z()*255))
+}
@@ -0,0 +1,149 @@
+// normalbake is a utility program that bakes the details of a high poly mesh
+// into textures of a low poly mesh with texture coordinates. Rays are cast
+// from a cage around the low poly surface onto the high poly surface. It
+// writes a tangent space normal map that matches NormalMapping of normal.glsl
+// and optionally a height and a curvature map. The maps are written either
+// as 8 bit png images, as float hdr images or as portable float maps. OpenEXR
+// isn't supported since the image2d package can neither read nor write it,
+// thus hdr and pfm take its place for float maps. Since the radiance format
+// can't store negative values, the signed height and curvature maps should be
+// written as pfm, which keeps the raw values. Both meshes are loaded without
+// centering and scaling, thus they have to be aligned in their obj files.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/adrianderstroff/pbr/pkg/bake"
+	"github.com/adrianderstroff/pbr/pkg/io/obj"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+)
+
+const (
+	OUT_PATH = "./"
+
+	RESOLUTION int     = 1024
+	CAGE       float32 = 0.01
+	PADDING    int     = 8
+	CURVATURE  float32 = 0.05
+)
+
+func main() {
+	low := flag.String("low", "", "obj file of the low poly mesh with texture coordinates")
+	high := flag.String("high", "", "obj file of the high poly mesh")
+	out := flag.String("out", OUT_PATH, "directory of the baked maps")
+	format := flag.String("format", "png", "image format of the maps, png, hdr or pfm")
+	width := flag.Int("width", RESOLUTION, "width of the maps")
+	height := flag.Int("height", RESOLUTION, "height of the maps")
+	cage := flag.Float64("cage", float64(CAGE), "offset of the cage relative to the diagonal of the low poly mesh")
+	padding := flag.Int("padding", PADDING, "number of texels the baked texels are dilated by")
+	heightmap := flag.Bool("heightmap", false, "write the height map")
+	curvature := flag.Bool("curvature", false, "write the curvature map")
+	curvscale := flag.Float64("curvscale", float64(CURVATURE), "curvature that maps to black and white in png images relative to the inverse diagonal")
+	smooth := flag.Bool("smooth", false, "generate smooth normals for meshes without normals")
+	flag.Parse()
+	if *low == "" || *high == "" {
+		flag.Usage()
+		return
+	}
+	if *format != "png" && *format != "hdr" && *format != "pfm" {
+		panic(fmt.Sprintf("unsupported format %v", *format))
+	}
+
+	// load both meshes
+	lowGeometry, err := obj.LoadRawGeometry(*low, false, *smooth)
+	if err != nil {
+		panic(err)
+	}
+	lowSurface, err := bake.MakeSurface(&lowGeometry)
+	if err != nil {
+		panic(err)
+	}
+	highGeometry, err := obj.LoadRawGeometry(*high, false, *smooth)
+	if err != nil {
+		panic(err)
+	}
+	highSurface, err := bake.MakeSurface(&highGeometry)
+	if err != nil {
+		panic(err)
+	}
+	start := time.Now()
+	hierarchy := highSurface.BVH()
+	fmt.Printf("built bvh with %v nodes in %v\n", len(hierarchy.Nodes), time.Since(start))
+
+	// the cage is relative to the size of the low poly mesh
+	bounds := lowSurface.Bounds()
+	diagonal := bounds.Size().Len()
+	options := bake.NormalOptions{
+		Cage:    float32(*cage) * diagonal,
+		Padding: *padding,
+	}
+
+	start = time.Now()
+	maps, err := bake.BakeNormals(&lowSurface, &highSurface, &hierarchy, *width, *height, options)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("baked %vx%v texels in %v\n", *width, *height, time.Since(start))
+
+	if err := save(&maps.Normal, *out, "normal", *format, 0, 1); err != nil {
+		panic(err)
+	}
+	if *heightmap {
+		if err := save(&maps.Height, *out, "height", *format, 0.5, 0.5/options.Cage); err != nil {
+			panic(err)
+		}
+	}
+	if *curvature {
+		scale := 0.5 / (float32(*curvscale) / diagonal)
+		if err := save(&maps.Curvature, *out, "curvature", *format, 0.5, scale); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// save writes the map to the directory with the specified name and format.
+// pfm images keep the raw signed values, hdr images keep the raw values with
+// negative values being clipped and single channels being replicated to rgb,
+// png images store offset + scale * value clamped to [0,1].
+func save(img *image2d.Image2D, dir, name, format string, offset, scale float32) error {
+	path := filepath.Join(dir, name+"."+format)
+	channels := img.GetChannels()
+	if format == "pfm" {
+		return img.SaveToPath(path)
+	}
+	if format == "hdr" {
+		rgb, err := image2d.MakeFloat32(img.GetWidth(), img.GetHeight(), 3)
+		if err != nil {
+			return err
+		}
+		for y := 0; y < img.GetHeight(); y++ {
+			for x := 0; x < img.GetWidth(); x++ {
+				for c := 0; c < 3; c++ {
+					rgb.SetFloat32(x, y, c, img.GetFloat32(x, y, c%channels))
+				}
+			}
+		}
+		return rgb.SaveToPath(path)
+	}
+
+	scaled, err := image2d.MakeFloat32(img.GetWidth(), img.GetHeight(), channels)
+	if err != nil {
+		return err
+	}
+	for y := 0; y < img.GetHeight(); y++ {
+		for x := 0; x < img.GetWidth(); x++ {
+			for c := 0; c < channels; c++ {
+				scaled.SetFloat32(x, y, c, offset+scale*img.GetFloat32(x, y, c))
+			}
+		}
+	}
+	ldr, err := bake.ToLDR(&scaled)
+	if err != nil {
+		return err
+	}
+	return ldr.SaveToPath(path)
+}
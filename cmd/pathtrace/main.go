@@ -0,0 +1,125 @@
+// pathtrace is a utility program that renders a reference image of the scene
+// of cmd/pbr with a CPU path tracer. It uses the same mesh, material textures,
+// environment cube map and camera as the realtime renderer. The estimate is
+// refined progressively and written as an hdr image and as a tone mapped png
+// after every few samples, such that it can be diffed against screenshots of
+// the realtime renderer.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/adrianderstroff/pbr/pkg/envmap"
+	"github.com/adrianderstroff/pbr/pkg/io/obj"
+	"github.com/adrianderstroff/pbr/pkg/pathtracer"
+	"github.com/adrianderstroff/pbr/pkg/scene/camera/trackballpan"
+)
+
+const (
+	MESH_PATH    = "./assets/objects/gun.obj"
+	TEX_PATH     = "./assets/images/textures/material-gun/"
+	CUBEMAP_PATH = "./assets/images/cubemap/hdr/"
+	OUT_PATH     = "./pathtrace"
+
+	WIDTH     int     = 1200
+	HEIGHT    int     = 800
+	SAMPLES   int     = 256
+	SAVE      int     = 16
+	DEPTH     int     = 8
+	RADIUS    float32 = 2
+	ROUGHNESS float32 = 0.1
+)
+
+func main() {
+	mesh := flag.String("obj", MESH_PATH, "obj file of the mesh")
+	textures := flag.String("textures", TEX_PATH, "directory of the material textures")
+	cubemap := flag.String("cubemap", CUBEMAP_PATH, "directory of the cube map faces")
+	extension := flag.String("ext", ".hdr", "file extension of the cube map faces")
+	out := flag.String("out", OUT_PATH, "output path without extension, writes .hdr and .png")
+	width := flag.Int("width", WIDTH, "width of the image")
+	height := flag.Int("height", HEIGHT, "height of the image")
+	samples := flag.Int("samples", SAMPLES, "number of samples per pixel")
+	save := flag.Int("save", SAVE, "save the image every n samples")
+	depth := flag.Int("depth", DEPTH, "maximum number of bounces")
+	radius := flag.Float64("radius", float64(RADIUS), "distance of the camera to the origin")
+	theta := flag.Float64("theta", 0, "rotation of the camera around the x-axis in degrees")
+	phi := flag.Float64("phi", 0, "rotation of the camera around the y-axis in degrees")
+	roughness := flag.Float64("roughness", float64(ROUGHNESS), "lower bound of the roughness like the global roughness of cmd/pbr")
+	intensity := flag.Float64("intensity", 1, "scale of the environment radiance")
+	clamp := flag.Float64("clamp", 0, "clamp the radiance of each sample, 0 disables clamping")
+	ao := flag.Bool("ao", true, "scale the BSDF by the ambient occlusion texture")
+	seed := flag.Int64("seed", 0, "seed of the random number generators")
+	flag.Parse()
+	if *save < 1 {
+		*save = *samples
+	}
+
+	// load the scene
+	geometry, err := obj.LoadGeometry(*mesh, false, false)
+	if err != nil {
+		panic(err)
+	}
+	material, err := pathtracer.LoadMaterial(*textures)
+	if err != nil {
+		panic(err)
+	}
+	material.GlobalRoughness = float32(*roughness)
+	faces, err := envmap.MakeCubemapFromDir(*cubemap, *extension)
+	if err != nil {
+		panic(err)
+	}
+	environment := pathtracer.MakeCubemapEnvironment(&faces)
+	environment.Intensity = float32(*intensity)
+
+	start := time.Now()
+	scene, err := pathtracer.MakeScene(&geometry, material, &environment)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("built bvh with %v nodes in %v\n", len(scene.BVH.Nodes), time.Since(start))
+
+	// use the default camera of cmd/pbr
+	cam := trackballpan.MakeDefault(*width, *height, float32(*radius))
+	cam.Rotate(float32(*theta), float32(*phi))
+	cam.Update()
+	camera := pathtracer.MakeCamera(cam.GetView(), cam.GetPerspective())
+
+	// render progressively
+	options := pathtracer.MakeDefaultOptions(*width, *height)
+	options.MaxDepth = *depth
+	options.MaxRadiance = float32(*clamp)
+	options.AO = *ao
+	options.Seed = *seed
+	pt := pathtracer.Make(&scene, camera, options)
+
+	start = time.Now()
+	for s := 1; s <= *samples; s++ {
+		pt.RenderSample()
+		if s%*save == 0 || s == *samples {
+			if err := saveImages(&pt, *out); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Printf("%v/%v samples after %v\n", s, *samples, time.Since(start))
+		}
+	}
+}
+
+// saveImages writes the current estimate as hdr image and as tone mapped png.
+func saveImages(pt *pathtracer.PathTracer, out string) error {
+	hdr, err := pt.Image()
+	if err != nil {
+		return err
+	}
+	if err := hdr.SaveToPath(out + ".hdr"); err != nil {
+		return err
+	}
+	ldr, err := pathtracer.Tonemap(&hdr)
+	if err != nil {
+		return err
+	}
+	return ldr.SaveToPath(out + ".png")
+}
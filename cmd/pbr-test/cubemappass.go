@@ -3,7 +3,9 @@ package main
 import (
 	"github.com/adrianderstroff/pbr/pkg/core/gl"
 	"github.com/adrianderstroff/pbr/pkg/core/shader"
+	"github.com/adrianderstroff/pbr/pkg/envmap"
 	"github.com/adrianderstroff/pbr/pkg/scene/camera"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
 	"github.com/adrianderstroff/pbr/pkg/view/mesh/cube"
 	"github.com/adrianderstroff/pbr/pkg/view/texture"
 	"github.com/go-gl/mathgl/mgl32"
@@ -13,6 +15,12 @@ import (
 type CubemapPass struct {
 	cubemapshader shader.Shader
 	cubemap       texture.Texture
+	// the cubemap without the sun
+	residual texture.Texture
+	sun      envmap.Light
+	hassun   bool
+	// render the residual instead of the whole cubemap
+	usesun bool
 }
 
 // MakeCubemapPass creates the cubemap pass with the specified paths
@@ -39,25 +47,58 @@ func MakeCubemapPass(shaderpath, cubemappath string) CubemapPass {
 		panic(err)
 	}
 
+	// extract the sun and upload the residual environment
+	faces, err := envmap.MakeCubemapFromDir(cubemappath, ".hdr")
+	if err != nil {
+		panic(err)
+	}
+	lights := envmap.ExtractLights(&faces, 1, SUN_THRESHOLD, SUN_MAX_SOLID_ANGLE)
+	envmap.RemoveLights(&faces, lights)
+	residual, err := texture.MakeCubeMapFromMipmaps([][]image2d.Image2D{faces.GetFaces()}, gl.RGB32F)
+	if err != nil {
+		panic(err)
+	}
+
 	err = gl.GetError()
 	if err != nil {
 		panic(err)
 	}
 
-	return CubemapPass{
+	cmp := CubemapPass{
 		cubemapshader: cubemapshader,
 		cubemap:       cubemap,
+		residual:      residual,
+		hassun:        len(lights) > 0,
+	}
+	if cmp.hassun {
+		cmp.sun = lights[0]
+	}
+	return cmp
+}
+
+// SetState selects between the whole cubemap and the residual without the sun
+func (cmp *CubemapPass) SetState(state State) {
+	cmp.usesun = state.envsun && cmp.hassun
+}
+
+// GetEnvironment returns the cubemap that is lit together with the sun if it
+// is enabled, otherwise the whole cubemap.
+func (cmp *CubemapPass) GetEnvironment() *texture.Texture {
+	if cmp.usesun {
+		return &cmp.residual
 	}
+	return &cmp.cubemap
 }
 
 // Render executes the draw command
 func (cmp *CubemapPass) Render(camera camera.Camera) {
 	cmp.cubemapshader.Use()
-	cmp.cubemap.Bind(0)
+	environment := cmp.GetEnvironment()
+	environment.Bind(0)
 	cmp.cubemapshader.UpdateMat4("M", mgl32.Ident4())
 	cmp.cubemapshader.UpdateMat4("V", camera.GetView())
 	cmp.cubemapshader.UpdateMat4("P", camera.GetPerspective())
 	cmp.cubemapshader.Render()
-	cmp.cubemap.Unbind()
+	environment.Unbind()
 	cmp.cubemapshader.Release()
 }
@@ -3,10 +3,13 @@ package main
 import (
 	"errors"
 
+	"github.com/adrianderstroff/pbr/pkg/brdf"
 	"github.com/adrianderstroff/pbr/pkg/buffer/fbo"
 	"github.com/adrianderstroff/pbr/pkg/core/gl"
 	"github.com/adrianderstroff/pbr/pkg/core/shader"
 	"github.com/adrianderstroff/pbr/pkg/scene/camera"
+	"github.com/adrianderstroff/pbr/pkg/scene/probe"
+	"github.com/adrianderstroff/pbr/pkg/view/mesh"
 	"github.com/adrianderstroff/pbr/pkg/view/mesh/sphere"
 	"github.com/adrianderstroff/pbr/pkg/view/texture"
 	"github.com/go-gl/mathgl/mgl32"
@@ -15,7 +18,10 @@ import (
 // IblPass encapsulates all relevant data for rendering a mesh using physically based rendering.
 type IblPass struct {
 	texturedshader shader.Shader
-	cubemap        texture.Texture
+	envpass        *CubemapPass
+	shaderpath     string
+	sphere         mesh.Mesh
+	model          brdf.Model
 	// dimensions
 	width  int
 	height int
@@ -27,6 +33,11 @@ type IblPass struct {
 	metallictexture  texture.Texture
 	roughnesstexture texture.Texture
 	aotexture        texture.Texture
+	// multiple scattering
+	albedotable *texture.Texture
+	// reflection probe around the scene and its own copy of the environment
+	probes       []probe.Probe
+	probecubemap *texture.Texture
 	// time
 	time float32
 	// deferred rendering
@@ -35,14 +46,12 @@ type IblPass struct {
 }
 
 // MakeIblPass creates a pbr pass
-func MakeIblPass(width, height int, shaderpath, texturepath string, cubemap *texture.Texture) IblPass {
+func MakeIblPass(width, height int, shaderpath, texturepath string, envpass *CubemapPass,
+	albedotable *texture.Texture) IblPass {
 	// create shaders
 	sphere := sphere.Make(20, 25, 1, gl.TRIANGLES)
-	texturedshader, err := shader.Make(shaderpath+"/pbr/test/main.vert", shaderpath+"/pbr/test/ibl.frag")
-	if err != nil {
-		panic(err)
-	}
-	texturedshader.AddRenderable(sphere)
+	model := brdf.MakeDefaultModel()
+	texturedshader := makeIblShader(shaderpath, &model, sphere)
 
 	// load pbr material
 	albedotexture, err := texture.MakeFromPathFixedChannels(texturepath+"/albedo.png", 4, gl.RGBA, gl.RGBA)
@@ -101,9 +110,21 @@ func MakeIblPass(width, height int, shaderpath, texturepath string, cubemap *tex
 		panic(errors.New("gbuffer incomplete"))
 	}
 
+	// project the reflections of the environment onto a box around the
+	// scene. the probe gets its own copy of the environment texture since a
+	// texture only keeps track of a single unit that it is bound to.
+	probecubemap := new(texture.Texture)
+	*probecubemap = *envpass.GetEnvironment()
+	extent := mgl32.Vec3{PROBE_SIZE, PROBE_SIZE, PROBE_SIZE}
+	box := probe.MakeBox(extent.Mul(-1), extent)
+	probes := []probe.Probe{probe.Make(mgl32.Vec3{0, 0, 0}, box, 0, probecubemap)}
+
 	return IblPass{
 		texturedshader: texturedshader,
-		cubemap:        *cubemap,
+		envpass:        envpass,
+		shaderpath:     shaderpath,
+		sphere:         sphere,
+		model:          model,
 		// dimensions
 		width:  width,
 		height: height,
@@ -115,6 +136,11 @@ func MakeIblPass(width, height int, shaderpath, texturepath string, cubemap *tex
 		metallictexture:  metallictexture,
 		roughnesstexture: roughnesstexture,
 		aotexture:        aotexture,
+		// multiple scattering
+		albedotable: albedotable,
+		// reflection probe
+		probes:       probes,
+		probecubemap: probecubemap,
 		// random
 		time: 0,
 		// deferred rendering
@@ -125,9 +151,25 @@ func MakeIblPass(width, height int, shaderpath, texturepath string, cubemap *tex
 
 // SetState updates the state of the pass
 func (rmp *IblPass) SetState(state State) {
+	// recompile the shader if other variants of the brdf terms are selected
+	model := state.Model()
+	if model.NDF != rmp.model.NDF || model.Geometry != rmp.model.Geometry ||
+		model.Fresnel != rmp.model.Fresnel {
+		rmp.texturedshader.Delete()
+		rmp.texturedshader = makeIblShader(rmp.shaderpath, &model, rmp.sphere)
+	}
+	rmp.model = model
+
 	rmp.texturedshader.Use()
 	rmp.texturedshader.UpdateInt32("uSamples", state.samples)
 	rmp.texturedshader.UpdateFloat32("uGlobalRoughness", state.globalroughness)
+	rmp.texturedshader.UpdateFloat32("uDielectricF0", state.dielectricf0)
+	rmp.texturedshader.UpdateVec3("uEta", model.Eta)
+	rmp.texturedshader.UpdateVec3("uKappa", model.K)
+	rmp.texturedshader.UpdateInt32("uMultiscatter", boolToInt32(state.multiscatter))
+	rmp.texturedshader.UpdateInt32("uSunEnabled", boolToInt32(rmp.envpass.usesun))
+	rmp.texturedshader.UpdateVec3("uSunDir", rmp.envpass.sun.Direction)
+	rmp.texturedshader.UpdateVec3("uSunIrradiance", rmp.envpass.sun.Irradiance())
 	rmp.texturedshader.Release()
 
 	rmp.imageidx = state.imageidx
@@ -156,14 +198,25 @@ func (rmp *IblPass) RenderObj(camera camera.Camera) {
 		gl.PolygonMode(gl.FRONT_AND_BACK, gl.FILL)
 	}
 
-	rmp.cubemap.Bind(0)
+	environment := rmp.envpass.GetEnvironment()
+	environment.Bind(0)
 	rmp.albedotexture.Bind(1)
 	rmp.normaltexture.Bind(2)
 	rmp.metallictexture.Bind(3)
 	rmp.roughnesstexture.Bind(4)
 	rmp.aotexture.Bind(5)
+	rmp.albedotable.Bind(6)
+
+	// the probe follows the selected environment. its uniforms are set every
+	// frame since the shader can be recompiled.
+	*rmp.probecubemap = *environment
+	probe.Bind(rmp.probes)
 
 	rmp.texturedshader.Use()
+	err := probe.Upload(&rmp.texturedshader, rmp.probes)
+	if err != nil {
+		panic(err)
+	}
 	rmp.texturedshader.UpdateMat4("V", camera.GetView())
 	rmp.texturedshader.UpdateMat4("P", camera.GetPerspective())
 	rmp.texturedshader.UpdateMat4("M", mgl32.Ident4())
@@ -171,12 +224,26 @@ func (rmp *IblPass) RenderObj(camera camera.Camera) {
 	rmp.texturedshader.Render()
 	rmp.texturedshader.Release()
 
-	rmp.cubemap.Unbind()
+	environment.Unbind()
 	rmp.albedotexture.Unbind()
 	rmp.normaltexture.Unbind()
 	rmp.metallictexture.Unbind()
 	rmp.roughnesstexture.Unbind()
 	rmp.aotexture.Unbind()
+	rmp.albedotable.Unbind()
+	probe.Unbind(rmp.probes)
 
 	gl.PolygonMode(gl.FRONT_AND_BACK, gl.FILL)
 }
+
+// makeIblShader compiles the image based lighting shader with the brdf
+// variants of the specified model.
+func makeIblShader(shaderpath string, model *brdf.Model, sphere mesh.Mesh) shader.Shader {
+	texturedshader, err := shader.MakeWithDefines(shaderpath+"/pbr/test/main.vert",
+		shaderpath+"/pbr/test/ibl.frag", model.Defines())
+	if err != nil {
+		panic(err)
+	}
+	texturedshader.AddRenderable(sphere)
+	return texturedshader
+}
@@ -6,11 +6,14 @@ import (
 	"runtime"
 	"strconv"
 
+	"github.com/adrianderstroff/pbr/pkg/brdf"
 	"github.com/adrianderstroff/pbr/pkg/cgm"
 	"github.com/adrianderstroff/pbr/pkg/core/gl"
 	"github.com/adrianderstroff/pbr/pkg/core/interaction"
 	"github.com/adrianderstroff/pbr/pkg/core/window"
+	"github.com/adrianderstroff/pbr/pkg/envmap"
 	"github.com/adrianderstroff/pbr/pkg/gui"
+	"github.com/adrianderstroff/pbr/pkg/ior"
 	"github.com/adrianderstroff/pbr/pkg/scene/camera/trackball"
 	"github.com/go-gl/mathgl/mgl32"
 )
@@ -24,6 +27,21 @@ const (
 
 	WIDTH  int = 1200
 	HEIGHT int = 800
+
+	MULTISCATTER_SIZE    int = 32
+	MULTISCATTER_SAMPLES int = 512
+	// the ibl albedo changes quickly at grazing angles
+	IBL_MULTISCATTER_SIZE    int = 64
+	IBL_MULTISCATTER_SAMPLES int = 4096
+
+	// half size of the box that the reflections are projected onto
+	PROBE_SIZE float32 = 50
+
+	// texels brighter than SUN_THRESHOLD times the average luminance of the
+	// cubemap belong to the sun if they cover at most SUN_MAX_SOLID_ANGLE
+	SUN_THRESHOLD       float32 = 20
+	SUN_MAX_SOLID_ANGLE float32 = 0.1
+	SUN_DISTANCE        float32 = 15
 )
 
 func init() {
@@ -41,6 +59,15 @@ func updatePos(a float32, pos *mgl32.Vec3) {
 	pos[2] = z
 }
 
+// updateSun places the point light at the sun that was extracted from the
+// cubemap. The intensity is chosen such that the light falling onto the
+// origin matches the irradiance of the sun, taking into account that the
+// direct shader multiplies the brdf by pi.
+func updateSun(sun *envmap.Light, pos, intensity *mgl32.Vec3) {
+	*pos = sun.Direction.Mul(SUN_DISTANCE)
+	*intensity = sun.Irradiance().Mul(SUN_DISTANCE * SUN_DISTANCE / math.Pi)
+}
+
 func main() {
 	// setup window
 	title := "PBR test"
@@ -55,10 +82,22 @@ func main() {
 	// make camera
 	camera := trackball.MakeDefault(WIDTH, HEIGHT, 5)
 
+	// precompute the albedo tables for the multiple scattering compensation
+	mstables := brdf.MakeMultiscatterTables(MULTISCATTER_SIZE, MULTISCATTER_SAMPLES)
+	albedotable, avgalbedotable, err := mstables.Textures()
+	if err != nil {
+		panic(err)
+	}
+	iblmstables := brdf.MakeIBLMultiscatterTables(IBL_MULTISCATTER_SIZE, IBL_MULTISCATTER_SAMPLES)
+	iblalbedotable, _, err := iblmstables.Textures()
+	if err != nil {
+		panic(err)
+	}
+
 	// make passes
-	pbrpass := MakePbrPass(WIDTH, HEIGHT, SHADER_PATH, TEX_PATH, OBJ_PATH)
+	pbrpass := MakePbrPass(WIDTH, HEIGHT, SHADER_PATH, TEX_PATH, OBJ_PATH, &albedotable, &avgalbedotable)
 	envpass := MakeCubemapPass(SHADER_PATH, CUBEMAP_PATH)
-	iblpass := MakeIblPass(WIDTH, HEIGHT, SHADER_PATH, TEX_PATH, &envpass.cubemap)
+	iblpass := MakeIblPass(WIDTH, HEIGHT, SHADER_PATH, TEX_PATH, &envpass, &iblalbedotable)
 	sunpass := MakeSunPass(WIDTH, HEIGHT, SHADER_PATH)
 
 	// setup gui
@@ -67,20 +106,38 @@ func main() {
 	interaction.AddInteractable(&camera)
 
 	// init state
+	gold, err := ior.GetConductor("gold")
+	if err != nil {
+		panic(err)
+	}
 	state := State{
-		imageidx:        0,
-		albedo:          mgl32.Vec4{1, 1, 1, 1},
-		roughness:       1.0,
-		metalness:       0.0,
-		lightpos:        mgl32.Vec3{10, 10, 10},
-		lightintensity:  mgl32.Vec3{100, 100, 100},
-		angle:           62.0,
-		samples:         10,
-		globalroughness: 0.0,
-		wireframe:       false,
-		normal:          false,
-		ibl:             false,
-		bgcolor:         mgl32.Vec4{0.6, 0.6, 0.6, 1.0},
+		imageidx:           0,
+		albedo:             mgl32.Vec4{1, 1, 1, 1},
+		roughness:          1.0,
+		metalness:          0.0,
+		lightpos:           mgl32.Vec3{10, 10, 10},
+		lightintensity:     mgl32.Vec3{100, 100, 100},
+		angle:              62.0,
+		samples:            10,
+		globalroughness:    0.0,
+		wireframe:          false,
+		normal:             false,
+		ibl:                false,
+		bgcolor:            mgl32.Vec4{0.6, 0.6, 0.6, 1.0},
+		ndf:                brdf.NDF_GGX,
+		geometry:           brdf.GEOMETRY_SMITH_SEPARABLE,
+		fresnel:            brdf.FRESNEL_SCHLICK,
+		dielectricf0:       0.04,
+		eta:                gold.N,
+		kappa:              gold.K,
+		multiscatter:       false,
+		clearcoat:          1.0,
+		clearcoatroughness: 0.1,
+		sheencolor:         mgl32.Vec3{1, 1, 1},
+		sheenroughness:     0.5,
+		anisotropy:         0.5,
+		transmission:       1.0,
+		ior:                1.5,
 	}
 
 	// set up options for the different displayable textures
@@ -90,6 +147,12 @@ func main() {
 	modes := mods[:]
 	var modeidx int32 = 0
 
+	// material presets with physically based indices of refraction
+	presets := []string{"custom"}
+	presets = append(presets, ior.ConductorNames()...)
+	presets = append(presets, ior.DielectricNames()...)
+	var presetidx int32 = 0
+
 	// render loop
 	renderloop := func() {
 		// update title
@@ -104,7 +167,12 @@ func main() {
 		camera.Update()
 
 		// update light pos
-		updatePos(state.angle, &state.lightpos)
+		if state.envsun && envpass.hassun {
+			updateSun(&envpass.sun, &state.lightpos, &state.lightintensity)
+		} else {
+			updatePos(state.angle, &state.lightpos)
+		}
+		envpass.SetState(state)
 
 		// execute pbr pass
 		if state.wireframe {
@@ -153,22 +221,66 @@ func main() {
 					gui.ColorPicker("albedo", &state.albedo)
 					gui.SliderFloat32("roughness", &state.roughness, 0, 1, 0.1)
 					gui.SliderFloat32("metalness", &state.metalness, 0, 1, 0.1)
+					gui.SliderFloat32("dielectric f0", &state.dielectricf0, 0, 0.2, 0.005)
 					gui.EndGroup()
 				}
 
 				if open := gui.BeginGroup("Light", 200); open {
-					gui.Slider3("color", &state.lightintensity, 0, 100, 1)
-					gui.SliderFloat32("angle", &state.angle, 0, 360, 1.0)
+					gui.Checkbox("sun from cubemap", &state.envsun)
+					if !state.envsun {
+						gui.Slider3("color", &state.lightintensity, 0, 100, 1)
+						gui.SliderFloat32("angle", &state.angle, 0, 360, 1.0)
+					}
+					gui.EndGroup()
+				}
+
+				if open := gui.BeginGroup("Extensions", 420); open {
+					gui.Checkbox("clearcoat", &state.clearcoatenabled)
+					if state.clearcoatenabled {
+						gui.SliderFloat32("intensity", &state.clearcoat, 0, 1, 0.05)
+						gui.SliderFloat32("cc roughness", &state.clearcoatroughness, 0, 1, 0.05)
+					}
+					gui.Checkbox("sheen", &state.sheenenabled)
+					if state.sheenenabled {
+						gui.Slider3("sheen color", &state.sheencolor, 0, 1, 0.05)
+						gui.SliderFloat32("sheen roughness", &state.sheenroughness, 0, 1, 0.05)
+					}
+					gui.Checkbox("anisotropy", &state.anisotropyenabled)
+					if state.anisotropyenabled {
+						gui.SliderFloat32("anisotropy", &state.anisotropy, -1, 1, 0.05)
+						gui.SliderFloat32("rotation", &state.anisotropyrotation, 0, 180, 1.0)
+					}
+					gui.Checkbox("transmission", &state.transmissionenabled)
+					if state.transmissionenabled {
+						gui.SliderFloat32("transmission", &state.transmission, 0, 1, 0.05)
+						gui.SliderFloat32("ior", &state.ior, 1, 3, 0.01)
+					}
 					gui.EndGroup()
 				}
 			} else {
-				if open := gui.BeginGroup("Mat", 135); open {
+				if open := gui.BeginGroup("Mat", 170); open {
 					gui.SliderFloat32("glob roughness", &state.globalroughness, 0, 1, 0.1)
 					gui.SliderInt32("samples", &state.samples, 1, 50, 1)
+					gui.Checkbox("extract sun", &state.envsun)
 					gui.EndGroup()
 				}
 			}
 
+			if open := gui.BeginGroup("Model", 265); open {
+				gui.Selector("ndf", brdf.NDF_NAMES, &state.ndf)
+				gui.Selector("geometry", brdf.GEOMETRY_NAMES, &state.geometry)
+				gui.Selector("fresnel", brdf.FRESNEL_NAMES, &state.fresnel)
+				if gui.Selector("preset", presets, &presetidx) {
+					state.ApplyPreset(presets[presetidx])
+				}
+				if state.fresnel == brdf.FRESNEL_CONDUCTOR {
+					gui.Input3("eta", &state.eta, 0, 10, 0.01)
+					gui.Input3("kappa", &state.kappa, 0, 10, 0.01)
+				}
+				gui.Checkbox("multiscatter", &state.multiscatter)
+				gui.EndGroup()
+			}
+
 			if open := gui.BeginGroup("Debug", 140); open {
 				gui.Checkbox("Wireframe", &state.wireframe)
 				gui.Checkbox("Render Normals", &state.normal)
@@ -193,19 +305,81 @@ type State struct {
 	albedo    mgl32.Vec4
 	roughness float32
 	metalness float32
+	// reflectivity of the non-metallic part
+	dielectricf0 float32
 
 	// light
 	lightpos       mgl32.Vec3
 	lightintensity mgl32.Vec3
 	angle          float32
+	// replace the sun of the cubemap by a light
+	envsun bool
 
 	// ibl
 	samples         int32
 	globalroughness float32
 
+	// brdf model
+	ndf          int32
+	geometry     int32
+	fresnel      int32
+	eta          mgl32.Vec3
+	kappa        mgl32.Vec3
+	multiscatter bool
+
+	// material extensions
+	clearcoatenabled    bool
+	clearcoat           float32
+	clearcoatroughness  float32
+	sheenenabled        bool
+	sheencolor          mgl32.Vec3
+	sheenroughness      float32
+	anisotropyenabled   bool
+	anisotropy          float32
+	anisotropyrotation  float32 // in degrees
+	transmissionenabled bool
+	transmission        float32
+	ior                 float32
+
 	// debug
 	wireframe bool
 	normal    bool
 	ibl       bool
 	bgcolor   mgl32.Vec4
 }
+
+// Model returns the brdf variants selected in the gui.
+func (state *State) Model() brdf.Model {
+	return brdf.Model{
+		NDF:      int(state.ndf),
+		Geometry: int(state.geometry),
+		Fresnel:  int(state.fresnel),
+		Eta:      state.eta,
+		K:        state.kappa,
+	}
+}
+
+// ApplyPreset sets the material parameters to the conductor or dielectric with
+// the specified name. Conductors switch to the conductor fresnel using their
+// complex index of refraction and use their reflectivity as albedo.
+// Dielectrics derive their reflectivity and the index of refraction of the
+// transmission from their index of refraction.
+func (state *State) ApplyPreset(name string) {
+	if c, err := ior.GetConductor(name); err == nil {
+		f0 := c.F0()
+		state.albedo = mgl32.Vec4{f0.X(), f0.Y(), f0.Z(), 1}
+		state.metalness = 1
+		state.fresnel = brdf.FRESNEL_CONDUCTOR
+		state.eta = c.N
+		state.kappa = c.K
+		return
+	}
+	if d, err := ior.GetDielectric(name); err == nil {
+		state.metalness = 0
+		state.dielectricf0 = d.F0()
+		state.ior = d.IOR
+		if state.fresnel == brdf.FRESNEL_CONDUCTOR {
+			state.fresnel = brdf.FRESNEL_SCHLICK
+		}
+	}
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"errors"
 
+	"github.com/adrianderstroff/pbr/pkg/brdf"
 	"github.com/adrianderstroff/pbr/pkg/buffer/fbo"
 	"github.com/adrianderstroff/pbr/pkg/core/gl"
 	"github.com/adrianderstroff/pbr/pkg/core/shader"
 	"github.com/adrianderstroff/pbr/pkg/scene/camera"
+	"github.com/adrianderstroff/pbr/pkg/view/mesh"
 	"github.com/adrianderstroff/pbr/pkg/view/mesh/sphere"
 	"github.com/adrianderstroff/pbr/pkg/view/texture"
 	"github.com/go-gl/mathgl/mgl32"
@@ -17,6 +19,9 @@ type PbrPass struct {
 	// shader
 	pbrshader    shader.Shader
 	normalshader shader.Shader
+	shaderpath   string
+	sphere       mesh.Mesh
+	model        brdf.Model
 	// uniform variables
 	samples         int32
 	globalroughness float32
@@ -29,6 +34,9 @@ type PbrPass struct {
 	// light
 	lightpos       mgl32.Vec3
 	lightintensity mgl32.Vec3
+	// multiple scattering
+	albedotable    *texture.Texture
+	avgalbedotable *texture.Texture
 	// dimensions
 	width  int
 	height int
@@ -39,7 +47,8 @@ type PbrPass struct {
 }
 
 // MakePbrPass creates a pbr pass
-func MakePbrPass(width, height int, shaderpath, texturepath, objpath string) PbrPass {
+func MakePbrPass(width, height int, shaderpath, texturepath, objpath string,
+	albedotable, avgalbedotable *texture.Texture) PbrPass {
 	// create shaders
 	sphere := sphere.Make(20, 20, 1, gl.TRIANGLES)
 	// sphere, err := obj.Load(objpath+"dragon.obj", true, true)
@@ -48,11 +57,8 @@ func MakePbrPass(width, height int, shaderpath, texturepath, objpath string) Pbr
 	// }
 
 	// set up pbr shader
-	pbrshader, err := shader.Make(shaderpath+"/pbr/test/main.vert", shaderpath+"/pbr/test/direct.frag")
-	if err != nil {
-		panic(err)
-	}
-	pbrshader.AddRenderable(sphere)
+	model := brdf.MakeDefaultModel()
+	pbrshader := makeDirectShader(shaderpath, &model, sphere)
 
 	// set up normal shader
 	normalshader, err := shader.Make(shaderpath+"/normal/main.vert", shaderpath+"/normal/main.frag")
@@ -86,11 +92,17 @@ func MakePbrPass(width, height int, shaderpath, texturepath, objpath string) Pbr
 		// shaders
 		pbrshader:    pbrshader,
 		normalshader: normalshader,
+		shaderpath:   shaderpath,
+		sphere:       sphere,
+		model:        model,
 		// uniform variables
 		samples:         10,
 		globalroughness: 0.1,
 		wireframe:       false,
 		rendernormal:    false,
+		// multiple scattering
+		albedotable:    albedotable,
+		avgalbedotable: avgalbedotable,
 		// dimensions
 		width:  width,
 		height: height,
@@ -112,6 +124,15 @@ func (pbr *PbrPass) SetState(state State) {
 	pbr.imageidx = int(state.imageidx)
 	pbr.rendernormal = state.normal
 
+	// recompile the shader if other variants of the brdf terms are selected
+	model := state.Model()
+	if model.NDF != pbr.model.NDF || model.Geometry != pbr.model.Geometry ||
+		model.Fresnel != pbr.model.Fresnel {
+		pbr.pbrshader.Delete()
+		pbr.pbrshader = makeDirectShader(pbr.shaderpath, &model, pbr.sphere)
+	}
+	pbr.model = model
+
 	color3 := mgl32.Vec3{albedo.X(), albedo.Y(), albedo.Z()}
 	pbr.pbrshader.Use()
 	pbr.pbrshader.UpdateVec3("uAlbedo", color3)
@@ -119,6 +140,22 @@ func (pbr *PbrPass) SetState(state State) {
 	pbr.pbrshader.UpdateFloat32("uMetallic", metalness)
 	pbr.pbrshader.UpdateVec3("uLightPos", lightpos)
 	pbr.pbrshader.UpdateVec3("uLightColor", lightintensity)
+	pbr.pbrshader.UpdateFloat32("uDielectricF0", state.dielectricf0)
+	pbr.pbrshader.UpdateVec3("uEta", model.Eta)
+	pbr.pbrshader.UpdateVec3("uKappa", model.K)
+	pbr.pbrshader.UpdateInt32("uMultiscatter", boolToInt32(state.multiscatter))
+	pbr.pbrshader.UpdateInt32("uClearcoatEnabled", boolToInt32(state.clearcoatenabled))
+	pbr.pbrshader.UpdateFloat32("uClearcoat", state.clearcoat)
+	pbr.pbrshader.UpdateFloat32("uClearcoatRoughness", state.clearcoatroughness)
+	pbr.pbrshader.UpdateInt32("uSheenEnabled", boolToInt32(state.sheenenabled))
+	pbr.pbrshader.UpdateVec3("uSheenColor", state.sheencolor)
+	pbr.pbrshader.UpdateFloat32("uSheenRoughness", state.sheenroughness)
+	pbr.pbrshader.UpdateInt32("uAnisotropyEnabled", boolToInt32(state.anisotropyenabled))
+	pbr.pbrshader.UpdateFloat32("uAnisotropy", state.anisotropy)
+	pbr.pbrshader.UpdateFloat32("uAnisotropyRotation", mgl32.DegToRad(state.anisotropyrotation))
+	pbr.pbrshader.UpdateInt32("uTransmissionEnabled", boolToInt32(state.transmissionenabled))
+	pbr.pbrshader.UpdateFloat32("uTransmission", state.transmission)
+	pbr.pbrshader.UpdateFloat32("uIor", state.ior)
 	pbr.pbrshader.Release()
 }
 
@@ -136,6 +173,8 @@ func (pbr *PbrPass) Render(camera camera.Camera) {
 		pbr.gbuffer.Clear()
 
 		// invoke pbr test shader
+		pbr.albedotable.Bind(0)
+		pbr.avgalbedotable.Bind(1)
 		pbr.pbrshader.Use()
 		pbr.pbrshader.UpdateMat4("P", camera.GetPerspective())
 		pbr.pbrshader.UpdateMat4("V", camera.GetView())
@@ -143,6 +182,8 @@ func (pbr *PbrPass) Render(camera camera.Camera) {
 		pbr.pbrshader.UpdateVec3("uCameraPos", camera.GetPos())
 		pbr.pbrshader.Render()
 		pbr.pbrshader.Release()
+		pbr.albedotable.Unbind()
+		pbr.avgalbedotable.Unbind()
 
 		pbr.gbuffer.Unbind()
 
@@ -152,3 +193,23 @@ func (pbr *PbrPass) Render(camera camera.Camera) {
 		pbr.gbuffer.CopyDepthToScreen(0, 0, w, h)
 	}
 }
+
+// makeDirectShader compiles the direct lighting shader with the brdf variants
+// of the specified model.
+func makeDirectShader(shaderpath string, model *brdf.Model, sphere mesh.Mesh) shader.Shader {
+	pbrshader, err := shader.MakeWithDefines(shaderpath+"/pbr/test/main.vert",
+		shaderpath+"/pbr/test/direct.frag", model.Defines())
+	if err != nil {
+		panic(err)
+	}
+	pbrshader.AddRenderable(sphere)
+	return pbrshader
+}
+
+// boolToInt32 converts a boolean into the value of a bool uniform.
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"github.com/adrianderstroff/pbr/pkg/core/gl"
 	"github.com/adrianderstroff/pbr/pkg/core/shader"
+	"github.com/adrianderstroff/pbr/pkg/envmap"
+	"github.com/adrianderstroff/pbr/pkg/ibl"
 	"github.com/adrianderstroff/pbr/pkg/scene/camera"
 	"github.com/adrianderstroff/pbr/pkg/view/mesh/cube"
 	"github.com/adrianderstroff/pbr/pkg/view/texture"
@@ -13,6 +15,12 @@ import (
 type CubemapPass struct {
 	cubemapshader shader.Shader
 	cubemap       texture.Texture
+	// luminance cdfs for importance sampling the cubemap
+	conditionalcdf texture.Texture
+	marginalcdf    texture.Texture
+	// split sum approximation of the specular image based lighting
+	prefiltered texture.Texture
+	brdflut     texture.Texture
 }
 
 // MakeCubemapPass creates the cubemap pass with the specified paths
@@ -39,14 +47,44 @@ func MakeCubemapPass(shaderpath, cubemappath string) CubemapPass {
 		panic(err)
 	}
 
+	// build the sampling distribution of the cubemap on the cpu
+	faces, err := envmap.MakeCubemapFromDir(cubemappath, ".hdr")
+	if err != nil {
+		panic(err)
+	}
+	sampler := envmap.MakeCubemapSampler(&faces)
+	conditionalcdf, marginalcdf, err := sampler.Textures()
+	if err != nil {
+		panic(err)
+	}
+
+	// bake the prefiltered specular environment and the brdf lookup table
+	levels, err := ibl.MakePrefilteredMipChain(&faces, PREFILTERED_RES, PREFILTERED_MIPS, PREFILTERED_SAMPLES)
+	if err != nil {
+		panic(err)
+	}
+	prefiltered, err := ibl.MakePrefilteredCubeMap(levels)
+	if err != nil {
+		panic(err)
+	}
+	lut, err := ibl.MakeBrdfLut(LUT_RES, LUT_SAMPLES)
+	if err != nil {
+		panic(err)
+	}
+	brdflut := ibl.MakeBrdfLutTexture(&lut)
+
 	err = gl.GetError()
 	if err != nil {
 		panic(err)
 	}
 
 	return CubemapPass{
-		cubemapshader: cubemapshader,
-		cubemap:       cubemap,
+		cubemapshader:  cubemapshader,
+		cubemap:        cubemap,
+		conditionalcdf: conditionalcdf,
+		marginalcdf:    marginalcdf,
+		prefiltered:    prefiltered,
+		brdflut:        brdflut,
 	}
 }
 
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/adrianderstroff/pbr/pkg/buffer/fbo"
+	"github.com/adrianderstroff/pbr/pkg/core/gl"
+	"github.com/adrianderstroff/pbr/pkg/core/shader"
+	"github.com/adrianderstroff/pbr/pkg/denoise"
+	"github.com/adrianderstroff/pbr/pkg/scene/camera"
+	"github.com/adrianderstroff/pbr/pkg/view/mesh/quad"
+	"github.com/adrianderstroff/pbr/pkg/view/texture"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// DenoisePass filters the noisy color of the g-buffer with the edge-avoiding
+// à-trous filter, see the package denoise for the CPU reference. The temporal
+// history is kept in pairs of frame buffers that swap their roles each frame.
+type DenoisePass struct {
+	reprojectshader shader.Shader
+	varianceshader  shader.Shader
+	atrousshader    shader.Shader
+	// integrated color, moments and surfaces of the current and previous frame
+	temporal [2]fbo.FBO
+	// color with its variance
+	variance fbo.FBO
+	// output of the first à-trous iteration which is the color history
+	history [2]fbo.FBO
+	// targets of the remaining à-trous iterations
+	pingpong [2]fbo.FBO
+	// index of the current frame buffers of temporal and history
+	current int
+	// history of the previous frame
+	valid          bool
+	historycolor   *texture.Texture
+	viewprojection mgl32.Mat4
+	options        denoise.Options
+}
+
+// MakeDenoisePass creates a denoise pass for a g-buffer of the specified
+// size.
+func MakeDenoisePass(width, height int, shaderpath string, options denoise.Options) DenoisePass {
+	// create shaders
+	screen := quad.Make(2, 2, gl.TRIANGLES)
+	reprojectshader, err := shader.Make(shaderpath+"/denoise/main.vert", shaderpath+"/denoise/reproject.frag")
+	if err != nil {
+		panic(err)
+	}
+	reprojectshader.AddRenderable(screen)
+	varianceshader, err := shader.Make(shaderpath+"/denoise/main.vert", shaderpath+"/denoise/variance.frag")
+	if err != nil {
+		panic(err)
+	}
+	varianceshader.AddRenderable(screen)
+	atrousshader, err := shader.Make(shaderpath+"/denoise/main.vert", shaderpath+"/denoise/atrous.frag")
+	if err != nil {
+		panic(err)
+	}
+	atrousshader.AddRenderable(screen)
+
+	// setup render targets
+	var temporal, history, pingpong [2]fbo.FBO
+	for i := 0; i < 2; i++ {
+		temporal[i] = makeDenoiseTarget(width, height, 3)
+		history[i] = makeDenoiseTarget(width, height, 1)
+		pingpong[i] = makeDenoiseTarget(width, height, 1)
+	}
+	variance := makeDenoiseTarget(width, height, 1)
+
+	denoisepass := DenoisePass{
+		reprojectshader: reprojectshader,
+		varianceshader:  varianceshader,
+		atrousshader:    atrousshader,
+		temporal:        temporal,
+		variance:        variance,
+		history:         history,
+		pingpong:        pingpong,
+		current:         0,
+		valid:           false,
+		historycolor:    nil,
+		viewprojection:  mgl32.Ident4(),
+		options:         options,
+	}
+	denoisepass.SetOptions(options)
+	return denoisepass
+}
+
+// makeDenoiseTarget creates a frame buffer with the specified number of float
+// color attachments.
+func makeDenoiseTarget(width, height, attachments int) fbo.FBO {
+	target := fbo.MakeEmpty()
+	for i := 0; i < attachments; i++ {
+		tex := texture.Make(width, height, gl.RGBA32F, gl.RGBA, gl.FLOAT, nil,
+			gl.NEAREST, gl.NEAREST, gl.CLAMP_TO_EDGE, gl.CLAMP_TO_EDGE)
+		target.AttachColorTexture(&tex, uint32(i))
+	}
+	if !target.IsComplete() {
+		panic(errors.New("denoise target incomplete"))
+	}
+	return target
+}
+
+// SetOptions updates the options of the denoiser.
+func (dnp *DenoisePass) SetOptions(options denoise.Options) {
+	dnp.options = options
+	for _, s := range []*shader.Shader{&dnp.reprojectshader, &dnp.varianceshader, &dnp.atrousshader} {
+		s.Use()
+		s.UpdateFloat32("uSigmaNormal", options.SigmaNormal)
+		s.UpdateFloat32("uSigmaDepth", options.SigmaDepth)
+		s.UpdateFloat32("uSigmaMaterial", options.SigmaMaterial)
+		s.UpdateFloat32("uSigmaLuminance", options.SigmaLuminance)
+		s.UpdateFloat32("uSigmaColor", options.SigmaColor)
+		s.UpdateInt32("uVariance", boolToInt32(options.Variance))
+		s.Release()
+	}
+	dnp.reprojectshader.Use()
+	dnp.reprojectshader.UpdateFloat32("uAlpha", options.Alpha)
+	dnp.reprojectshader.Release()
+}
+
+// Reset discards the history, e.g. after a camera cut.
+func (dnp *DenoisePass) Reset() {
+	dnp.valid = false
+}
+
+// Render filters the color of the g-buffer that has been rendered with the
+// specified camera and returns the frame buffer holding the result in its
+// first color attachment. Background pixels keep their color.
+func (dnp *DenoisePass) Render(gbuffer *fbo.FBO, camera camera.Camera) *fbo.FBO {
+	viewprojection := camera.GetViewPerspective()
+	previous := 1 - dnp.current
+	temporal := &dnp.temporal[dnp.current]
+
+	// the g-buffer is available to all shaders
+	for i := uint32(0); i < 6; i++ {
+		gbuffer.GetColorTexture(i).Bind(i)
+	}
+	gbuffer.GetDepthTexture().Bind(6)
+
+	// accumulate the previous frames
+	history := dnp.options.Temporal && dnp.valid
+	if history {
+		dnp.historycolor.Bind(7)
+		dnp.temporal[previous].GetColorTexture(1).Bind(8)
+		dnp.temporal[previous].GetColorTexture(2).Bind(9)
+	}
+	dnp.reprojectshader.Use()
+	dnp.reprojectshader.UpdateMat4("uInvViewProjection", viewprojection.Inv())
+	dnp.reprojectshader.UpdateMat4("uPrevViewProjection", dnp.viewprojection)
+	dnp.reprojectshader.UpdateMat4("uPrevInvViewProjection", dnp.viewprojection.Inv())
+	dnp.reprojectshader.UpdateInt32("uHistory", boolToInt32(history))
+	temporal.Bind()
+	dnp.reprojectshader.Render()
+	temporal.Unbind()
+	dnp.reprojectshader.Release()
+
+	// estimate the variance
+	temporal.GetColorTexture(0).Bind(7)
+	temporal.GetColorTexture(1).Bind(8)
+	dnp.varianceshader.Use()
+	dnp.variance.Bind()
+	dnp.varianceshader.Render()
+	dnp.variance.Unbind()
+	dnp.varianceshader.Release()
+
+	// the output of the first iteration is the history of the next frame
+	result := &dnp.variance
+	dnp.historycolor = temporal.GetColorTexture(0)
+	dnp.atrousshader.Use()
+	for i := 0; i < dnp.options.Iterations; i++ {
+		target := &dnp.pingpong[i%2]
+		if i == 0 {
+			target = &dnp.history[dnp.current]
+			dnp.historycolor = target.GetColorTexture(0)
+		}
+		result.GetColorTexture(0).Bind(7)
+		dnp.atrousshader.UpdateInt32("uStepSize", int32(1)<<uint(i))
+		target.Bind()
+		dnp.atrousshader.Render()
+		target.Unbind()
+		result = target
+	}
+	dnp.atrousshader.Release()
+
+	// unbind all textures, otherwise they could be read while being rendered
+	// to in the next frame
+	for unit := uint32(0); unit < 10; unit++ {
+		gl.ActiveTexture(gl.TEXTURE0 + unit)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+	}
+
+	dnp.valid = true
+	dnp.viewprojection = viewprojection
+	dnp.current = previous
+	return result
+}
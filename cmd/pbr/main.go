@@ -20,6 +20,16 @@ const (
 
 	WIDTH  int = 1200
 	HEIGHT int = 800
+
+	// half size of the box that the reflections are projected onto
+	PROBE_SIZE float32 = 50
+
+	// prefiltered specular environment and brdf lookup table
+	PREFILTERED_RES     int = 128
+	PREFILTERED_MIPS    int = 5
+	PREFILTERED_SAMPLES int = 64
+	LUT_RES             int = 128
+	LUT_SAMPLES         int = 256
 )
 
 func init() {
@@ -45,7 +55,7 @@ func main() {
 
 	// make passes
 	cubemappass := MakeCubemapPass(SHADER_PATH, CUBEMAP_PATH)
-	pbrpass := MakePbrPass(WIDTH, HEIGHT, MESH_PATH, SHADER_PATH, TEX_PATH, &cubemappass.cubemap)
+	pbrpass := MakePbrPass(WIDTH, HEIGHT, MESH_PATH, SHADER_PATH, TEX_PATH, &cubemappass)
 
 	// setup gui
 	gui := gui.New(window.Window)
@@ -56,9 +66,13 @@ func main() {
 
 	// init state
 	state := State{
-		roughness: 0.1,
-		samples:   10,
-		wireframe: false,
+		roughness:  0.1,
+		samples:    10,
+		wireframe:  false,
+		denoise:    false,
+		iterations: 5,
+		variance:   true,
+		temporal:   true,
 	}
 
 	// render loop
@@ -79,10 +93,20 @@ func main() {
 
 		// render GUI
 		gui.Begin()
-		if open := gui.BeginWindow("Options", 0, 0, 250, 355); open {
-			if open := gui.BeginGroup("Material", 135); open {
+		if open := gui.BeginWindow("Options", 0, 0, 250, 510); open {
+			if open := gui.BeginGroup("Material", 195); open {
 				gui.SliderFloat32("roughness", &state.roughness, 0, 1, 0.01)
 				gui.SliderInt32("samples", &state.samples, 1, 500, 1)
+				gui.Checkbox("Importance sample environment", &state.envimportance)
+				gui.Checkbox("Prefiltered specular", &state.prefiltered)
+				gui.EndGroup()
+			}
+
+			if open := gui.BeginGroup("Denoise", 130); open {
+				gui.Checkbox("Denoise", &state.denoise)
+				gui.SliderInt32("iterations", &state.iterations, 0, 8, 1)
+				gui.Checkbox("Variance guided", &state.variance)
+				gui.Checkbox("Temporal reprojection", &state.temporal)
 				gui.EndGroup()
 			}
 
@@ -100,8 +124,16 @@ func main() {
 // State describes the gui state used for the pbr pass.
 type State struct {
 	// material
-	samples   int32
-	roughness float32
+	samples       int32
+	roughness     float32
+	envimportance bool
+	prefiltered   bool
+
+	// denoise
+	denoise    bool
+	iterations int32
+	variance   bool
+	temporal   bool
 
 	// debug
 	wireframe bool
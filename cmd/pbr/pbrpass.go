@@ -6,8 +6,10 @@ import (
 	"github.com/adrianderstroff/pbr/pkg/buffer/fbo"
 	"github.com/adrianderstroff/pbr/pkg/core/gl"
 	"github.com/adrianderstroff/pbr/pkg/core/shader"
+	"github.com/adrianderstroff/pbr/pkg/denoise"
 	"github.com/adrianderstroff/pbr/pkg/io/obj"
 	"github.com/adrianderstroff/pbr/pkg/scene/camera"
+	"github.com/adrianderstroff/pbr/pkg/scene/probe"
 	"github.com/adrianderstroff/pbr/pkg/view/texture"
 	"github.com/go-gl/mathgl/mgl32"
 )
@@ -16,6 +18,12 @@ import (
 type PbrPass struct {
 	texturedshader shader.Shader
 	cubemap        texture.Texture
+	conditionalcdf texture.Texture
+	marginalcdf    texture.Texture
+	prefiltered    texture.Texture
+	brdflut        texture.Texture
+	// parallax corrected reflections
+	probes []probe.Probe
 	// dimensions
 	width  int
 	height int
@@ -31,10 +39,13 @@ type PbrPass struct {
 	time float32
 	// deferred rendering
 	gbuffer fbo.FBO
+	// denoising of the noisy color
+	denoise     bool
+	denoisepass DenoisePass
 }
 
 // MakePbrPass creates a pbr pass
-func MakePbrPass(width, height int, meshpath, shaderpath, texturepath string, cubemap *texture.Texture) PbrPass {
+func MakePbrPass(width, height int, meshpath, shaderpath, texturepath string, cubemappass *CubemapPass) PbrPass {
 	// create shaders
 	//sphere := sphere.Make(20, 25, 1, gl.TRIANGLES)
 	gun, err := obj.Load(meshpath+"gun.obj", false, false)
@@ -47,6 +58,17 @@ func MakePbrPass(width, height int, meshpath, shaderpath, texturepath string, cu
 	}
 	texturedshader.AddRenderable(gun)
 
+	// project the reflections of the cubemap onto a box around the scene
+	extent := mgl32.Vec3{PROBE_SIZE, PROBE_SIZE, PROBE_SIZE}
+	box := probe.MakeBox(extent.Mul(-1), extent)
+	probes := []probe.Probe{probe.Make(mgl32.Vec3{0, 0, 0}, box, 0, &cubemappass.cubemap)}
+	texturedshader.Use()
+	err = probe.Upload(&texturedshader, probes)
+	if err != nil {
+		panic(err)
+	}
+	texturedshader.Release()
+
 	// load pbr material
 	albedotexture, err := texture.MakeFromPathFixedChannels(texturepath+"/albedo.png", 4, gl.RGBA, gl.RGBA)
 	if err != nil {
@@ -82,6 +104,7 @@ func MakePbrPass(width, height int, meshpath, shaderpath, texturepath string, cu
 	// update textured shader
 	texturedshader.Use()
 	texturedshader.UpdateFloat32("uGlobalRoughness", 0.1)
+	texturedshader.UpdateFloat32("uPrefilteredMaxMip", float32(PREFILTERED_MIPS-1))
 	texturedshader.Release()
 
 	// setup g-buffer
@@ -103,10 +126,16 @@ func MakePbrPass(width, height int, meshpath, shaderpath, texturepath string, cu
 	if !gbuffer.IsComplete() {
 		panic(errors.New("gbuffer incomplete"))
 	}
+	denoisepass := MakeDenoisePass(width, height, shaderpath, denoise.MakeDefaultOptions())
 
 	return PbrPass{
 		texturedshader: texturedshader,
-		cubemap:        *cubemap,
+		cubemap:        cubemappass.cubemap,
+		conditionalcdf: cubemappass.conditionalcdf,
+		marginalcdf:    cubemappass.marginalcdf,
+		prefiltered:    cubemappass.prefiltered,
+		brdflut:        cubemappass.brdflut,
+		probes:         probes,
 		// dimensions
 		width:  width,
 		height: height,
@@ -122,6 +151,9 @@ func MakePbrPass(width, height int, meshpath, shaderpath, texturepath string, cu
 		time: 0,
 		// deferred rendering
 		gbuffer: gbuffer,
+		// denoising
+		denoise:     false,
+		denoisepass: denoisepass,
 	}
 }
 
@@ -130,9 +162,22 @@ func (rmp *PbrPass) SetState(state *State) {
 	rmp.texturedshader.Use()
 	rmp.texturedshader.UpdateInt32("uSamples", state.samples)
 	rmp.texturedshader.UpdateFloat32("uGlobalRoughness", state.roughness)
+	rmp.texturedshader.UpdateInt32("uEnvImportance", boolToInt32(state.envimportance))
+	rmp.texturedshader.UpdateInt32("uPrefiltered", boolToInt32(state.prefiltered))
 	rmp.texturedshader.Release()
 
 	rmp.wireframe = state.wireframe
+
+	// the history is outdated if the denoiser has been disabled
+	if state.denoise && !rmp.denoise {
+		rmp.denoisepass.Reset()
+	}
+	rmp.denoise = state.denoise
+	options := denoise.MakeDefaultOptions()
+	options.Iterations = int(state.iterations)
+	options.Variance = state.variance
+	options.Temporal = state.temporal
+	rmp.denoisepass.SetOptions(options)
 }
 
 // Render does the pbr pass
@@ -144,7 +189,12 @@ func (rmp *PbrPass) Render(camera camera.Camera) {
 
 	// copy gbuffer textures to the screen
 	w, h := int32(rmp.width), int32(rmp.height)
-	rmp.gbuffer.CopyColorToScreen(0, 0, 0, w, h)
+	if rmp.denoise {
+		denoised := rmp.denoisepass.Render(&rmp.gbuffer, camera)
+		denoised.CopyColorToScreen(0, 0, 0, w, h)
+	} else {
+		rmp.gbuffer.CopyColorToScreen(0, 0, 0, w, h)
+	}
 	rmp.gbuffer.CopyDepthToScreen(0, 0, w, h)
 	rmp.gbuffer.CopyColorToScreenRegion(1, 0, 0, w, h, 0, 0, w/5, h/5)
 	rmp.gbuffer.CopyDepthToScreenRegion(0, 0, w, h, 0, 0, w/5, h/5)
@@ -172,6 +222,11 @@ func (rmp *PbrPass) RenderObj(camera camera.Camera) {
 	rmp.metallictexture.Bind(3)
 	rmp.roughnesstexture.Bind(4)
 	rmp.aotexture.Bind(5)
+	rmp.conditionalcdf.Bind(6)
+	rmp.marginalcdf.Bind(7)
+	probe.Bind(rmp.probes)
+	rmp.prefiltered.Bind(13)
+	rmp.brdflut.Bind(14)
 
 	rmp.texturedshader.Use()
 	rmp.texturedshader.UpdateMat4("V", camera.GetView())
@@ -187,6 +242,19 @@ func (rmp *PbrPass) RenderObj(camera camera.Camera) {
 	rmp.metallictexture.Unbind()
 	rmp.roughnesstexture.Unbind()
 	rmp.aotexture.Unbind()
+	rmp.conditionalcdf.Unbind()
+	rmp.marginalcdf.Unbind()
+	probe.Unbind(rmp.probes)
+	rmp.prefiltered.Unbind()
+	rmp.brdflut.Unbind()
 
 	gl.PolygonMode(gl.FRONT_AND_BACK, gl.FILL)
 }
+
+// boolToInt32 converts a boolean into the value of a bool uniform.
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
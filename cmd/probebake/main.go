@@ -0,0 +1,90 @@
+// probebake is a utility program that bakes a grid of irradiance light probes
+// for the scene of cmd/pbr with the CPU path tracer. The probes are placed on
+// a regular grid over the bounds of the mesh enlarged by a margin. Each probe
+// stores the irradiance and the distance moments used for the visibility
+// aware interpolation of assets/shaders/pbr/shared/probegrid.glsl. The grid is
+// written as json that can be loaded with lightprobe.LoadFromPath.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/adrianderstroff/pbr/pkg/envmap"
+	"github.com/adrianderstroff/pbr/pkg/io/obj"
+	"github.com/adrianderstroff/pbr/pkg/lightprobe"
+	"github.com/adrianderstroff/pbr/pkg/pathtracer"
+)
+
+const (
+	MESH_PATH    = "./assets/objects/gun.obj"
+	TEX_PATH     = "./assets/images/textures/material-gun/"
+	CUBEMAP_PATH = "./assets/images/cubemap/hdr/"
+	OUT_PATH     = "./probes.json"
+
+	RESOLUTION int     = 4
+	SAMPLES    int     = 1024
+	DEPTH      int     = 4
+	MARGIN     float32 = 0.1
+)
+
+func main() {
+	mesh := flag.String("obj", MESH_PATH, "obj file of the mesh")
+	textures := flag.String("textures", TEX_PATH, "directory of the material textures")
+	cubemap := flag.String("cubemap", CUBEMAP_PATH, "directory of the cube map faces")
+	extension := flag.String("ext", ".hdr", "file extension of the cube map faces")
+	out := flag.String("out", OUT_PATH, "json file of the baked grid")
+	resx := flag.Int("x", RESOLUTION, "number of probes along the x-axis")
+	resy := flag.Int("y", RESOLUTION, "number of probes along the y-axis")
+	resz := flag.Int("z", RESOLUTION, "number of probes along the z-axis")
+	samples := flag.Int("samples", SAMPLES, "number of rays per probe")
+	depth := flag.Int("depth", DEPTH, "maximum number of bounces")
+	margin := flag.Float64("margin", float64(MARGIN), "margin around the bounds of the mesh relative to its size")
+	intensity := flag.Float64("intensity", 1, "scale of the environment radiance")
+	seed := flag.Int64("seed", 0, "seed of the random number generators")
+	flag.Parse()
+
+	// load the scene
+	geometry, err := obj.LoadGeometry(*mesh, false, false)
+	if err != nil {
+		panic(err)
+	}
+	material, err := pathtracer.LoadMaterial(*textures)
+	if err != nil {
+		panic(err)
+	}
+	faces, err := envmap.MakeCubemapFromDir(*cubemap, *extension)
+	if err != nil {
+		panic(err)
+	}
+	environment := pathtracer.MakeCubemapEnvironment(&faces)
+	environment.Intensity = float32(*intensity)
+	scene, err := pathtracer.MakeScene(&geometry, material, &environment)
+	if err != nil {
+		panic(err)
+	}
+
+	// enlarge the bounds such that the outermost probes don't lie on the mesh
+	bounds := scene.BVH.Bounds()
+	padding := bounds.Size().Mul(float32(*margin))
+	bounds.Min = bounds.Min.Sub(padding)
+	bounds.Max = bounds.Max.Add(padding)
+	grid, err := lightprobe.MakeGrid(bounds, [3]int{*resx, *resy, *resz})
+	if err != nil {
+		panic(err)
+	}
+
+	options := pathtracer.MakeDefaultOptions(0, 0)
+	options.MaxDepth = *depth
+	options.Seed = *seed
+
+	start := time.Now()
+	lightprobe.Bake(&grid, &scene, options, *samples)
+	fmt.Printf("baked %v probes in %v\n", grid.Count(), time.Since(start))
+	fmt.Printf("bounds %v to %v\n", bounds.Min, bounds.Max)
+
+	if err := grid.SaveToPath(*out); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,144 @@
+// rasterize is a utility program that renders a mesh with the software
+// rasterizer, thus it doesn't need a GPU or a window. The mesh is seen by a
+// trackball camera and shaded either with a head light or by visualizing its
+// normals or texture coordinates. It writes the shaded image as color.png and
+// the depth buffer as depth.png, where the depth range of the mesh is
+// stretched to [0,1], which is useful as reference images.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/core/gl"
+	"github.com/adrianderstroff/pbr/pkg/io/obj"
+	"github.com/adrianderstroff/pbr/pkg/raster"
+	"github.com/adrianderstroff/pbr/pkg/scene/camera/trackball"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	MESH_PATH = "./assets/objects/gun.obj"
+	OUT_PATH  = "./"
+
+	WIDTH  int     = 800
+	HEIGHT int     = 600
+	RADIUS float32 = 2
+)
+
+func main() {
+	mesh := flag.String("obj", MESH_PATH, "obj file of the mesh")
+	out := flag.String("out", OUT_PATH, "directory of color.png and depth.png")
+	width := flag.Int("width", WIDTH, "width of the images")
+	height := flag.Int("height", HEIGHT, "height of the images")
+	radius := flag.Float64("radius", float64(RADIUS), "distance of the camera to the center of the mesh")
+	theta := flag.Float64("theta", 0, "vertical rotation of the camera in degrees")
+	phi := flag.Float64("phi", 0, "horizontal rotation of the camera in degrees")
+	mode := flag.String("mode", "shaded", "shading of the mesh, shaded, normal or uv")
+	nocull := flag.Bool("nocull", false, "disable back face culling")
+	smooth := flag.Bool("smooth", false, "generate smooth normals if the mesh has none")
+	flag.Parse()
+
+	// load the mesh
+	geometry, err := obj.LoadGeometry(*mesh, false, *smooth)
+	if err != nil {
+		panic(err)
+	}
+
+	// setup camera
+	camera := trackball.MakeDefault(*width, *height, float32(*radius))
+	camera.Rotate(float32(*theta), float32(*phi))
+	camera.Update()
+
+	// setup render targets
+	color, err := image2d.Make(*width, *height, 4)
+	if err != nil {
+		panic(err)
+	}
+	depth, err := image2d.MakeFloat32(*width, *height, 1)
+	if err != nil {
+		panic(err)
+	}
+	rasterizer := raster.Make(*width, *height)
+	rasterizer.CullFace = !*nocull
+	if err := rasterizer.AttachColor(&color, 0); err != nil {
+		panic(err)
+	}
+	if err := rasterizer.AttachDepth(&depth); err != nil {
+		panic(err)
+	}
+	rasterizer.Clear()
+
+	shader, err := makeShader(*mode, camera.GetPos())
+	if err != nil {
+		panic(err)
+	}
+	if err := rasterizer.Render(&geometry, gl.TRIANGLES, &camera, mgl32.Ident4(), shader); err != nil {
+		panic(err)
+	}
+
+	if err := color.SaveToPath(filepath.Join(*out, "color.png")); err != nil {
+		panic(err)
+	}
+	if err := saveDepth(&depth, filepath.Join(*out, "depth.png")); err != nil {
+		panic(err)
+	}
+}
+
+// makeShader returns the shader of the specified mode. The head light is
+// located at the camera position eye.
+func makeShader(mode string, eye mgl32.Vec3) (raster.Shader, error) {
+	switch mode {
+	case "shaded":
+		return func(fragment *raster.Fragment, out []mgl32.Vec4) bool {
+			n := fragment.Vec3("normal").Normalize()
+			l := eye.Sub(fragment.Vec3("pos")).Normalize()
+			diffuse := cgm.Abs32(n.Dot(l))
+			out[0] = mgl32.Vec4{diffuse, diffuse, diffuse, 1}
+			return true
+		}, nil
+	case "normal":
+		return func(fragment *raster.Fragment, out []mgl32.Vec4) bool {
+			n := fragment.Vec3("normal").Normalize().Mul(0.5).Add(mgl32.Vec3{0.5, 0.5, 0.5})
+			out[0] = n.Vec4(1)
+			return true
+		}, nil
+	case "uv":
+		return func(fragment *raster.Fragment, out []mgl32.Vec4) bool {
+			uv := fragment.Vec2("uv")
+			out[0] = mgl32.Vec4{uv.X(), uv.Y(), 0, 1}
+			return true
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported mode %v", mode)
+}
+
+// saveDepth writes the depth buffer as 8 bit png with the range of the
+// covered pixels stretched to [0,1]. Uncovered pixels are white.
+func saveDepth(depth *image2d.Image2D, path string) error {
+	lo, hi := float32(1), float32(0)
+	for y := 0; y < depth.GetHeight(); y++ {
+		for x := 0; x < depth.GetWidth(); x++ {
+			if d := depth.GetFloat32(x, y, 0); d < 1 {
+				lo, hi = cgm.Min32(lo, d), cgm.Max32(hi, d)
+			}
+		}
+	}
+
+	img, err := image2d.Make(depth.GetWidth(), depth.GetHeight(), 1)
+	if err != nil {
+		return err
+	}
+	for y := 0; y < depth.GetHeight(); y++ {
+		for x := 0; x < depth.GetWidth(); x++ {
+			d := depth.GetFloat32(x, y, 0)
+			if d < 1 && hi > lo {
+				img.SetFloat32(x, y, 0, (d-lo)/(hi-lo))
+			}
+		}
+	}
+	return img.SaveToPath(path)
+}
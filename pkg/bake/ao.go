@@ -0,0 +1,157 @@
+package bake
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/adrianderstroff/pbr/pkg/bvh"
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/adrianderstroff/pbr/pkg/sampling"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// AOOptions of the ambient occlusion baker. Samples is the number of rays per
+// texel and RayLength the distance up to which hits occlude the texel, which
+// is unlimited for values of 0. The rays start Bias away from the surface
+// along the geometric normal to avoid self intersections. Padding is the
+// number of texels the baked texels are dilated by.
+type AOOptions struct {
+	Samples   int
+	RayLength float32
+	Bias      float32
+	Padding   int
+}
+
+// MakeDefaultAOOptions returns the options for 256 rays per texel with a ray
+// length that suits the normalized meshes of obj.LoadGeometry.
+func MakeDefaultAOOptions() AOOptions {
+	return AOOptions{
+		Samples:   256,
+		RayLength: 0.5,
+		Bias:      1e-4,
+		Padding:   8,
+	}
+}
+
+// BakeAO bakes the ambient occlusion and the bent normals of the surface into
+// textures of the specified size. The rays are distributed proportional to the
+// cosine around the normal, thus the fraction of unoccluded rays is the cosine
+// weighted ambient occlusion that the pbr shaders expect. The bent normal is
+// the average unoccluded direction and is stored in the tangent space of
+// NormalMapping of normal.glsl, such that it can be used like a normal map.
+// The ambient occlusion is returned as float image with one channel and the
+// bent normals as float image with three channels.
+func BakeAO(surface *Surface, hierarchy *bvh.BVH, width, height int, options AOOptions) (image2d.Image2D, image2d.Image2D, error) {
+	ao, err := image2d.MakeFloat32(width, height, 1)
+	if err != nil {
+		return image2d.Image2D{}, image2d.Image2D{}, err
+	}
+	bent, err := image2d.MakeFloat32(width, height, 3)
+	if err != nil {
+		return image2d.Image2D{}, image2d.Image2D{}, err
+	}
+
+	// uncovered texels are unoccluded with the neutral normal
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			ao.SetFloat32(x, y, 0, 1)
+			setVec3(&bent, x, y, mgl32.Vec3{0.5, 0.5, 1})
+		}
+	}
+
+	tmax := options.RayLength
+	if tmax <= 0 {
+		tmax = float32(math.Inf(1))
+	}
+
+	texels := surface.Rasterize(width, height)
+	forEachTexel(texels, func(t *Texel) {
+		origin := t.Position.Add(t.Ng.Mul(options.Bias))
+		seed := sampling.Hash(uint32(t.Y*width + t.X))
+
+		unoccluded := 0
+		var direction mgl32.Vec3
+		for s := 0; s < options.Samples; s++ {
+			xi := sampling.OwenScrambledSobol2D(uint32(s), seed)
+			dir := sampling.TangentToWorld(sampling.CosineHemisphere(xi), t.Normal)
+
+			// directions below the surface are occluded by the surface itself
+			if dir.Dot(t.Ng) <= 0 {
+				continue
+			}
+			ray := geom.Ray{Origin: origin, Direction: dir}
+			if hierarchy.AnyHit(&ray, 0, tmax) {
+				continue
+			}
+
+			unoccluded++
+			direction = direction.Add(dir)
+		}
+
+		if options.Samples > 0 {
+			ao.SetFloat32(t.X, t.Y, 0, float32(unoccluded)/float32(options.Samples))
+		}
+		if direction.Len() > 0 {
+			setVec3(&bent, t.X, t.Y, EncodeNormal(t.Normal, direction.Normalize()))
+		}
+	})
+
+	Dilate(&ao, Mask(texels, width, height), options.Padding)
+	Dilate(&bent, Mask(texels, width, height), options.Padding)
+	return ao, bent, nil
+}
+
+// EncodeNormal transforms the normalized direction dir into the tangent space
+// of NormalMapping of normal.glsl around the surface normal and maps it to
+// [0,1], such that geom.NormalMapping of the encoded normal yields dir again.
+// The binormal and tangent of NormalMapping are orthogonal but not normalized,
+// thus the components are divided by their squared lengths and the result is
+// scaled to fit into [-1,1], which the normalization undoes. For normals
+// along the positive y-axis or the x-axis the frame of NormalMapping
+// degenerates and only the surface normal itself can be encoded.
+func EncodeNormal(surfaceNormal, dir mgl32.Vec3) mgl32.Vec3 {
+	n := surfaceNormal.Normalize()
+	b, t := geom.NormalMappingFrame(n)
+
+	if b.Dot(b) == 0 {
+		return mgl32.Vec3{0.5, 0.5, 1}
+	}
+	rn := mgl32.Vec3{dir.Dot(b) / b.Dot(b), dir.Dot(t) / t.Dot(t), dir.Dot(n)}
+	if m := cgm.Max32(cgm.Abs32(rn.X()), cgm.Max32(cgm.Abs32(rn.Y()), cgm.Abs32(rn.Z()))); m > 1 {
+		rn = rn.Mul(1 / m)
+	}
+	return rn.Mul(0.5).Add(mgl32.Vec3{0.5, 0.5, 0.5})
+}
+
+// forEachTexel calls bake for all texels. The texels are distributed among all
+// available CPUs, thus bake must only write to the texel it has been called
+// for.
+func forEachTexel(texels []Texel, bake func(t *Texel)) {
+	indices := make(chan int, len(texels))
+	for i := range texels {
+		indices <- i
+	}
+	close(indices)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				bake(&texels[i])
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// setVec3 sets the first three channels of the texel (x,y).
+func setVec3(img *image2d.Image2D, x, y int, v mgl32.Vec3) {
+	for c := 0; c < 3; c++ {
+		img.SetFloat32(x, y, c, v[c])
+	}
+}
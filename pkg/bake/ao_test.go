@@ -0,0 +1,57 @@
+package bake
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// NormalMapping of an encoded direction yields the direction again
+func TestEncodeNormal(t *testing.T) {
+	normals := []mgl32.Vec3{
+		{0, 0, 1}, {0, 0, -1}, {0, -1, 0},
+		mgl32.Vec3{0.1, 1, 0.05}.Normalize(), mgl32.Vec3{1, 0.0005, 1}.Normalize(),
+		mgl32.Vec3{-1, 2, 3}.Normalize(), mgl32.Vec3{0.5, -1, 0.2}.Normalize(),
+	}
+	rnd := rand.New(rand.NewSource(42))
+	for _, n := range normals {
+		for i := 0; i < 100; i++ {
+			// random direction in the hemisphere around the normal
+			dir := mgl32.Vec3{rnd.Float32()*2 - 1, rnd.Float32()*2 - 1, rnd.Float32()*2 - 1}
+			if dir.Len() < 0.1 {
+				continue
+			}
+			dir = dir.Normalize()
+			if dir.Dot(n) < 0 {
+				dir = dir.Mul(-1)
+			}
+
+			encoded := EncodeNormal(n, dir)
+			for c := 0; c < 3; c++ {
+				if encoded[c] < 0 || encoded[c] > 1 {
+					t.Fatalf("normal %v: encoding %v of %v lies outside of [0,1]", n, encoded, dir)
+				}
+			}
+			if decoded := geom.NormalMapping(n, encoded); !(decoded.Sub(dir).Len() <= 1e-3) {
+				t.Fatalf("normal %v: expected %v, got %v", n, dir, decoded)
+			}
+		}
+	}
+}
+
+// the frame of NormalMapping vanishes for normals along the positive y-axis
+// or the x-axis, thus any direction is encoded as the neutral normal
+func TestEncodeNormalDegenerate(t *testing.T) {
+	for _, n := range []mgl32.Vec3{{0, 1, 0}, {1, 0, 0}, {-1, 0, 0}} {
+		dir := n.Add(mgl32.Vec3{0, 0, 1}).Normalize()
+		encoded := EncodeNormal(n, dir)
+		if encoded != (mgl32.Vec3{0.5, 0.5, 1}) {
+			t.Errorf("normal %v: encoded %v as %v", n, dir, encoded)
+		}
+		if decoded := geom.NormalMapping(n, encoded); !(decoded.Sub(n).Len() <= 1e-6) {
+			t.Errorf("normal %v: decoded the neutral normal as %v", n, decoded)
+		}
+	}
+}
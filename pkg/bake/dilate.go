@@ -0,0 +1,67 @@
+package bake
+
+import (
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+)
+
+// Mask returns which texels of a texture of the specified size are covered by
+// the texels.
+func Mask(texels []Texel, width, height int) []bool {
+	mask := make([]bool, width*height)
+	for _, t := range texels {
+		mask[t.Y*width+t.X] = true
+	}
+	return mask
+}
+
+// Dilate grows the covered texels of the mask into the uncovered texels by the
+// specified number of texels. Each uncovered texel next to covered texels is
+// set to the average of its covered neighbors, which prevents seams when the
+// texture is filtered or mipmapped. The mask is updated to include the filled
+// texels.
+func Dilate(img *image2d.Image2D, mask []bool, padding int) {
+	width, height := img.GetWidth(), img.GetHeight()
+	channels := img.GetChannels()
+
+	for i := 0; i < padding; i++ {
+		var filled []int
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				if mask[y*width+x] {
+					continue
+				}
+
+				// average the covered neighbors of the last iteration
+				sum := make([]float32, channels)
+				count := 0
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						nx, ny := x+dx, y+dy
+						if nx < 0 || nx >= width || ny < 0 || ny >= height || !mask[ny*width+nx] {
+							continue
+						}
+						for c := 0; c < channels; c++ {
+							sum[c] += img.GetFloat32(nx, ny, c)
+						}
+						count++
+					}
+				}
+				if count == 0 {
+					continue
+				}
+
+				for c := 0; c < channels; c++ {
+					img.SetFloat32(x, y, c, sum[c]/float32(count))
+				}
+				filled = append(filled, y*width+x)
+			}
+		}
+
+		if len(filled) == 0 {
+			break
+		}
+		for _, idx := range filled {
+			mask[idx] = true
+		}
+	}
+}
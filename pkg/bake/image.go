@@ -0,0 +1,22 @@
+package bake
+
+import (
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+)
+
+// ToLDR converts the float image to an 8 bit image with the same number of
+// channels that can be saved as png. Values are clamped to [0,1].
+func ToLDR(img *image2d.Image2D) (image2d.Image2D, error) {
+	ldr, err := image2d.Make(img.GetWidth(), img.GetHeight(), img.GetChannels())
+	if err != nil {
+		return image2d.Image2D{}, err
+	}
+	for y := 0; y < img.GetHeight(); y++ {
+		for x := 0; x < img.GetWidth(); x++ {
+			for c := 0; c < img.GetChannels(); c++ {
+				ldr.SetFloat32(x, y, c, img.GetFloat32(x, y, c))
+			}
+		}
+	}
+	return ldr, nil
+}
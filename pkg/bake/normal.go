@@ -0,0 +1,110 @@
+package bake
+
+import (
+	"github.com/adrianderstroff/pbr/pkg/bvh"
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// NormalOptions of the high to low poly baker. Cage is the distance the cage
+// is offset from the low poly surface along its normals. The rays start on
+// the cage and search the high poly surface up to the same distance below
+// the low poly surface. Padding is the number of texels the baked texels are
+// dilated by.
+type NormalOptions struct {
+	Cage    float32
+	Padding int
+}
+
+// NormalMaps are the results of BakeNormals. Normal holds the normals of the
+// high poly surface in the tangent space of NormalMapping of normal.glsl
+// around the low poly normals. Height holds the distance of the high poly
+// surface above the low poly surface, which is negative below it. Curvature
+// holds the mean curvature of the high poly surface, which is positive for
+// convex and negative for concave regions. Normal has three channels, the
+// others one.
+type NormalMaps struct {
+	Normal    image2d.Image2D
+	Height    image2d.Image2D
+	Curvature image2d.Image2D
+}
+
+// BakeNormals transfers the details of the high poly surface onto the texture
+// of the low poly surface. For each texel of the low poly surface a ray is
+// cast from the cage along the negated low poly normal and the first hit with
+// the high poly surface is used. Texels whose ray misses the high poly surface
+// get the low poly normal and a height of 0.
+func BakeNormals(low, high *Surface, hierarchy *bvh.BVH, width, height int, options NormalOptions) (NormalMaps, error) {
+	var maps NormalMaps
+	var err error
+	if maps.Normal, err = image2d.MakeFloat32(width, height, 3); err != nil {
+		return NormalMaps{}, err
+	}
+	if maps.Height, err = image2d.MakeFloat32(width, height, 1); err != nil {
+		return NormalMaps{}, err
+	}
+	if maps.Curvature, err = image2d.MakeFloat32(width, height, 1); err != nil {
+		return NormalMaps{}, err
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			setVec3(&maps.Normal, x, y, mgl32.Vec3{0.5, 0.5, 1})
+		}
+	}
+
+	// world space position and normal of the high poly surface of each texel
+	// for estimating the curvature
+	positions := make([]mgl32.Vec3, width*height)
+	normals := make([]mgl32.Vec3, width*height)
+	found := make([]bool, width*height)
+
+	texels := low.Rasterize(width, height)
+	forEachTexel(texels, func(t *Texel) {
+		origin := t.Position.Add(t.Normal.Mul(options.Cage))
+		ray := geom.Ray{Origin: origin, Direction: t.Normal.Mul(-1)}
+		hit, index, ok := hierarchy.ClosestHit(&ray, 0, 2*options.Cage)
+		if !ok {
+			return
+		}
+
+		n := high.Normal(index, hit.Barycentric)
+		setVec3(&maps.Normal, t.X, t.Y, EncodeNormal(t.Normal, n))
+		maps.Height.SetFloat32(t.X, t.Y, 0, options.Cage-hit.T)
+
+		idx := t.Y*width + t.X
+		positions[idx], normals[idx], found[idx] = hit.P, n, true
+	})
+
+	// the mean curvature is estimated from the change of the normals between
+	// neighboring texels relative to their distance
+	forEachTexel(texels, func(t *Texel) {
+		idx := t.Y*width + t.X
+		if !found[idx] {
+			return
+		}
+
+		var sum float32
+		count := 0
+		offsets := [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+		for _, o := range offsets {
+			x, y := t.X+o[0], t.Y+o[1]
+			if x < 0 || x >= width || y < 0 || y >= height || !found[y*width+x] {
+				continue
+			}
+			dp := positions[y*width+x].Sub(positions[idx])
+			if d2 := dp.Dot(dp); d2 > 0 {
+				sum += normals[y*width+x].Sub(normals[idx]).Dot(dp) / d2
+				count++
+			}
+		}
+		if count > 0 {
+			maps.Curvature.SetFloat32(t.X, t.Y, 0, sum/float32(count))
+		}
+	})
+
+	Dilate(&maps.Normal, Mask(texels, width, height), options.Padding)
+	Dilate(&maps.Height, Mask(texels, width, height), options.Padding)
+	Dilate(&maps.Curvature, Mask(texels, width, height), options.Padding)
+	return maps, nil
+}
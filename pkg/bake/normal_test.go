@@ -0,0 +1,117 @@
+package bake
+
+import (
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	NORMAL_SIZE      = 16
+	NORMAL_CAGE      = 0.1
+	NORMAL_TOLERANCE = 1e-4
+)
+
+// a flat high poly surface slightly above the flat low poly surface only
+// changes the height, thus every texel gets the neutral normal
+func TestBakeNormalsFlat(t *testing.T) {
+	low := makeLowQuad()
+	high := makeHighQuad(func(p mgl32.Vec2) float32 { return 0.02 })
+	hierarchy := high.BVH()
+
+	maps, err := BakeNormals(&low, &high, &hierarchy, NORMAL_SIZE, NORMAL_SIZE, NormalOptions{Cage: NORMAL_CAGE, Padding: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < NORMAL_SIZE; y++ {
+		for x := 0; x < NORMAL_SIZE; x++ {
+			n := getVec3(&maps.Normal, x, y)
+			if !(n.Sub(mgl32.Vec3{0.5, 0.5, 1}).Len() <= NORMAL_TOLERANCE) {
+				t.Fatalf("texel (%v,%v): expected the normal (0.5,0.5,1), got %v", x, y, n)
+			}
+			if h := maps.Height.GetFloat32(x, y, 0); !(cgm.Abs32(h-0.02) <= NORMAL_TOLERANCE) {
+				t.Fatalf("texel (%v,%v): expected a height of 0.02, got %v", x, y, h)
+			}
+			if c := maps.Curvature.GetFloat32(x, y, 0); !(cgm.Abs32(c) <= NORMAL_TOLERANCE) {
+				t.Fatalf("texel (%v,%v): expected no curvature, got %v", x, y, c)
+			}
+		}
+	}
+}
+
+// the normal of a tilted high poly surface is recovered by NormalMapping
+// from the baked normal map
+func TestBakeNormalsTilted(t *testing.T) {
+	low := makeLowQuad()
+	high := makeHighQuad(func(p mgl32.Vec2) float32 { return 0.1 * (p.X() - 0.5) })
+	hierarchy := high.BVH()
+
+	maps, err := BakeNormals(&low, &high, &hierarchy, NORMAL_SIZE, NORMAL_SIZE, NormalOptions{Cage: NORMAL_CAGE, Padding: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := mgl32.Vec3{-0.1, 0, 1}.Normalize()
+	for y := 0; y < NORMAL_SIZE; y++ {
+		for x := 0; x < NORMAL_SIZE; x++ {
+			n := geom.NormalMapping(mgl32.Vec3{0, 0, 1}, getVec3(&maps.Normal, x, y))
+			if !(n.Sub(expected).Len() <= NORMAL_TOLERANCE) {
+				t.Fatalf("texel (%v,%v): expected the normal %v, got %v", x, y, expected, n)
+			}
+		}
+	}
+}
+
+// makeLowQuad returns the unit square in the xy-plane facing z whose texture
+// coordinates are its xy-coordinates.
+func makeLowQuad() Surface {
+	corners := []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}}
+	triangles := []geom.Triangle{
+		makeUVTriangle(corners[0], corners[1], corners[2]),
+		makeUVTriangle(corners[0], corners[2], corners[3]),
+	}
+	normals := make([]mgl32.Vec3, 3*len(triangles))
+	for i := range normals {
+		normals[i] = mgl32.Vec3{0, 0, 1}
+	}
+	return Surface{Triangles: triangles, Normals: normals}
+}
+
+// makeHighQuad returns a tessellated plane over [-0.5,1.5]^2 with the height
+// z(x,y), which has to be linear, and the normals of its triangles.
+func makeHighQuad(z func(p mgl32.Vec2) float32) Surface {
+	const cells = 4
+	vertex := func(i, j int) mgl32.Vec3 {
+		p := mgl32.Vec2{-0.5 + 2*float32(i)/cells, -0.5 + 2*float32(j)/cells}
+		return mgl32.Vec3{p.X(), p.Y(), z(p)}
+	}
+
+	var surface Surface
+	for j := 0; j < cells; j++ {
+		for i := 0; i < cells; i++ {
+			a, b, c, d := vertex(i, j), vertex(i+1, j), vertex(i+1, j+1), vertex(i, j+1)
+			for _, tri := range []geom.Triangle{makeUVTriangle(a, b, c), makeUVTriangle(a, c, d)} {
+				surface.Triangles = append(surface.Triangles, tri)
+				n := tri.Normal()
+				surface.Normals = append(surface.Normals, n, n, n)
+			}
+		}
+	}
+	return surface
+}
+
+// makeUVTriangle creates a triangle whose texture coordinates are the
+// xy-coordinates of its vertices.
+func makeUVTriangle(v0, v1, v2 mgl32.Vec3) geom.Triangle {
+	return geom.Triangle{
+		V0: v0, V1: v1, V2: v2,
+		UV0: v0.Vec2(), UV1: v1.Vec2(), UV2: v2.Vec2(),
+	}
+}
+
+// getVec3 returns the first three channels of the texel (x,y).
+func getVec3(img *image2d.Image2D, x, y int) mgl32.Vec3 {
+	return mgl32.Vec3{img.GetFloat32(x, y, 0), img.GetFloat32(x, y, 1), img.GetFloat32(x, y, 2)}
+}
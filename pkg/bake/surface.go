@@ -0,0 +1,200 @@
+// Package bake provides CPU texture bakers that sample the surface of a mesh
+// in texture space. The triangles are rasterized in uv space, such that each
+// covered texel knows its position and normal on the surface, which are then
+// used to cast rays against the mesh. Texels that aren't covered by any
+// triangle are filled by dilating the covered texels to prevent seams when
+// the textures are filtered.
+package bake
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adrianderstroff/pbr/pkg/bvh"
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/adrianderstroff/pbr/pkg/view/mesh"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Surface is a triangle soup with texture coordinates and the three vertex
+// normals of each triangle.
+type Surface struct {
+	Triangles []geom.Triangle
+	Normals   []mgl32.Vec3
+}
+
+// Texel is a texel of the texture that is covered by the triangle with the
+// index Triangle. Position and Normal are the interpolated position and normal
+// at the texel center, Ng is the geometric normal facing the same side.
+type Texel struct {
+	X, Y     int
+	Triangle int
+	Position mgl32.Vec3
+	Normal   mgl32.Vec3
+	Ng       mgl32.Vec3
+}
+
+// MakeSurface extracts the triangles of the geometry, which needs a pos and an
+// uv vertex attribute like the meshes of obj.LoadGeometry. If it has no normal
+// attribute the normals of the triangles are used.
+func MakeSurface(geometry *mesh.Geometry) (Surface, error) {
+	return MakeSurfaceWithUV(geometry, "uv")
+}
+
+// MakeSurfaceWithUV extracts the triangles of the geometry like MakeSurface
+// but takes the texture coordinates from the vertex attribute with the
+// specified id, e.g. the ones created by unwrap.Unwrap.
+func MakeSurfaceWithUV(geometry *mesh.Geometry, uv string) (Surface, error) {
+	uvs, _, err := geometry.Attribute(uv)
+	if err != nil {
+		return Surface{}, errors.New("baking needs texture coordinates")
+	}
+	triangles, err := bvh.TrianglesFromGeometry(geometry)
+	if err != nil {
+		return Surface{}, err
+	}
+	if len(uvs) != 6*len(triangles) {
+		return Surface{}, fmt.Errorf("vertex attribute %v doesn't match the triangles", uv)
+	}
+	for i := range triangles {
+		tri := &triangles[i]
+		tri.UV0 = mgl32.Vec2{uvs[6*i], uvs[6*i+1]}
+		tri.UV1 = mgl32.Vec2{uvs[6*i+2], uvs[6*i+3]}
+		tri.UV2 = mgl32.Vec2{uvs[6*i+4], uvs[6*i+5]}
+	}
+
+	normals := make([]mgl32.Vec3, 3*len(triangles))
+	data, _, err := geometry.Attribute("normal")
+	hasnormals := err == nil && len(data)/3 == len(normals)
+	for i := range normals {
+		if hasnormals {
+			normals[i] = mgl32.Vec3{data[3*i], data[3*i+1], data[3*i+2]}
+		}
+		if normals[i].Len() == 0 {
+			normals[i] = triangles[i/3].Normal()
+		} else {
+			normals[i] = normals[i].Normalize()
+		}
+	}
+
+	return Surface{
+		Triangles: triangles,
+		Normals:   normals,
+	}, nil
+}
+
+// BVH builds the hierarchy over the triangles of the surface.
+func (surface *Surface) BVH() bvh.BVH {
+	return bvh.Make(surface.Triangles)
+}
+
+// Bounds returns the bounding box of all triangles.
+func (surface *Surface) Bounds() geom.AABB {
+	bounds := geom.MakeEmptyAABB()
+	for i := range surface.Triangles {
+		b := surface.Triangles[i].Bounds()
+		bounds.Union(&b)
+	}
+	return bounds
+}
+
+// Rasterize returns all texels of a texture of the specified size whose
+// centers are covered by a triangle in uv space. Images are uploaded upside
+// down by the texture package, thus v = 0 is the last row of the texture. If
+// triangles overlap in uv space the texel belongs to the last one.
+func (surface *Surface) Rasterize(width, height int) []Texel {
+	owner := make([]int, width*height)
+	for i := range owner {
+		owner[i] = -1
+	}
+	texels := make([]Texel, width*height)
+
+	w, h := float32(width), float32(height)
+	for index := range surface.Triangles {
+		tri := &surface.Triangles[index]
+		p0 := mgl32.Vec2{tri.UV0.X() * w, (1 - tri.UV0.Y()) * h}
+		p1 := mgl32.Vec2{tri.UV1.X() * w, (1 - tri.UV1.Y()) * h}
+		p2 := mgl32.Vec2{tri.UV2.X() * w, (1 - tri.UV2.Y()) * h}
+
+		// skip triangles that are degenerated in uv space
+		area := edge(p0, p1, p2)
+		if area == 0 {
+			continue
+		}
+
+		// texels within the bounding box of the triangle
+		x0, x1 := texelRange(p0.X(), p1.X(), p2.X(), width)
+		y0, y1 := texelRange(p0.Y(), p1.Y(), p2.Y(), height)
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				p := mgl32.Vec2{float32(x) + 0.5, float32(y) + 0.5}
+				b := mgl32.Vec3{edge(p1, p2, p) / area, edge(p2, p0, p) / area, edge(p0, p1, p) / area}
+				if b.X() < 0 || b.Y() < 0 || b.Z() < 0 {
+					continue
+				}
+
+				owner[y*width+x] = index
+				texels[y*width+x] = surface.makeTexel(x, y, index, b)
+			}
+		}
+	}
+
+	// keep the covered texels in row order
+	covered := make([]Texel, 0, len(texels))
+	for i, o := range owner {
+		if o >= 0 {
+			covered = append(covered, texels[i])
+		}
+	}
+	return covered
+}
+
+// makeTexel interpolates the position and the normal of the triangle with the
+// specified index at the barycentric coordinates b.
+func (surface *Surface) makeTexel(x, y, index int, b mgl32.Vec3) Texel {
+	tri := &surface.Triangles[index]
+	position := tri.V0.Mul(b.X()).Add(tri.V1.Mul(b.Y())).Add(tri.V2.Mul(b.Z()))
+
+	ng := tri.Normal()
+	n := surface.Normal(index, b)
+
+	// let the geometric normal face the same side as the vertex normals
+	if ng.Dot(n) < 0 {
+		ng = ng.Mul(-1)
+	}
+
+	return Texel{
+		X:        x,
+		Y:        y,
+		Triangle: index,
+		Position: position,
+		Normal:   n,
+		Ng:       ng,
+	}
+}
+
+// Normal returns the normalized vertex normal of the triangle with the
+// specified index interpolated at the barycentric coordinates b.
+func (surface *Surface) Normal(index int, b mgl32.Vec3) mgl32.Vec3 {
+	n := surface.Normals[3*index].Mul(b.X()).
+		Add(surface.Normals[3*index+1].Mul(b.Y())).
+		Add(surface.Normals[3*index+2].Mul(b.Z()))
+	if n.Len() == 0 {
+		return surface.Triangles[index].Normal()
+	}
+	return n.Normalize()
+}
+
+// edge returns twice the signed area of the triangle (a,b,c).
+func edge(a, b, c mgl32.Vec2) float32 {
+	return (b.X()-a.X())*(c.Y()-a.Y()) - (b.Y()-a.Y())*(c.X()-a.X())
+}
+
+// texelRange returns the range of texels whose centers lie between the
+// smallest and the largest of the three coordinates, clamped to the texture.
+func texelRange(a, b, c float32, size int) (int, int) {
+	lo := cgm.Min32(a, cgm.Min32(b, c))
+	hi := cgm.Max32(a, cgm.Max32(b, c))
+	return int(cgm.Clamp(lo-0.5, 0, float32(size-1))), int(cgm.Clamp(hi+0.5, 0, float32(size-1)))
+}
@@ -0,0 +1,110 @@
+// Package brdf is a Go port of the Cook-Torrance BRDF used by the shaders in
+// assets/shaders/pbr. The functions mirror their GLSL counterparts in
+// shared/brdf.glsl, test/direct.frag and test/ibl.frag exactly, including the
+// epsilon of 0.01 that clamps the denominator of the specular brdf, so that
+// they can serve as a reference when validating changes to the shaders. The
+// tests of this package check the normalization, reciprocity and energy
+// conservation of the brdf numerically.
+package brdf
+
+import (
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// NormalDistributionGGX uses trowbridge-reitz ggx normal distribution function
+// which approximates the relative surface area of microfacets, that are exactly
+// aligned with the halfway vector h. The parameter a specifies the roughness of
+// the surface. Typically a is simply roughness^2.
+func NormalDistributionGGX(n, h mgl32.Vec3, a float32) float32 {
+	angle := cgm.Max32(n.Dot(h), 0)
+	a2 := a * a
+	d := (angle*angle)*(a2-1) + 1
+
+	return a2 / (math.Pi * d * d)
+}
+
+// GeometrySchlickGGX is the schlick approximation of the smith equation. given
+// the surface normal n and a vector v as well as the roughness parameter k, the
+// function approximates how much light can travel in direction v. here k is
+// (roughness+1)^2/8 when doing direct lighting.
+func GeometrySchlickGGX(v, n mgl32.Vec3, k float32) float32 {
+	nDotv := cgm.Max32(n.Dot(v), 0)
+	return nDotv / (nDotv*(1.0-k) + k)
+}
+
+// GeometrySmith specifies the geometric shadowing of the microfacets based on
+// the view, light and surface normal as well as the roughness of the surface.
+// here k is (roughness+1)^2/8 when doing direct lighting.
+func GeometrySmith(l, v, n mgl32.Vec3, k float32) float32 {
+	ggx1 := GeometrySchlickGGX(l, n, k)
+	ggx2 := GeometrySchlickGGX(v, n, k)
+
+	return ggx1 * ggx2
+}
+
+// FresnelSchlick specifies the reflection of light on a smooth surface. at a
+// grazing angle all materials become perfect mirrors. f0 is the base
+// reflectivity of the material, which is low for dielectrics (non-metals) and
+// usually high for metals.
+func FresnelSchlick(v, n, f0 mgl32.Vec3) mgl32.Vec3 {
+	vdotn := cgm.Max32(v.Dot(n), 0)
+	fc := float32(math.Pow(float64(1-vdotn), 5))
+	return f0.Add(mgl32.Vec3{1, 1, 1}.Sub(f0).Mul(fc))
+}
+
+// FresnelSchlickRoughness is the variant of FresnelSchlick that takes the
+// roughness into account, which is used for image based lighting. In the
+// shaders it is an overload of FresnelSchlick.
+func FresnelSchlickRoughness(v, n, f0 mgl32.Vec3, roughness float32) mgl32.Vec3 {
+	vdotn := cgm.Max32(v.Dot(n), 0)
+	fc := float32(math.Pow(float64(1-vdotn), 5))
+	fmax := mgl32.Vec3{
+		cgm.Max32(1-roughness, f0.X()),
+		cgm.Max32(1-roughness, f0.Y()),
+		cgm.Max32(1-roughness, f0.Z()),
+	}
+	return f0.Add(fmax.Sub(f0).Mul(fc))
+}
+
+// KDirect remaps the perceptual roughness to the parameter k of
+// GeometrySchlickGGX for direct lighting like test/direct.frag does.
+func KDirect(roughness float32) float32 {
+	return ((roughness + 1) * (roughness + 1)) / 8.0
+}
+
+// KIBL remaps the roughness parameter a to the parameter k of
+// GeometrySchlickGGX for image based lighting like ibl/pbr.glsl and
+// test/ibl.frag do. ibl/pbr.glsl passes a = roughness^2 while test/ibl.frag
+// passes the roughness itself.
+func KIBL(a float32) float32 {
+	return (a * a) / 2.0
+}
+
+// F0 returns the base reflectivity of a material. Dielectrics use a constant
+// reflectivity of 0.04 while metals use their albedo.
+func F0(albedo mgl32.Vec3, metallic float32) mgl32.Vec3 {
+	dielectric := mgl32.Vec3{0.04, 0.04, 0.04}
+	return dielectric.Mul(1 - metallic).Add(albedo.Mul(metallic))
+}
+
+// Specular evaluates the specular Cook-Torrance BRDF for the light direction l
+// and view direction v with the normal n. a is roughness^2 and k is the
+// remapped roughness of the geometry term.
+func Specular(l, v, n, f0 mgl32.Vec3, a, k float32) mgl32.Vec3 {
+	h := l.Add(v).Normalize()
+
+	// calculate brdf
+	d := NormalDistributionGGX(n, h, a)
+	g := GeometrySmith(l, v, n, k)
+	f := FresnelSchlick(v, n, f0)
+
+	// calculate normalization
+	ndotl := cgm.Max32(n.Dot(l), 0)
+	ndotv := cgm.Max32(n.Dot(v), 0)
+	denom := cgm.Max32(4*ndotl*ndotv, 0.01)
+
+	return f.Mul(d * g / denom)
+}
@@ -0,0 +1,225 @@
+package brdf
+
+import (
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// minimal roughness of the fit to keep the specular peak finite
+const minFitRoughness float32 = 0.02
+
+// FitSample is a single measurement of a brdf for the light direction L and
+// the view direction V in the local frame with the normal along the z axis.
+type FitSample struct {
+	L     mgl32.Vec3
+	V     mgl32.Vec3
+	Value mgl32.Vec3
+}
+
+// FitParameters are the parameters of the brdf of test/direct.frag. F0 is the
+// reflectivity of the dielectric part, which is fixed to 0.04 in the shaders.
+type FitParameters struct {
+	Albedo    mgl32.Vec3
+	Metallic  float32
+	Roughness float32
+	F0        float32
+}
+
+// SpecularF0 returns the base reflectivity blended between the dielectric F0
+// and the albedo by the metalness.
+func (params *FitParameters) SpecularF0() mgl32.Vec3 {
+	f0 := mgl32.Vec3{params.F0, params.F0, params.F0}
+	return f0.Mul(1 - params.Metallic).Add(params.Albedo.Mul(params.Metallic))
+}
+
+// Evaluate returns the brdf for the light direction l and the view direction
+// v in the local frame with the normal along the z axis.
+func (params *FitParameters) Evaluate(l, v mgl32.Vec3) mgl32.Vec3 {
+	n := mgl32.Vec3{0, 0, 1}
+	if l.Z() <= 0 || v.Z() <= 0 {
+		return mgl32.Vec3{0, 0, 0}
+	}
+
+	a := params.Roughness * params.Roughness
+	specular := Specular(l, v, n, params.SpecularF0(), a, KDirect(params.Roughness))
+
+	F := FresnelSchlick(v, n, params.SpecularF0())
+	kD := mgl32.Vec3{1, 1, 1}.Sub(F).Mul(1 - params.Metallic)
+	diffuse := params.Albedo.Mul((1 - params.Metallic) / math.Pi)
+
+	return specular.Add(mgl32.Vec3{kD.X() * diffuse.X(), kD.Y() * diffuse.Y(), kD.Z() * diffuse.Z()})
+}
+
+// FitError returns the root mean square error between the brdf with the
+// specified parameters and the samples. As measured brdfs span several orders
+// of magnitude the error is calculated on the cosine weighted values
+// compressed by log(1 + x), which keeps the specular peak from dominating.
+func FitError(params FitParameters, samples []FitSample) float32 {
+	if len(samples) == 0 {
+		return 0
+	}
+
+	workers := runtime.NumCPU()
+	sums := make([]float64, workers)
+	chunk := (len(samples) + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			end := cgm.Mini((w+1)*chunk, len(samples))
+			for i := w * chunk; i < end; i++ {
+				s := &samples[i]
+				model := params.Evaluate(s.L, s.V)
+				for c := 0; c < 3; c++ {
+					r := compress(model[c]*s.L.Z()) - compress(s.Value[c]*s.L.Z())
+					sums[w] += r * r
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	var sum float64
+	for _, s := range sums {
+		sum += s
+	}
+	return float32(math.Sqrt(sum / float64(3*len(samples))))
+}
+
+// Fit finds the parameters that minimize FitError for the samples using the
+// Nelder-Mead method. To not get stuck in a local minimum the search is
+// started from several dielectric and metallic initial guesses with the
+// specified number of iterations each, and the best result is refined by
+// another search. It returns the best parameters along with their error.
+func Fit(samples []FitSample, iterations int) (FitParameters, float32) {
+	starts := []FitParameters{}
+	for _, metallic := range []float32{0, 1} {
+		for _, roughness := range []float32{0.1, 0.3, 0.6} {
+			starts = append(starts, FitParameters{
+				Albedo:    mgl32.Vec3{0.5, 0.5, 0.5},
+				Metallic:  metallic,
+				Roughness: roughness,
+				F0:        0.04,
+			})
+		}
+	}
+
+	cost := func(x []float32) float32 {
+		return FitError(paramsFromVector(x), samples)
+	}
+
+	var best []float32
+	bestErr := float32(math.Inf(1))
+	for _, start := range starts {
+		x, err := nelderMead(cost, paramsToVector(start), 0.1, iterations)
+		if err < bestErr {
+			best, bestErr = x, err
+		}
+	}
+
+	// the simplex collapses along the valley between the albedo and the
+	// reflectivity, thus the search is restarted from the best vertex
+	best, bestErr = nelderMead(cost, best, 0.02, iterations)
+
+	return paramsFromVector(best), bestErr
+}
+
+// paramsToVector flattens the parameters for the optimizer.
+func paramsToVector(params FitParameters) []float32 {
+	return []float32{
+		params.Albedo.X(), params.Albedo.Y(), params.Albedo.Z(),
+		params.Metallic, params.Roughness, params.F0,
+	}
+}
+
+// paramsFromVector creates the parameters from the vector of the optimizer
+// and clamps them to their valid ranges.
+func paramsFromVector(x []float32) FitParameters {
+	return FitParameters{
+		Albedo:    mgl32.Vec3{cgm.Clamp(x[0], 0, 1), cgm.Clamp(x[1], 0, 1), cgm.Clamp(x[2], 0, 1)},
+		Metallic:  cgm.Clamp(x[3], 0, 1),
+		Roughness: cgm.Clamp(x[4], minFitRoughness, 1),
+		F0:        cgm.Clamp(x[5], 0, 1),
+	}
+}
+
+// nelderMead minimizes the cost function starting at x0 with a simplex of
+// the specified size. It returns the best vertex and its cost.
+func nelderMead(cost func([]float32) float32, x0 []float32, size float32, iterations int) ([]float32, float32) {
+	type vertex struct {
+		x    []float32
+		cost float32
+	}
+	dim := len(x0)
+
+	// initial simplex along the coordinate axes
+	simplex := make([]vertex, dim+1)
+	simplex[0] = vertex{x0, cost(x0)}
+	for i := 0; i < dim; i++ {
+		x := append([]float32{}, x0...)
+		x[i] += size
+		simplex[i+1] = vertex{x, cost(x)}
+	}
+
+	// point on the line between the centroid c and the worst vertex w
+	along := func(c, w []float32, t float32) []float32 {
+		x := make([]float32, dim)
+		for i := range x {
+			x[i] = c[i] + t*(w[i]-c[i])
+		}
+		return x
+	}
+
+	for it := 0; it < iterations; it++ {
+		sort.Slice(simplex, func(i, j int) bool { return simplex[i].cost < simplex[j].cost })
+
+		// centroid of all but the worst vertex
+		centroid := make([]float32, dim)
+		for _, v := range simplex[:dim] {
+			for i := range centroid {
+				centroid[i] += v.x[i] / float32(dim)
+			}
+		}
+		worst := simplex[dim]
+
+		reflected := along(centroid, worst.x, -1)
+		rcost := cost(reflected)
+		switch {
+		case rcost < simplex[0].cost:
+			expanded := along(centroid, worst.x, -2)
+			if ecost := cost(expanded); ecost < rcost {
+				simplex[dim] = vertex{expanded, ecost}
+			} else {
+				simplex[dim] = vertex{reflected, rcost}
+			}
+		case rcost < simplex[dim-1].cost:
+			simplex[dim] = vertex{reflected, rcost}
+		default:
+			contracted := along(centroid, worst.x, 0.5)
+			if ccost := cost(contracted); ccost < worst.cost {
+				simplex[dim] = vertex{contracted, ccost}
+				continue
+			}
+
+			// shrink towards the best vertex
+			for v := 1; v <= dim; v++ {
+				simplex[v].x = along(simplex[0].x, simplex[v].x, 0.5)
+				simplex[v].cost = cost(simplex[v].x)
+			}
+		}
+	}
+
+	sort.Slice(simplex, func(i, j int) bool { return simplex[i].cost < simplex[j].cost })
+	return simplex[0].x, simplex[0].cost
+}
+
+func compress(x float32) float64 {
+	return math.Log1p(math.Max(float64(x), 0))
+}
@@ -0,0 +1,70 @@
+package brdf
+
+import (
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/io/merl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	FIT_ITERATIONS      int     = 200
+	FIT_THETA_H_STRIDE  int     = 2
+	FIT_THETA_D_STRIDE  int     = 10
+	FIT_PHI_D_STRIDE    int     = 30
+	FIT_ERROR_BOUND     float32 = 1e-3
+	PARAMETER_TOLERANCE float32 = 2e-2
+)
+
+// the fit recovers the parameters of a dielectric and a metal from samples
+// that are generated by Evaluate at the cells of a merl table
+func TestFit(t *testing.T) {
+	cases := []struct {
+		name   string
+		params FitParameters
+	}{
+		{"dielectric", FitParameters{Albedo: mgl32.Vec3{0.8, 0.3, 0.1}, Metallic: 0, Roughness: 0.4, F0: 0.04}},
+		{"metal", FitParameters{Albedo: mgl32.Vec3{1, 0.78, 0.34}, Metallic: 1, Roughness: 0.25, F0: 0.04}},
+	}
+	for _, c := range cases {
+		samples := makeFitSamples(&c.params)
+		fitted, err := Fit(samples, FIT_ITERATIONS)
+		if err > FIT_ERROR_BOUND {
+			t.Errorf("%v: expected an error below %v, got %v", c.name, FIT_ERROR_BOUND, err)
+		}
+
+		if cgm.Abs32(fitted.Roughness-c.params.Roughness) > PARAMETER_TOLERANCE {
+			t.Errorf("%v: expected a roughness of %v, got %v", c.name, c.params.Roughness, fitted.Roughness)
+		}
+		if cgm.Abs32(fitted.Metallic-c.params.Metallic) > PARAMETER_TOLERANCE {
+			t.Errorf("%v: expected a metalness of %v, got %v", c.name, c.params.Metallic, fitted.Metallic)
+		}
+		if fitted.Albedo.Sub(c.params.Albedo).Len() > PARAMETER_TOLERANCE {
+			t.Errorf("%v: expected an albedo of %v, got %v", c.name, c.params.Albedo, fitted.Albedo)
+		}
+		// the dielectric reflectivity only matters for dielectrics
+		if c.params.Metallic == 0 && cgm.Abs32(fitted.F0-c.params.F0) > PARAMETER_TOLERANCE {
+			t.Errorf("%v: expected a reflectivity of %v, got %v", c.name, c.params.F0, fitted.F0)
+		}
+	}
+}
+
+// makeFitSamples evaluates the brdf at the directions of the subsampled cells
+// of a merl table like cmd/merlfit does for measured brdfs.
+func makeFitSamples(params *FitParameters) []FitSample {
+	samples := []FitSample{}
+	for th := 0; th < merl.THETA_H_RES; th += FIT_THETA_H_STRIDE {
+		for td := 0; td < merl.THETA_D_RES; td += FIT_THETA_D_STRIDE {
+			for pd := 0; pd < merl.PHI_D_RES; pd += FIT_PHI_D_STRIDE {
+				thetaH, thetaD, phiD := merl.CellAngles(th, td, pd)
+				l, v := merl.StdCoords(thetaH, 0, thetaD, phiD)
+				if l.Z() <= 0 || v.Z() <= 0 {
+					continue
+				}
+				samples = append(samples, FitSample{L: l, V: v, Value: params.Evaluate(l, v)})
+			}
+		}
+	}
+	return samples
+}
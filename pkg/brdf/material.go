@@ -0,0 +1,276 @@
+package brdf
+
+import (
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Material mirrors PbrMaterial of test/direct.frag including the principled
+// extensions. A value of 0 for Clearcoat, SheenColor, Anisotropy or
+// Transmission disables the corresponding lobe.
+type Material struct {
+	Albedo    mgl32.Vec3
+	Metallic  float32
+	Roughness float32
+	// clear coat layer on top of the base layer
+	Clearcoat          float32
+	ClearcoatRoughness float32
+	// sheen for cloth like materials
+	SheenColor     mgl32.Vec3
+	SheenRoughness float32
+	// anisotropy in [-1,1] and rotation of the tangent in radians
+	Anisotropy         float32
+	AnisotropyRotation float32
+	// thin-walled transmission with the index of refraction IOR
+	Transmission float32
+	IOR          float32
+}
+
+// MakeMaterial creates a material without any of the extensions.
+func MakeMaterial(albedo mgl32.Vec3, metallic, roughness float32) Material {
+	return Material{
+		Albedo:             albedo,
+		Metallic:           metallic,
+		Roughness:          roughness,
+		ClearcoatRoughness: 0.1,
+		SheenRoughness:     0.5,
+		IOR:                1.5,
+	}
+}
+
+// F0 returns the base reflectivity of the material. Transmissive dielectrics
+// use the reflectivity of their index of refraction.
+func (mat *Material) F0() mgl32.Vec3 {
+	if mat.Transmission > 0 {
+		f0 := IorToF0(mat.IOR)
+		return mgl32.Vec3{f0, f0, f0}.Mul(1 - mat.Metallic).Add(mat.Albedo.Mul(mat.Metallic))
+	}
+	return F0(mat.Albedo, mat.Metallic)
+}
+
+// Evaluate returns the value of the BSDF for the light direction l and view
+// direction v with the normal n. Light from behind the surface is only
+// transmitted.
+func (mat *Material) Evaluate(l, v, n mgl32.Vec3) mgl32.Vec3 {
+	if n.Dot(l) >= 0 {
+		return mat.Brdf(l, v, n)
+	}
+	return mat.Btdf(l, v, n)
+}
+
+// Brdf mirrors Brdf of test/direct.frag with the default microfacet model.
+func (mat *Material) Brdf(l, v, n mgl32.Vec3) mgl32.Vec3 {
+	a := mat.Roughness * mat.Roughness
+	k := KDirect(mat.Roughness)
+	f0 := mat.F0()
+	h := l.Add(v).Normalize()
+
+	F := FresnelSchlick(v, n, f0)
+	kD := mgl32.Vec3{1, 1, 1}.Sub(F).Mul(1 - mat.Metallic)
+	diffuseColor := mat.Albedo.Mul((1 - mat.Metallic) / math.Pi)
+
+	// single scattering specular lobe
+	var specularColor mgl32.Vec3
+	if mat.Anisotropy != 0 {
+		specularColor = F.Mul(AnisotropicSpecular(l, v, n, a, mat.Anisotropy, mat.AnisotropyRotation))
+	} else {
+		d := NormalDistributionGGX(n, h, a)
+		g := GeometrySmith(l, v, n, k)
+		ndotl := cgm.Max32(n.Dot(l), 0)
+		ndotv := cgm.Max32(n.Dot(v), 0)
+		denom := cgm.Max32(4*ndotl*ndotv, 0.01)
+		specularColor = F.Mul(d * g / denom)
+	}
+
+	// the transmitted light isn't diffusely reflected
+	diffuseColor = diffuseColor.Mul(1 - mat.Transmission)
+
+	color := specularColor.Add(mgl32.Vec3{
+		kD.X() * diffuseColor.X(),
+		kD.Y() * diffuseColor.Y(),
+		kD.Z() * diffuseColor.Z(),
+	})
+
+	// sheen on top of the base layer
+	if mat.SheenColor != (mgl32.Vec3{0, 0, 0}) {
+		color = color.Add(SheenLobe(l, v, n, mat.SheenColor, mat.SheenRoughness))
+	}
+
+	// the clear coat layer absorbs the energy it reflects from the layers below
+	if mat.Clearcoat > 0 {
+		fc := ClearcoatFresnel(v, h, mat.Clearcoat)
+		lobe := ClearcoatLobe(l, v, n, mat.Clearcoat, mat.ClearcoatRoughness)
+		color = color.Mul(1 - fc).Add(mgl32.Vec3{lobe, lobe, lobe})
+	}
+
+	return color
+}
+
+// IBLBrdf mirrors Brdf of ibl/pbr.glsl, which ignores all extensions of the
+// material. a is roughness^2 and k is KIBL(a). The diffuse lobe is multiplied
+// by pi and the specular lobe by the metalness like in the shader, which
+// combines them as PI * Kd * Fd + metallic * Fs.
+func (mat *Material) IBLBrdf(l, v, n mgl32.Vec3) mgl32.Vec3 {
+	a := mat.Roughness * mat.Roughness
+	k := KIBL(a)
+	f0 := F0(mat.Albedo, mat.Metallic)
+	h := l.Add(v).Normalize()
+
+	// specular lobe with the normalization epsilon of ibl/pbr.glsl
+	d := NormalDistributionGGX(n, h, a)
+	g := GeometrySmith(l, v, n, k)
+	f := FresnelSchlickRoughness(v, n, f0, mat.Roughness)
+	ndotl := cgm.Max32(n.Dot(l), 0)
+	ndotv := cgm.Max32(n.Dot(v), 0)
+	denom := cgm.Max32(4*ndotl*ndotv, 0.001)
+	fs := f.Mul(d * g / denom)
+
+	// diffuse lobe
+	kd := mgl32.Vec3{1, 1, 1}.Sub(f).Mul(1 - mat.Metallic)
+	fd := mat.Albedo.Mul(1 / math.Pi)
+	diffuse := mgl32.Vec3{kd.X() * fd.X(), kd.Y() * fd.Y(), kd.Z() * fd.Z()}.Mul(math.Pi)
+
+	return diffuse.Add(fs.Mul(mat.Metallic))
+}
+
+// Btdf mirrors Btdf of test/direct.frag and returns the thin-walled
+// transmission for light coming from behind the surface.
+func (mat *Material) Btdf(l, v, n mgl32.Vec3) mgl32.Vec3 {
+	if mat.Transmission <= 0 {
+		return mgl32.Vec3{0, 0, 0}
+	}
+	a := mat.Roughness * mat.Roughness
+	lobe := TransmissionLobe(l, v, n, mat.Albedo, a, mat.Transmission, mat.IOR)
+	return lobe.Mul(1 - mat.Metallic)
+}
+
+// VisibilityKelemen is the visibility term of Kelemen which is cheap enough
+// for the clear coat layer. It already includes the 1 / (4 (n.l) (n.v)).
+func VisibilityKelemen(l, h mgl32.Vec3) float32 {
+	lDoth := cgm.Max32(l.Dot(h), 1e-4)
+	return 0.25 / (lDoth * lDoth)
+}
+
+// ClearcoatFresnel returns the fresnel of the clear coat layer, which is a
+// dielectric with an ior of 1.5, scaled by the clear coat intensity.
+func ClearcoatFresnel(v, h mgl32.Vec3, clearcoat float32) float32 {
+	vDoth := cgm.Max32(v.Dot(h), 0)
+	return (0.04 + 0.96*float32(math.Pow(float64(1-vDoth), 5))) * clearcoat
+}
+
+// ClearcoatLobe returns the specular lobe of the clear coat layer with the
+// perceptual roughness clearcoatRoughness.
+func ClearcoatLobe(l, v, n mgl32.Vec3, clearcoat, clearcoatRoughness float32) float32 {
+	h := l.Add(v).Normalize()
+	a := clearcoatRoughness * clearcoatRoughness
+	return NormalDistributionGGX(n, h, a) * VisibilityKelemen(l, h) * ClearcoatFresnel(v, h, clearcoat)
+}
+
+// NormalDistributionCharlie is the charlie sheen distribution of Estevez and
+// Kulla for the roughness parameter a.
+func NormalDistributionCharlie(n, h mgl32.Vec3, a float32) float32 {
+	invA := 1 / cgm.Max32(a, 1e-3)
+	cos2h := cgm.Max32(n.Dot(h), 0)
+	cos2h *= cos2h
+	sin2h := cgm.Max32(1-cos2h, 1e-7)
+	return (2 + invA) * float32(math.Pow(float64(sin2h), float64(invA*0.5))) / (2 * math.Pi)
+}
+
+// VisibilityNeubelt is the visibility term of Neubelt and Pettineo for cloth.
+func VisibilityNeubelt(nDotL, nDotV float32) float32 {
+	return 1 / cgm.Max32(4*(nDotL+nDotV-nDotL*nDotV), 1e-4)
+}
+
+// SheenLobe returns the sheen lobe with the specified color and perceptual
+// roughness.
+func SheenLobe(l, v, n, sheenColor mgl32.Vec3, sheenRoughness float32) mgl32.Vec3 {
+	h := l.Add(v).Normalize()
+	d := NormalDistributionCharlie(n, h, sheenRoughness*sheenRoughness)
+	vis := VisibilityNeubelt(cgm.Max32(n.Dot(l), 0), cgm.Max32(n.Dot(v), 0))
+	return sheenColor.Mul(d * vis)
+}
+
+// AnisotropicFrame returns the tangent and bitangent of the normal rotated by
+// the angle rotation in radians around the normal.
+func AnisotropicFrame(n mgl32.Vec3, rotation float32) (mgl32.Vec3, mgl32.Vec3) {
+	up := mgl32.Vec3{1, 0, 0}
+	if cgm.Abs32(n.Y()) < 0.999 {
+		up = mgl32.Vec3{0, 1, 0}
+	}
+	t0 := up.Cross(n).Normalize()
+	b0 := n.Cross(t0)
+	t := t0.Mul(cgm.Cos32(rotation)).Add(b0.Mul(cgm.Sin32(rotation)))
+	return t, n.Cross(t)
+}
+
+// AnisotropicRoughness returns the roughness along the tangent and the
+// bitangent for the anisotropy in [-1,1].
+func AnisotropicRoughness(a, anisotropy float32) (float32, float32) {
+	at := cgm.Max32(a*(1+anisotropy), 1e-3)
+	ab := cgm.Max32(a*(1-anisotropy), 1e-3)
+	return at, ab
+}
+
+// NormalDistributionAnisotropicGGX is the anisotropic GGX distribution with
+// the roughness at along the tangent t and ab along the bitangent b.
+func NormalDistributionAnisotropicGGX(n, h, t, b mgl32.Vec3, at, ab float32) float32 {
+	a2 := at * ab
+	d := mgl32.Vec3{ab * t.Dot(h), at * b.Dot(h), a2 * cgm.Max32(n.Dot(h), 0)}
+	w2 := a2 / d.Dot(d)
+	return a2 * w2 * w2 / math.Pi
+}
+
+// VisibilityAnisotropicSmithGGXCorrelated is the height-correlated smith
+// visibility for the anisotropic GGX distribution. It already includes the
+// 1 / (4 (n.l) (n.v)).
+func VisibilityAnisotropicSmithGGXCorrelated(l, v, n, t, b mgl32.Vec3, at, ab float32) float32 {
+	nDotL := cgm.Max32(n.Dot(l), 0)
+	nDotV := cgm.Max32(n.Dot(v), 0)
+	lambdaV := nDotL * mgl32.Vec3{at * t.Dot(v), ab * b.Dot(v), nDotV}.Len()
+	lambdaL := nDotV * mgl32.Vec3{at * t.Dot(l), ab * b.Dot(l), nDotL}.Len()
+	return 0.5 / cgm.Max32(lambdaV+lambdaL, 1e-6)
+}
+
+// AnisotropicSpecular returns the anisotropic specular lobe without fresnel.
+func AnisotropicSpecular(l, v, n mgl32.Vec3, a, anisotropy, rotation float32) float32 {
+	t, b := AnisotropicFrame(n, rotation)
+	at, ab := AnisotropicRoughness(a, anisotropy)
+
+	h := l.Add(v).Normalize()
+	d := NormalDistributionAnisotropicGGX(n, h, t, b, at, ab)
+	vis := VisibilityAnisotropicSmithGGXCorrelated(l, v, n, t, b, at, ab)
+	return d * vis
+}
+
+// IorToF0 returns the reflectance at normal incidence of a dielectric with the
+// index of refraction ior.
+func IorToF0(ior float32) float32 {
+	r := (ior - 1) / (ior + 1)
+	return r * r
+}
+
+// ThinWalledDirection mirrors the light direction l, which comes from behind
+// the surface, onto the side of the normal.
+func ThinWalledDirection(l, n mgl32.Vec3) mgl32.Vec3 {
+	return l.Sub(n.Mul(2 * n.Dot(l)))
+}
+
+// TransmissionLobe returns the thin-walled transmission lobe for light coming
+// from behind the surface. The lobe is a GGX lobe with the roughness parameter
+// a tinted by the albedo and weighted by the energy not reflected by the
+// surface.
+func TransmissionLobe(l, v, n, albedo mgl32.Vec3, a, transmission, ior float32) mgl32.Vec3 {
+	lt := ThinWalledDirection(l, n)
+	h := lt.Add(v).Normalize()
+	nDotL := cgm.Max32(n.Dot(lt), 0)
+	nDotV := cgm.Max32(n.Dot(v), 0)
+
+	d := NormalDistributionGGX(n, h, a)
+	vis := VisibilitySmithGGXCorrelated(nDotV, nDotL, a)
+
+	f0 := IorToF0(ior)
+	f := f0 + (1-f0)*float32(math.Pow(float64(1-nDotV), 5))
+	return albedo.Mul(transmission * (1 - f) * d * vis)
+}
@@ -0,0 +1,173 @@
+package brdf
+
+import (
+	"math"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	THETA_STEPS int     = 512
+	PHI_STEPS   int     = 1024
+	LOBE_BOUND  float32 = 1.01 // allows for the error of the quadrature
+)
+
+var (
+	lobeRoughnesses = []float32{0.3, 0.5, 0.75, 1}
+	lobeViewAngles  = []float32{0.1, 0.5, 1}
+)
+
+// the clear coat layer is a dielectric that reflects at most the clear coat
+// intensity
+func TestClearcoatLobe(t *testing.T) {
+	n := mgl32.Vec3{0, 0, 1}
+	for _, r := range lobeRoughnesses {
+		for _, nv := range lobeViewAngles {
+			v := viewDirection(nv)
+			albedo := hemisphereIntegral(func(l mgl32.Vec3) float32 {
+				return ClearcoatLobe(l, v, n, 1, r)
+			})
+			if albedo > LOBE_BOUND {
+				t.Errorf("roughness %.2f n.v %.2f: albedo = %.4f", r, nv, albedo)
+			}
+		}
+	}
+
+	checkReciprocity(t, "clear coat", func(l, v mgl32.Vec3) float32 {
+		return ClearcoatLobe(l, v, n, 1, 0.5)
+	})
+}
+
+// a white sheen doesn't reflect more than it receives
+func TestSheenLobe(t *testing.T) {
+	n := mgl32.Vec3{0, 0, 1}
+	white := mgl32.Vec3{1, 1, 1}
+	for _, r := range lobeRoughnesses {
+		for _, nv := range lobeViewAngles {
+			v := viewDirection(nv)
+			albedo := hemisphereIntegral(func(l mgl32.Vec3) float32 {
+				return SheenLobe(l, v, n, white, r).X()
+			})
+			if albedo > LOBE_BOUND {
+				t.Errorf("roughness %.2f n.v %.2f: albedo = %.4f", r, nv, albedo)
+			}
+		}
+	}
+
+	checkReciprocity(t, "sheen", func(l, v mgl32.Vec3) float32 {
+		return SheenLobe(l, v, n, white, 0.5).X()
+	})
+}
+
+// the anisotropic lobe without fresnel reflects at most all energy and
+// without anisotropy it is the isotropic GGX lobe with the correlated smith
+// visibility
+func TestAnisotropicSpecular(t *testing.T) {
+	n := mgl32.Vec3{0, 0, 1}
+	for _, r := range lobeRoughnesses {
+		a := r * r
+		for _, anisotropy := range []float32{-0.5, 0.5, 0.8} {
+			for _, nv := range lobeViewAngles {
+				v := viewDirection(nv)
+				albedo := hemisphereIntegral(func(l mgl32.Vec3) float32 {
+					return AnisotropicSpecular(l, v, n, a, anisotropy, 0.3)
+				})
+				if albedo > LOBE_BOUND {
+					t.Errorf("roughness %.2f anisotropy %.1f n.v %.2f: albedo = %.4f", r, anisotropy, nv, albedo)
+				}
+			}
+		}
+	}
+
+	l := mgl32.Vec3{0.6, 0.1, 0.79}.Normalize()
+	v := mgl32.Vec3{-0.3, 0.4, 0.5}.Normalize()
+	for _, r := range lobeRoughnesses {
+		a := r * r
+		h := l.Add(v).Normalize()
+		expected := NormalDistributionGGX(n, h, a) * VisibilitySmithGGXCorrelated(n.Dot(v), n.Dot(l), a)
+		if got := AnisotropicSpecular(l, v, n, a, 0, 0.3); cgm.Abs32(got-expected) > RECIPROCITY_EPS*expected {
+			t.Errorf("roughness %.2f: expected the isotropic lobe %v, got %v", r, expected, got)
+		}
+	}
+
+	checkReciprocity(t, "anisotropy", func(l, v mgl32.Vec3) float32 {
+		return AnisotropicSpecular(l, v, n, 0.25, 0.6, 0.3)
+	})
+}
+
+// the thin-walled transmission transmits at most the energy that isn't
+// reflected by the surface
+func TestTransmissionLobe(t *testing.T) {
+	n := mgl32.Vec3{0, 0, 1}
+	white := mgl32.Vec3{1, 1, 1}
+	for _, r := range lobeRoughnesses {
+		for _, nv := range lobeViewAngles {
+			v := viewDirection(nv)
+			// the light comes from the lower hemisphere
+			albedo := hemisphereIntegral(func(l mgl32.Vec3) float32 {
+				below := mgl32.Vec3{l.X(), l.Y(), -l.Z()}
+				return TransmissionLobe(below, v, n, white, r*r, 1, 1.5).X()
+			})
+			if albedo > LOBE_BOUND {
+				t.Errorf("roughness %.2f n.v %.2f: albedo = %.4f", r, nv, albedo)
+			}
+		}
+	}
+
+	// the fresnel of the transmission only depends on the view angle like the
+	// one of the shaders, thus it is divided out and the remaining lobe is
+	// compared with the one for light and view swapped, which looks at the
+	// surface from below
+	f0 := IorToF0(1.5)
+	fresnel := func(nDotV float32) float32 {
+		return f0 + (1-f0)*float32(math.Pow(float64(1-nDotV), 5))
+	}
+	checkReciprocity(t, "transmission", func(l, v mgl32.Vec3) float32 {
+		below := mgl32.Vec3{l.X(), l.Y(), -l.Z()}
+		lobe := TransmissionLobe(below, v, n, white, 0.25, 1, 1.5).X()
+		return lobe / (1 - fresnel(v.Z()))
+	})
+}
+
+// checkReciprocity compares the lobe f for light and view directions with the
+// lobe for the swapped directions.
+func checkReciprocity(t *testing.T, name string, f func(l, v mgl32.Vec3) float32) {
+	directions := []mgl32.Vec3{
+		mgl32.Vec3{0.6, 0.1, 0.79}.Normalize(),
+		mgl32.Vec3{-0.3, 0.4, 0.5}.Normalize(),
+		mgl32.Vec3{0.1, -0.9, 0.2}.Normalize(),
+		{0, 0, 1},
+	}
+	for _, l := range directions {
+		for _, v := range directions {
+			f1, f2 := f(l, v), f(v, l)
+			if cgm.Abs32(f1-f2) > RECIPROCITY_EPS*cgm.Max32(f1, 1) {
+				t.Errorf("%v: f(%v,%v) = %v but f(%v,%v) = %v", name, l, v, f1, v, l, f2)
+			}
+		}
+	}
+}
+
+// hemisphereIntegral integrates f(l) * (n.l) over the hemisphere around the
+// normal z with the midpoint rule over cos(theta) and phi.
+func hemisphereIntegral(f func(l mgl32.Vec3) float32) float32 {
+	var sum float64
+	for i := 0; i < THETA_STEPS; i++ {
+		cosTheta := (float32(i) + 0.5) / float32(THETA_STEPS)
+		sinTheta := cgm.Sqrt32(1 - cosTheta*cosTheta)
+		for j := 0; j < PHI_STEPS; j++ {
+			phi := 2 * math.Pi * (float32(j) + 0.5) / float32(PHI_STEPS)
+			l := mgl32.Vec3{sinTheta * cgm.Cos32(phi), sinTheta * cgm.Sin32(phi), cosTheta}
+			sum += float64(f(l) * cosTheta)
+		}
+	}
+	return float32(sum * 2 * math.Pi / float64(THETA_STEPS*PHI_STEPS))
+}
+
+// viewDirection returns the view direction in the xz-plane with the cosine
+// nDotV to the normal z.
+func viewDirection(nDotV float32) mgl32.Vec3 {
+	return mgl32.Vec3{cgm.Sqrt32(1 - nDotV*nDotV), 0, nDotV}
+}
@@ -0,0 +1,235 @@
+package brdf
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/core/gl"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/adrianderstroff/pbr/pkg/view/texture"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// MultiscatterTables hold the precomputed albedos needed for the multiple
+// scattering compensation of Kulla and Conty "Revisiting Physically Based
+// Shading at Imageworks". E is the directional albedo of the single
+// scattering specular lobe with a fresnel of 1 for Size values of n.v in x and
+// Size values of the perceptual roughness in y, both sampled at the texel
+// centers. Eavg is the cosine weighted average of E over n.v per roughness.
+// The remapping of the perceptual roughness to a and k depends on the brdf the
+// tables are made for, see MakeMultiscatterTables and
+// MakeIBLMultiscatterTables.
+type MultiscatterTables struct {
+	Size int
+	E    []float32
+	Eavg []float32
+	// remapping of the perceptual roughness to a and k
+	remapA func(roughness float32) float32
+	remapK func(roughness float32) float32
+}
+
+// MakeMultiscatterTables computes the albedo tables of the specified size
+// using the specified number of importance samples per entry for the direct
+// lighting brdf of test/direct.frag, thus a is roughness^2 and k is
+// KDirect(roughness). The rows are computed in parallel.
+func MakeMultiscatterTables(size, samples int) MultiscatterTables {
+	alpha := func(roughness float32) float32 { return roughness * roughness }
+	return makeMultiscatterTables(size, samples, alpha, KDirect, 1)
+}
+
+// MakeIBLMultiscatterTables computes the albedo tables for the image based
+// lighting brdf of test/ibl.frag, thus a is the roughness itself and k is
+// KIBL(roughness). The small k lets the single scattering lobe reflect more
+// than 1 at grazing angles, thus E isn't clamped at 1 such that the
+// compensation scales the lobe down there.
+func MakeIBLMultiscatterTables(size, samples int) MultiscatterTables {
+	alpha := func(roughness float32) float32 { return roughness }
+	return makeMultiscatterTables(size, samples, alpha, KIBL, float32(math.Inf(1)))
+}
+
+// makeMultiscatterTables computes the albedo tables using the specified
+// remapping of the perceptual roughness to a and k. E is clamped to
+// [0,limit].
+func makeMultiscatterTables(size, samples int, remapA, remapK func(roughness float32) float32,
+	limit float32) MultiscatterTables {
+	tables := MultiscatterTables{
+		Size:   size,
+		E:      make([]float32, size*size),
+		Eavg:   make([]float32, size),
+		remapA: remapA,
+		remapK: remapK,
+	}
+
+	rows := make(chan int, size)
+	for y := 0; y < size; y++ {
+		rows <- y
+	}
+	close(rows)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := range rows {
+				roughness := (float32(y) + 0.5) / float32(size)
+				a, k := tables.a(roughness), tables.k(roughness)
+
+				// Eavg = 2 * Int E(mu) mu dmu
+				var avg float32
+				for x := 0; x < size; x++ {
+					mu := (float32(x) + 0.5) / float32(size)
+					e := cgm.Clamp(WhiteFurnace(mu, a, k, samples), 0, limit)
+					tables.E[x+y*size] = e
+					avg += 2 * e * mu / float32(size)
+				}
+				tables.Eavg[y] = cgm.Clamp(avg, 0, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return tables
+}
+
+// DirectionalAlbedo returns the linearly interpolated directional albedo
+// E(mu) for the perceptual roughness.
+func (tables *MultiscatterTables) DirectionalAlbedo(mu, roughness float32) float32 {
+	x, x1, tx := tables.coordinate(mu)
+	y, y1, ty := tables.coordinate(roughness)
+
+	s := tables.Size
+	e0 := tables.E[x+y*s]*(1-tx) + tables.E[x1+y*s]*tx
+	e1 := tables.E[x+y1*s]*(1-tx) + tables.E[x1+y1*s]*tx
+	return e0*(1-ty) + e1*ty
+}
+
+// AverageAlbedo returns the linearly interpolated average albedo Eavg for the
+// perceptual roughness.
+func (tables *MultiscatterTables) AverageAlbedo(roughness float32) float32 {
+	y, y1, ty := tables.coordinate(roughness)
+	return tables.Eavg[y]*(1-ty) + tables.Eavg[y1]*ty
+}
+
+// Multiscatter evaluates the multiple scattering lobe that adds the energy
+// lost by the single scattering specular lobe. n.l and n.v are the cosines of
+// the light and view direction. The tint of colored fresnel is approximated
+// with the hemispherical average of schlick's fresnel.
+func (tables *MultiscatterTables) Multiscatter(nDotL, nDotV, roughness float32, f0 mgl32.Vec3) mgl32.Vec3 {
+	eo := tables.DirectionalAlbedo(nDotV, roughness)
+	ei := tables.DirectionalAlbedo(nDotL, roughness)
+	eavg := tables.AverageAlbedo(roughness)
+	if eavg >= 1 {
+		return mgl32.Vec3{0, 0, 0}
+	}
+
+	fms := (1 - eo) * (1 - ei) / (math.Pi * (1 - eavg))
+	favg := f0.Add(mgl32.Vec3{1, 1, 1}.Sub(f0).Mul(1.0 / 21.0))
+	tint := mgl32.Vec3{}
+	for c := 0; c < 3; c++ {
+		tint[c] = favg[c] * favg[c] * eavg / (1 - favg[c]*(1-eavg))
+	}
+	return tint.Mul(fms)
+}
+
+// WhiteFurnaceMultiscatter returns the fraction of energy reflected by a
+// white surface including the multiple scattering lobe. The single
+// scattering lobe uses the same a and k as the tables. With a correct
+// compensation the result is close to 1 for all roughnesses.
+func WhiteFurnaceMultiscatter(tables *MultiscatterTables, nDotV, roughness float32, samples int) float32 {
+	single := WhiteFurnace(nDotV, tables.a(roughness), tables.k(roughness), samples)
+
+	// the multiple scattering lobe only depends on n.l, thus the integral over
+	// the hemisphere reduces to 2*pi * Int fms(mu) mu dmu
+	white := mgl32.Vec3{1, 1, 1}
+	var multi float32
+	for i := 0; i < samples; i++ {
+		mu := (float32(i) + 0.5) / float32(samples)
+		fms := tables.Multiscatter(mu, nDotV, roughness, white)
+		multi += 2 * math.Pi * fms.X() * mu / float32(samples)
+	}
+
+	return single + multi
+}
+
+// WhiteFurnaceCompensated returns the fraction of energy reflected by a white
+// surface whose single scattering lobe is scaled by Compensation, which is
+// the image based lighting counterpart of WhiteFurnaceMultiscatter.
+func WhiteFurnaceCompensated(tables *MultiscatterTables, nDotV, roughness float32, samples int) float32 {
+	single := WhiteFurnace(nDotV, tables.a(roughness), tables.k(roughness), samples)
+	return single * tables.Compensation(nDotV, roughness, mgl32.Vec3{1, 1, 1}).X()
+}
+
+// Compensation returns the factor that scales the single scattering specular
+// lobe to account for the missing energy, following Fdez-Aguera "A
+// Multiple-Scattering Microfacet Model for Real-Time Image-based Lighting".
+// It mirrors MultiscatterCompensation of shared/multiscatter.glsl.
+func (tables *MultiscatterTables) Compensation(nDotV, roughness float32, f0 mgl32.Vec3) mgl32.Vec3 {
+	ess := cgm.Max32(tables.DirectionalAlbedo(nDotV, roughness), 1e-4)
+	return mgl32.Vec3{1, 1, 1}.Add(f0.Mul(1/ess - 1))
+}
+
+// Images returns the directional albedo table as a size x size image and the
+// average albedo table as a size x 1 image, both with a single float channel.
+func (tables *MultiscatterTables) Images() (image2d.Image2D, image2d.Image2D, error) {
+	e, err := image2d.MakeFloat32(tables.Size, tables.Size, 1)
+	if err != nil {
+		return image2d.Image2D{}, image2d.Image2D{}, err
+	}
+	eavg, err := image2d.MakeFloat32(tables.Size, 1, 1)
+	if err != nil {
+		return image2d.Image2D{}, image2d.Image2D{}, err
+	}
+
+	for y := 0; y < tables.Size; y++ {
+		for x := 0; x < tables.Size; x++ {
+			e.SetFloat32(x, y, 0, tables.E[x+y*tables.Size])
+		}
+		eavg.SetFloat32(y, 0, 0, tables.Eavg[y])
+	}
+
+	return e, eavg, nil
+}
+
+// Textures uploads both tables to the GPU. The directional albedo is sampled
+// with vec2(n.v, roughness) and the average albedo with vec2(roughness, 0.5).
+func (tables *MultiscatterTables) Textures() (texture.Texture, texture.Texture, error) {
+	e, eavg, err := tables.Images()
+	if err != nil {
+		return texture.Texture{}, texture.Texture{}, err
+	}
+
+	etex := texture.Make(e.GetWidth(), e.GetHeight(), gl.R32F, gl.RED,
+		e.GetPixelType(), e.GetDataPointer(), gl.LINEAR, gl.LINEAR,
+		gl.CLAMP_TO_EDGE, gl.CLAMP_TO_EDGE)
+	eavgtex := texture.Make(eavg.GetWidth(), eavg.GetHeight(), gl.R32F, gl.RED,
+		eavg.GetPixelType(), eavg.GetDataPointer(), gl.LINEAR, gl.LINEAR,
+		gl.CLAMP_TO_EDGE, gl.CLAMP_TO_EDGE)
+	return etex, eavgtex, nil
+}
+
+// a returns the a of the perceptual roughness the tables have been made for.
+func (tables *MultiscatterTables) a(roughness float32) float32 {
+	if tables.remapA == nil {
+		return roughness * roughness
+	}
+	return tables.remapA(roughness)
+}
+
+// k returns the k of the perceptual roughness the tables have been made for.
+func (tables *MultiscatterTables) k(roughness float32) float32 {
+	if tables.remapK == nil {
+		return KDirect(roughness)
+	}
+	return tables.remapK(roughness)
+}
+
+// coordinate maps a value in [0,1] onto the two closest table entries and the
+// interpolation weight between them.
+func (tables *MultiscatterTables) coordinate(val float32) (int, int, float32) {
+	pos := cgm.Clamp(val*float32(tables.Size)-0.5, 0, float32(tables.Size-1))
+	i := int(pos)
+	return i, cgm.Mini(i+1, tables.Size-1), pos - float32(i)
+}
@@ -0,0 +1,46 @@
+package brdf
+
+import (
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+)
+
+const (
+	MULTISCATTER_SIZE      int     = 32
+	MULTISCATTER_SAMPLES   int     = 512
+	MULTISCATTER_TOLERANCE float32 = 0.03
+
+	// the directional albedo with the small ibl k changes quickly at grazing
+	// angles, thus the table needs more texels and samples to be interpolated
+	// accurately
+	IBL_MULTISCATTER_SIZE    int = 64
+	IBL_MULTISCATTER_SAMPLES int = 4096
+)
+
+// with the multiple scattering lobe a white surface reflects all energy
+func TestWhiteFurnaceMultiscatter(t *testing.T) {
+	tables := MakeMultiscatterTables(MULTISCATTER_SIZE, MULTISCATTER_SAMPLES)
+	for _, r := range roughnesses {
+		for _, nv := range viewangles {
+			albedo := WhiteFurnaceMultiscatter(&tables, nv, r, FURNACE_SAMPLES)
+			if cgm.Abs32(albedo-1) > MULTISCATTER_TOLERANCE {
+				t.Errorf("roughness %.2f n.v %.2f: albedo = %.4f", r, nv, albedo)
+			}
+		}
+	}
+}
+
+// the compensation of image based lighting scales the single scattering lobe
+// such that a white surface reflects all energy
+func TestWhiteFurnaceCompensated(t *testing.T) {
+	tables := MakeIBLMultiscatterTables(IBL_MULTISCATTER_SIZE, IBL_MULTISCATTER_SAMPLES)
+	for _, r := range roughnesses {
+		for _, nv := range viewangles {
+			albedo := WhiteFurnaceCompensated(&tables, nv, r, FURNACE_SAMPLES)
+			if cgm.Abs32(albedo-1) > MULTISCATTER_TOLERANCE {
+				t.Errorf("roughness %.2f n.v %.2f: albedo = %.4f", r, nv, albedo)
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package brdf
+
+import (
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/sampling"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// NDFNormalization numerically integrates D(h) * (n.h) over the hemisphere
+// for the roughness parameter a. For a normalized distribution the result is
+// 1. As the distribution is isotropic the integral over the azimuth is 2*pi
+// and only the polar angle has to be integrated using the specified number of
+// samples. The samples are spaced logarithmically towards the normal to
+// resolve the narrow peak of very smooth surfaces.
+func NDFNormalization(a float32, samples int) float32 {
+	return integrateNDF(NormalDistributionGGX, a, samples)
+}
+
+// NDFNormalization is the counterpart of NDFNormalization for the normal
+// distribution function selected by the model.
+func (model *Model) NDFNormalization(a float32, samples int) float32 {
+	return integrateNDF(model.D, a, samples)
+}
+
+// integrateNDF integrates the normal distribution function d like
+// NDFNormalization.
+func integrateNDF(d func(n, h mgl32.Vec3, a float32) float32, a float32, samples int) float32 {
+	n := mgl32.Vec3{0, 0, 1}
+
+	// with w = 1 - cos^2(theta) the integral becomes 1/2 * Int D dw. it is
+	// solved with the midpoint rule over ln(w) where dw = w dln(w).
+	const minLog = -30.0
+	dlog := -minLog / float64(samples)
+
+	var sum float64
+	for i := 0; i < samples; i++ {
+		w := math.Exp(minLog + (float64(i)+0.5)*dlog)
+		cosTheta := math.Sqrt(1 - w)
+		h := mgl32.Vec3{float32(math.Sqrt(w)), 0, float32(cosTheta)}
+		sum += 0.5 * float64(d(n, h, a)) * w * dlog
+	}
+
+	return float32(2 * math.Pi * sum)
+}
+
+// ReciprocityError returns the largest absolute difference between the
+// specular BRDF evaluated for (l,v) and for the swapped directions (v,l).
+// Helmholtz reciprocity requires the difference to be 0.
+func ReciprocityError(l, v, n, f0 mgl32.Vec3, a, k float32) float32 {
+	f1 := Specular(l, v, n, f0, a, k)
+	f2 := Specular(v, l, n, f0, a, k)
+	diff := f1.Sub(f2)
+	return cgm.Max32(cgm.Abs32(diff.X()), cgm.Max32(cgm.Abs32(diff.Y()), cgm.Abs32(diff.Z())))
+}
+
+// DirectionalAlbedo integrates the specular BRDF times n.l over all light
+// directions for the view angle n.v. The light directions are importance
+// sampled according to the GGX distribution with the roughness parameter a.
+func DirectionalAlbedo(nDotV float32, f0 mgl32.Vec3, a, k float32, samples int) mgl32.Vec3 {
+	nDotV = cgm.Max32(nDotV, 1e-4)
+	n := mgl32.Vec3{0, 0, 1}
+	v := mgl32.Vec3{cgm.Sqrt32(1 - nDotV*nDotV), 0, nDotV}
+
+	sum := mgl32.Vec3{0, 0, 0}
+	for s := 0; s < samples; s++ {
+		xi := sampling.HammersleySampling(uint32(s), uint32(samples))
+		h := sampling.ImportanceSamplingGGX(xi, n, a)
+		l := h.Mul(2 * v.Dot(h)).Sub(v)
+
+		nDotL := l.Z()
+		vDotH := v.Dot(h)
+		if nDotL <= 0 || vDotH <= 0 {
+			continue
+		}
+
+		// pdf of the light direction is D * (n.h) / (4 * (v.h))
+		pdf := NormalDistributionGGX(n, h, a) * h.Z() / (4 * vDotH)
+		if pdf <= 0 {
+			continue
+		}
+		f := Specular(l, v, n, f0, a, k)
+		sum = sum.Add(f.Mul(nDotL / pdf))
+	}
+
+	return sum.Mul(1 / float32(samples))
+}
+
+// WhiteFurnace returns the fraction of energy that is reflected by a white
+// specular surface, which has a base reflectivity of 1, lit by a uniform white
+// environment. Energy conservation requires the result to be at most 1.
+func WhiteFurnace(nDotV, a, k float32, samples int) float32 {
+	return DirectionalAlbedo(nDotV, mgl32.Vec3{1, 1, 1}, a, k, samples).X()
+}
+
+// MaterialAlbedo integrates the combined diffuse and specular BRDF of the
+// material times n.l over all light directions for the view angle n.v, which
+// is the energy the material reflects when lit by a uniform white environment.
+// The BRDF is Brdf of test/direct.frag.
+func MaterialAlbedo(mat *Material, nDotV float32, samples int) mgl32.Vec3 {
+	return integrateAlbedo(mat.Brdf, mat.Roughness*mat.Roughness, nDotV, samples)
+}
+
+// IBLMaterialAlbedo is the counterpart of MaterialAlbedo for Brdf of
+// ibl/pbr.glsl, which is evaluated by Material.IBLBrdf.
+func IBLMaterialAlbedo(mat *Material, nDotV float32, samples int) mgl32.Vec3 {
+	return integrateAlbedo(mat.IBLBrdf, mat.Roughness*mat.Roughness, nDotV, samples)
+}
+
+// integrateAlbedo integrates the brdf f times n.l over all light directions
+// for the view angle n.v. Half of the samples are distributed according to
+// the cosine and half according to the GGX distribution with the roughness
+// parameter a. They are combined with the balance heuristic to handle both
+// the diffuse and the narrow specular lobe.
+func integrateAlbedo(f func(l, v, n mgl32.Vec3) mgl32.Vec3, a, nDotV float32, samples int) mgl32.Vec3 {
+	nDotV = cgm.Max32(nDotV, 1e-4)
+	n := mgl32.Vec3{0, 0, 1}
+	v := mgl32.Vec3{cgm.Sqrt32(1 - nDotV*nDotV), 0, nDotV}
+
+	// pdfs of both strategies for the light direction l
+	pdfs := func(l mgl32.Vec3) (float32, float32) {
+		h := l.Add(v).Normalize()
+		pdfCos := l.Z() / math.Pi
+		pdfGGX := NormalDistributionGGX(n, h, a) * h.Z() / (4 * cgm.Max32(v.Dot(h), 1e-6))
+		return pdfCos, pdfGGX
+	}
+
+	half := cgm.Maxi(samples/2, 1)
+	sum := mgl32.Vec3{0, 0, 0}
+	for s := 0; s < half; s++ {
+		xi := sampling.HammersleySampling(uint32(s), uint32(half))
+
+		// cosine distributed light direction
+		phi := 2 * math.Pi * xi.X()
+		r := cgm.Sqrt32(xi.Y())
+		lcos := mgl32.Vec3{r * cgm.Cos32(phi), r * cgm.Sin32(phi), cgm.Sqrt32(1 - xi.Y())}
+
+		// ggx distributed light direction
+		h := sampling.ImportanceSamplingGGX(xi, n, a)
+		lggx := h.Mul(2 * v.Dot(h)).Sub(v)
+
+		for _, l := range []mgl32.Vec3{lcos, lggx} {
+			if l.Z() <= 0 {
+				continue
+			}
+			pdfCos, pdfGGX := pdfs(l)
+			if pdfCos+pdfGGX <= 0 {
+				continue
+			}
+			sum = sum.Add(f(l, v, n).Mul(l.Z() / (pdfCos + pdfGGX)))
+		}
+	}
+
+	return sum.Mul(1 / float32(half))
+}
@@ -0,0 +1,110 @@
+package brdf
+
+import (
+	"math"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	NDF_SAMPLES      int     = 4096
+	FURNACE_SAMPLES  int     = 4096
+	NDF_TOLERANCE    float32 = 1e-2
+	RECIPROCITY_EPS  float32 = 1e-4
+	FURNACE_BOUND    float32 = 1.02 // allows for the noise of the integration
+	K_TOLERANCE      float32 = 1e-6
+	ALBEDO_TOLERANCE float32 = 2e-2
+)
+
+var (
+	roughnesses = []float32{0.05, 0.1, 0.25, 0.5, 0.75, 1}
+	viewangles  = []float32{0.05, 0.2, 0.5, 0.8, 1}
+)
+
+// the ndf has to integrate to 1 when weighted by the cosine
+func TestNDFNormalization(t *testing.T) {
+	for _, r := range roughnesses {
+		norm := NDFNormalization(r*r, NDF_SAMPLES)
+		if cgm.Abs32(norm-1) > NDF_TOLERANCE {
+			t.Errorf("roughness %.2f: Int D(h) (n.h) dh = %.5f", r, norm)
+		}
+	}
+}
+
+// swapping light and view must not change the brdf. the fresnel term of the
+// shaders uses v.n instead of v.h, thus only a white f0 is reciprocal.
+func TestReciprocity(t *testing.T) {
+	n := mgl32.Vec3{0, 0, 1}
+	l := mgl32.Vec3{0.6, 0.1, 0.79}.Normalize()
+	v := mgl32.Vec3{-0.3, 0.4, 0.5}.Normalize()
+	white := mgl32.Vec3{1, 1, 1}
+	for _, r := range roughnesses {
+		err := ReciprocityError(l, v, n, white, r*r, KDirect(r))
+		if err > RECIPROCITY_EPS {
+			t.Errorf("roughness %.2f: |f(l,v) - f(v,l)| = %.2e", r, err)
+		}
+	}
+}
+
+// a white surface in a white environment can't reflect more than it gets. the
+// small ibl k of test/ibl.frag hardly shadows at all, thus at grazing angles
+// the 1/(n.v) of the denominator lets it reflect more than it gets and only
+// the larger angles are checked for it.
+func TestWhiteFurnace(t *testing.T) {
+	for _, r := range roughnesses {
+		a := r * r
+		for _, nv := range viewangles {
+			if albedo := WhiteFurnace(nv, a, KDirect(r), FURNACE_SAMPLES); albedo > FURNACE_BOUND {
+				t.Errorf("roughness %.2f n.v %.2f: direct k albedo = %.4f", r, nv, albedo)
+			}
+			if nv < 0.2 {
+				continue
+			}
+			if albedo := WhiteFurnace(nv, a, KIBL(a), FURNACE_SAMPLES); albedo > FURNACE_BOUND {
+				t.Errorf("roughness %.2f n.v %.2f: ibl k albedo = %.4f", r, nv, albedo)
+			}
+		}
+	}
+}
+
+// the remapping has to match the formulas used in the shaders
+func TestKRemapping(t *testing.T) {
+	for _, r := range roughnesses {
+		a := r * r
+		kd := KDirect(r)
+		ki := KIBL(a)
+		if cgm.Abs32(kd-(r+1)*(r+1)/8) > K_TOLERANCE {
+			t.Errorf("roughness %.2f: direct k = %.5f", r, kd)
+		}
+		if cgm.Abs32(ki-a*a/2) > K_TOLERANCE {
+			t.Errorf("roughness %.2f: ibl k = %.5f", r, ki)
+		}
+		if ki > kd {
+			t.Errorf("roughness %.2f: ibl k %.5f is larger than direct k %.5f", r, ki, kd)
+		}
+	}
+}
+
+// the specular lobe of ibl/pbr.glsl is scaled by the metalness, thus for a
+// dielectric only the diffuse lobe remains. it doesn't depend on the light
+// direction and integrates to pi * (1 - F) * albedo.
+func TestIBLMaterialAlbedo(t *testing.T) {
+	n := mgl32.Vec3{0, 0, 1}
+	albedo := mgl32.Vec3{0.8, 0.5, 0.2}
+	for _, r := range roughnesses {
+		mat := MakeMaterial(albedo, 0, r)
+		for _, nv := range viewangles {
+			v := mgl32.Vec3{cgm.Sqrt32(1 - nv*nv), 0, nv}
+			f := FresnelSchlickRoughness(v, n, F0(albedo, 0), r)
+			got := IBLMaterialAlbedo(&mat, nv, FURNACE_SAMPLES)
+			for c := 0; c < 3; c++ {
+				expected := math.Pi * (1 - f[c]) * albedo[c]
+				if cgm.Abs32(got[c]-expected) > ALBEDO_TOLERANCE*expected {
+					t.Errorf("roughness %.2f n.v %.2f channel %v: expected %.4f, got %.4f", r, nv, c, expected, got[c])
+				}
+			}
+		}
+	}
+}
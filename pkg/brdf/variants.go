@@ -0,0 +1,253 @@
+package brdf
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Variants of the normal distribution function. The values match the defines
+// in shared/microfacet.glsl.
+const (
+	NDF_GGX         = 0
+	NDF_BECKMANN    = 1
+	NDF_BLINN_PHONG = 2
+)
+
+// Variants of the geometry term. The values match the defines in
+// shared/microfacet.glsl.
+const (
+	GEOMETRY_SMITH_SEPARABLE  = 0
+	GEOMETRY_SMITH_CORRELATED = 1
+	GEOMETRY_KELEMEN          = 2
+	GEOMETRY_IMPLICIT         = 3
+)
+
+// Variants of the fresnel term. The values match the defines in
+// shared/microfacet.glsl.
+const (
+	FRESNEL_SCHLICK    = 0
+	FRESNEL_DIELECTRIC = 1
+	FRESNEL_CONDUCTOR  = 2
+)
+
+// Names of the variants in the order of their values, e.g. for GUI selectors.
+var (
+	NDF_NAMES      = []string{"ggx", "beckmann", "blinn-phong"}
+	GEOMETRY_NAMES = []string{"smith separable", "smith correlated", "kelemen", "implicit"}
+	FRESNEL_NAMES  = []string{"schlick", "dielectric", "conductor"}
+)
+
+// Model selects the variants of the terms of the microfacet BRDF. Eta and K
+// are the real and imaginary part of the complex index of refraction per
+// color channel which are only used by the conductor fresnel.
+type Model struct {
+	NDF      int
+	Geometry int
+	Fresnel  int
+	Eta      mgl32.Vec3
+	K        mgl32.Vec3
+}
+
+// MakeDefaultModel returns the model used by the shaders if no variant has
+// been selected: GGX, separable Smith with Schlick-GGX and Schlick's fresnel.
+func MakeDefaultModel() Model {
+	return Model{
+		NDF:      NDF_GGX,
+		Geometry: GEOMETRY_SMITH_SEPARABLE,
+		Fresnel:  FRESNEL_SCHLICK,
+		Eta:      mgl32.Vec3{1, 1, 1},
+		K:        mgl32.Vec3{0, 0, 0},
+	}
+}
+
+// Defines returns the shader defines that select the variants of this model,
+// see shader.MakeWithDefines.
+func (model *Model) Defines() map[string]string {
+	return map[string]string{
+		"NDF":      strconv.Itoa(model.NDF),
+		"GEOMETRY": strconv.Itoa(model.Geometry),
+		"FRESNEL":  strconv.Itoa(model.Fresnel),
+	}
+}
+
+// D evaluates the selected normal distribution function.
+func (model *Model) D(n, h mgl32.Vec3, a float32) float32 {
+	switch model.NDF {
+	case NDF_BECKMANN:
+		return NormalDistributionBeckmann(n, h, a)
+	case NDF_BLINN_PHONG:
+		return NormalDistributionBlinnPhong(n, h, a)
+	}
+	return NormalDistributionGGX(n, h, a)
+}
+
+// G evaluates the selected geometry term. a is roughness^2 and k is the
+// remapped roughness that is only used by the separable Smith term.
+func (model *Model) G(l, v, n mgl32.Vec3, a, k float32) float32 {
+	switch model.Geometry {
+	case GEOMETRY_SMITH_CORRELATED:
+		return GeometrySmithCorrelated(l, v, n, a)
+	case GEOMETRY_KELEMEN:
+		return GeometryKelemen(l, v, n)
+	case GEOMETRY_IMPLICIT:
+		return GeometryImplicit(l, v, n)
+	}
+	return GeometrySmith(l, v, n, k)
+}
+
+// F evaluates the selected fresnel term. Like FresnelSchlick the angle
+// between v and n is used.
+func (model *Model) F(v, n, f0 mgl32.Vec3) mgl32.Vec3 {
+	switch model.Fresnel {
+	case FRESNEL_DIELECTRIC:
+		cosTheta := cgm.Max32(v.Dot(n), 0)
+		return mgl32.Vec3{
+			FresnelDielectric(cosTheta, F0ToIor(f0.X())),
+			FresnelDielectric(cosTheta, F0ToIor(f0.Y())),
+			FresnelDielectric(cosTheta, F0ToIor(f0.Z())),
+		}
+	case FRESNEL_CONDUCTOR:
+		return FresnelConductor(cgm.Max32(v.Dot(n), 0), model.Eta, model.K)
+	}
+	return FresnelSchlick(v, n, f0)
+}
+
+// Specular evaluates the specular microfacet BRDF using the selected
+// variants. It matches Specular for the default model.
+func (model *Model) Specular(l, v, n, f0 mgl32.Vec3, a, k float32) mgl32.Vec3 {
+	h := l.Add(v).Normalize()
+
+	d := model.D(n, h, a)
+	g := model.G(l, v, n, a, k)
+	f := model.F(v, n, f0)
+
+	ndotl := cgm.Max32(n.Dot(l), 0)
+	ndotv := cgm.Max32(n.Dot(v), 0)
+	denom := cgm.Max32(4*ndotl*ndotv, 0.01)
+
+	return f.Mul(d * g / denom)
+}
+
+// NormalDistributionBeckmann is the beckmann normal distribution function for
+// the roughness parameter a.
+func NormalDistributionBeckmann(n, h mgl32.Vec3, a float32) float32 {
+	nDoth := cgm.Max32(n.Dot(h), 1e-4)
+	a2 := cgm.Max32(a*a, 1e-6)
+	cos2 := nDoth * nDoth
+	e := math.Exp(float64((cos2 - 1) / (a2 * cos2)))
+	return float32(e) / (math.Pi * a2 * cos2 * cos2)
+}
+
+// NormalDistributionBlinnPhong is the normalized blinn-phong normal
+// distribution function. The roughness parameter a is mapped to the phong
+// exponent 2/a^2 - 2 which makes it similar to beckmann.
+func NormalDistributionBlinnPhong(n, h mgl32.Vec3, a float32) float32 {
+	nDoth := cgm.Max32(n.Dot(h), 0)
+	a2 := cgm.Max32(a*a, 1e-6)
+	exponent := 2/a2 - 2
+	return (exponent + 2) / (2 * math.Pi) * float32(math.Pow(float64(nDoth), float64(exponent)))
+}
+
+// GeometrySmithCorrelated is the height-correlated smith geometry term for
+// GGX with the roughness parameter a. Unlike GeometrySmith it accounts for the
+// correlation between masking and shadowing.
+func GeometrySmithCorrelated(l, v, n mgl32.Vec3, a float32) float32 {
+	nDotl := cgm.Max32(n.Dot(l), 0)
+	nDotv := cgm.Max32(n.Dot(v), 0)
+	a2 := a * a
+	ggxv := nDotl * cgm.Sqrt32(nDotv*nDotv*(1-a2)+a2)
+	ggxl := nDotv * cgm.Sqrt32(nDotl*nDotl*(1-a2)+a2)
+	denom := ggxv + ggxl
+	if denom <= 0 {
+		return 0
+	}
+	return 2 * nDotl * nDotv / denom
+}
+
+// VisibilitySmithGGXCorrelated is the height-correlated Smith masking and
+// shadowing term for GGX, already divided by the 4 * (n.l) * (n.v) of the
+// specular BRDF. a is the GGX roughness parameter, typically roughness^2.
+func VisibilitySmithGGXCorrelated(nDotV, nDotL, a float32) float32 {
+	a2 := a * a
+	ggxv := nDotL * cgm.Sqrt32(nDotV*nDotV*(1-a2)+a2)
+	ggxl := nDotV * cgm.Sqrt32(nDotL*nDotL*(1-a2)+a2)
+	denom := ggxv + ggxl
+	if denom <= 0 {
+		return 0
+	}
+	return 0.5 / denom
+}
+
+// GeometryKelemen is the geometry term of Kelemen and Szirmay-Kalos which
+// approximates the cook-torrance geometry term with a cheap visibility term.
+func GeometryKelemen(l, v, n mgl32.Vec3) float32 {
+	h := l.Add(v).Normalize()
+	nDotl := cgm.Max32(n.Dot(l), 0)
+	nDotv := cgm.Max32(n.Dot(v), 0)
+	vDoth := cgm.Max32(v.Dot(h), 1e-4)
+	return nDotl * nDotv / (vDoth * vDoth)
+}
+
+// GeometryImplicit is the implicit geometry term that cancels out the
+// denominator of the microfacet BRDF.
+func GeometryImplicit(l, v, n mgl32.Vec3) float32 {
+	return cgm.Max32(n.Dot(l), 0) * cgm.Max32(n.Dot(v), 0)
+}
+
+// F0ToIor returns the index of refraction of a dielectric with the base
+// reflectivity f0 when the light comes from air.
+func F0ToIor(f0 float32) float32 {
+	s := cgm.Sqrt32(cgm.Clamp(f0, 0, 0.99))
+	return (1 + s) / (1 - s)
+}
+
+// FresnelDielectric is the exact fresnel reflectance for unpolarized light
+// hitting a dielectric with the relative index of refraction eta. cosTheta is
+// the cosine of the angle of incidence.
+func FresnelDielectric(cosTheta, eta float32) float32 {
+	c := float64(cosTheta)
+	g2 := float64(eta*eta) - 1 + c*c
+	// total internal reflection
+	if g2 < 0 {
+		return 1
+	}
+	g := math.Sqrt(g2)
+	a := (g - c) / (g + c)
+	b := (c*(g+c) - 1) / (c*(g-c) + 1)
+	return float32(0.5 * a * a * (1 + b*b))
+}
+
+// FresnelConductor is the exact fresnel reflectance for unpolarized light
+// hitting a conductor with the complex index of refraction eta + i*k per
+// color channel. cosTheta is the cosine of the angle of incidence.
+func FresnelConductor(cosTheta float32, eta, k mgl32.Vec3) mgl32.Vec3 {
+	return mgl32.Vec3{
+		fresnelConductor(cosTheta, eta.X(), k.X()),
+		fresnelConductor(cosTheta, eta.Y(), k.Y()),
+		fresnelConductor(cosTheta, eta.Z(), k.Z()),
+	}
+}
+
+// fresnelConductor evaluates the conductor fresnel for one color channel.
+func fresnelConductor(cosTheta, eta, k float32) float32 {
+	c2 := float64(cosTheta * cosTheta)
+	s2 := 1 - c2
+	eta2 := float64(eta * eta)
+	k2 := float64(k * k)
+
+	t0 := eta2 - k2 - s2
+	a2b2 := math.Sqrt(t0*t0 + 4*eta2*k2)
+	t1 := a2b2 + c2
+	a := math.Sqrt(math.Max(0.5*(a2b2+t0), 0))
+	t2 := 2 * a * float64(cosTheta)
+	rs := (t1 - t2) / (t1 + t2)
+
+	t3 := c2*a2b2 + s2*s2
+	t4 := t2 * s2
+	rp := rs * (t3 - t4) / (t3 + t4)
+
+	return float32(0.5 * (rp + rs))
+}
@@ -0,0 +1,138 @@
+package brdf
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	MICROFACET_PATH            = "../../assets/shaders/pbr/shared/microfacet.glsl"
+	FRESNEL_TOLERANCE  float32 = 1e-5
+	GEOMETRY_TOLERANCE float32 = 1e-5
+)
+
+// every normal distribution function has to integrate to 1 when weighted by
+// the cosine
+func TestVariantNDFNormalization(t *testing.T) {
+	for ndf, name := range NDF_NAMES {
+		model := MakeDefaultModel()
+		model.NDF = ndf
+		for _, r := range roughnesses {
+			norm := model.NDFNormalization(r*r, NDF_SAMPLES)
+			if cgm.Abs32(norm-1) > NDF_TOLERANCE {
+				t.Errorf("%v roughness %.2f: Int D(h) (n.h) dh = %.5f", name, r, norm)
+			}
+		}
+	}
+}
+
+// the geometry terms are visibilities in [0,1] that are symmetric in l and v
+// and don't shadow at normal incidence
+func TestVariantGeometry(t *testing.T) {
+	n := mgl32.Vec3{0, 0, 1}
+	l := mgl32.Vec3{0.6, 0.1, 0.79}.Normalize()
+	v := mgl32.Vec3{-0.3, 0.4, 0.5}.Normalize()
+	for geometry, name := range GEOMETRY_NAMES {
+		model := MakeDefaultModel()
+		model.Geometry = geometry
+		for _, r := range roughnesses {
+			a := r * r
+			g := model.G(l, v, n, a, KDirect(r))
+			if g < 0 || g > 1+GEOMETRY_TOLERANCE {
+				t.Errorf("%v roughness %.2f: G = %v lies outside of [0,1]", name, r, g)
+			}
+			if swapped := model.G(v, l, n, a, KDirect(r)); cgm.Abs32(g-swapped) > GEOMETRY_TOLERANCE {
+				t.Errorf("%v roughness %.2f: G(l,v) = %v but G(v,l) = %v", name, r, g, swapped)
+			}
+			if g := model.G(n, n, n, a, KDirect(r)); cgm.Abs32(g-1) > GEOMETRY_TOLERANCE {
+				t.Errorf("%v roughness %.2f: expected G(n,n) = 1, got %v", name, r, g)
+			}
+		}
+	}
+}
+
+// the exact fresnel terms reflect f0 at normal incidence and everything at
+// grazing angles, and a conductor without absorption is a dielectric
+func TestVariantFresnel(t *testing.T) {
+	for _, f0 := range []float32{0.02, 0.04, 0.08, 0.5} {
+		eta := F0ToIor(f0)
+		if f := FresnelDielectric(1, eta); cgm.Abs32(f-f0) > FRESNEL_TOLERANCE {
+			t.Errorf("f0 %v: expected a dielectric reflectance of f0 at normal incidence, got %v", f0, f)
+		}
+		if f := FresnelDielectric(0, eta); cgm.Abs32(f-1) > FRESNEL_TOLERANCE {
+			t.Errorf("f0 %v: expected a dielectric reflectance of 1 at grazing angles, got %v", f0, f)
+		}
+		for _, c := range []float32{0.1, 0.5, 0.9} {
+			dielectric := FresnelDielectric(c, eta)
+			conductor := FresnelConductor(c, mgl32.Vec3{eta, eta, eta}, mgl32.Vec3{})
+			if cgm.Abs32(conductor.X()-dielectric) > FRESNEL_TOLERANCE {
+				t.Errorf("f0 %v cos %v: conductor %v differs from dielectric %v", f0, c, conductor.X(), dielectric)
+			}
+		}
+	}
+
+	// gold at normal incidence ((eta-1)^2 + k^2) / ((eta+1)^2 + k^2)
+	eta := mgl32.Vec3{0.143, 0.374, 1.442}
+	k := mgl32.Vec3{3.983, 2.385, 1.603}
+	f := FresnelConductor(1, eta, k)
+	for c := 0; c < 3; c++ {
+		expected := ((eta[c]-1)*(eta[c]-1) + k[c]*k[c]) / ((eta[c]+1)*(eta[c]+1) + k[c]*k[c])
+		if cgm.Abs32(f[c]-expected) > FRESNEL_TOLERANCE {
+			t.Errorf("channel %v: expected a conductor reflectance of %v at normal incidence, got %v", c, expected, f[c])
+		}
+	}
+}
+
+// the default model is the specular brdf that had been used before the
+// variants existed
+func TestDefaultModel(t *testing.T) {
+	model := MakeDefaultModel()
+	n := mgl32.Vec3{0, 0, 1}
+	l := mgl32.Vec3{0.6, 0.1, 0.79}.Normalize()
+	v := mgl32.Vec3{-0.3, 0.4, 0.5}.Normalize()
+	f0 := mgl32.Vec3{0.04, 0.5, 0.9}
+	for _, r := range roughnesses {
+		a, k := r*r, KDirect(r)
+		expected := Specular(l, v, n, f0, a, k)
+		if got := model.Specular(l, v, n, f0, a, k); got.Sub(expected).Len() > FRESNEL_TOLERANCE*expected.Len() {
+			t.Errorf("roughness %.2f: expected %v, got %v", r, expected, got)
+		}
+	}
+}
+
+// the values of the variants have to match the defines of microfacet.glsl
+func TestVariantDefines(t *testing.T) {
+	data, err := ioutil.ReadFile(MICROFACET_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := string(data)
+
+	defines := map[string]int{
+		"NDF_GGX":                   NDF_GGX,
+		"NDF_BECKMANN":              NDF_BECKMANN,
+		"NDF_BLINN_PHONG":           NDF_BLINN_PHONG,
+		"GEOMETRY_SMITH_SEPARABLE":  GEOMETRY_SMITH_SEPARABLE,
+		"GEOMETRY_SMITH_CORRELATED": GEOMETRY_SMITH_CORRELATED,
+		"GEOMETRY_KELEMEN":          GEOMETRY_KELEMEN,
+		"GEOMETRY_IMPLICIT":         GEOMETRY_IMPLICIT,
+		"FRESNEL_SCHLICK":           FRESNEL_SCHLICK,
+		"FRESNEL_DIELECTRIC":        FRESNEL_DIELECTRIC,
+		"FRESNEL_CONDUCTOR":         FRESNEL_CONDUCTOR,
+	}
+	for name, expected := range defines {
+		match := regexp.MustCompile(`#define ` + name + `\s+(\d+)`).FindStringSubmatch(source)
+		if match == nil {
+			t.Errorf("%v is not defined", name)
+			continue
+		}
+		if value, _ := strconv.Atoi(match[1]); value != expected {
+			t.Errorf("%v: expected %v, got %v", name, expected, value)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+// Package bvh provides a bounding volume hierarchy over triangle soups to
+// answer spatial queries like ray casts and overlap tests. The hierarchy is
+// built top down using the surface area heuristic (SAH) with binning and is
+// stored as a flat array of nodes that can be uploaded to the GPU.
+package bvh
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/adrianderstroff/pbr/pkg/view/mesh"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// parameters of the construction
+const (
+	BINS            int     = 16
+	MAX_LEAF_SIZE   int     = 4
+	TRAVERSAL_COST  float32 = 1.0 // cost of visiting a node relative to a triangle test
+	INTERSECT_COST  float32 = 1.0
+	PARALLEL_CUTOFF int     = 4096 // minimal number of triangles to build a subtree in parallel
+	// deepest level of the hierarchy. deeper subtrees become leaves with more
+	// than MAX_LEAF_SIZE triangles, which bounds the traversal stack of
+	// bvh.glsl to MAX_DEPTH+1 entries.
+	MAX_DEPTH int = 64
+)
+
+// Node of the hierarchy. The left child of an inner node directly follows its
+// parent in the node array, while Offset is the index of the right child.
+// For leaves Offset is the index of the first of Count triangles.
+type Node struct {
+	Bounds geom.AABB
+	Offset int
+	Count  int
+}
+
+// IsLeaf returns true if the node references triangles.
+func (node *Node) IsLeaf() bool {
+	return node.Count > 0
+}
+
+// BVH is a bounding volume hierarchy over triangles. The triangles are
+// reordered such that each leaf references a contiguous range. Indices maps
+// them back to their position in the original triangle soup.
+type BVH struct {
+	Nodes     []Node
+	Triangles []geom.Triangle
+	Indices   []int
+}
+
+// buildNode is the node of the temporary tree created during construction.
+type buildNode struct {
+	bounds      geom.AABB
+	left, right *buildNode
+	start, end  int
+}
+
+// primitive caches the bounds and centroid of a triangle during construction.
+type primitive struct {
+	bounds   geom.AABB
+	centroid mgl32.Vec3
+	index    int
+}
+
+// Make builds a hierarchy over the triangles. The hierarchy of an empty
+// triangle soup has no nodes and all queries miss.
+func Make(triangles []geom.Triangle) BVH {
+	prims := make([]primitive, len(triangles))
+	for i := range triangles {
+		prims[i] = primitive{
+			bounds:   triangles[i].Bounds(),
+			centroid: triangles[i].Centroid(),
+			index:    i,
+		}
+	}
+
+	// subtrees with many triangles are built in parallel with at most one
+	// worker per cpu
+	var root *buildNode
+	if len(prims) > 0 {
+		sem := make(chan struct{}, runtime.NumCPU())
+		root = build(prims, 0, len(prims), 1, sem)
+	}
+
+	bvh := BVH{
+		Nodes:     []Node{},
+		Triangles: make([]geom.Triangle, len(prims)),
+		Indices:   make([]int, len(prims)),
+	}
+	for i, p := range prims {
+		bvh.Triangles[i] = triangles[p.index]
+		bvh.Indices[i] = p.index
+	}
+	if root != nil {
+		bvh.flatten(root)
+	}
+
+	return bvh
+}
+
+// MakeFromGeometry builds a hierarchy over the triangle soup given by the pos
+// and the optional uv vertex attributes of the geometry.
+func MakeFromGeometry(geometry *mesh.Geometry) (BVH, error) {
+	triangles, err := TrianglesFromGeometry(geometry)
+	if err != nil {
+		return BVH{}, err
+	}
+	return Make(triangles), nil
+}
+
+// TrianglesFromGeometry turns each three consecutive vertices of the geometry
+// into a triangle. The texture coordinates are taken from the uv vertex
+// attribute if the geometry has one.
+func TrianglesFromGeometry(geometry *mesh.Geometry) ([]geom.Triangle, error) {
+	positions, _, err := geometry.Attribute("pos")
+	if err != nil {
+		return nil, err
+	}
+	uvs, _, err := geometry.Attribute("uv")
+	hasuvs := err == nil && len(uvs)/2 == len(positions)/3
+
+	vec3 := func(i int) mgl32.Vec3 {
+		return mgl32.Vec3{positions[3*i], positions[3*i+1], positions[3*i+2]}
+	}
+	vec2 := func(i int) mgl32.Vec2 {
+		return mgl32.Vec2{uvs[2*i], uvs[2*i+1]}
+	}
+
+	triangles := make([]geom.Triangle, 0, len(positions)/9)
+	for v := 0; v+2 < len(positions)/3; v += 3 {
+		tri := geom.MakeTriangle(vec3(v), vec3(v+1), vec3(v+2))
+		if hasuvs {
+			tri.UV0, tri.UV1, tri.UV2 = vec2(v), vec2(v+1), vec2(v+2)
+		}
+		triangles = append(triangles, tri)
+	}
+	return triangles, nil
+}
+
+// Bounds returns the bounding box of all triangles.
+func (bvh *BVH) Bounds() geom.AABB {
+	if len(bvh.Nodes) == 0 {
+		return geom.MakeEmptyAABB()
+	}
+	return bvh.Nodes[0].Bounds
+}
+
+// Depth returns the length of the longest path from the root to a leaf.
+func (bvh *BVH) Depth() int {
+	if len(bvh.Nodes) == 0 {
+		return 0
+	}
+	var depth func(idx int) int
+	depth = func(idx int) int {
+		node := &bvh.Nodes[idx]
+		if node.IsLeaf() {
+			return 1
+		}
+		l, r := depth(idx+1), depth(node.Offset)
+		if l > r {
+			return l + 1
+		}
+		return r + 1
+	}
+	return depth(0)
+}
+
+// SAHCost returns the expected cost of a ray query according to the surface
+// area heuristic. It is used to compare the quality of hierarchies.
+func (bvh *BVH) SAHCost() float32 {
+	if len(bvh.Nodes) == 0 {
+		return 0
+	}
+	rootarea := bvh.Nodes[0].Bounds.SurfaceArea()
+	if rootarea == 0 {
+		return 0
+	}
+
+	var cost float32
+	for i := range bvh.Nodes {
+		node := &bvh.Nodes[i]
+		area := node.Bounds.SurfaceArea() / rootarea
+		if node.IsLeaf() {
+			cost += area * INTERSECT_COST * float32(node.Count)
+		} else {
+			cost += area * TRAVERSAL_COST
+		}
+	}
+	return cost
+}
+
+// build recursively splits the primitives in [start,end) and returns the
+// root of the subtree, which is on the specified level of the hierarchy.
+func build(prims []primitive, start, end, depth int, sem chan struct{}) *buildNode {
+	node := &buildNode{bounds: geom.MakeEmptyAABB(), start: start, end: end}
+	centroids := geom.MakeEmptyAABB()
+	for i := start; i < end; i++ {
+		node.bounds.Union(&prims[i].bounds)
+		centroids.Extend(prims[i].centroid)
+	}
+
+	count := end - start
+	if count <= 1 || depth >= MAX_DEPTH {
+		return node
+	}
+
+	// find the best split. if all centroids coincide they can't be split.
+	axis, split, cost := findSplit(prims[start:end], &centroids, node.bounds.SurfaceArea())
+	leafcost := INTERSECT_COST * float32(count)
+	if axis == -1 || (count <= MAX_LEAF_SIZE && cost >= leafcost) {
+		return node
+	}
+
+	// partition the primitives by the bin of their centroid
+	mid := partition(prims[start:end], func(p *primitive) bool {
+		return binIndex(p.centroid[axis], centroids.Min[axis], centroids.Max[axis]) < split
+	}) + start
+	if mid == start || mid == end {
+		mid = (start + end) / 2
+	}
+
+	// build large subtrees in parallel if a worker is available
+	if count >= PARALLEL_CUTOFF {
+		select {
+		case sem <- struct{}{}:
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				node.left = build(prims, start, mid, depth+1, sem)
+				<-sem
+			}()
+			node.right = build(prims, mid, end, depth+1, sem)
+			wg.Wait()
+			return node
+		default:
+		}
+	}
+
+	node.left = build(prims, start, mid, depth+1, sem)
+	node.right = build(prims, mid, end, depth+1, sem)
+	return node
+}
+
+// findSplit bins the primitives along each axis by their centroid and
+// evaluates the SAH cost of splitting between each pair of adjacent bins. It
+// returns the best axis, the index of the first bin of the right side and the
+// cost of the split relative to the surface area of the parent. The axis is
+// -1 if the primitives can't be split.
+func findSplit(prims []primitive, centroids *geom.AABB, area float32) (int, int, float32) {
+	type bin struct {
+		bounds geom.AABB
+		count  int
+	}
+	if area <= 0 {
+		area = 1
+	}
+
+	bestaxis, bestsplit := -1, 0
+	bestcost := float32(math.Inf(1))
+	for axis := 0; axis < 3; axis++ {
+		lo, hi := centroids.Min[axis], centroids.Max[axis]
+		if hi <= lo {
+			continue
+		}
+
+		bins := make([]bin, BINS)
+		for i := range bins {
+			bins[i].bounds = geom.MakeEmptyAABB()
+		}
+		for i := range prims {
+			b := binIndex(prims[i].centroid[axis], lo, hi)
+			bins[b].count++
+			bins[b].bounds.Union(&prims[i].bounds)
+		}
+
+		// sweep from the right to accumulate the area and count of the right
+		// side of each split
+		rightarea := make([]float32, BINS)
+		rightcount := make([]int, BINS)
+		acc := geom.MakeEmptyAABB()
+		n := 0
+		for i := BINS - 1; i > 0; i-- {
+			acc.Union(&bins[i].bounds)
+			n += bins[i].count
+			rightarea[i] = acc.SurfaceArea()
+			rightcount[i] = n
+		}
+
+		// sweep from the left and evaluate each split
+		acc = geom.MakeEmptyAABB()
+		n = 0
+		for i := 1; i < BINS; i++ {
+			acc.Union(&bins[i-1].bounds)
+			n += bins[i-1].count
+			if n == 0 || rightcount[i] == 0 {
+				continue
+			}
+			cost := TRAVERSAL_COST + INTERSECT_COST*
+				(acc.SurfaceArea()*float32(n)+rightarea[i]*float32(rightcount[i]))/area
+			if cost < bestcost {
+				bestaxis, bestsplit, bestcost = axis, i, cost
+			}
+		}
+	}
+
+	return bestaxis, bestsplit, bestcost
+}
+
+// binIndex returns the bin of the centroid coordinate c within [lo,hi].
+func binIndex(c, lo, hi float32) int {
+	b := int(float32(BINS) * (c - lo) / (hi - lo))
+	if b < 0 {
+		return 0
+	}
+	if b >= BINS {
+		return BINS - 1
+	}
+	return b
+}
+
+// partition reorders the primitives such that all primitives satisfying the
+// predicate come first. It returns the number of these primitives.
+func partition(prims []primitive, pred func(p *primitive) bool) int {
+	i := 0
+	for j := range prims {
+		if pred(&prims[j]) {
+			prims[i], prims[j] = prims[j], prims[i]
+			i++
+		}
+	}
+	return i
+}
+
+// flatten appends the subtree in depth first order to the node array and
+// returns the index of its root.
+func (bvh *BVH) flatten(node *buildNode) int {
+	idx := len(bvh.Nodes)
+	bvh.Nodes = append(bvh.Nodes, Node{Bounds: node.bounds})
+	if node.left == nil {
+		bvh.Nodes[idx].Offset = node.start
+		bvh.Nodes[idx].Count = node.end - node.start
+		return idx
+	}
+
+	bvh.flatten(node.left)
+	right := bvh.flatten(node.right)
+	bvh.Nodes[idx].Offset = right
+	return idx
+}
@@ -0,0 +1,243 @@
+package bvh
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/adrianderstroff/pbr/pkg/io/obj"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	MESH_PATH = "../../assets/objects/gun.obj"
+	SEED      = 42
+	SOUP_SIZE = 20000
+)
+
+var inf = float32(math.Inf(1))
+
+func TestEmpty(t *testing.T) {
+	for _, triangles := range [][]geom.Triangle{nil, {}} {
+		hierarchy := Make(triangles)
+		if len(hierarchy.Nodes) != 0 {
+			t.Fatalf("expected no nodes, got %v", len(hierarchy.Nodes))
+		}
+		ray := geom.MakeRay(mgl32.Vec3{0, 0, -1}, mgl32.Vec3{0, 0, 1})
+		if _, _, ok := hierarchy.ClosestHit(&ray, 0, inf); ok {
+			t.Error("closest hit on an empty hierarchy")
+		}
+		if hierarchy.AnyHit(&ray, 0, inf) {
+			t.Error("any hit on an empty hierarchy")
+		}
+		box := geom.AABB{Min: mgl32.Vec3{-1, -1, -1}, Max: mgl32.Vec3{1, 1, 1}}
+		if indices := hierarchy.Overlap(box); len(indices) != 0 {
+			t.Errorf("overlap on an empty hierarchy returned %v", indices)
+		}
+		if hierarchy.Depth() != 0 || hierarchy.SAHCost() != 0 {
+			t.Error("expected depth and cost of 0")
+		}
+	}
+}
+
+func TestSingleTriangle(t *testing.T) {
+	tri := geom.MakeTriangle(mgl32.Vec3{-1, -1, 0}, mgl32.Vec3{1, -1, 0}, mgl32.Vec3{0, 1, 0})
+	hierarchy := Make([]geom.Triangle{tri})
+	if len(hierarchy.Nodes) != 1 || !hierarchy.Nodes[0].IsLeaf() {
+		t.Fatalf("expected a single leaf, got %+v", hierarchy.Nodes)
+	}
+	ray := geom.MakeRay(mgl32.Vec3{0, 0, -1}, mgl32.Vec3{0, 0, 1})
+	hit, index, ok := hierarchy.ClosestHit(&ray, 0, inf)
+	if !ok || index != 0 || cgm.Abs32(hit.T-1) > 1e-6 {
+		t.Errorf("expected a hit of triangle 0 at t=1, got %v %v %v", ok, index, hit.T)
+	}
+}
+
+func TestClosestHit(t *testing.T) {
+	rnd := rand.New(rand.NewSource(SEED))
+	triangles := makeTriangleSoup(rnd, 2000)
+	hierarchy := Make(triangles)
+	bounds := hierarchy.Bounds()
+
+	for _, ray := range makeRays(rnd, &bounds, 2000) {
+		hit, index, ok := hierarchy.ClosestHit(&ray, 0, inf)
+		bhit, bindex, bok := bruteForce(triangles, &ray)
+		if ok != bok {
+			t.Fatalf("hierarchy hit %v but brute force hit %v", ok, bok)
+		}
+		if ok && (cgm.Abs32(hit.T-bhit.T) > 1e-4*cgm.Max32(1, bhit.T) || (index != bindex && hit.T != bhit.T)) {
+			t.Fatalf("hierarchy hit triangle %v at %v, brute force %v at %v", index, hit.T, bindex, bhit.T)
+		}
+		if hierarchy.AnyHit(&ray, 0, inf) != bok {
+			t.Fatalf("any hit doesn't agree with brute force")
+		}
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	rnd := rand.New(rand.NewSource(SEED))
+	triangles := makeTriangleSoup(rnd, 2000)
+	hierarchy := Make(triangles)
+	bounds := hierarchy.Bounds()
+	size := bounds.Size().Mul(0.05)
+
+	for i := 0; i < 200; i++ {
+		c := randomPoint(rnd, &bounds)
+		box := geom.AABB{Min: c.Sub(size), Max: c.Add(size)}
+
+		found := map[int]bool{}
+		for _, idx := range hierarchy.Overlap(box) {
+			found[idx] = true
+		}
+		for idx := range triangles {
+			tb := triangles[idx].Bounds()
+			if tb.Overlaps(&box) != found[idx] {
+				t.Fatalf("triangle %v overlaps %v but was reported %v", idx, tb.Overlaps(&box), found[idx])
+			}
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	rnd := rand.New(rand.NewSource(SEED))
+	triangles := makeTriangleSoup(rnd, 2000)
+	prims := make([]primitive, len(triangles))
+	for i := range triangles {
+		prims[i] = primitive{bounds: triangles[i].Bounds(), centroid: triangles[i].Centroid(), index: i}
+	}
+
+	// a subtree starting two levels above the deepest level has at most
+	// three levels and its leaves still cover all triangles
+	sem := make(chan struct{}, 1)
+	root := build(prims, 0, len(prims), MAX_DEPTH-2, sem)
+	covered := 0
+	var levels func(node *buildNode) int
+	levels = func(node *buildNode) int {
+		if node.left == nil {
+			covered += node.end - node.start
+			return 1
+		}
+		return 1 + cgm.Maxi(levels(node.left), levels(node.right))
+	}
+	if l := levels(root); l > 3 {
+		t.Errorf("expected at most 3 levels, got %v", l)
+	}
+	if covered != len(triangles) {
+		t.Errorf("leaves cover %v of %v triangles", covered, len(triangles))
+	}
+}
+
+func BenchmarkBuild(b *testing.B) {
+	triangles := loadTriangles(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Make(triangles)
+	}
+}
+
+func BenchmarkClosestHit(b *testing.B) {
+	hierarchy, rays := setupRayBenchmark(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hierarchy.ClosestHit(&rays[i%len(rays)], 0, inf)
+	}
+}
+
+func BenchmarkAnyHit(b *testing.B) {
+	hierarchy, rays := setupRayBenchmark(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hierarchy.AnyHit(&rays[i%len(rays)], 0, inf)
+	}
+}
+
+func BenchmarkOverlap(b *testing.B) {
+	hierarchy := Make(loadTriangles(b))
+	bounds := hierarchy.Bounds()
+	rnd := rand.New(rand.NewSource(SEED))
+
+	// boxes of 1% of the extent of the model
+	size := bounds.Size().Mul(0.01)
+	boxes := make([]geom.AABB, 4096)
+	for i := range boxes {
+		c := randomPoint(rnd, &bounds)
+		boxes[i] = geom.AABB{Min: c.Sub(size), Max: c.Add(size)}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hierarchy.Overlap(boxes[i%len(boxes)])
+	}
+}
+
+// loadTriangles loads the gun model of the pbr demo. If the model isn't
+// available a random triangle soup of similar size is used instead.
+func loadTriangles(b *testing.B) []geom.Triangle {
+	geometry, err := obj.LoadGeometry(MESH_PATH, false, false)
+	if err != nil {
+		b.Logf("%v, using a random triangle soup", err)
+		return makeTriangleSoup(rand.New(rand.NewSource(SEED)), SOUP_SIZE)
+	}
+	triangles, err := TrianglesFromGeometry(&geometry)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return triangles
+}
+
+func setupRayBenchmark(b *testing.B) (BVH, []geom.Ray) {
+	hierarchy := Make(loadTriangles(b))
+	bounds := hierarchy.Bounds()
+	rnd := rand.New(rand.NewSource(SEED))
+	return hierarchy, makeRays(rnd, &bounds, 4096)
+}
+
+// makeTriangleSoup creates small random triangles in the unit cube.
+func makeTriangleSoup(rnd *rand.Rand, count int) []geom.Triangle {
+	unit := geom.AABB{Min: mgl32.Vec3{0, 0, 0}, Max: mgl32.Vec3{1, 1, 1}}
+	triangles := make([]geom.Triangle, count)
+	for i := range triangles {
+		v0 := randomPoint(rnd, &unit)
+		v1 := v0.Add(randomPoint(rnd, &unit).Mul(0.1))
+		v2 := v0.Add(randomPoint(rnd, &unit).Mul(0.1))
+		triangles[i] = geom.MakeTriangle(v0, v1, v2)
+	}
+	return triangles
+}
+
+// makeRays creates rays starting on the bounding sphere of the box that point
+// towards random points inside of the box.
+func makeRays(rnd *rand.Rand, bounds *geom.AABB, count int) []geom.Ray {
+	center := bounds.Center()
+	radius := bounds.Size().Len()
+	rays := make([]geom.Ray, count)
+	for i := range rays {
+		// uniformly distributed direction
+		z := 2*rnd.Float32() - 1
+		phi := 2 * math.Pi * rnd.Float32()
+		r := cgm.Sqrt32(1 - z*z)
+		dir := mgl32.Vec3{r * cgm.Cos32(phi), r * cgm.Sin32(phi), z}
+
+		origin := center.Add(dir.Mul(radius))
+		rays[i] = geom.MakeRay(origin, randomPoint(rnd, bounds).Sub(origin))
+	}
+	return rays
+}
+
+func randomPoint(rnd *rand.Rand, bounds *geom.AABB) mgl32.Vec3 {
+	s := bounds.Size()
+	return bounds.Min.Add(mgl32.Vec3{rnd.Float32() * s.X(), rnd.Float32() * s.Y(), rnd.Float32() * s.Z()})
+}
+
+func bruteForce(triangles []geom.Triangle, ray *geom.Ray) (geom.Hit, int, bool) {
+	closest := geom.Hit{}
+	index := -1
+	tmax := inf
+	for i := range triangles {
+		if hit, ok := triangles[i].IntersectWatertight(ray, 0, tmax); ok {
+			closest, index, tmax = hit, i, hit.T
+		}
+	}
+	return closest, index, index != -1
+}
@@ -0,0 +1,59 @@
+package bvh
+
+import (
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/buffer/ssbo"
+)
+
+// byte sizes of a node and a triangle in the std430 layout of bvh.glsl
+const (
+	NODE_SIZE     int = 8 * 4
+	TRIANGLE_SIZE int = 12 * 4
+)
+
+// NodeData flattens the nodes into two vec4 per node. The first holds the
+// minimum of the bounds and the offset, the second the maximum and the
+// triangle count. The integers are stored bitwise and have to be read with
+// floatBitsToInt in the shader.
+func (bvh *BVH) NodeData() []float32 {
+	data := make([]float32, 0, len(bvh.Nodes)*NODE_SIZE/4)
+	for _, node := range bvh.Nodes {
+		min, max := node.Bounds.Min, node.Bounds.Max
+		data = append(data,
+			min.X(), min.Y(), min.Z(), intBits(node.Offset),
+			max.X(), max.Y(), max.Z(), intBits(node.Count))
+	}
+	return data
+}
+
+// TriangleData flattens the reordered triangles into three vec4 per triangle
+// holding the vertices. The w component of the first vertex stores the index
+// of the triangle in the original triangle soup bitwise.
+func (bvh *BVH) TriangleData() []float32 {
+	data := make([]float32, 0, len(bvh.Triangles)*TRIANGLE_SIZE/4)
+	for i, tri := range bvh.Triangles {
+		data = append(data,
+			tri.V0.X(), tri.V0.Y(), tri.V0.Z(), intBits(bvh.Indices[i]),
+			tri.V1.X(), tri.V1.Y(), tri.V1.Z(), 0,
+			tri.V2.X(), tri.V2.Y(), tri.V2.Z(), 0)
+	}
+	return data
+}
+
+// MakeSSBOs uploads the nodes and triangles into two shader storage buffers
+// that can be bound to the bindings used by bvh.glsl.
+func (bvh *BVH) MakeSSBOs() (ssbo.SSBO, ssbo.SSBO) {
+	nodes := ssbo.Make(NODE_SIZE, len(bvh.Nodes))
+	nodes.UploadArray(bvh.NodeData())
+
+	triangles := ssbo.Make(TRIANGLE_SIZE, len(bvh.Triangles))
+	triangles.UploadArray(bvh.TriangleData())
+
+	return nodes, triangles
+}
+
+// intBits reinterprets the bits of the integer as a float.
+func intBits(i int) float32 {
+	return math.Float32frombits(uint32(int32(i)))
+}
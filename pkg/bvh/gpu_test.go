@@ -0,0 +1,161 @@
+package bvh
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const SHADER_PATH = "../../assets/shaders/pbr/shared/bvh.glsl"
+
+// the sizes of the packed nodes and triangles have to match the structs of
+// bvh.glsl and its stack has to hold the longest path of the hierarchy
+func TestShaderLayout(t *testing.T) {
+	data, err := ioutil.ReadFile(SHADER_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := string(data)
+
+	structs := map[string]int{
+		"BvhNode":     NODE_SIZE,
+		"BvhTriangle": TRIANGLE_SIZE,
+	}
+	for name, size := range structs {
+		match := regexp.MustCompile(`struct ` + name + ` \{([^}]*)\}`).FindStringSubmatch(source)
+		if match == nil {
+			t.Errorf("%v is not declared", name)
+			continue
+		}
+		// only vec4 members keep the std430 layout free of padding
+		members := strings.Count(match[1], ";")
+		vec4s := strings.Count(match[1], "vec4 ")
+		if members != vec4s || vec4s*16 != size {
+			t.Errorf("%v: expected %v bytes of vec4 members, got %v members with %v vec4", name, size, members, vec4s)
+		}
+	}
+
+	match := regexp.MustCompile(`#define BVH_STACK_SIZE (\d+)`).FindStringSubmatch(source)
+	if match == nil {
+		t.Fatal("BVH_STACK_SIZE is not defined")
+	}
+	if size, _ := strconv.Atoi(match[1]); size < MAX_DEPTH+1 {
+		t.Errorf("expected a stack of at least %v entries, got %v", MAX_DEPTH+1, size)
+	}
+}
+
+// a mirror of the traversal of bvh.glsl on the packed data finds the same
+// hits as the traversal of the hierarchy and needs at most one stack entry
+// per level
+func TestShaderTraversal(t *testing.T) {
+	rnd := rand.New(rand.NewSource(SEED))
+	triangles := makeTriangleSoup(rnd, 2000)
+	hierarchy := Make(triangles)
+	bounds := hierarchy.Bounds()
+	nodes, tris := hierarchy.NodeData(), hierarchy.TriangleData()
+	if len(nodes) != len(hierarchy.Nodes)*NODE_SIZE/4 || len(tris) != len(triangles)*TRIANGLE_SIZE/4 {
+		t.Fatalf("expected %v node and %v triangle floats, got %v and %v",
+			len(hierarchy.Nodes)*NODE_SIZE/4, len(triangles)*TRIANGLE_SIZE/4, len(nodes), len(tris))
+	}
+
+	depth := hierarchy.Depth()
+	for _, ray := range makeRays(rnd, &bounds, 2000) {
+		hit, index, ok := hierarchy.ClosestHit(&ray, 0, inf)
+		gt, gindex, stack := shaderClosestHit(nodes, tris, &ray, 0, inf)
+		if ok != (gindex != -1) {
+			t.Fatalf("hierarchy hit %v but the shader traversal hit triangle %v", ok, gindex)
+		}
+		if ok && (cgm.Abs32(hit.T-gt) > 1e-4*cgm.Max32(1, hit.T) || (index != gindex && hit.T != gt)) {
+			t.Fatalf("hierarchy hit triangle %v at %v, shader traversal %v at %v", index, hit.T, gindex, gt)
+		}
+		if stack > depth {
+			t.Fatalf("the shader traversal needed %v stack entries for a depth of %v", stack, depth)
+		}
+	}
+}
+
+// shaderClosestHit mirrors BvhClosestHit of bvh.glsl on the data of NodeData
+// and TriangleData. It returns the ray parameter and the index of the closest
+// hit or -1 on a miss, along with the number of used stack entries.
+func shaderClosestHit(nodes, tris []float32, ray *geom.Ray, tmin, tmax float32) (float32, int, int) {
+	index := -1
+	invdir := ray.InvDirection()
+	stack := []int{0}
+	used := 1
+	for len(stack) > 0 {
+		idx := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node := nodes[idx*NODE_SIZE/4:]
+		bmin := mgl32.Vec3{node[0], node[1], node[2]}
+		bmax := mgl32.Vec3{node[4], node[5], node[6]}
+		if !shaderSlab(ray.Origin, invdir, bmin, bmax, tmin, tmax) {
+			continue
+		}
+
+		offset, count := floatBitsToInt(node[3]), floatBitsToInt(node[7])
+		if count > 0 {
+			for i := offset; i < offset+count; i++ {
+				tri := tris[i*TRIANGLE_SIZE/4:]
+				v0 := mgl32.Vec3{tri[0], tri[1], tri[2]}
+				v1 := mgl32.Vec3{tri[4], tri[5], tri[6]}
+				v2 := mgl32.Vec3{tri[8], tri[9], tri[10]}
+				if t, ok := shaderIntersectTriangle(ray.Origin, ray.Direction, v0, v1, v2, tmin, tmax); ok {
+					tmax, index = t, floatBitsToInt(tri[3])
+				}
+			}
+		} else {
+			stack = append(stack, offset, idx+1)
+			used = cgm.Maxi(used, len(stack))
+		}
+	}
+	return tmax, index, used
+}
+
+// shaderSlab mirrors BvhSlab of bvh.glsl.
+func shaderSlab(o, invdir, bmin, bmax mgl32.Vec3, tmin, tmax float32) bool {
+	tnear, tfar := tmin, tmax
+	for i := 0; i < 3; i++ {
+		t0, t1 := (bmin[i]-o[i])*invdir[i], (bmax[i]-o[i])*invdir[i]
+		tnear = cgm.Max32(tnear, cgm.Min32(t0, t1))
+		tfar = cgm.Min32(tfar, cgm.Max32(t0, t1))
+	}
+	return tnear <= tfar
+}
+
+// shaderIntersectTriangle mirrors BvhIntersectTriangle of bvh.glsl.
+func shaderIntersectTriangle(o, d, v0, v1, v2 mgl32.Vec3, tmin, tmax float32) (float32, bool) {
+	e1, e2 := v1.Sub(v0), v2.Sub(v0)
+	p := d.Cross(e2)
+	det := e1.Dot(p)
+	if cgm.Abs32(det) < 1e-12 {
+		return 0, false
+	}
+	invdet := 1 / det
+
+	s := o.Sub(v0)
+	u := s.Dot(p) * invdet
+	if u < 0 || u > 1 {
+		return 0, false
+	}
+	q := s.Cross(e1)
+	v := d.Dot(q) * invdet
+	if v < 0 || u+v > 1 {
+		return 0, false
+	}
+
+	t := e2.Dot(q) * invdet
+	return t, t >= tmin && t <= tmax
+}
+
+// floatBitsToInt mirrors the glsl function and is the inverse of intBits.
+func floatBitsToInt(f float32) int {
+	return int(int32(math.Float32bits(f)))
+}
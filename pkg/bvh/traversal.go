@@ -0,0 +1,132 @@
+package bvh
+
+import (
+	"github.com/adrianderstroff/pbr/pkg/geom"
+)
+
+// initial capacity of the traversal stack
+const stackSize = 64
+
+// Intersect returns the closest intersection of the ray with any triangle
+// with a ray parameter in [tmin,tmax]. It makes the BVH a geom.Intersectable.
+func (bvh *BVH) Intersect(ray *geom.Ray, tmin, tmax float32) (geom.Hit, bool) {
+	hit, _, ok := bvh.ClosestHit(ray, tmin, tmax)
+	return hit, ok
+}
+
+// ClosestHit returns the closest intersection of the ray with any triangle
+// with a ray parameter in [tmin,tmax] along with the index of the triangle in
+// the original triangle soup. Children are visited front to back to be able
+// to cull nodes behind the closest hit so far.
+func (bvh *BVH) ClosestHit(ray *geom.Ray, tmin, tmax float32) (geom.Hit, int, bool) {
+	if len(bvh.Nodes) == 0 {
+		return geom.Hit{}, -1, false
+	}
+	invdir := ray.InvDirection()
+
+	closest := geom.Hit{}
+	index := -1
+	stack := make([]int, 1, stackSize)
+	for len(stack) > 0 {
+		idx := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node := &bvh.Nodes[idx]
+		if _, _, ok := node.Bounds.Slab(ray, invdir, tmin, tmax); !ok {
+			continue
+		}
+
+		if node.IsLeaf() {
+			for i := node.Offset; i < node.Offset+node.Count; i++ {
+				if hit, ok := bvh.Triangles[i].IntersectWatertight(ray, tmin, tmax); ok {
+					closest, index, tmax = hit, bvh.Indices[i], hit.T
+				}
+			}
+			continue
+		}
+
+		// push the farther child first so that the nearer child is visited
+		// first
+		left, right := idx+1, node.Offset
+		tl, _, okl := bvh.Nodes[left].Bounds.Slab(ray, invdir, tmin, tmax)
+		tr, _, okr := bvh.Nodes[right].Bounds.Slab(ray, invdir, tmin, tmax)
+		switch {
+		case okl && okr:
+			if tl > tr {
+				left, right = right, left
+			}
+			stack = append(stack, right, left)
+		case okl:
+			stack = append(stack, left)
+		case okr:
+			stack = append(stack, right)
+		}
+	}
+
+	return closest, index, index != -1
+}
+
+// AnyHit returns true if the ray intersects any triangle with a ray parameter
+// in [tmin,tmax]. It terminates at the first found intersection, which makes
+// it suitable for shadow and occlusion rays.
+func (bvh *BVH) AnyHit(ray *geom.Ray, tmin, tmax float32) bool {
+	if len(bvh.Nodes) == 0 {
+		return false
+	}
+	invdir := ray.InvDirection()
+
+	stack := make([]int, 1, stackSize)
+	for len(stack) > 0 {
+		idx := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node := &bvh.Nodes[idx]
+		if _, _, ok := node.Bounds.Slab(ray, invdir, tmin, tmax); !ok {
+			continue
+		}
+
+		if node.IsLeaf() {
+			for i := node.Offset; i < node.Offset+node.Count; i++ {
+				if _, ok := bvh.Triangles[i].IntersectWatertight(ray, tmin, tmax); ok {
+					return true
+				}
+			}
+			continue
+		}
+
+		stack = append(stack, node.Offset, idx+1)
+	}
+
+	return false
+}
+
+// Overlap returns the indices of all triangles in the original triangle soup
+// whose bounding boxes overlap the box.
+func (bvh *BVH) Overlap(aabb geom.AABB) []int {
+	indices := []int{}
+	if len(bvh.Nodes) == 0 {
+		return indices
+	}
+
+	stack := make([]int, 1, stackSize)
+	for len(stack) > 0 {
+		idx := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node := &bvh.Nodes[idx]
+		if !node.Bounds.Overlaps(&aabb) {
+			continue
+		}
+
+		if node.IsLeaf() {
+			for i := node.Offset; i < node.Offset+node.Count; i++ {
+				bounds := bvh.Triangles[i].Bounds()
+				if bounds.Overlaps(&aabb) {
+					indices = append(indices, bvh.Indices[i])
+				}
+			}
+			continue
+		}
+
+		stack = append(stack, node.Offset, idx+1)
+	}
+
+	return indices
+}
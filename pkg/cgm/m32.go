@@ -51,3 +51,8 @@ func Asin32(a float32) float32 {
 func Atan232(a, b float32) float32 {
 	return float32(math.Atan2(float64(a), float64(b)))
 }
+
+// Pow32 is a float32 variant of math.Pow which is float64
+func Pow32(a, b float32) float32 {
+	return float32(math.Pow(float64(a), float64(b)))
+}
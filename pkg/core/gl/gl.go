@@ -343,6 +343,12 @@ const (
 	RGB_INTEGER                      = ogl.RGB_INTEGER
 	RGB16F                           = ogl.RGB16F
 	RGB32F                           = ogl.RGB32F
+	R16F                             = ogl.R16F
+	R32F                             = ogl.R32F
+	RG16F                            = ogl.RG16F
+	RG32F                            = ogl.RG32F
+	RGBA16F                          = ogl.RGBA16F
+	RGBA32F                          = ogl.RGBA32F
 	BGR                              = ogl.BGR
 	BGR_INTEGER                      = ogl.BGR_INTEGER
 	RGBA                             = ogl.RGBA
@@ -6,6 +6,7 @@ package shader
 import (
 	"fmt"
 	"io/ioutil"
+	"sort"
 	"strings"
 
 	gl "github.com/adrianderstroff/pbr/pkg/core/gl"
@@ -20,6 +21,14 @@ type Shader struct {
 
 // Make contructs a Shader that consists of a vertex and fragment shader.
 func Make(vertexShaderPath, fragmentShaderPath string) (Shader, error) {
+	return MakeWithDefines(vertexShaderPath, fragmentShaderPath, nil)
+}
+
+// MakeWithDefines contructs a Shader that consists of a vertex and fragment
+// shader. The defines are inserted as #define name value directly after the
+// #version directive of both shaders, which allows to select variants of a
+// shader at compile time.
+func MakeWithDefines(vertexShaderPath, fragmentShaderPath string, defines map[string]string) (Shader, error) {
 	// loads files
 	vertexShaderSource, err := loadFile(vertexShaderPath)
 	if err != nil {
@@ -29,6 +38,8 @@ func Make(vertexShaderPath, fragmentShaderPath string) (Shader, error) {
 	if err != nil {
 		return Shader{}, fmt.Errorf("Error on: %v\n%v", fragmentShaderPath, err)
 	}
+	vertexShaderSource = insertDefines(vertexShaderSource, defines)
+	fragmentShaderSource = insertDefines(fragmentShaderSource, defines)
 
 	// compile shaders
 	vertexShader, err := compileShader(vertexShaderSource, gl.VERTEX_SHADER)
@@ -264,6 +275,17 @@ func (shader *Shader) UpdateVec3(uniformName string, vec3 mgl32.Vec3) {
 	}
 }
 
+// UpdateVec3Slice updates the value of an vec3 slice in the shader.
+func (shader *Shader) UpdateVec3Slice(uniformName string, vec3 []mgl32.Vec3) {
+	if len(vec3) == 0 {
+		return
+	}
+	location := gl.GetUniformLocation(shader.programHandle, gl.Str(uniformName+"\x00"))
+	if location != -1 {
+		gl.Uniform3fv(location, int32(len(vec3)), &vec3[0][0])
+	}
+}
+
 // UpdateMat4 updates the value of an mat4 in the shader.
 func (shader *Shader) UpdateMat4(uniformName string, mat mgl32.Mat4) {
 	location := gl.GetUniformLocation(shader.programHandle, gl.Str(uniformName+"\x00"))
@@ -296,6 +318,38 @@ func loadFileOld(filepath string) (string, error) {
 	return string(bytes), nil
 }
 
+// insertDefines adds a #define directive for each of the defines after the
+// #version directive of the shader source. The defines are sorted by name to
+// get the same source for the same defines.
+func insertDefines(source string, defines map[string]string) string {
+	if len(defines) == 0 {
+		return source
+	}
+
+	names := make([]string, 0, len(defines))
+	for name := range defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var directives string
+	for _, name := range names {
+		directives += "#define " + name + " " + defines[name] + "\n"
+	}
+
+	// the version directive has to stay the first statement of the shader
+	idx := strings.Index(source, "#version")
+	if idx == -1 {
+		return directives + source
+	}
+	end := strings.Index(source[idx:], "\n")
+	if end == -1 {
+		return source + "\n" + directives
+	}
+	end += idx + 1
+	return source[:end] + directives + source[end:]
+}
+
 // compileShader compiles a shader with the specified shaderType.
 func compileShader(source string, shaderType uint32) (uint32, error) {
 	shader := gl.CreateShader(shaderType)
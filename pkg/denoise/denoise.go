@@ -0,0 +1,217 @@
+// Package denoise provides the CPU reference of the screen space denoiser of
+// the pbr renderer. It implements the edge-avoiding à-trous wavelet filter of
+// Dammertz et al. "Edge-Avoiding À-Trous Wavelet Transform for fast Global
+// Illumination Filtering" as a joint bilateral filter guided by the G-buffer,
+// thus the noise is blurred away without blurring across edges in the
+// geometry or the materials. Optionally the filter is extended to the
+// spatiotemporal variance-guided filter of Schied et al. "Spatiotemporal
+// Variance-Guided Filtering: Real-Time Reconstruction for Path-Traced Global
+// Illumination", which steers the luminance weights by the estimated variance
+// of each pixel and accumulates the samples of previous frames by
+// reprojecting them into the current frame.
+package denoise
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Options of the denoiser. Iterations is the number of à-trous passes, where
+// pass i uses a step size of 2^i pixels. SigmaNormal is the exponent of the
+// cosine between the normals, SigmaDepth scales the depth difference that is
+// tolerated along the depth gradient and SigmaMaterial the sum of absolute
+// differences of albedo, metallic, roughness and ambient occlusion. If
+// Variance is set the luminance differences are compared against
+// SigmaLuminance times the standard deviation of the luminance, otherwise
+// against SigmaColor, where a SigmaColor of 0 disables the luminance weight.
+// If Temporal is set the previous frames are blended in with a weight of
+// Alpha.
+type Options struct {
+	Iterations     int
+	SigmaNormal    float32
+	SigmaDepth     float32
+	SigmaMaterial  float32
+	SigmaLuminance float32
+	SigmaColor     float32
+	Variance       bool
+	Temporal       bool
+	Alpha          float32
+}
+
+// MakeDefaultOptions returns the options of the spatiotemporal
+// variance-guided filter with the parameters of Schied et al.
+func MakeDefaultOptions() Options {
+	return Options{
+		Iterations:     5,
+		SigmaNormal:    128,
+		SigmaDepth:     1,
+		SigmaMaterial:  0.1,
+		SigmaLuminance: 4,
+		SigmaColor:     0.1,
+		Variance:       true,
+		Temporal:       true,
+		Alpha:          0.2,
+	}
+}
+
+// GBuffer holds the attachments of the G-buffer the denoiser is guided by.
+// Normal stores the normals mapped to [0,1] and Depth the window space depth
+// in [0,1], where pixels with a depth of 1 are background and are left
+// untouched. Metallic, Roughness and AO are read from their first channel.
+// The first row of all images is the top of the viewport like in images
+// returned by image2d.MakeFromFrameBuffer.
+type GBuffer struct {
+	Albedo    *image2d.Image2D
+	Normal    *image2d.Image2D
+	Metallic  *image2d.Image2D
+	Roughness *image2d.Image2D
+	AO        *image2d.Image2D
+	Depth     *image2d.Image2D
+}
+
+// Denoiser filters a sequence of frames. The history of the previous frame
+// is kept for the temporal reprojection.
+type Denoiser struct {
+	width   int
+	height  int
+	options Options
+	// history of the previous frame
+	valid          bool
+	color          []mgl32.Vec3
+	moments        []mgl32.Vec2
+	length         []float32
+	surfaces       []surface
+	viewProjection mgl32.Mat4
+}
+
+// Make creates a Denoiser for frames of the specified size.
+func Make(width, height int, options Options) Denoiser {
+	return Denoiser{
+		width:   width,
+		height:  height,
+		options: options,
+	}
+}
+
+// SetOptions changes the options of the denoiser.
+func (denoiser *Denoiser) SetOptions(options Options) {
+	denoiser.options = options
+}
+
+// Reset discards the history, e.g. after a camera cut.
+func (denoiser *Denoiser) Reset() {
+	denoiser.valid = false
+}
+
+// Denoise filters the noisy color guided by the G-buffer and returns the
+// result as float image with three channels. viewProjection is the product of
+// the projection and view matrix the frame has been rendered with, which is
+// used to reproject the pixels into the previous frame.
+func (denoiser *Denoiser) Denoise(color *image2d.Image2D, gbuffer *GBuffer, viewProjection mgl32.Mat4) (image2d.Image2D, error) {
+	if err := denoiser.check(color, gbuffer); err != nil {
+		return image2d.Image2D{}, err
+	}
+	options := denoiser.options
+	count := denoiser.width * denoiser.height
+
+	surfaces := denoiser.makeSurfaces(gbuffer)
+	noisy := make([]mgl32.Vec3, count)
+	for i := range noisy {
+		x, y := i%denoiser.width, i/denoiser.width
+		noisy[i] = mgl32.Vec3{color.GetFloat32(x, y, 0), color.GetFloat32(x, y, 1), color.GetFloat32(x, y, 2)}
+	}
+
+	// accumulate the previous frames
+	integrated, moments, length := noisy, make([]mgl32.Vec2, count), make([]float32, count)
+	if options.Temporal && denoiser.valid {
+		integrated, moments, length = denoiser.reproject(noisy, surfaces, viewProjection)
+	} else {
+		for i, c := range noisy {
+			l := luminance(c)
+			moments[i] = mgl32.Vec2{l, l * l}
+			length[i] = 1
+		}
+	}
+
+	// estimate the variance from the temporal moments or spatially if the
+	// history is too short
+	variance := make([]float32, count)
+	if options.Variance {
+		forEachRow(denoiser.height, func(y int) {
+			for x := 0; x < denoiser.width; x++ {
+				i := y*denoiser.width + x
+				if surfaces[i].background {
+					continue
+				}
+				if options.Temporal && length[i] >= MIN_HISTORY {
+					variance[i] = cgm.Max32(moments[i].Y()-moments[i].X()*moments[i].X(), 0)
+				} else {
+					variance[i] = denoiser.spatialVariance(x, y, integrated, surfaces)
+				}
+			}
+		})
+	}
+
+	// the output of the first iteration is the history of the next frame
+	filtered := integrated
+	history := integrated
+	for i := 0; i < options.Iterations; i++ {
+		filtered, variance = denoiser.atrous(filtered, variance, surfaces, 1<<uint(i))
+		if i == 0 {
+			history = filtered
+		}
+	}
+
+	denoiser.valid = true
+	denoiser.color = history
+	denoiser.moments = moments
+	denoiser.length = length
+	denoiser.surfaces = surfaces
+	denoiser.viewProjection = viewProjection
+
+	out, err := image2d.MakeFloat32(denoiser.width, denoiser.height, 3)
+	if err != nil {
+		return image2d.Image2D{}, err
+	}
+	for i, c := range filtered {
+		if surfaces[i].background {
+			c = noisy[i]
+		}
+		x, y := i%denoiser.width, i/denoiser.width
+		for ch := 0; ch < 3; ch++ {
+			out.SetFloat32(x, y, ch, c[ch])
+		}
+	}
+	return out, nil
+}
+
+// check validates the sizes and channels of the images.
+func (denoiser *Denoiser) check(color *image2d.Image2D, gbuffer *GBuffer) error {
+	if color.GetChannels() < 3 {
+		return errors.New("color needs at least three channels")
+	}
+	images := []*image2d.Image2D{color, gbuffer.Albedo, gbuffer.Normal, gbuffer.Metallic,
+		gbuffer.Roughness, gbuffer.AO, gbuffer.Depth}
+	for _, img := range images {
+		if img == nil {
+			return errors.New("G-buffer is incomplete")
+		}
+		if img.GetWidth() != denoiser.width || img.GetHeight() != denoiser.height {
+			return fmt.Errorf("image of size %vx%v doesn't match the denoiser of size %vx%v",
+				img.GetWidth(), img.GetHeight(), denoiser.width, denoiser.height)
+		}
+	}
+	if gbuffer.Albedo.GetChannels() < 3 || gbuffer.Normal.GetChannels() < 3 {
+		return errors.New("albedo and normal need at least three channels")
+	}
+	return nil
+}
+
+// luminance returns the relative luminance of the linear color c.
+func luminance(c mgl32.Vec3) float32 {
+	return 0.2126*c.X() + 0.7152*c.Y() + 0.0722*c.Z()
+}
@@ -0,0 +1,281 @@
+package denoise
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	WIDTH  int = 32
+	HEIGHT int = 32
+	SEED       = 42
+)
+
+// pixel is the G-buffer of a single pixel of a test scene.
+type pixel struct {
+	albedo mgl32.Vec3
+	normal mgl32.Vec3
+	depth  float32
+}
+
+// flat is a grey surface facing the camera.
+func flat(x, y int) pixel {
+	return pixel{albedo: mgl32.Vec3{0.5, 0.5, 0.5}, normal: mgl32.Vec3{0, 0, 1}, depth: 0.5}
+}
+
+func TestNoiseReduction(t *testing.T) {
+	rnd := rand.New(rand.NewSource(SEED))
+	options := MakeDefaultOptions()
+	options.Temporal = false
+	denoiser := Make(WIDTH, HEIGHT, options)
+
+	gbuffer := makeGBuffer(t, flat)
+	color := makeColor(t, func(x, y int) mgl32.Vec3 { return noisy(rnd, 0.5) })
+	out, err := denoiser.Denoise(&color, &gbuffer, mgl32.Ident4())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, after := variance(&color), variance(&out)
+	if after > before/10 {
+		t.Errorf("expected the variance to drop from %v by at least a factor 10, got %v", before, after)
+	}
+}
+
+func TestEdges(t *testing.T) {
+	scenes := map[string]func(x, y int) pixel{
+		"albedo": func(x, y int) pixel {
+			p := flat(x, y)
+			if x >= WIDTH/2 {
+				p.albedo = mgl32.Vec3{0.9, 0.1, 0.1}
+			}
+			return p
+		},
+		"normal": func(x, y int) pixel {
+			p := flat(x, y)
+			if x >= WIDTH/2 {
+				p.normal = mgl32.Vec3{1, 0, 0}
+			}
+			return p
+		},
+		"depth": func(x, y int) pixel {
+			p := flat(x, y)
+			if x >= WIDTH/2 {
+				p.depth = 0.9
+			}
+			return p
+		},
+	}
+
+	// the luminance weight is disabled so that only the G-buffer stops the
+	// filter at the edge
+	options := MakeDefaultOptions()
+	options.Temporal = false
+	options.Variance = false
+	options.SigmaColor = 0
+
+	side := func(x, y int) mgl32.Vec3 {
+		if x >= WIDTH/2 {
+			return mgl32.Vec3{1, 1, 1}
+		}
+		return mgl32.Vec3{0, 0, 0}
+	}
+	for name, scene := range scenes {
+		denoiser := Make(WIDTH, HEIGHT, options)
+		gbuffer := makeGBuffer(t, scene)
+		color := makeColor(t, side)
+		out, err := denoiser.Denoise(&color, &gbuffer, mgl32.Ident4())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < HEIGHT; y++ {
+			for x := 0; x < WIDTH; x++ {
+				if d := cgm.Abs32(out.GetFloat32(x, y, 0) - side(x, y).X()); d > 1e-3 {
+					t.Fatalf("%v edge: pixel (%v,%v) bled by %v", name, x, y, d)
+				}
+			}
+		}
+	}
+}
+
+func TestBackground(t *testing.T) {
+	rnd := rand.New(rand.NewSource(SEED))
+	denoiser := Make(WIDTH, HEIGHT, MakeDefaultOptions())
+
+	// the upper half is background
+	scene := func(x, y int) pixel {
+		p := flat(x, y)
+		if y < HEIGHT/2 {
+			p.depth = 1
+		}
+		return p
+	}
+	gbuffer := makeGBuffer(t, scene)
+	for frame := 0; frame < 3; frame++ {
+		color := makeColor(t, func(x, y int) mgl32.Vec3 { return noisy(rnd, 0.5) })
+		out, err := denoiser.Denoise(&color, &gbuffer, mgl32.Ident4())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < HEIGHT/2; y++ {
+			for x := 0; x < WIDTH; x++ {
+				for c := 0; c < 3; c++ {
+					if out.GetFloat32(x, y, c) != color.GetFloat32(x, y, c) {
+						t.Fatalf("frame %v: background pixel (%v,%v) changed", frame, x, y)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestTemporalAccumulation(t *testing.T) {
+	rnd := rand.New(rand.NewSource(SEED))
+
+	// without spatial filtering the reduction is only due to the history
+	options := MakeDefaultOptions()
+	options.Iterations = 0
+	denoiser := Make(WIDTH, HEIGHT, options)
+
+	gbuffer := makeGBuffer(t, flat)
+	var first, last float32
+	for frame := 0; frame < 16; frame++ {
+		color := makeColor(t, func(x, y int) mgl32.Vec3 { return noisy(rnd, 0.5) })
+		out, err := denoiser.Denoise(&color, &gbuffer, mgl32.Ident4())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame == 0 {
+			first = variance(&out)
+		}
+		last = variance(&out)
+	}
+
+	// blending with alpha reduces the variance to alpha/(2-alpha)
+	expected := options.Alpha / (2 - options.Alpha)
+	if last > 2*expected*first {
+		t.Errorf("expected the variance to drop from %v to about %v, got %v", first, expected*first, last)
+	}
+}
+
+func TestHistoryRejection(t *testing.T) {
+	options := MakeDefaultOptions()
+	options.Iterations = 0
+
+	changes := map[string]func(x, y int) pixel{
+		"same": flat,
+		"normal": func(x, y int) pixel {
+			p := flat(x, y)
+			p.normal = mgl32.Vec3{1, 0, 0}
+			return p
+		},
+		"depth": func(x, y int) pixel {
+			p := flat(x, y)
+			p.depth = 0.9
+			return p
+		},
+	}
+	black := func(x, y int) mgl32.Vec3 { return mgl32.Vec3{0, 0, 0} }
+	white := func(x, y int) mgl32.Vec3 { return mgl32.Vec3{1, 1, 1} }
+
+	for name, change := range changes {
+		denoiser := Make(WIDTH, HEIGHT, options)
+		previous := makeGBuffer(t, flat)
+		color := makeColor(t, black)
+		if _, err := denoiser.Denoise(&color, &previous, mgl32.Ident4()); err != nil {
+			t.Fatal(err)
+		}
+
+		current := makeGBuffer(t, change)
+		color = makeColor(t, white)
+		out, err := denoiser.Denoise(&color, &current, mgl32.Ident4())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// an accepted history of one frame is blended with a weight of 1/2
+		expected := float32(1)
+		if name == "same" {
+			expected = 0.5
+		}
+		if v := out.GetFloat32(WIDTH/2, HEIGHT/2, 0); cgm.Abs32(v-expected) > 1e-5 {
+			t.Errorf("%v: expected %v, got %v", name, expected, v)
+		}
+	}
+}
+
+// makeGBuffer creates the G-buffer of the specified scene.
+func makeGBuffer(t *testing.T, scene func(x, y int) pixel) GBuffer {
+	images := make([]image2d.Image2D, 6)
+	for i := range images {
+		img, err := image2d.MakeFloat32(WIDTH, HEIGHT, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		images[i] = img
+	}
+	gbuffer := GBuffer{
+		Albedo:    &images[0],
+		Normal:    &images[1],
+		Metallic:  &images[2],
+		Roughness: &images[3],
+		AO:        &images[4],
+		Depth:     &images[5],
+	}
+	for y := 0; y < HEIGHT; y++ {
+		for x := 0; x < WIDTH; x++ {
+			p := scene(x, y)
+			n := p.normal.Add(mgl32.Vec3{1, 1, 1}).Mul(0.5)
+			for c := 0; c < 3; c++ {
+				gbuffer.Albedo.SetFloat32(x, y, c, p.albedo[c])
+				gbuffer.Normal.SetFloat32(x, y, c, n[c])
+			}
+			gbuffer.Roughness.SetFloat32(x, y, 0, 0.5)
+			gbuffer.AO.SetFloat32(x, y, 0, 1)
+			gbuffer.Depth.SetFloat32(x, y, 0, p.depth)
+		}
+	}
+	return gbuffer
+}
+
+// makeColor creates the color image with the specified color per pixel.
+func makeColor(t *testing.T, color func(x, y int) mgl32.Vec3) image2d.Image2D {
+	img, err := image2d.MakeFloat32(WIDTH, HEIGHT, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < HEIGHT; y++ {
+		for x := 0; x < WIDTH; x++ {
+			c := color(x, y)
+			for ch := 0; ch < 3; ch++ {
+				img.SetFloat32(x, y, ch, c[ch])
+			}
+		}
+	}
+	return img
+}
+
+// noisy returns a grey color whose value is uniformly distributed around mean.
+func noisy(rnd *rand.Rand, mean float32) mgl32.Vec3 {
+	v := mean + rnd.Float32() - 0.5
+	return mgl32.Vec3{v, v, v}
+}
+
+// variance returns the variance of the first channel of the image.
+func variance(img *image2d.Image2D) float32 {
+	var sum, sum2 float32
+	for y := 0; y < img.GetHeight(); y++ {
+		for x := 0; x < img.GetWidth(); x++ {
+			v := img.GetFloat32(x, y, 0)
+			sum += v
+			sum2 += v * v
+		}
+	}
+	n := float32(img.GetWidth() * img.GetHeight())
+	mean := sum / n
+	return sum2/n - mean*mean
+}
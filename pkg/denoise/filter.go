@@ -0,0 +1,153 @@
+package denoise
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// weights of the 5x5 B3 spline kernel of the à-trous wavelet transform
+var kernel = [5]float32{1.0 / 16, 1.0 / 4, 3.0 / 8, 1.0 / 4, 1.0 / 16}
+
+// weights of the 3x3 gaussian the variance is prefiltered with, indexed by
+// the distance to the center in x plus the distance in y
+var gaussian = [3]float32{1.0 / 4, 1.0 / 8, 1.0 / 16}
+
+// atrous applies one iteration of the edge-avoiding à-trous filter with the
+// specified step size between the taps. The variance is filtered with the
+// squared weights, such that it stays the variance of the filtered color.
+func (denoiser *Denoiser) atrous(color []mgl32.Vec3, variance []float32, surfaces []surface, step int) ([]mgl32.Vec3, []float32) {
+	w, h := denoiser.width, denoiser.height
+	outColor := make([]mgl32.Vec3, len(color))
+	outVariance := make([]float32, len(variance))
+
+	forEachRow(h, func(y int) {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			p := &surfaces[i]
+			if p.background {
+				outColor[i], outVariance[i] = color[i], variance[i]
+				continue
+			}
+
+			lp := luminance(color[i])
+			stddev := cgm.Sqrt32(denoiser.prefilterVariance(variance, surfaces, x, y))
+
+			var sumColor mgl32.Vec3
+			var sumWeight, sumVariance float32
+			for ky := -2; ky <= 2; ky++ {
+				for kx := -2; kx <= 2; kx++ {
+					qx, qy := x+kx*step, y+ky*step
+					if qx < 0 || qy < 0 || qx >= w || qy >= h {
+						continue
+					}
+					j := qy*w + qx
+					q := &surfaces[j]
+					if q.background {
+						continue
+					}
+
+					offset := mgl32.Vec2{float32(kx * step), float32(ky * step)}
+					weight := kernel[kx+2] * kernel[ky+2] * denoiser.weight(p, q, offset) *
+						denoiser.luminanceWeight(lp, luminance(color[j]), stddev)
+
+					sumColor = sumColor.Add(color[j].Mul(weight))
+					sumWeight += weight
+					sumVariance += weight * weight * variance[j]
+				}
+			}
+
+			if sumWeight == 0 {
+				outColor[i], outVariance[i] = color[i], variance[i]
+				continue
+			}
+			outColor[i] = sumColor.Mul(1 / sumWeight)
+			outVariance[i] = sumVariance / (sumWeight * sumWeight)
+		}
+	})
+
+	return outColor, outVariance
+}
+
+// prefilterVariance returns the variance at (x,y) blurred with a 3x3
+// gaussian, which makes the luminance weights more robust.
+func (denoiser *Denoiser) prefilterVariance(variance []float32, surfaces []surface, x, y int) float32 {
+	var sum, weights float32
+	for ky := -1; ky <= 1; ky++ {
+		for kx := -1; kx <= 1; kx++ {
+			qx, qy := x+kx, y+ky
+			if qx < 0 || qy < 0 || qx >= denoiser.width || qy >= denoiser.height {
+				continue
+			}
+			j := qy*denoiser.width + qx
+			if surfaces[j].background {
+				continue
+			}
+			g := gaussian[cgm.Absi(kx)+cgm.Absi(ky)]
+			sum += g * variance[j]
+			weights += g
+		}
+	}
+	if weights == 0 {
+		return 0
+	}
+	return sum / weights
+}
+
+// spatialVariance estimates the variance of the luminance at (x,y) from the
+// surrounding pixels that belong to the same surface.
+func (denoiser *Denoiser) spatialVariance(x, y int, color []mgl32.Vec3, surfaces []surface) float32 {
+	p := &surfaces[y*denoiser.width+x]
+	var m1, m2, weights float32
+	r := VARIANCE_RADIUS
+	for ky := -r; ky <= r; ky++ {
+		for kx := -r; kx <= r; kx++ {
+			qx, qy := x+kx, y+ky
+			if qx < 0 || qy < 0 || qx >= denoiser.width || qy >= denoiser.height {
+				continue
+			}
+			j := qy*denoiser.width + qx
+			q := &surfaces[j]
+			if q.background {
+				continue
+			}
+
+			weight := denoiser.weight(p, q, mgl32.Vec2{float32(kx), float32(ky)})
+			l := luminance(color[j])
+			m1 += weight * l
+			m2 += weight * l * l
+			weights += weight
+		}
+	}
+	if weights == 0 {
+		return 0
+	}
+	m1 /= weights
+	m2 /= weights
+	return cgm.Max32(m2-m1*m1, 0)
+}
+
+// forEachRow calls filter for each row. The rows are distributed among all
+// available CPUs, thus filter must only write to the row it has been called
+// for.
+func forEachRow(height int, filter func(y int)) {
+	rows := make(chan int, height)
+	for y := 0; y < height; y++ {
+		rows <- y
+	}
+	close(rows)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := range rows {
+				filter(y)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,139 @@
+package denoise
+
+import (
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Constants shared with the shaders in assets/shaders/denoise.
+const (
+	// number of frames after which the variance is estimated temporally
+	MIN_HISTORY float32 = 4
+	// radius of the window of the spatial variance estimate
+	VARIANCE_RADIUS int = 3
+	// largest distance of a reprojected surface relative to its view depth
+	REPROJECTION_DEPTH float32 = 0.05
+	// smallest cosine between the normals of a reprojected surface
+	REPROJECTION_NORMAL float32 = 0.9
+	// prevents divisions by zero in the depth and luminance weights
+	WEIGHT_EPS float32 = 1e-6
+)
+
+// surface is the decoded G-buffer of one pixel. gradient is the change of
+// the depth per pixel in x and y direction and material holds the albedo,
+// metallic, roughness and ambient occlusion.
+type surface struct {
+	normal     mgl32.Vec3
+	depth      float32
+	gradient   mgl32.Vec2
+	material   [6]float32
+	background bool
+}
+
+// makeSurfaces decodes the G-buffer of all pixels.
+func (denoiser *Denoiser) makeSurfaces(gbuffer *GBuffer) []surface {
+	w, h := denoiser.width, denoiser.height
+	surfaces := make([]surface, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			s := &surfaces[y*w+x]
+			s.depth = gbuffer.Depth.GetFloat32(x, y, 0)
+			s.background = s.depth >= 1
+			n := mgl32.Vec3{
+				gbuffer.Normal.GetFloat32(x, y, 0),
+				gbuffer.Normal.GetFloat32(x, y, 1),
+				gbuffer.Normal.GetFloat32(x, y, 2),
+			}.Mul(2).Sub(mgl32.Vec3{1, 1, 1})
+			if n.Len() > 0 {
+				s.normal = n.Normalize()
+			}
+			s.material = [6]float32{
+				gbuffer.Albedo.GetFloat32(x, y, 0),
+				gbuffer.Albedo.GetFloat32(x, y, 1),
+				gbuffer.Albedo.GetFloat32(x, y, 2),
+				gbuffer.Metallic.GetFloat32(x, y, 0),
+				gbuffer.Roughness.GetFloat32(x, y, 0),
+				gbuffer.AO.GetFloat32(x, y, 0),
+			}
+		}
+	}
+
+	// the smaller one sided difference doesn't cross depth discontinuities
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			s := &surfaces[y*w+x]
+			if s.background {
+				continue
+			}
+			s.gradient = mgl32.Vec2{
+				denoiser.derivative(surfaces, x, y, 1, 0),
+				denoiser.derivative(surfaces, x, y, 0, 1),
+			}
+		}
+	}
+	return surfaces
+}
+
+// derivative returns the one sided difference of the depth at (x,y) in the
+// direction (dx,dy) with the smaller magnitude, ignoring background pixels.
+func (denoiser *Denoiser) derivative(surfaces []surface, x, y, dx, dy int) float32 {
+	z := surfaces[y*denoiser.width+x].depth
+	d := float32(math.Inf(1))
+	for _, sign := range []int{-1, 1} {
+		nx, ny := x+sign*dx, y+sign*dy
+		if nx < 0 || ny < 0 || nx >= denoiser.width || ny >= denoiser.height {
+			continue
+		}
+		q := &surfaces[ny*denoiser.width+nx]
+		if q.background {
+			continue
+		}
+		if diff := float32(sign) * (q.depth - z); cgm.Abs32(diff) < cgm.Abs32(d) {
+			d = diff
+		}
+	}
+	if math.IsInf(float64(d), 0) {
+		return 0
+	}
+	return d
+}
+
+// weight returns the edge stopping weight between the surfaces p and q that
+// are offset pixels apart, which is the product of the normal, depth and
+// material weights.
+func (denoiser *Denoiser) weight(p, q *surface, offset mgl32.Vec2) float32 {
+	options := &denoiser.options
+
+	wn := cgm.Pow32(cgm.Max32(p.normal.Dot(q.normal), 0), options.SigmaNormal)
+
+	dz := cgm.Abs32(p.depth - q.depth)
+	wz := float32(math.Exp(float64(-dz / (options.SigmaDepth*cgm.Abs32(p.gradient.Dot(offset)) + WEIGHT_EPS))))
+
+	var dm float32
+	for i := range p.material {
+		dm += cgm.Abs32(p.material[i] - q.material[i])
+	}
+	wm := float32(1)
+	if options.SigmaMaterial > 0 {
+		wm = float32(math.Exp(float64(-dm / options.SigmaMaterial)))
+	}
+
+	return wn * wz * wm
+}
+
+// luminanceWeight returns the weight of the luminance difference between
+// lp and lq. stddev is the filtered standard deviation of the luminance at
+// the center pixel, which is only used for variance guided weights.
+func (denoiser *Denoiser) luminanceWeight(lp, lq, stddev float32) float32 {
+	options := &denoiser.options
+	dl := cgm.Abs32(lp - lq)
+	if options.Variance {
+		return float32(math.Exp(float64(-dl / (options.SigmaLuminance*stddev + WEIGHT_EPS))))
+	}
+	if options.SigmaColor <= 0 {
+		return 1
+	}
+	return float32(math.Exp(float64(-dl / options.SigmaColor)))
+}
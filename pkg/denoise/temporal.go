@@ -0,0 +1,94 @@
+package denoise
+
+import (
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// reproject finds the surface of each pixel in the previous frame and blends
+// the history with the noisy color and its luminance moments. The history is
+// blended with a weight of Alpha, but at least with the weight of the average
+// of all accumulated frames, such that short histories converge quickly.
+// Pixels whose surface has been occluded or wasn't visible in the previous
+// frame start a new history. Returns the integrated colors, moments and the
+// lengths of the histories.
+func (denoiser *Denoiser) reproject(noisy []mgl32.Vec3, surfaces []surface, viewProjection mgl32.Mat4) ([]mgl32.Vec3, []mgl32.Vec2, []float32) {
+	w, h := denoiser.width, denoiser.height
+	integrated := make([]mgl32.Vec3, len(noisy))
+	moments := make([]mgl32.Vec2, len(noisy))
+	length := make([]float32, len(noisy))
+
+	inverse := viewProjection.Inv()
+	previousInverse := denoiser.viewProjection.Inv()
+	forEachRow(h, func(y int) {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			l := luminance(noisy[i])
+			integrated[i] = noisy[i]
+			moments[i] = mgl32.Vec2{l, l * l}
+			length[i] = 1
+
+			j, ok := denoiser.previousPixel(x, y, surfaces, inverse, previousInverse)
+			if !ok {
+				continue
+			}
+
+			length[i] = denoiser.length[j] + 1
+			alpha := cgm.Max32(denoiser.options.Alpha, 1/length[i])
+			integrated[i] = denoiser.color[j].Add(noisy[i].Sub(denoiser.color[j]).Mul(alpha))
+			moments[i] = denoiser.moments[j].Add(moments[i].Sub(denoiser.moments[j]).Mul(alpha))
+		}
+	})
+
+	return integrated, moments, length
+}
+
+// previousPixel returns the index of the pixel that showed the surface of the
+// pixel (x,y) in the previous frame. The position of the pixel is
+// reconstructed from its depth and projected into the previous frame. The
+// previous pixel is only valid if its reconstructed position is close to that
+// position and its normal is similar.
+func (denoiser *Denoiser) previousPixel(x, y int, surfaces []surface, inverse, previousInverse mgl32.Mat4) (int, bool) {
+	w, h := denoiser.width, denoiser.height
+	p := &surfaces[y*w+x]
+	if p.background {
+		return 0, false
+	}
+
+	position := unproject(float32(x)+0.5, float32(y)+0.5, p.depth, w, h, inverse)
+	clip := denoiser.viewProjection.Mul4x1(position.Vec4(1))
+	if clip.W() <= 0 {
+		return 0, false
+	}
+	ndc := clip.Vec3().Mul(1 / clip.W())
+	px := int(cgm.Floor32((ndc.X() + 1) / 2 * float32(w)))
+	py := int(cgm.Floor32((1 - ndc.Y()) / 2 * float32(h)))
+	if px < 0 || py < 0 || px >= w || py >= h {
+		return 0, false
+	}
+
+	j := py*w + px
+	q := &denoiser.surfaces[j]
+	if q.background || p.normal.Dot(q.normal) < REPROJECTION_NORMAL {
+		return 0, false
+	}
+	previous := unproject(float32(px)+0.5, float32(py)+0.5, q.depth, w, h, previousInverse)
+	if previous.Sub(position).Len() > REPROJECTION_DEPTH*clip.W() {
+		return 0, false
+	}
+	return j, true
+}
+
+// unproject returns the world space position at the pixel coordinates (x,y)
+// with the window space depth z for the inverse of the view projection
+// matrix.
+func unproject(x, y, z float32, width, height int, inverse mgl32.Mat4) mgl32.Vec3 {
+	ndc := mgl32.Vec4{
+		2*x/float32(width) - 1,
+		1 - 2*y/float32(height),
+		2*z - 1,
+		1,
+	}
+	p := inverse.Mul4x1(ndc)
+	return p.Vec3().Mul(1 / p.W())
+}
@@ -0,0 +1,346 @@
+// Package envmap provides CPU side representations of environment maps that
+// can be sampled by direction, like cube maps and equirectangular images.
+package envmap
+
+import (
+	"errors"
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Indices of the cube map faces. They follow the order of the OpenGL cube map
+// targets starting at gl.TEXTURE_CUBE_MAP_POSITIVE_X.
+const (
+	FACE_RIGHT  = 0 // +x
+	FACE_LEFT   = 1 // -x
+	FACE_TOP    = 2 // +y
+	FACE_BOTTOM = 3 // -y
+	FACE_FRONT  = 4 // +z
+	FACE_BACK   = 5 // -z
+)
+
+// FaceNames are the file names of the cube map faces as used throughout the
+// assets folder.
+var FaceNames = []string{"right", "left", "top", "bottom", "front", "back"}
+
+// Cubemap holds the six quadratic faces of a cube map on the CPU. The faces
+// are laid out like they are uploaded to an OpenGL cube map, thus the texel
+// (x,y) of a face corresponds to the texture coordinates (s,t).
+type Cubemap struct {
+	faces []image2d.Image2D
+	size  int
+}
+
+// MakeCubemap constructs a cube map from six images in the order right, left,
+// top, bottom, front and back. All faces have to be quadratic and of the same
+// size.
+func MakeCubemap(faces []image2d.Image2D) (Cubemap, error) {
+	if len(faces) != 6 {
+		return Cubemap{}, errors.New("a cube map needs exactly 6 faces")
+	}
+
+	size := faces[0].GetWidth()
+	for _, face := range faces {
+		if !face.IsQuadratic() || face.GetWidth() != size {
+			return Cubemap{}, errors.New("cube map faces have to be quadratic and of the same size")
+		}
+	}
+
+	return Cubemap{
+		faces: faces,
+		size:  size,
+	}, nil
+}
+
+// MakeEmptyCubemap constructs a black cube map with float faces of the
+// specified size and number of channels.
+func MakeEmptyCubemap(size, channels int) (Cubemap, error) {
+	faces := make([]image2d.Image2D, 6)
+	for i := range faces {
+		face, err := image2d.MakeFloat32(size, size, channels)
+		if err != nil {
+			return Cubemap{}, err
+		}
+		faces[i] = face
+	}
+	return MakeCubemap(faces)
+}
+
+// MakeCubemapFromPaths loads the six faces of a cube map from the specified
+// paths.
+func MakeCubemapFromPaths(right, left, top, bottom, front, back string) (Cubemap, error) {
+	paths := []string{right, left, top, bottom, front, back}
+	faces := make([]image2d.Image2D, 6)
+	for i, path := range paths {
+		face, err := image2d.MakeFromPath(path)
+		if err != nil {
+			return Cubemap{}, err
+		}
+		faces[i] = face
+	}
+	return MakeCubemap(faces)
+}
+
+// MakeCubemapFromDir loads the six faces of a cube map from the directory. The
+// faces have to be named like FaceNames with the specified file extension,
+// e.g. ".hdr".
+func MakeCubemapFromDir(dir, extension string) (Cubemap, error) {
+	paths := make([]string, 6)
+	for i, name := range FaceNames {
+		paths[i] = dir + name + extension
+	}
+	return MakeCubemapFromPaths(paths[0], paths[1], paths[2], paths[3], paths[4], paths[5])
+}
+
+// MakeCubemapFromEquirect resamples an equirectangular image into a cube map
+// with faces of the specified size.
+func MakeCubemapFromEquirect(equirect *image2d.Image2D, size int) (Cubemap, error) {
+	cubemap, err := MakeEmptyCubemap(size, 3)
+	if err != nil {
+		return Cubemap{}, err
+	}
+
+	for f := 0; f < 6; f++ {
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				dir := cubemap.TexelDirection(f, x, y)
+				cubemap.SetTexel(f, x, y, SampleEquirect(equirect, dir))
+			}
+		}
+	}
+
+	return cubemap, nil
+}
+
+// SaveToDir saves all faces into the directory using the face names and the
+// specified extension, e.g. ".hdr".
+func (cubemap *Cubemap) SaveToDir(dir, extension string) error {
+	for i, name := range FaceNames {
+		if err := cubemap.faces[i].SaveToPath(dir + name + extension); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetSize returns the width and height of each face.
+func (cubemap *Cubemap) GetSize() int {
+	return cubemap.size
+}
+
+// GetFace returns the face with the specified index.
+func (cubemap *Cubemap) GetFace(face int) *image2d.Image2D {
+	return &cubemap.faces[face]
+}
+
+// GetFaces returns all six faces.
+func (cubemap *Cubemap) GetFaces() []image2d.Image2D {
+	return cubemap.faces
+}
+
+// GetTexel returns the color of the texel (x,y) of the specified face.
+func (cubemap *Cubemap) GetTexel(face, x, y int) mgl32.Vec3 {
+	return getColor(&cubemap.faces[face], x, y)
+}
+
+// SetTexel sets the color of the texel (x,y) of the specified face.
+func (cubemap *Cubemap) SetTexel(face, x, y int, color mgl32.Vec3) {
+	img := &cubemap.faces[face]
+	for c := 0; c < cgm.Mini(img.GetChannels(), 3); c++ {
+		img.SetFloat32(x, y, c, color[c])
+	}
+}
+
+// TexelDirection returns the normalized direction pointing from the center of
+// the cube map to the center of the texel (x,y) of the specified face.
+func (cubemap *Cubemap) TexelDirection(face, x, y int) mgl32.Vec3 {
+	s := 2*(float32(x)+0.5)/float32(cubemap.size) - 1
+	t := 2*(float32(y)+0.5)/float32(cubemap.size) - 1
+	return FaceDirection(face, s, t)
+}
+
+// TexelSolidAngle returns the solid angle that is covered by the texel (x,y).
+// It is the same for every face.
+func (cubemap *Cubemap) TexelSolidAngle(x, y int) float32 {
+	inv := 1.0 / float64(cubemap.size)
+	x0 := 2*float64(x)*inv - 1
+	y0 := 2*float64(y)*inv - 1
+	x1 := x0 + 2*inv
+	y1 := y0 + 2*inv
+	angle := areaElement(x0, y0) - areaElement(x0, y1) - areaElement(x1, y0) + areaElement(x1, y1)
+	return float32(math.Abs(angle))
+}
+
+// Sample returns the bilinearly filtered color in the specified direction.
+// The filtering does not cross the borders of a face.
+func (cubemap *Cubemap) Sample(dir mgl32.Vec3) mgl32.Vec3 {
+	face, s, t := DirectionToFace(dir)
+	x := (s+1)/2*float32(cubemap.size) - 0.5
+	y := (t+1)/2*float32(cubemap.size) - 0.5
+	return sampleBilinear(&cubemap.faces[face], x, y)
+}
+
+// FaceDirection returns the normalized direction of the point (s,t) on the
+// specified face where s and t are in the range [-1,1]. It follows the
+// conventions of the OpenGL specification for cube map texture selection.
+func FaceDirection(face int, s, t float32) mgl32.Vec3 {
+	var dir mgl32.Vec3
+	switch face {
+	case FACE_RIGHT:
+		dir = mgl32.Vec3{1, -t, -s}
+	case FACE_LEFT:
+		dir = mgl32.Vec3{-1, -t, s}
+	case FACE_TOP:
+		dir = mgl32.Vec3{s, 1, t}
+	case FACE_BOTTOM:
+		dir = mgl32.Vec3{s, -1, -t}
+	case FACE_FRONT:
+		dir = mgl32.Vec3{s, -t, 1}
+	case FACE_BACK:
+		dir = mgl32.Vec3{-s, -t, -1}
+	}
+	return dir.Normalize()
+}
+
+// DirectionToFace determines the face that the direction points to and the
+// position (s,t) on that face in the range [-1,1].
+func DirectionToFace(dir mgl32.Vec3) (int, float32, float32) {
+	ax := cgm.Abs32(dir.X())
+	ay := cgm.Abs32(dir.Y())
+	az := cgm.Abs32(dir.Z())
+
+	var (
+		face   int
+		sc, tc float32
+		ma     float32
+	)
+	if ax >= ay && ax >= az {
+		ma = ax
+		if dir.X() > 0 {
+			face, sc, tc = FACE_RIGHT, -dir.Z(), -dir.Y()
+		} else {
+			face, sc, tc = FACE_LEFT, dir.Z(), -dir.Y()
+		}
+	} else if ay >= az {
+		ma = ay
+		if dir.Y() > 0 {
+			face, sc, tc = FACE_TOP, dir.X(), dir.Z()
+		} else {
+			face, sc, tc = FACE_BOTTOM, dir.X(), -dir.Z()
+		}
+	} else {
+		ma = az
+		if dir.Z() > 0 {
+			face, sc, tc = FACE_FRONT, dir.X(), -dir.Y()
+		} else {
+			face, sc, tc = FACE_BACK, -dir.X(), -dir.Y()
+		}
+	}
+
+	if ma == 0 {
+		return FACE_RIGHT, 0, 0
+	}
+	return face, sc / ma, tc / ma
+}
+
+// areaElement is the integral of the solid angle from the face center to the
+// point (x,y) of a face at distance 1.
+func areaElement(x, y float64) float64 {
+	return math.Atan2(x*y, math.Sqrt(x*x+y*y+1))
+}
+
+// getColor returns the rgb color of the pixel (x,y). Images with less than
+// three channels are treated as gray scale.
+func getColor(img *image2d.Image2D, x, y int) mgl32.Vec3 {
+	if img.GetChannels() < 3 {
+		v := img.GetFloat32(x, y, 0)
+		return mgl32.Vec3{v, v, v}
+	}
+	return mgl32.Vec3{
+		img.GetFloat32(x, y, 0),
+		img.GetFloat32(x, y, 1),
+		img.GetFloat32(x, y, 2),
+	}
+}
+
+// sampleBilinear returns the bilinearly filtered color at the continuous pixel
+// position (x,y) where pixel centers are at integer positions. Positions
+// outside of the image are clamped to the border.
+func sampleBilinear(img *image2d.Image2D, x, y float32) mgl32.Vec3 {
+	w, h := img.GetWidth(), img.GetHeight()
+	x = cgm.Clamp(x, 0, float32(w-1))
+	y = cgm.Clamp(y, 0, float32(h-1))
+
+	x0, y0 := int(x), int(y)
+	x1, y1 := cgm.Mini(x0+1, w-1), cgm.Mini(y0+1, h-1)
+	tx, ty := x-float32(x0), y-float32(y0)
+
+	c00 := getColor(img, x0, y0)
+	c10 := getColor(img, x1, y0)
+	c01 := getColor(img, x0, y1)
+	c11 := getColor(img, x1, y1)
+
+	top := c00.Mul(1 - tx).Add(c10.Mul(tx))
+	bottom := c01.Mul(1 - tx).Add(c11.Mul(tx))
+	return top.Mul(1 - ty).Add(bottom.Mul(ty))
+}
+
+// Downsample returns a cube map of half the size where each texel is the
+// average of the corresponding 2x2 texels of this cube map.
+func (cubemap *Cubemap) Downsample() (Cubemap, error) {
+	size := cgm.Maxi(cubemap.size/2, 1)
+	half, err := MakeEmptyCubemap(size, 3)
+	if err != nil {
+		return Cubemap{}, err
+	}
+
+	for f := 0; f < 6; f++ {
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				x0, y0 := cgm.Mini(2*x, cubemap.size-1), cgm.Mini(2*y, cubemap.size-1)
+				x1, y1 := cgm.Mini(2*x+1, cubemap.size-1), cgm.Mini(2*y+1, cubemap.size-1)
+				color := cubemap.GetTexel(f, x0, y0).
+					Add(cubemap.GetTexel(f, x1, y0)).
+					Add(cubemap.GetTexel(f, x0, y1)).
+					Add(cubemap.GetTexel(f, x1, y1))
+				half.SetTexel(f, x, y, color.Mul(0.25))
+			}
+		}
+	}
+
+	return half, nil
+}
+
+// MakeMipChain creates all mip levels of the cube map down to a face size of
+// 1x1. The first level is the cube map itself.
+func (cubemap *Cubemap) MakeMipChain() ([]Cubemap, error) {
+	chain := []Cubemap{*cubemap}
+	for chain[len(chain)-1].size > 1 {
+		level, err := chain[len(chain)-1].Downsample()
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, level)
+	}
+	return chain, nil
+}
+
+// SampleMipChain returns the trilinearly filtered color of the mip chain in
+// the specified direction. The level of detail is clamped to the available
+// levels.
+func SampleMipChain(chain []Cubemap, dir mgl32.Vec3, lod float32) mgl32.Vec3 {
+	lod = cgm.Clamp(lod, 0, float32(len(chain)-1))
+	l0 := int(lod)
+	l1 := cgm.Mini(l0+1, len(chain)-1)
+	t := lod - float32(l0)
+
+	c0 := chain[l0].Sample(dir)
+	if t == 0 || l0 == l1 {
+		return c0
+	}
+	c1 := chain[l1].Sample(dir)
+	return c0.Mul(1 - t).Add(c1.Mul(t))
+}
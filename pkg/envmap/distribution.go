@@ -0,0 +1,122 @@
+package envmap
+
+import (
+	"sort"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Distribution1D is a piecewise constant distribution over [0,1] with one
+// segment per value of Func. CDF has one more entry than Func and is
+// normalized such that its last entry is 1. Integral is the integral of the
+// function over [0,1].
+type Distribution1D struct {
+	Func     []float32
+	CDF      []float32
+	Integral float32
+}
+
+// MakeDistribution1D creates the distribution of the non-negative function
+// values f. A function that is zero everywhere turns into a uniform
+// distribution.
+func MakeDistribution1D(f []float32) Distribution1D {
+	n := len(f)
+	cdf := make([]float32, n+1)
+	sum := float64(0)
+	for i, v := range f {
+		sum += float64(v) / float64(n)
+		cdf[i+1] = float32(sum)
+	}
+
+	// normalize the cdf or fall back to a uniform distribution
+	for i := 1; i <= n; i++ {
+		if sum > 0 {
+			cdf[i] /= float32(sum)
+		} else {
+			cdf[i] = float32(i) / float32(n)
+		}
+	}
+	cdf[n] = 1
+
+	return Distribution1D{
+		Func:     f,
+		CDF:      cdf,
+		Integral: float32(sum),
+	}
+}
+
+// Count returns the number of segments.
+func (dist *Distribution1D) Count() int {
+	return len(dist.Func)
+}
+
+// SampleContinuous maps the uniform random number u onto a position in [0,1]
+// that is distributed according to the function. It returns the position, its
+// pdf and the index of the segment that contains it.
+func (dist *Distribution1D) SampleContinuous(u float32) (float32, float32, int) {
+	// find the last cdf entry that is less than or equal to u
+	n := dist.Count()
+	offset := sort.Search(n+1, func(i int) bool { return dist.CDF[i] > u }) - 1
+	offset = cgm.Maxi(0, cgm.Mini(offset, n-1))
+
+	// position within the segment
+	du := u - dist.CDF[offset]
+	if width := dist.CDF[offset+1] - dist.CDF[offset]; width > 0 {
+		du /= width
+	}
+	x := (float32(offset) + cgm.Clamp(du, 0, 1)) / float32(n)
+
+	return x, dist.SegmentPdf(offset), offset
+}
+
+// SegmentPdf returns the pdf of the positions within the segment i.
+func (dist *Distribution1D) SegmentPdf(i int) float32 {
+	return (dist.CDF[i+1] - dist.CDF[i]) * float32(dist.Count())
+}
+
+// Pdf returns the pdf of the position x in [0,1].
+func (dist *Distribution1D) Pdf(x float32) float32 {
+	i := cgm.Maxi(0, cgm.Mini(int(x*float32(dist.Count())), dist.Count()-1))
+	return dist.SegmentPdf(i)
+}
+
+// Distribution2D is a piecewise constant distribution over [0,1]^2 given by a
+// grid of function values. The rows are chosen by the marginal distribution
+// and the position within a row by the conditional distribution of that row.
+type Distribution2D struct {
+	Conditional []Distribution1D
+	Marginal    Distribution1D
+}
+
+// MakeDistribution2D creates the distribution of the non-negative function
+// values f given in row-major order with the specified width and height.
+func MakeDistribution2D(f []float32, width, height int) Distribution2D {
+	conditional := make([]Distribution1D, height)
+	integrals := make([]float32, height)
+	for y := 0; y < height; y++ {
+		conditional[y] = MakeDistribution1D(f[y*width : (y+1)*width])
+		integrals[y] = conditional[y].Integral
+	}
+
+	return Distribution2D{
+		Conditional: conditional,
+		Marginal:    MakeDistribution1D(integrals),
+	}
+}
+
+// SampleContinuous maps the uniform random numbers u onto a position (x,y) in
+// [0,1]^2 that is distributed according to the function. y is the row
+// coordinate. It returns the position and its pdf.
+func (dist *Distribution2D) SampleContinuous(u mgl32.Vec2) (mgl32.Vec2, float32) {
+	y, pdfy, row := dist.Marginal.SampleContinuous(u.Y())
+	x, pdfx, _ := dist.Conditional[row].SampleContinuous(u.X())
+	return mgl32.Vec2{x, y}, pdfx * pdfy
+}
+
+// Pdf returns the pdf of the position p in [0,1]^2.
+func (dist *Distribution2D) Pdf(p mgl32.Vec2) float32 {
+	height := dist.Marginal.Count()
+	row := cgm.Maxi(0, cgm.Mini(int(p.Y()*float32(height)), height-1))
+	return dist.Marginal.SegmentPdf(row) * dist.Conditional[row].Pdf(p.X())
+}
@@ -0,0 +1,75 @@
+package envmap
+
+import (
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// EquirectUV returns the texture coordinates of the direction in an
+// equirectangular image. It matches sampleSphericalMap in the gencubemap
+// shader, thus v = 0 corresponds to the bottom row of the image file.
+func EquirectUV(dir mgl32.Vec3) (float32, float32) {
+	dir = dir.Normalize()
+	u := cgm.Atan232(dir.Z(), dir.X())/(2*math.Pi) + 0.5
+	v := cgm.Asin32(cgm.Clamp(dir.Y(), -1, 1))/math.Pi + 0.5
+	return u, v
+}
+
+// EquirectDirection is the inverse of EquirectUV and returns the normalized
+// direction of the texture coordinates (u,v).
+func EquirectDirection(u, v float32) mgl32.Vec3 {
+	phi := (u - 0.5) * 2 * math.Pi
+	theta := (v - 0.5) * math.Pi
+	return mgl32.Vec3{
+		cgm.Cos32(theta) * cgm.Cos32(phi),
+		cgm.Sin32(theta),
+		cgm.Cos32(theta) * cgm.Sin32(phi),
+	}
+}
+
+// EquirectPixelDirection returns the direction of the center of the pixel
+// (x,y) of an equirectangular image of the specified dimensions.
+func EquirectPixelDirection(x, y, width, height int) mgl32.Vec3 {
+	u := (float32(x) + 0.5) / float32(width)
+	v := 1 - (float32(y)+0.5)/float32(height)
+	return EquirectDirection(u, v)
+}
+
+// EquirectPixelSolidAngle returns the solid angle covered by the pixels of row
+// y of an equirectangular image of the specified dimensions.
+func EquirectPixelSolidAngle(y, width, height int) float32 {
+	// the solid angle is the difference of sin(latitude) of both row borders
+	lat0 := math.Pi * (0.5 - float64(y)/float64(height))
+	lat1 := math.Pi * (0.5 - float64(y+1)/float64(height))
+	dphi := 2 * math.Pi / float64(width)
+	return float32(dphi * (math.Sin(lat0) - math.Sin(lat1)))
+}
+
+// SampleEquirect returns the bilinearly filtered color of the equirectangular
+// image in the specified direction.
+func SampleEquirect(img *image2d.Image2D, dir mgl32.Vec3) mgl32.Vec3 {
+	u, v := EquirectUV(dir)
+	w, h := img.GetWidth(), img.GetHeight()
+	x := u*float32(w) - 0.5
+	y := (1-v)*float32(h) - 0.5
+
+	// wrap around horizontally, clamp vertically
+	x = cgm.Mod32(x+float32(w), float32(w))
+	y = cgm.Clamp(y, 0, float32(h-1))
+
+	x0, y0 := int(x), int(y)
+	x1, y1 := (x0+1)%w, cgm.Mini(y0+1, h-1)
+	tx, ty := x-float32(x0), y-float32(y0)
+
+	c00 := getColor(img, x0, y0)
+	c10 := getColor(img, x1, y0)
+	c01 := getColor(img, x0, y1)
+	c11 := getColor(img, x1, y1)
+
+	top := c00.Mul(1 - tx).Add(c10.Mul(tx))
+	bottom := c01.Mul(1 - tx).Add(c11.Mul(tx))
+	return top.Mul(1 - ty).Add(bottom.Mul(ty))
+}
@@ -0,0 +1,194 @@
+package envmap
+
+import (
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/core/gl"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/adrianderstroff/pbr/pkg/view/texture"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Sampler chooses directions proportional to the luminance of an environment
+// map, which is needed to handle small and bright light sources like the sun.
+// Sample maps two uniform random numbers onto a direction and returns it with
+// its pdf with respect to the solid angle. Pdf returns the pdf of an arbitrary
+// direction for combining the samples with BRDF samples.
+type Sampler interface {
+	Sample(xi mgl32.Vec2) (mgl32.Vec3, float32)
+	Pdf(dir mgl32.Vec3) float32
+}
+
+// EquirectSampler samples the directions of an equirectangular image. The
+// rows of the distribution are the rows of the image from top to bottom and
+// the luminance is weighted by the sine of the polar angle, since the rows
+// close to the poles cover a smaller solid angle.
+type EquirectSampler struct {
+	Distribution Distribution2D
+}
+
+// MakeEquirectSampler creates the sampling distribution of the
+// equirectangular image.
+func MakeEquirectSampler(img *image2d.Image2D) EquirectSampler {
+	w, h := img.GetWidth(), img.GetHeight()
+	f := make([]float32, w*h)
+	for y := 0; y < h; y++ {
+		sinTheta := cgm.Sin32(math.Pi * (float32(y) + 0.5) / float32(h))
+		for x := 0; x < w; x++ {
+			f[y*w+x] = cgm.Max32(img.Luminance(x, y), 0) * sinTheta
+		}
+	}
+	return EquirectSampler{
+		Distribution: MakeDistribution2D(f, w, h),
+	}
+}
+
+// Sample returns a direction distributed according to the luminance of the
+// image and its pdf.
+func (sampler *EquirectSampler) Sample(xi mgl32.Vec2) (mgl32.Vec3, float32) {
+	p, pdf := sampler.Distribution.SampleContinuous(xi)
+	u, v := p.X(), 1-p.Y()
+	dir := EquirectDirection(u, v)
+	return dir, equirectSolidAnglePdf(pdf, v)
+}
+
+// Pdf returns the pdf of sampling the direction dir.
+func (sampler *EquirectSampler) Pdf(dir mgl32.Vec3) float32 {
+	u, v := EquirectUV(dir)
+	pdf := sampler.Distribution.Pdf(mgl32.Vec2{u, 1 - v})
+	return equirectSolidAnglePdf(pdf, v)
+}
+
+// Images returns the conditional cdfs as an image with one row per image row
+// and the marginal cdf as a single row, both with a single float channel. See
+// cdfImages for the layout.
+func (sampler *EquirectSampler) Images() (image2d.Image2D, image2d.Image2D, error) {
+	return cdfImages(&sampler.Distribution)
+}
+
+// Textures uploads the cdfs of Images to the GPU.
+func (sampler *EquirectSampler) Textures() (texture.Texture, texture.Texture, error) {
+	return cdfTextures(&sampler.Distribution)
+}
+
+// equirectSolidAnglePdf converts the pdf of the texture coordinates into the
+// pdf with respect to the solid angle. A pixel at the texture coordinate v
+// covers 2 pi^2 cos(latitude) times its area in texture space.
+func equirectSolidAnglePdf(pdf, v float32) float32 {
+	cosLatitude := cgm.Cos32((v - 0.5) * math.Pi)
+	if cosLatitude <= 0 {
+		return 0
+	}
+	return pdf / (2 * math.Pi * math.Pi * cosLatitude)
+}
+
+// CubemapSampler samples the directions of a cube map. The distribution is
+// defined over the faces stacked on top of each other in the order of the
+// face indices, which results in size columns and 6*size rows. Each texel is
+// weighted by its luminance and its solid angle.
+type CubemapSampler struct {
+	Distribution Distribution2D
+	size         int
+}
+
+// MakeCubemapSampler creates the sampling distribution of the cube map.
+func MakeCubemapSampler(cubemap *Cubemap) CubemapSampler {
+	size := cubemap.size
+	f := make([]float32, 6*size*size)
+	for face := 0; face < 6; face++ {
+		img := &cubemap.faces[face]
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				row := face*size + y
+				f[row*size+x] = cgm.Max32(img.Luminance(x, y), 0) * cubemap.TexelSolidAngle(x, y)
+			}
+		}
+	}
+	return CubemapSampler{
+		Distribution: MakeDistribution2D(f, size, 6*size),
+		size:         size,
+	}
+}
+
+// Sample returns a direction distributed according to the luminance of the
+// cube map and its pdf.
+func (sampler *CubemapSampler) Sample(xi mgl32.Vec2) (mgl32.Vec3, float32) {
+	p, pdf := sampler.Distribution.SampleContinuous(xi)
+	face := cgm.Mini(int(p.Y()*6), 5)
+	s := 2*p.X() - 1
+	t := 2*(p.Y()*6-float32(face)) - 1
+	return FaceDirection(face, s, t), cubemapSolidAnglePdf(pdf, s, t)
+}
+
+// Pdf returns the pdf of sampling the direction dir.
+func (sampler *CubemapSampler) Pdf(dir mgl32.Vec3) float32 {
+	face, s, t := DirectionToFace(dir)
+	p := mgl32.Vec2{(s + 1) / 2, (float32(face) + (t+1)/2) / 6}
+	return cubemapSolidAnglePdf(sampler.Distribution.Pdf(p), s, t)
+}
+
+// Images returns the conditional cdfs as an image with one row per row of the
+// stacked faces and the marginal cdf as a single row, both with a single float
+// channel. See cdfImages for the layout.
+func (sampler *CubemapSampler) Images() (image2d.Image2D, image2d.Image2D, error) {
+	return cdfImages(&sampler.Distribution)
+}
+
+// Textures uploads the cdfs of Images to the GPU. They are used by
+// SampleEnvironmentImportance and EnvironmentImportancePdf of
+// shared/envsampling.glsl.
+func (sampler *CubemapSampler) Textures() (texture.Texture, texture.Texture, error) {
+	return cdfTextures(&sampler.Distribution)
+}
+
+// cubemapSolidAnglePdf converts the pdf over the stacked faces into the pdf
+// with respect to the solid angle. Each face covers a sixth of the stacked
+// domain and a 2x2 square in (s,t), whose area element at (s,t) covers a
+// solid angle of 1/(1+s^2+t^2)^(3/2).
+func cubemapSolidAnglePdf(pdf, s, t float32) float32 {
+	d := 1 + s*s + t*t
+	return pdf / 24 * d * cgm.Sqrt32(d)
+}
+
+// cdfImages stores the cdfs of the distribution in two float images. The
+// conditional image has the same size as the function and the marginal image
+// has one row. The leading zero of each cdf is omitted, thus texel i holds
+// the upper end of segment i.
+func cdfImages(dist *Distribution2D) (image2d.Image2D, image2d.Image2D, error) {
+	width, height := dist.Conditional[0].Count(), dist.Marginal.Count()
+	conditional, err := image2d.MakeFloat32(width, height, 1)
+	if err != nil {
+		return image2d.Image2D{}, image2d.Image2D{}, err
+	}
+	marginal, err := image2d.MakeFloat32(height, 1, 1)
+	if err != nil {
+		return image2d.Image2D{}, image2d.Image2D{}, err
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			conditional.SetFloat32(x, y, 0, dist.Conditional[y].CDF[x+1])
+		}
+		marginal.SetFloat32(y, 0, 0, dist.Marginal.CDF[y+1])
+	}
+
+	return conditional, marginal, nil
+}
+
+// cdfTextures uploads the images of cdfImages as unfiltered float textures.
+// The shaders access them with texelFetch only.
+func cdfTextures(dist *Distribution2D) (texture.Texture, texture.Texture, error) {
+	conditional, marginal, err := cdfImages(dist)
+	if err != nil {
+		return texture.Texture{}, texture.Texture{}, err
+	}
+
+	ctex := texture.Make(conditional.GetWidth(), conditional.GetHeight(), gl.R32F, gl.RED,
+		conditional.GetPixelType(), conditional.GetDataPointer(), gl.NEAREST, gl.NEAREST,
+		gl.CLAMP_TO_EDGE, gl.CLAMP_TO_EDGE)
+	mtex := texture.Make(marginal.GetWidth(), marginal.GetHeight(), gl.R32F, gl.RED,
+		marginal.GetPixelType(), marginal.GetDataPointer(), gl.NEAREST, gl.NEAREST,
+		gl.CLAMP_TO_EDGE, gl.CLAMP_TO_EDGE)
+	return ctex, mtex, nil
+}
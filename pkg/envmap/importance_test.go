@@ -0,0 +1,219 @@
+package envmap
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	SEED             = 42
+	SEGMENTS         = 17
+	GRID_WIDTH       = 9
+	GRID_HEIGHT      = 7
+	CUBEMAP_SIZE     = 16
+	EQUIRECT_WIDTH   = 64
+	EQUIRECT_HEIGHT  = 32
+	SAMPLES          = 64
+	PDF_TOLERANCE    = 1e-3
+	SPHERE_TOLERANCE = 1e-2
+)
+
+// sun is the direction of the bright spot of the test environment
+var sun = mgl32.Vec3{0.3, 0.8, -0.5}.Normalize()
+
+// the pdf of a 1d distribution has to integrate to 1 and has to match the pdf
+// returned by the sampling
+func TestDistribution1D(t *testing.T) {
+	rng := rand.New(rand.NewSource(SEED))
+	f := make([]float32, SEGMENTS)
+	for i := range f {
+		f[i] = rng.Float32() * 10
+	}
+	f[3] = 0
+
+	dist := MakeDistribution1D(f)
+	integral := float32(0)
+	for i := 0; i < SEGMENTS; i++ {
+		integral += dist.Pdf((float32(i)+0.5)/SEGMENTS) / SEGMENTS
+	}
+	if cgm.Abs32(integral-1) > PDF_TOLERANCE {
+		t.Errorf("expected the pdf to integrate to 1, got %v", integral)
+	}
+
+	for s := 0; s < SAMPLES; s++ {
+		u := (float32(s) + 0.5) / SAMPLES
+		x, pdf, i := dist.SampleContinuous(u)
+		if x < float32(i)/SEGMENTS || x > float32(i+1)/SEGMENTS {
+			t.Errorf("u %v: position %v is not within segment %v", u, x, i)
+		}
+		if f[i] == 0 {
+			t.Errorf("u %v: sampled segment %v of zero value", u, i)
+		}
+		if expected := dist.Pdf(x); cgm.Abs32(pdf-expected) > PDF_TOLERANCE*expected {
+			t.Errorf("u %v: expected a pdf of %v, got %v", u, expected, pdf)
+		}
+	}
+
+	// a function that is zero everywhere turns into a uniform distribution
+	zero := MakeDistribution1D(make([]float32, SEGMENTS))
+	for i := 0; i < SEGMENTS; i++ {
+		if pdf := zero.SegmentPdf(i); cgm.Abs32(pdf-1) > PDF_TOLERANCE {
+			t.Errorf("segment %v: expected a uniform pdf of 1, got %v", i, pdf)
+		}
+	}
+}
+
+// the pdf of a 2d distribution has to integrate to 1 and has to match the pdf
+// returned by the sampling
+func TestDistribution2D(t *testing.T) {
+	rng := rand.New(rand.NewSource(SEED))
+	f := make([]float32, GRID_WIDTH*GRID_HEIGHT)
+	for i := range f {
+		f[i] = rng.Float32() * 10
+	}
+
+	dist := MakeDistribution2D(f, GRID_WIDTH, GRID_HEIGHT)
+	integral := float32(0)
+	for y := 0; y < GRID_HEIGHT; y++ {
+		for x := 0; x < GRID_WIDTH; x++ {
+			p := mgl32.Vec2{(float32(x) + 0.5) / GRID_WIDTH, (float32(y) + 0.5) / GRID_HEIGHT}
+			integral += dist.Pdf(p) / (GRID_WIDTH * GRID_HEIGHT)
+		}
+	}
+	if cgm.Abs32(integral-1) > PDF_TOLERANCE {
+		t.Errorf("expected the pdf to integrate to 1, got %v", integral)
+	}
+
+	for _, xi := range stratifiedSamples() {
+		p, pdf := dist.SampleContinuous(xi)
+		if expected := dist.Pdf(p); cgm.Abs32(pdf-expected) > PDF_TOLERANCE*expected {
+			t.Errorf("xi %v: expected a pdf of %v, got %v", xi, expected, pdf)
+		}
+	}
+}
+
+// DirectionToFace is the inverse of FaceDirection like cubeDirectionToFace is
+// the inverse of cubeFaceDirection in shared/envsampling.glsl
+func TestDirectionToFace(t *testing.T) {
+	for face := 0; face < 6; face++ {
+		for _, s := range []float32{-0.95, -0.5, 0, 0.3, 0.95} {
+			for _, u := range []float32{-0.95, -0.2, 0, 0.6, 0.95} {
+				f, ss, tt := DirectionToFace(FaceDirection(face, s, u))
+				if f != face || cgm.Abs32(ss-s) > PDF_TOLERANCE || cgm.Abs32(tt-u) > PDF_TOLERANCE {
+					t.Errorf("face %v (%v,%v): got face %v (%v,%v)", face, s, u, f, ss, tt)
+				}
+			}
+		}
+	}
+}
+
+// the solid angle pdf of the cube map sampler has to integrate to 1 over the
+// sphere and has to match the pdf returned by the sampling, which checks the
+// conversion pdf/24 * (1+s^2+t^2)^(3/2)
+func TestCubemapSampler(t *testing.T) {
+	cubemap, err := MakeEmptyCubemap(CUBEMAP_SIZE, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for face := 0; face < 6; face++ {
+		for y := 0; y < CUBEMAP_SIZE; y++ {
+			for x := 0; x < CUBEMAP_SIZE; x++ {
+				l := environment(cubemap.TexelDirection(face, x, y))
+				cubemap.SetTexel(face, x, y, mgl32.Vec3{l, l, l})
+			}
+		}
+	}
+
+	sampler := MakeCubemapSampler(&cubemap)
+	integral := float32(0)
+	for face := 0; face < 6; face++ {
+		for y := 0; y < CUBEMAP_SIZE; y++ {
+			for x := 0; x < CUBEMAP_SIZE; x++ {
+				dir := cubemap.TexelDirection(face, x, y)
+				integral += sampler.Pdf(dir) * cubemap.TexelSolidAngle(x, y)
+			}
+		}
+	}
+	if cgm.Abs32(integral-1) > SPHERE_TOLERANCE {
+		t.Errorf("expected the pdf to integrate to 1, got %v", integral)
+	}
+
+	checkSampler(t, &sampler)
+}
+
+// the solid angle pdf of the equirectangular sampler has to integrate to 1
+// over the sphere and has to match the pdf returned by the sampling, which
+// checks the conversion pdf/(2 pi^2 cos(latitude))
+func TestEquirectSampler(t *testing.T) {
+	img, err := image2d.MakeFloat32(EQUIRECT_WIDTH, EQUIRECT_HEIGHT, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < EQUIRECT_HEIGHT; y++ {
+		for x := 0; x < EQUIRECT_WIDTH; x++ {
+			l := environment(EquirectPixelDirection(x, y, EQUIRECT_WIDTH, EQUIRECT_HEIGHT))
+			for c := 0; c < 3; c++ {
+				img.SetFloat32(x, y, c, l)
+			}
+		}
+	}
+
+	sampler := MakeEquirectSampler(&img)
+	integral := float32(0)
+	for y := 0; y < EQUIRECT_HEIGHT; y++ {
+		for x := 0; x < EQUIRECT_WIDTH; x++ {
+			dir := EquirectPixelDirection(x, y, EQUIRECT_WIDTH, EQUIRECT_HEIGHT)
+			integral += sampler.Pdf(dir) * EquirectPixelSolidAngle(y, EQUIRECT_WIDTH, EQUIRECT_HEIGHT)
+		}
+	}
+	if cgm.Abs32(integral-1) > SPHERE_TOLERANCE {
+		t.Errorf("expected the pdf to integrate to 1, got %v", integral)
+	}
+
+	checkSampler(t, &sampler)
+}
+
+// checkSampler compares the pdf returned by Sample with the pdf of Pdf for the
+// sampled direction. The round trip through the direction loses precision of
+// the latitude close to the poles, where the pdf of an equirectangular
+// sampler changes quickly, thus the pdfs are compared with the tolerance of
+// the integration.
+func checkSampler(t *testing.T, sampler Sampler) {
+	for _, xi := range stratifiedSamples() {
+		dir, pdf := sampler.Sample(xi)
+		if cgm.Abs32(dir.Len()-1) > PDF_TOLERANCE {
+			t.Errorf("xi %v: direction %v is not normalized", xi, dir)
+		}
+		if expected := sampler.Pdf(dir); cgm.Abs32(pdf-expected) > SPHERE_TOLERANCE*expected {
+			t.Errorf("xi %v: expected a pdf of %v, got %v", xi, expected, pdf)
+		}
+	}
+}
+
+// stratifiedSamples returns one jittered sample per cell of a regular grid
+// over [0,1]^2.
+func stratifiedSamples() []mgl32.Vec2 {
+	rng := rand.New(rand.NewSource(SEED))
+	samples := make([]mgl32.Vec2, 0, SAMPLES*SAMPLES)
+	for y := 0; y < SAMPLES; y++ {
+		for x := 0; x < SAMPLES; x++ {
+			samples = append(samples, mgl32.Vec2{
+				(float32(x) + rng.Float32()) / SAMPLES,
+				(float32(y) + rng.Float32()) / SAMPLES,
+			})
+		}
+	}
+	return samples
+}
+
+// environment is a sky gradient with a bright spot around the sun.
+func environment(dir mgl32.Vec3) float32 {
+	sky := 0.1 + cgm.Max32(dir.Y(), 0)
+	spot := float32(math.Pow(float64(cgm.Max32(dir.Dot(sun), 0)), 64)) * 100
+	return sky + spot
+}
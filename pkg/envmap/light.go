@@ -0,0 +1,187 @@
+package envmap
+
+import (
+	"math"
+	"sort"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Light is a bright compact region of an environment map like the sun that
+// can be rendered as a directional light instead. The radiance is the part of
+// the region above the luminance cutoff that ExtractLights used, averaged over
+// the solid angle of the region. Thus rendering the light together with the
+// residual environment of RemoveLights yields the original environment.
+type Light struct {
+	Direction  mgl32.Vec3 // normalized direction towards the light
+	SolidAngle float32    // in steradians
+	Radiance   mgl32.Vec3
+	// texels of the region and the cutoff for removing the light
+	texels []cubemapTexel
+	cutoff float32
+}
+
+// cubemapTexel is the texel (x,y) of a face of a cube map.
+type cubemapTexel struct {
+	face, x, y int
+}
+
+// Irradiance returns the irradiance of the light on a surface facing the
+// light, which is the color of an equivalent directional light.
+func (light *Light) Irradiance() mgl32.Vec3 {
+	return light.Radiance.Mul(light.SolidAngle)
+}
+
+// ExtractLights finds up to count bright compact regions of the cube map. A
+// texel belongs to a region if its luminance is larger than threshold times
+// the average luminance of the environment. Regions are grown from the
+// brightest texels to all connected texels above this cutoff, also across the
+// borders of the faces. Regions covering a solid angle larger than
+// maxSolidAngle aren't compact, e.g. a bright overcast sky, and are ignored.
+// The lights are sorted by their irradiance in descending order.
+func ExtractLights(cubemap *Cubemap, count int, threshold, maxSolidAngle float32) []Light {
+	size := cubemap.size
+
+	// luminance of all texels and the average luminance over the sphere
+	luminance := make([]float32, 6*size*size)
+	var total float64
+	for face := 0; face < 6; face++ {
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				l := cgm.Max32(cubemap.faces[face].Luminance(x, y), 0)
+				luminance[(face*size+y)*size+x] = l
+				total += float64(l * cubemap.TexelSolidAngle(x, y))
+			}
+		}
+	}
+	cutoff := threshold * float32(total/(4*math.Pi))
+
+	// texels that are already part of a region
+	visited := make([]bool, len(luminance))
+	index := func(t cubemapTexel) int {
+		return (t.face*size+t.y)*size + t.x
+	}
+
+	var lights []Light
+	for len(lights) < count {
+		// start at the brightest remaining texel
+		brightest := -1
+		for i, l := range luminance {
+			if !visited[i] && l > cutoff && (brightest < 0 || l > luminance[brightest]) {
+				brightest = i
+			}
+		}
+		if brightest < 0 {
+			break
+		}
+
+		// flood fill all connected texels above the cutoff
+		start := cubemapTexel{brightest / (size * size), brightest % size, (brightest / size) % size}
+		visited[brightest] = true
+		region := []cubemapTexel{start}
+		for i := 0; i < len(region); i++ {
+			for _, n := range cubemap.texelNeighbors(region[i]) {
+				idx := index(n)
+				if !visited[idx] && luminance[idx] > cutoff {
+					visited[idx] = true
+					region = append(region, n)
+				}
+			}
+		}
+
+		light := cubemap.makeLight(region, cutoff)
+		if light.SolidAngle <= maxSolidAngle {
+			lights = append(lights, light)
+		}
+	}
+
+	sort.SliceStable(lights, func(i, j int) bool {
+		return luminanceRGB(lights[i].Irradiance()) > luminanceRGB(lights[j].Irradiance())
+	})
+	return lights
+}
+
+// RemoveLights scales the texels of each light down to the luminance cutoff
+// of ExtractLights, which leaves the residual environment. The lights have to
+// be extracted from this cube map.
+func RemoveLights(cubemap *Cubemap, lights []Light) {
+	for _, light := range lights {
+		for _, t := range light.texels {
+			color := cubemap.GetTexel(t.face, t.x, t.y)
+			cubemap.SetTexel(t.face, t.x, t.y, color.Mul(light.residualScale(luminanceRGB(color))))
+		}
+	}
+}
+
+// makeLight integrates the radiance above the cutoff over the region. The
+// direction is the average direction weighted by the luminance.
+func (cubemap *Cubemap) makeLight(region []cubemapTexel, cutoff float32) Light {
+	light := Light{
+		texels: region,
+		cutoff: cutoff,
+	}
+
+	var (
+		power     mgl32.Vec3
+		direction mgl32.Vec3
+	)
+	for _, t := range region {
+		color := cubemap.GetTexel(t.face, t.x, t.y)
+		removed := color.Mul(1 - light.residualScale(luminanceRGB(color)))
+		dw := cubemap.TexelSolidAngle(t.x, t.y)
+
+		power = power.Add(removed.Mul(dw))
+		direction = direction.Add(cubemap.TexelDirection(t.face, t.x, t.y).Mul(luminanceRGB(removed) * dw))
+		light.SolidAngle += dw
+	}
+
+	light.Radiance = power.Mul(1 / light.SolidAngle)
+	if direction.Len() > 0 {
+		light.Direction = direction.Normalize()
+	} else {
+		light.Direction = cubemap.TexelDirection(region[0].face, region[0].x, region[0].y)
+	}
+	return light
+}
+
+// residualScale returns the factor that scales a texel of the light with the
+// specified luminance down to the cutoff.
+func (light *Light) residualScale(luminance float32) float32 {
+	if luminance <= light.cutoff {
+		return 1
+	}
+	return light.cutoff / luminance
+}
+
+// texelNeighbors returns the four texels adjacent to the texel t. Neighbors
+// beyond the border of a face are looked up on the adjacent face.
+func (cubemap *Cubemap) texelNeighbors(t cubemapTexel) []cubemapTexel {
+	offsets := [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	neighbors := make([]cubemapTexel, 0, 4)
+	for _, o := range offsets {
+		x, y := t.x+o[0], t.y+o[1]
+		if x >= 0 && x < cubemap.size && y >= 0 && y < cubemap.size {
+			neighbors = append(neighbors, cubemapTexel{t.face, x, y})
+			continue
+		}
+
+		// the direction through the texel center outside of the face points
+		// into the adjacent face
+		s := 2*(float32(x)+0.5)/float32(cubemap.size) - 1
+		tc := 2*(float32(y)+0.5)/float32(cubemap.size) - 1
+		face, fs, ft := DirectionToFace(FaceDirection(t.face, s, tc))
+		neighbors = append(neighbors, cubemapTexel{
+			face: face,
+			x:    cgm.Mini(int((fs+1)/2*float32(cubemap.size)), cubemap.size-1),
+			y:    cgm.Mini(int((ft+1)/2*float32(cubemap.size)), cubemap.size-1),
+		})
+	}
+	return neighbors
+}
+
+// luminanceRGB returns the relative luminance of the linear rgb color using the
+// Rec. 709 primaries like image2d.Image2D.Luminance.
+func luminanceRGB(color mgl32.Vec3) float32 {
+	return 0.2126*color.X() + 0.7152*color.Y() + 0.0722*color.Z()
+}
@@ -0,0 +1,181 @@
+package geom
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// AABB is an axis aligned bounding box defined by the min and max point.
+type AABB struct {
+	Min mgl32.Vec3
+	Max mgl32.Vec3
+}
+
+// MakeEmptyAABB creates an empty box that can be grown with Extend.
+func MakeEmptyAABB() AABB {
+	inf := float32(math.Inf(1))
+	return AABB{
+		Min: mgl32.Vec3{inf, inf, inf},
+		Max: mgl32.Vec3{-inf, -inf, -inf},
+	}
+}
+
+// IsEmpty returns true if the box doesn't contain any point.
+func (aabb *AABB) IsEmpty() bool {
+	return aabb.Min.X() > aabb.Max.X() || aabb.Min.Y() > aabb.Max.Y() || aabb.Min.Z() > aabb.Max.Z()
+}
+
+// Extend grows the box to contain the point p.
+func (aabb *AABB) Extend(p mgl32.Vec3) {
+	for i := 0; i < 3; i++ {
+		aabb.Min[i] = float32(math.Min(float64(aabb.Min[i]), float64(p[i])))
+		aabb.Max[i] = float32(math.Max(float64(aabb.Max[i]), float64(p[i])))
+	}
+}
+
+// Union grows the box to contain the other box. Empty boxes are ignored.
+func (aabb *AABB) Union(other *AABB) {
+	if other.IsEmpty() {
+		return
+	}
+	aabb.Extend(other.Min)
+	aabb.Extend(other.Max)
+}
+
+// Center returns the center of the box.
+func (aabb *AABB) Center() mgl32.Vec3 {
+	return aabb.Min.Add(aabb.Max).Mul(0.5)
+}
+
+// Size returns the extent of the box along each axis.
+func (aabb *AABB) Size() mgl32.Vec3 {
+	return aabb.Max.Sub(aabb.Min)
+}
+
+// SurfaceArea returns the surface area of the box. Empty boxes have an area
+// of 0.
+func (aabb *AABB) SurfaceArea() float32 {
+	if aabb.IsEmpty() {
+		return 0
+	}
+	d := aabb.Size()
+	return 2 * (d.X()*d.Y() + d.Y()*d.Z() + d.Z()*d.X())
+}
+
+// LongestAxis returns the index of the axis with the largest extent.
+func (aabb *AABB) LongestAxis() int {
+	d := aabb.Size()
+	if d.X() > d.Y() && d.X() > d.Z() {
+		return 0
+	}
+	if d.Y() > d.Z() {
+		return 1
+	}
+	return 2
+}
+
+// Overlaps returns true if the box and the other box share at least one
+// point.
+func (aabb *AABB) Overlaps(other *AABB) bool {
+	for i := 0; i < 3; i++ {
+		if aabb.Max[i] < other.Min[i] || other.Max[i] < aabb.Min[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Slab returns the range of ray parameters [tnear,tfar] within the box
+// clipped to [tmin,tmax] and whether the range is non-empty. invdir is the
+// inverse direction of the ray which is passed in to be reused for many
+// boxes. Components of invdir can be infinite for axis aligned rays. The
+// resulting NaNs for rays starting on a slab boundary fail all comparisons
+// and are thus ignored. The far distance is enlarged by the maximal rounding
+// error to not miss boxes due to rounding.
+func (aabb *AABB) Slab(ray *Ray, invdir mgl32.Vec3, tmin, tmax float32) (float32, float32, bool) {
+	tnear, tfar := tmin, tmax
+	for i := 0; i < 3; i++ {
+		t0 := (aabb.Min[i] - ray.Origin[i]) * invdir[i]
+		t1 := (aabb.Max[i] - ray.Origin[i]) * invdir[i]
+		if t0 > t1 {
+			t0, t1 = t1, t0
+		}
+		t1 *= 1 + 2*gamma(3)
+
+		if t0 > tnear {
+			tnear = t0
+		}
+		if t1 < tfar {
+			tfar = t1
+		}
+		if tnear > tfar {
+			return 0, 0, false
+		}
+	}
+	return tnear, tfar, true
+}
+
+// Intersect returns the closest intersection of the ray with the surface of
+// the box with a ray parameter in [tmin,tmax]. Rays starting inside the box
+// hit its far side. The texture coordinates are in [0,1] on each face.
+func (aabb *AABB) Intersect(ray *Ray, tmin, tmax float32) (Hit, bool) {
+	tnear, tfar, ok := aabb.Slab(ray, ray.InvDirection(), tmin, tmax)
+	if !ok {
+		return Hit{}, false
+	}
+
+	// the near side is clipped by tmin if the ray starts inside the box
+	t := tnear
+	if tnear <= tmin {
+		t = tfar
+		if tfar >= tmax {
+			return Hit{}, false
+		}
+	}
+
+	p := ray.At(t)
+	outward, uv := aabb.faceNormalAndUV(p)
+	hit := Hit{T: t, P: p, UV: uv}
+	hit.setFaceNormal(ray, outward)
+	return hit, true
+}
+
+// faceNormalAndUV returns the outward normal and the texture coordinates of
+// the face closest to the point p on the surface of the box.
+func (aabb *AABB) faceNormalAndUV(p mgl32.Vec3) (mgl32.Vec3, mgl32.Vec2) {
+	size := aabb.Size()
+	local := p.Sub(aabb.Min)
+
+	// find the face with the smallest relative distance to the point
+	axis, sign := 0, float32(-1)
+	best := float32(math.Inf(1))
+	for i := 0; i < 3; i++ {
+		if size[i] <= 0 {
+			continue
+		}
+		dmin := local[i] / size[i]
+		dmax := 1 - dmin
+		if dmin < best {
+			axis, sign, best = i, -1, dmin
+		}
+		if dmax < best {
+			axis, sign, best = i, 1, dmax
+		}
+	}
+
+	n := mgl32.Vec3{}
+	n[axis] = sign
+
+	// the texture coordinates span the two other axes
+	u, v := (axis+1)%3, (axis+2)%3
+	uv := mgl32.Vec2{ratio(local[u], size[u]), ratio(local[v], size[v])}
+	return n, uv
+}
+
+func ratio(a, b float32) float32 {
+	if b <= 0 {
+		return 0
+	}
+	return a / b
+}
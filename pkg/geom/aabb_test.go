@@ -0,0 +1,108 @@
+package geom
+
+import (
+	"math"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+var inf = float32(math.Inf(1))
+
+func TestAABBIntersect(t *testing.T) {
+	box := AABB{Min: mgl32.Vec3{-1, -1, -1}, Max: mgl32.Vec3{1, 1, 1}}
+	cases := []struct {
+		name   string
+		ray    Ray
+		hit    bool
+		t      float32
+		normal mgl32.Vec3
+		front  bool
+	}{
+		{"outside", MakeRay(mgl32.Vec3{0, 0, -3}, mgl32.Vec3{0, 0, 1}), true, 2, mgl32.Vec3{0, 0, -1}, true},
+		{"inside", MakeRay(mgl32.Vec3{0, 0, 0}, mgl32.Vec3{1, 0, 0}), true, 1, mgl32.Vec3{-1, 0, 0}, false},
+		{"oblique", MakeRay(mgl32.Vec3{-3, 0, 0}, mgl32.Vec3{4, 1, 0}), true, 0.5 * cgm.Sqrt32(17), mgl32.Vec3{-1, 0, 0}, true},
+		{"miss", MakeRay(mgl32.Vec3{0, 2, -3}, mgl32.Vec3{0, 0, 1}), false, 0, mgl32.Vec3{}, false},
+		{"behind", MakeRay(mgl32.Vec3{0, 0, 3}, mgl32.Vec3{0, 0, 1}), false, 0, mgl32.Vec3{}, false},
+	}
+
+	for _, c := range cases {
+		hit, ok := box.Intersect(&c.ray, 0, inf)
+		if ok != c.hit {
+			t.Errorf("%v: expected hit %v, got %v", c.name, c.hit, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if cgm.Abs32(hit.T-c.t) > 1e-5 {
+			t.Errorf("%v: expected t=%v, got %v", c.name, c.t, hit.T)
+		}
+		if hit.N.Sub(c.normal).Len() > 1e-5 || hit.FrontFace != c.front {
+			t.Errorf("%v: expected normal %v front %v, got %v %v", c.name, c.normal, c.front, hit.N, hit.FrontFace)
+		}
+		if hit.UV.X() < 0 || hit.UV.X() > 1 || hit.UV.Y() < 0 || hit.UV.Y() > 1 {
+			t.Errorf("%v: texture coordinates %v outside of [0,1]", c.name, hit.UV)
+		}
+	}
+
+	// the origin lies on the slab boundary of x, which results in 0*inf. the
+	// hit lies on an edge of the box, thus only the distance is checked.
+	ray := MakeRay(mgl32.Vec3{1, 0, -3}, mgl32.Vec3{0, 0, 1})
+	if hit, ok := box.Intersect(&ray, 0, inf); !ok || cgm.Abs32(hit.T-2) > 1e-5 {
+		t.Errorf("boundary: expected a hit at t=2, got %v %v", ok, hit.T)
+	}
+
+	// the range of the ray parameter is respected
+	ray = MakeRay(mgl32.Vec3{0, 0, -3}, mgl32.Vec3{0, 0, 1})
+	if _, ok := box.Intersect(&ray, 0, 1.5); ok {
+		t.Error("hit beyond tmax")
+	}
+	if hit, ok := box.Intersect(&ray, 2.5, inf); !ok || cgm.Abs32(hit.T-4) > 1e-5 {
+		t.Errorf("expected the far side at t=4 for tmin=2.5, got %v %v", ok, hit.T)
+	}
+}
+
+func TestAABBSlab(t *testing.T) {
+	box := AABB{Min: mgl32.Vec3{0, 0, 0}, Max: mgl32.Vec3{1, 2, 3}}
+	ray := MakeRay(mgl32.Vec3{0.5, 1, -1}, mgl32.Vec3{0, 0, 1})
+	tnear, tfar, ok := box.Slab(&ray, ray.InvDirection(), 0, inf)
+	if !ok || cgm.Abs32(tnear-1) > 1e-5 || cgm.Abs32(tfar-4) > 1e-5 {
+		t.Errorf("expected [1,4], got [%v,%v] %v", tnear, tfar, ok)
+	}
+
+	// the far distance is never underestimated, thus a ray grazing the far
+	// corner still hits the box
+	ray = MakeRay(mgl32.Vec3{-1, -1, 0.5}, mgl32.Vec3{2, 3, 0})
+	if _, _, ok := box.Slab(&ray, ray.InvDirection(), 0, inf); !ok {
+		t.Error("ray through the corner missed the box")
+	}
+}
+
+func TestAABBBounds(t *testing.T) {
+	box := MakeEmptyAABB()
+	if !box.IsEmpty() || box.SurfaceArea() != 0 {
+		t.Error("expected an empty box with an area of 0")
+	}
+	box.Extend(mgl32.Vec3{1, 0, 0})
+	box.Extend(mgl32.Vec3{0, 2, 3})
+	if box.IsEmpty() || box.Min != (mgl32.Vec3{0, 0, 0}) || box.Max != (mgl32.Vec3{1, 2, 3}) {
+		t.Errorf("unexpected box %v", box)
+	}
+	if box.SurfaceArea() != 22 || box.LongestAxis() != 2 {
+		t.Errorf("expected an area of 22 and axis 2, got %v %v", box.SurfaceArea(), box.LongestAxis())
+	}
+
+	empty := MakeEmptyAABB()
+	box.Union(&empty)
+	if box.Min != (mgl32.Vec3{0, 0, 0}) || box.Max != (mgl32.Vec3{1, 2, 3}) {
+		t.Errorf("union with an empty box changed the box to %v", box)
+	}
+
+	touching := AABB{Min: mgl32.Vec3{1, 0, 0}, Max: mgl32.Vec3{2, 1, 1}}
+	apart := AABB{Min: mgl32.Vec3{1.1, 0, 0}, Max: mgl32.Vec3{2, 1, 1}}
+	if !box.Overlaps(&touching) || box.Overlaps(&apart) {
+		t.Error("expected touching boxes to overlap and separate boxes not to")
+	}
+}
@@ -0,0 +1,98 @@
+// Package geom provides rays and the intersection of rays with geometric
+// primitives like spheres, boxes, triangles, planes and disks. All
+// intersections return a hit record with the position, normal, barycentric
+// coordinates and texture coordinates of the closest hit.
+package geom
+
+import (
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// machine epsilon of float32 used to bound rounding errors
+const epsilon float32 = 1.0 / (1 << 24)
+
+// Ray primitive consisting of an origin and a direction.
+type Ray struct {
+	Origin    mgl32.Vec3
+	Direction mgl32.Vec3
+}
+
+// Hit record storing the ray parameter T, the intersection point P and the
+// surface normal N. The normal always faces against the ray, FrontFace
+// specifies if the ray hit the outside of the surface. Barycentric holds the
+// weights of the vertices of a triangle and UV the texture coordinates.
+type Hit struct {
+	T           float32
+	P           mgl32.Vec3
+	N           mgl32.Vec3
+	FrontFace   bool
+	Barycentric mgl32.Vec3
+	UV          mgl32.Vec2
+}
+
+// Intersectable is a primitive that can be intersected by a ray.
+type Intersectable interface {
+	Intersect(ray *Ray, tmin, tmax float32) (Hit, bool)
+}
+
+// MakeRay creates a ray with a normalized direction.
+func MakeRay(origin, direction mgl32.Vec3) Ray {
+	return Ray{Origin: origin, Direction: direction.Normalize()}
+}
+
+// At returns the point along the ray for the parameter t.
+func (ray *Ray) At(t float32) mgl32.Vec3 {
+	return ray.Origin.Add(ray.Direction.Mul(t))
+}
+
+// InvDirection returns the componentwise inverse of the direction. Components
+// of zero turn into infinity with the sign of the zero.
+func (ray *Ray) InvDirection() mgl32.Vec3 {
+	return mgl32.Vec3{1 / ray.Direction.X(), 1 / ray.Direction.Y(), 1 / ray.Direction.Z()}
+}
+
+// setFaceNormal orients the outward normal against the ray and records which
+// side of the surface has been hit.
+func (hit *Hit) setFaceNormal(ray *Ray, outward mgl32.Vec3) {
+	hit.FrontFace = ray.Direction.Dot(outward) < 0
+	hit.N = outward
+	if !hit.FrontFace {
+		hit.N = outward.Mul(-1)
+	}
+}
+
+// ToWorld transforms the direction d from the local frame of the hit, whose
+// z-axis is the normal, into world space. Together with the warps of the
+// sampling package it generates directions around the normal.
+func (hit *Hit) ToWorld(d mgl32.Vec3) mgl32.Vec3 {
+	t, b := orthonormalBasis(hit.N)
+	return t.Mul(d.X()).Add(b.Mul(d.Y())).Add(hit.N.Mul(d.Z()))
+}
+
+// gamma bounds the relative rounding error of n floating point operations.
+func gamma(n int) float32 {
+	return float32(n) * epsilon / (1 - float32(n)*epsilon)
+}
+
+// orthonormalBasis returns two vectors that together with n form an
+// orthonormal basis.
+func orthonormalBasis(n mgl32.Vec3) (mgl32.Vec3, mgl32.Vec3) {
+	up := mgl32.Vec3{1, 0, 0}
+	if cgm.Abs32(n.Y()) < 0.999 {
+		up = mgl32.Vec3{0, 1, 0}
+	}
+	t := up.Cross(n).Normalize()
+	b := n.Cross(t)
+	return t, b
+}
+
+// sphericalUV maps the unit direction d onto the equirectangular texture
+// coordinates used throughout the renderer.
+func sphericalUV(d mgl32.Vec3) mgl32.Vec2 {
+	u := cgm.Atan232(d.Z(), d.X())/(2*math.Pi) + 0.5
+	v := cgm.Asin32(cgm.Clamp(d.Y(), -1, 1))/math.Pi + 0.5
+	return mgl32.Vec2{u, v}
+}
@@ -0,0 +1,100 @@
+package geom
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/sampling"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+var normals = []mgl32.Vec3{
+	{0, 0, 1}, {0, 1, 0}, {0, -1, 0}, {1, 0, 0},
+	mgl32.Vec3{0.001, 1, 0}.Normalize(), mgl32.Vec3{1, 2, -3}.Normalize(),
+}
+
+func TestOrthonormalBasis(t *testing.T) {
+	for _, n := range normals {
+		tangent, bitangent := orthonormalBasis(n)
+		for _, d := range []float32{tangent.Dot(n), bitangent.Dot(n), tangent.Dot(bitangent)} {
+			if cgm.Abs32(d) > 1e-5 {
+				t.Errorf("normal %v: basis %v %v isn't orthogonal", n, tangent, bitangent)
+			}
+		}
+		if cgm.Abs32(tangent.Len()-1) > 1e-5 || cgm.Abs32(bitangent.Len()-1) > 1e-5 {
+			t.Errorf("normal %v: basis %v %v isn't normalized", n, tangent, bitangent)
+		}
+		// right handed such that tangent x bitangent = n
+		if tangent.Cross(bitangent).Sub(n).Len() > 1e-5 {
+			t.Errorf("normal %v: basis %v %v isn't right handed", n, tangent, bitangent)
+		}
+	}
+}
+
+func TestSphericalUV(t *testing.T) {
+	cases := []struct {
+		d  mgl32.Vec3
+		uv mgl32.Vec2
+	}{
+		{mgl32.Vec3{1, 0, 0}, mgl32.Vec2{0.5, 0.5}},
+		{mgl32.Vec3{0, 0, 1}, mgl32.Vec2{0.75, 0.5}},
+		{mgl32.Vec3{0, 1, 0}, mgl32.Vec2{0.5, 1}},
+		{mgl32.Vec3{0, -1, 0}, mgl32.Vec2{0.5, 0}},
+	}
+	for _, c := range cases {
+		if uv := sphericalUV(c.d); uv.Sub(c.uv).Len() > 1e-5 {
+			t.Errorf("direction %v: expected %v, got %v", c.d, c.uv, uv)
+		}
+	}
+}
+
+// cosine distributed directions transformed into the frame of a hit lie in
+// the hemisphere around the normal with a mean cosine of 2/3
+func TestToWorld(t *testing.T) {
+	const samples = 4096
+	rnd := rand.New(rand.NewSource(SEED))
+	for _, n := range normals {
+		hit := Hit{N: n}
+		var mean float32
+		for i := 0; i < samples; i++ {
+			d := hit.ToWorld(sampling.CosineHemisphere(mgl32.Vec2{rnd.Float32(), rnd.Float32()}))
+			if cgm.Abs32(d.Len()-1) > 1e-4 {
+				t.Fatalf("normal %v: direction %v isn't normalized", n, d)
+			}
+			if d.Dot(n) < -1e-5 {
+				t.Fatalf("normal %v: direction %v lies below the surface", n, d)
+			}
+			mean += d.Dot(n) / samples
+		}
+		if cgm.Abs32(mean-2.0/3.0) > 0.02 {
+			t.Errorf("normal %v: expected a mean cosine of 2/3, got %v", n, mean)
+		}
+	}
+}
+
+// the frame of NormalMapping is orthogonal and the neutral normal map yields
+// the surface normal
+func TestNormalMapping(t *testing.T) {
+	normals := []mgl32.Vec3{
+		{0, 0, 1}, {1, 0, 0}, {0, -1, 0}, {0, 1, 0},
+		mgl32.Vec3{0.1, 1, 0.05}.Normalize(), mgl32.Vec3{-1, 2, 3}.Normalize(),
+	}
+	for _, n := range normals {
+		b, tangent := NormalMappingFrame(n)
+		if cgm.Abs32(b.Dot(n)) > 1e-6 || cgm.Abs32(tangent.Dot(n)) > 1e-6 || cgm.Abs32(b.Dot(tangent)) > 1e-6 {
+			t.Errorf("normal %v: frame %v %v isn't orthogonal", n, b, tangent)
+		}
+		if mapped := NormalMapping(n, mgl32.Vec3{0.5, 0.5, 1}); mapped.Sub(n).Len() > 1e-6 {
+			t.Errorf("normal %v: neutral normal map yields %v", n, mapped)
+		}
+	}
+
+	// the red channel tilts the normal towards the binormal
+	n := mgl32.Vec3{0, 0, 1}
+	b, _ := NormalMappingFrame(n)
+	mapped := NormalMapping(n, mgl32.Vec3{1, 0.5, 0.5})
+	if mapped.Sub(b.Normalize()).Len() > 1e-6 {
+		t.Errorf("red normal map yields %v instead of %v", mapped, b.Normalize())
+	}
+}
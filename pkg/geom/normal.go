@@ -0,0 +1,42 @@
+package geom
+
+import "github.com/go-gl/mathgl/mgl32"
+
+// epsilon of the shaders used to pick the helper axis of the tangent frame
+const shaderEpsilon float32 = 0.001
+
+// NormalMappingFrame returns the binormal and tangent that NormalMapping of
+// normal.glsl derives from the normalized surface normal n. Like in the
+// shader both are orthogonal to n but not normalized, their length is the
+// sine of the angle between n and the helper axis, which is the y-axis for
+// normals pointing upwards and the x-axis otherwise. Thus the frame
+// degenerates for normals along the positive y-axis or the x-axis, where both
+// vectors vanish.
+func NormalMappingFrame(n mgl32.Vec3) (mgl32.Vec3, mgl32.Vec3) {
+	t := mgl32.Vec3{0, 1, 0}
+	if n.Dot(mgl32.Vec3{0, 1, 0}) < shaderEpsilon {
+		t = mgl32.Vec3{1, 0, 0}
+	}
+	b := t.Cross(n)
+	t = n.Cross(b)
+	return b, t
+}
+
+// NormalMapping mirrors NormalMapping of normal.glsl. The relative normal is
+// the color of the normal map in [0,1]. The tangent frame is derived from the
+// surface normal alone, thus the result matches the realtime renderer rather
+// than a tangent frame aligned with the texture coordinates. Unlike the
+// shader the result is normalized, which only changes its length.
+func NormalMapping(surfaceNormal, relativeNormal mgl32.Vec3) mgl32.Vec3 {
+	n := surfaceNormal.Normalize()
+	b, t := NormalMappingFrame(n)
+
+	// in its neutral position the relative normal is pointing in the
+	// z-direction which is blue
+	rn := relativeNormal.Mul(2).Sub(mgl32.Vec3{1, 1, 1})
+	mapped := b.Mul(rn.X()).Add(t.Mul(rn.Y())).Add(n.Mul(rn.Z()))
+	if mapped.Len() == 0 {
+		return n
+	}
+	return mapped.Normalize()
+}
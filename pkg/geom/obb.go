@@ -0,0 +1,65 @@
+package geom
+
+import (
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// OBB is an oriented bounding box defined by its center, the orthonormal
+// axes of its local frame and half of its extent along each of these axes.
+type OBB struct {
+	Center   mgl32.Vec3
+	Axes     [3]mgl32.Vec3
+	HalfSize mgl32.Vec3
+}
+
+// MakeOBB creates an oriented box whose axes are the columns of the rotation.
+func MakeOBB(center, halfsize mgl32.Vec3, rotation mgl32.Mat3) OBB {
+	return OBB{
+		Center:   center,
+		Axes:     [3]mgl32.Vec3{rotation.Col(0), rotation.Col(1), rotation.Col(2)},
+		HalfSize: halfsize,
+	}
+}
+
+// Intersect returns the closest intersection of the ray with the surface of
+// the box. The ray is transformed into the local frame of the box and
+// intersected with the corresponding axis aligned box. The texture
+// coordinates are in [0,1] on each face.
+func (obb *OBB) Intersect(ray *Ray, tmin, tmax float32) (Hit, bool) {
+	// as the axes are orthonormal the ray parameters are the same in both
+	// frames
+	o := ray.Origin.Sub(obb.Center)
+	local := Ray{
+		Origin:    mgl32.Vec3{o.Dot(obb.Axes[0]), o.Dot(obb.Axes[1]), o.Dot(obb.Axes[2])},
+		Direction: obb.toLocal(ray.Direction),
+	}
+	box := AABB{Min: obb.HalfSize.Mul(-1), Max: obb.HalfSize}
+	hit, ok := box.Intersect(&local, tmin, tmax)
+	if !ok {
+		return Hit{}, false
+	}
+
+	hit.P = ray.At(hit.T)
+	hit.N = obb.toWorld(hit.N)
+	return hit, true
+}
+
+// Bounds returns the axis aligned bounding box of the box.
+func (obb *OBB) Bounds() AABB {
+	e := mgl32.Vec3{}
+	for i := 0; i < 3; i++ {
+		for a := 0; a < 3; a++ {
+			e[i] += cgm.Abs32(obb.Axes[a][i]) * obb.HalfSize[a]
+		}
+	}
+	return AABB{Min: obb.Center.Sub(e), Max: obb.Center.Add(e)}
+}
+
+func (obb *OBB) toLocal(v mgl32.Vec3) mgl32.Vec3 {
+	return mgl32.Vec3{v.Dot(obb.Axes[0]), v.Dot(obb.Axes[1]), v.Dot(obb.Axes[2])}
+}
+
+func (obb *OBB) toWorld(v mgl32.Vec3) mgl32.Vec3 {
+	return obb.Axes[0].Mul(v.X()).Add(obb.Axes[1].Mul(v.Y())).Add(obb.Axes[2].Mul(v.Z()))
+}
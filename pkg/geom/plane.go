@@ -0,0 +1,90 @@
+package geom
+
+import (
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Plane is an infinite plane through a point with the specified normal.
+type Plane struct {
+	Point  mgl32.Vec3
+	Normal mgl32.Vec3
+}
+
+// Disk is a circular part of a plane around the center with the specified
+// normal and radius.
+type Disk struct {
+	Center mgl32.Vec3
+	Normal mgl32.Vec3
+	Radius float32
+}
+
+// Intersect returns the intersection of the ray with the plane. The texture
+// coordinates are the coordinates of the hit within the plane relative to
+// the point of the plane.
+func (plane *Plane) Intersect(ray *Ray, tmin, tmax float32) (Hit, bool) {
+	t, ok := intersectPlane(ray, plane.Point, plane.Normal, tmin, tmax)
+	if !ok {
+		return Hit{}, false
+	}
+
+	p := ray.At(t)
+	tangent, bitangent := orthonormalBasis(plane.Normal)
+	local := p.Sub(plane.Point)
+	hit := Hit{T: t, P: p, UV: mgl32.Vec2{local.Dot(tangent), local.Dot(bitangent)}}
+	hit.setFaceNormal(ray, plane.Normal)
+	return hit, true
+}
+
+// Intersect returns the intersection of the ray with the disk. The texture
+// coordinates are the polar coordinates of the hit with the distance to the
+// center relative to the radius and the angle in [0,1].
+func (disk *Disk) Intersect(ray *Ray, tmin, tmax float32) (Hit, bool) {
+	t, ok := intersectPlane(ray, disk.Center, disk.Normal, tmin, tmax)
+	if !ok {
+		return Hit{}, false
+	}
+
+	p := ray.At(t)
+	local := p.Sub(disk.Center)
+	r := local.Len()
+	if r > disk.Radius {
+		return Hit{}, false
+	}
+
+	tangent, bitangent := orthonormalBasis(disk.Normal)
+	phi := cgm.Atan232(local.Dot(bitangent), local.Dot(tangent))
+	if phi < 0 {
+		phi += 2 * math.Pi
+	}
+	hit := Hit{T: t, P: p, UV: mgl32.Vec2{r / disk.Radius, phi / (2 * math.Pi)}}
+	hit.setFaceNormal(ray, disk.Normal)
+	return hit, true
+}
+
+// Bounds returns the bounding box of the disk.
+func (disk *Disk) Bounds() AABB {
+	// extent of the disk along each axis
+	n := disk.Normal.Normalize()
+	e := mgl32.Vec3{}
+	for i := 0; i < 3; i++ {
+		e[i] = disk.Radius * cgm.Sqrt32(cgm.Max32(1-n[i]*n[i], 0))
+	}
+	return AABB{Min: disk.Center.Sub(e), Max: disk.Center.Add(e)}
+}
+
+// intersectPlane returns the ray parameter of the intersection with the plane
+// through the point p with the normal n.
+func intersectPlane(ray *Ray, p, n mgl32.Vec3, tmin, tmax float32) (float32, bool) {
+	denom := n.Dot(ray.Direction)
+	if cgm.Abs32(denom) < 1e-12 {
+		return 0, false
+	}
+	t := p.Sub(ray.Origin).Dot(n) / denom
+	if t < tmin || t > tmax {
+		return 0, false
+	}
+	return t, true
+}
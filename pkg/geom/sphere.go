@@ -0,0 +1,49 @@
+package geom
+
+import (
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Sphere consists of a center and a radius.
+type Sphere struct {
+	Center mgl32.Vec3
+	Radius float32
+}
+
+// Intersect returns the closest intersection of the ray with the sphere with
+// a ray parameter in [tmin,tmax]. The texture coordinates are the
+// equirectangular coordinates of the normal.
+func (sphere *Sphere) Intersect(ray *Ray, tmin, tmax float32) (Hit, bool) {
+	// solve squared term
+	oc := ray.Origin.Sub(sphere.Center)
+	a := ray.Direction.Dot(ray.Direction)
+	b := oc.Dot(ray.Direction)
+	c := oc.Dot(oc) - sphere.Radius*sphere.Radius
+	discriminant := b*b - a*c
+	if discriminant < 0 {
+		return Hit{}, false
+	}
+
+	// take the nearer solution if it is inside the range
+	sqrtd := cgm.Sqrt32(discriminant)
+	t := (-b - sqrtd) / a
+	if t < tmin || t > tmax {
+		t = (-b + sqrtd) / a
+		if t < tmin || t > tmax {
+			return Hit{}, false
+		}
+	}
+
+	p := ray.At(t)
+	outward := p.Sub(sphere.Center).Mul(1 / sphere.Radius)
+	hit := Hit{T: t, P: p, UV: sphericalUV(outward)}
+	hit.setFaceNormal(ray, outward)
+	return hit, true
+}
+
+// Bounds returns the bounding box of the sphere.
+func (sphere *Sphere) Bounds() AABB {
+	r := mgl32.Vec3{sphere.Radius, sphere.Radius, sphere.Radius}
+	return AABB{Min: sphere.Center.Sub(r), Max: sphere.Center.Add(r)}
+}
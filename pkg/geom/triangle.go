@@ -0,0 +1,148 @@
+package geom
+
+import (
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Triangle is defined by its three vertices and their texture coordinates.
+type Triangle struct {
+	V0, V1, V2    mgl32.Vec3
+	UV0, UV1, UV2 mgl32.Vec2
+}
+
+// MakeTriangle creates a triangle whose texture coordinates are the
+// barycentric coordinates of V1 and V2.
+func MakeTriangle(v0, v1, v2 mgl32.Vec3) Triangle {
+	return Triangle{
+		V0: v0, V1: v1, V2: v2,
+		UV0: mgl32.Vec2{0, 0}, UV1: mgl32.Vec2{1, 0}, UV2: mgl32.Vec2{0, 1},
+	}
+}
+
+// Normal returns the normal of the triangle given by the winding order of its
+// vertices.
+func (tri *Triangle) Normal() mgl32.Vec3 {
+	return tri.V1.Sub(tri.V0).Cross(tri.V2.Sub(tri.V0)).Normalize()
+}
+
+// Bounds returns the bounding box of the triangle.
+func (tri *Triangle) Bounds() AABB {
+	aabb := MakeEmptyAABB()
+	aabb.Extend(tri.V0)
+	aabb.Extend(tri.V1)
+	aabb.Extend(tri.V2)
+	return aabb
+}
+
+// Centroid returns the center of gravity of the triangle.
+func (tri *Triangle) Centroid() mgl32.Vec3 {
+	return tri.V0.Add(tri.V1).Add(tri.V2).Mul(1.0 / 3.0)
+}
+
+// Intersect returns the intersection of the ray with the triangle using the
+// algorithm of Möller and Trumbore "Fast, Minimum Storage Ray/Triangle
+// Intersection". It is fast but can miss hits on shared edges.
+func (tri *Triangle) Intersect(ray *Ray, tmin, tmax float32) (Hit, bool) {
+	e1 := tri.V1.Sub(tri.V0)
+	e2 := tri.V2.Sub(tri.V0)
+	p := ray.Direction.Cross(e2)
+	det := e1.Dot(p)
+
+	// the ray is parallel to the triangle
+	if cgm.Abs32(det) < 1e-12 {
+		return Hit{}, false
+	}
+	invdet := 1 / det
+
+	s := ray.Origin.Sub(tri.V0)
+	u := s.Dot(p) * invdet
+	if u < 0 || u > 1 {
+		return Hit{}, false
+	}
+
+	q := s.Cross(e1)
+	v := ray.Direction.Dot(q) * invdet
+	if v < 0 || u+v > 1 {
+		return Hit{}, false
+	}
+
+	t := e2.Dot(q) * invdet
+	if t < tmin || t > tmax {
+		return Hit{}, false
+	}
+
+	return tri.makeHit(ray, t, mgl32.Vec3{1 - u - v, u, v}), true
+}
+
+// IntersectWatertight returns the intersection of the ray with the triangle
+// using the algorithm of Woop et al. "Watertight Ray/Triangle Intersection".
+// Rays hitting an edge shared by two triangles hit at least one of them.
+func (tri *Triangle) IntersectWatertight(ray *Ray, tmin, tmax float32) (Hit, bool) {
+	dir := ray.Direction
+
+	// the dimension with the largest extent of the direction becomes z while
+	// keeping the winding order
+	kz := 0
+	if cgm.Abs32(dir.Y()) > cgm.Abs32(dir[kz]) {
+		kz = 1
+	}
+	if cgm.Abs32(dir.Z()) > cgm.Abs32(dir[kz]) {
+		kz = 2
+	}
+	kx := (kz + 1) % 3
+	ky := (kx + 1) % 3
+	if dir[kz] < 0 {
+		kx, ky = ky, kx
+	}
+
+	// shear constants that align the ray with the z axis
+	sx := dir[kx] / dir[kz]
+	sy := dir[ky] / dir[kz]
+	sz := 1 / dir[kz]
+
+	// vertices relative to the ray origin in the sheared space
+	a := tri.V0.Sub(ray.Origin)
+	b := tri.V1.Sub(ray.Origin)
+	c := tri.V2.Sub(ray.Origin)
+	ax, ay := a[kx]-sx*a[kz], a[ky]-sy*a[kz]
+	bx, by := b[kx]-sx*b[kz], b[ky]-sy*b[kz]
+	cx, cy := c[kx]-sx*c[kz], c[ky]-sy*c[kz]
+
+	// scaled barycentric coordinates. edges are recomputed in double
+	// precision to get a consistent result on both sides of an edge.
+	u := cx*by - cy*bx
+	v := ax*cy - ay*cx
+	w := bx*ay - by*ax
+	if u == 0 || v == 0 || w == 0 {
+		u = float32(float64(cx)*float64(by) - float64(cy)*float64(bx))
+		v = float32(float64(ax)*float64(cy) - float64(ay)*float64(cx))
+		w = float32(float64(bx)*float64(ay) - float64(by)*float64(ax))
+	}
+	if (u < 0 || v < 0 || w < 0) && (u > 0 || v > 0 || w > 0) {
+		return Hit{}, false
+	}
+
+	det := u + v + w
+	if det == 0 {
+		return Hit{}, false
+	}
+
+	// scaled distance of the hit
+	az, bz, cz := sz*a[kz], sz*b[kz], sz*c[kz]
+	t := (u*az + v*bz + w*cz) / det
+	if t < tmin || t > tmax {
+		return Hit{}, false
+	}
+
+	return tri.makeHit(ray, t, mgl32.Vec3{u / det, v / det, w / det}), true
+}
+
+// makeHit creates the hit record for the ray parameter t and the barycentric
+// coordinates of the vertices.
+func (tri *Triangle) makeHit(ray *Ray, t float32, bary mgl32.Vec3) Hit {
+	uv := tri.UV0.Mul(bary.X()).Add(tri.UV1.Mul(bary.Y())).Add(tri.UV2.Mul(bary.Z()))
+	hit := Hit{T: t, P: ray.At(t), Barycentric: bary, UV: uv}
+	hit.setFaceNormal(ray, tri.Normal())
+	return hit
+}
@@ -0,0 +1,131 @@
+package geom
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const SEED = 42
+
+func TestTriangleIntersect(t *testing.T) {
+	tri := MakeTriangle(mgl32.Vec3{0, 0, 0}, mgl32.Vec3{1, 0, 0}, mgl32.Vec3{0, 1, 0})
+	intersections := map[string]func(ray *Ray, tmin, tmax float32) (Hit, bool){
+		"moeller-trumbore": tri.Intersect,
+		"watertight":       tri.IntersectWatertight,
+	}
+
+	for name, intersect := range intersections {
+		ray := MakeRay(mgl32.Vec3{0.25, 0.5, 2}, mgl32.Vec3{0, 0, -1})
+		hit, ok := intersect(&ray, 0, inf)
+		if !ok {
+			t.Fatalf("%v: missed the triangle", name)
+		}
+		if cgm.Abs32(hit.T-2) > 1e-6 {
+			t.Errorf("%v: expected t=2, got %v", name, hit.T)
+		}
+		if hit.Barycentric.Sub(mgl32.Vec3{0.25, 0.25, 0.5}).Len() > 1e-6 {
+			t.Errorf("%v: expected barycentric (0.25,0.25,0.5), got %v", name, hit.Barycentric)
+		}
+		if hit.UV.Sub(mgl32.Vec2{0.25, 0.5}).Len() > 1e-6 {
+			t.Errorf("%v: expected uv (0.25,0.5), got %v", name, hit.UV)
+		}
+		if !hit.FrontFace || hit.N != (mgl32.Vec3{0, 0, 1}) {
+			t.Errorf("%v: expected the front face, got %v %v", name, hit.FrontFace, hit.N)
+		}
+
+		// the back face is hit as well
+		ray = MakeRay(mgl32.Vec3{0.25, 0.25, -1}, mgl32.Vec3{0, 0, 1})
+		if hit, ok := intersect(&ray, 0, inf); !ok || hit.FrontFace || hit.N != (mgl32.Vec3{0, 0, -1}) {
+			t.Errorf("%v: expected the back face, got %v %v %v", name, ok, hit.FrontFace, hit.N)
+		}
+
+		misses := []Ray{
+			MakeRay(mgl32.Vec3{0.75, 0.75, 1}, mgl32.Vec3{0, 0, -1}),
+			MakeRay(mgl32.Vec3{-0.1, 0.5, 1}, mgl32.Vec3{0, 0, -1}),
+			MakeRay(mgl32.Vec3{0.25, 0.25, 1}, mgl32.Vec3{0, 0, 1}),
+			MakeRay(mgl32.Vec3{-1, 0.25, 0}, mgl32.Vec3{1, 0, 0}),
+		}
+		for _, ray := range misses {
+			if _, ok := intersect(&ray, 0, inf); ok {
+				t.Errorf("%v: expected %v to miss", name, ray)
+			}
+		}
+		ray = MakeRay(mgl32.Vec3{0.25, 0.25, 1}, mgl32.Vec3{0, 0, -1})
+		if _, ok := intersect(&ray, 0, 0.5); ok {
+			t.Errorf("%v: hit beyond tmax", name)
+		}
+	}
+}
+
+// rays through the vertices of a triangle hit it and rays through an edge hit
+// at least one of the two triangles sharing it
+func TestWatertightEdgesAndVertices(t *testing.T) {
+	v := []mgl32.Vec3{{0.1, 0.2, 0.3}, {1.7, -0.3, 0.1}, {0.4, 1.3, -0.2}}
+	tri := MakeTriangle(v[0], v[1], v[2])
+	origin := mgl32.Vec3{0.3, 0.4, 5}
+
+	for i := range v {
+		ray := MakeRay(origin, v[i].Sub(origin))
+		hit, ok := tri.IntersectWatertight(&ray, 0, inf)
+		if !ok {
+			t.Errorf("ray through vertex %v missed", i)
+			continue
+		}
+		if hit.Barycentric[i] < 1-1e-5 {
+			t.Errorf("vertex %v: expected its weight to be 1, got %v", i, hit.Barycentric)
+		}
+	}
+
+	neighbor := MakeTriangle(v[1], v[0], mgl32.Vec3{0.9, -1.4, 0.5})
+	rnd := rand.New(rand.NewSource(SEED))
+	for i := 0; i < 1000; i++ {
+		p := v[0].Add(v[1].Sub(v[0]).Mul(rnd.Float32()))
+		ray := MakeRay(origin, p.Sub(origin))
+		_, ok0 := tri.IntersectWatertight(&ray, 0, inf)
+		_, ok1 := neighbor.IntersectWatertight(&ray, 0, inf)
+		if !ok0 && !ok1 {
+			t.Fatalf("ray through %v on the shared edge missed both triangles", p)
+		}
+	}
+}
+
+// rays through the shared edges and the shared vertex of a fan of triangles
+// hit at least one of them, which the fast test of Möller and Trumbore
+// doesn't guarantee
+func TestWatertightSharedEdges(t *testing.T) {
+	rnd := rand.New(rand.NewSource(SEED))
+	center := mgl32.Vec3{0.13, -0.27, 0.31}
+	var fan []Triangle
+	var rim []mgl32.Vec3
+	for i := 0; i < 7; i++ {
+		angle := 2 * 3.14159265 * float32(i) / 7
+		rim = append(rim, center.Add(mgl32.Vec3{cgm.Cos32(angle), cgm.Sin32(angle), 0.3 * cgm.Sin32(3*angle)}))
+	}
+	for i := range rim {
+		fan = append(fan, MakeTriangle(center, rim[i], rim[(i+1)%len(rim)]))
+	}
+
+	hits := func(ray *Ray) bool {
+		for i := range fan {
+			if _, ok := fan[i].IntersectWatertight(ray, 0, inf); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := 0; i < 2000; i++ {
+		origin := mgl32.Vec3{rnd.Float32()*4 - 2, rnd.Float32()*4 - 2, 3 + rnd.Float32()}
+		target := center
+		if i > 0 {
+			target = center.Add(rim[rnd.Intn(len(rim))].Sub(center).Mul(rnd.Float32()))
+		}
+		ray := MakeRay(origin, target.Sub(origin))
+		if !hits(&ray) {
+			t.Fatalf("ray from %v through the shared point %v missed all triangles", origin, target)
+		}
+	}
+}
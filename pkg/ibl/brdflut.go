@@ -0,0 +1,131 @@
+// Package ibl provides offline precomputations for image based lighting like
+// the environment BRDF lookup table of the split-sum approximation.
+package ibl
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/adrianderstroff/pbr/pkg/brdf"
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/core/gl"
+	"github.com/adrianderstroff/pbr/pkg/sampling"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/adrianderstroff/pbr/pkg/view/texture"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// IntegrateBrdf solves the second integral of the split-sum approximation for
+// the specified view angle and perceptual roughness using the specified number
+// of importance samples. The result is the scale and the bias that are applied
+// to f0 to get the directional albedo of the specular GGX lobe:
+// albedo = f0 * scale + bias.
+func IntegrateBrdf(nDotV, roughness float32, samples int) (float32, float32) {
+	nDotV = cgm.Max32(nDotV, 1e-4)
+	a := roughness * roughness
+
+	// view direction in tangent space with the normal pointing in z
+	n := mgl32.Vec3{0, 0, 1}
+	v := mgl32.Vec3{cgm.Sqrt32(1 - nDotV*nDotV), 0, nDotV}
+
+	var scale, bias float64
+	for s := 0; s < samples; s++ {
+		// sample a half vector and reflect the view direction on it
+		xi := sampling.HammersleySampling(uint32(s), uint32(samples))
+		h := sampling.ImportanceSamplingGGX(xi, n, a)
+		l := reflect(v.Mul(-1), h)
+
+		nDotL := cgm.Max32(l.Z(), 0)
+		nDotH := cgm.Max32(h.Z(), 0)
+		vDotH := cgm.Max32(v.Dot(h), 0)
+		if nDotL <= 0 || nDotH <= 0 {
+			continue
+		}
+
+		// the pdf of the sample is D * (n.h) / (4 * (v.h)), thus D cancels
+		// out and only the visibility term with the jacobian remains
+		vis := brdf.VisibilitySmithGGXCorrelated(nDotV, nDotL, a)
+		gvis := float64(4 * vis * nDotL * vDotH / nDotH)
+		fc := math.Pow(1-float64(vDotH), 5)
+
+		scale += (1 - fc) * gvis
+		bias += fc * gvis
+	}
+
+	return float32(scale / float64(samples)), float32(bias / float64(samples))
+}
+
+// MakeBrdfLut creates the environment BRDF lookup table of the specified
+// size. The x-axis of the image corresponds to n.v and the y-axis to the
+// roughness, both sampled at the texel centers. The first channel holds the
+// scale and the second channel the bias applied to f0. The rows are computed
+// in parallel.
+func MakeBrdfLut(size, samples int) (image2d.Image2D, error) {
+	lut, err := image2d.MakeFloat32(size, size, 2)
+	if err != nil {
+		return image2d.Image2D{}, err
+	}
+
+	rows := make(chan int, size)
+	for y := 0; y < size; y++ {
+		rows <- y
+	}
+	close(rows)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := range rows {
+				roughness := (float32(y) + 0.5) / float32(size)
+				for x := 0; x < size; x++ {
+					nDotV := (float32(x) + 0.5) / float32(size)
+					scale, bias := IntegrateBrdf(nDotV, roughness, samples)
+					lut.SetFloat32(x, y, 0, scale)
+					lut.SetFloat32(x, y, 1, bias)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return lut, nil
+}
+
+// MakeBrdfLutTexture uploads the lookup table to the GPU. Images loaded from
+// disk have 3 channels, of which only the first two are used. The texture is
+// linearly filtered and clamped, so that it can be sampled directly with
+// vec2(n.v, roughness).
+func MakeBrdfLutTexture(lut *image2d.Image2D) texture.Texture {
+	format := uint32(gl.RG)
+	if lut.GetChannels() == 3 {
+		format = gl.RGB
+	}
+	return texture.Make(lut.GetWidth(), lut.GetHeight(), gl.RG32F, format,
+		lut.GetPixelType(), lut.GetDataPointer(), gl.LINEAR, gl.LINEAR,
+		gl.CLAMP_TO_EDGE, gl.CLAMP_TO_EDGE)
+}
+
+// LoadBrdfLutTexture loads a lookup table that had been saved as a .pfm
+// portable float map and uploads it to the GPU. Lookup tables with less than
+// 32bit per channel are rejected since the quantization biases the scale and
+// bias terms.
+func LoadBrdfLutTexture(path string) (texture.Texture, error) {
+	lut, err := image2d.MakeFromPath(path)
+	if err != nil {
+		return texture.Texture{}, err
+	}
+	if lut.GetByteDepth() != 4 {
+		return texture.Texture{}, fmt.Errorf("brdf lut %v has to store 32bit floats", path)
+	}
+	return MakeBrdfLutTexture(&lut), nil
+}
+
+// reflect mirrors the incident vector i at the normal n like its GLSL
+// counterpart.
+func reflect(i, n mgl32.Vec3) mgl32.Vec3 {
+	return i.Sub(n.Mul(2 * n.Dot(i)))
+}
@@ -0,0 +1,200 @@
+package ibl
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/core/gl"
+	"github.com/adrianderstroff/pbr/pkg/envmap"
+	"github.com/adrianderstroff/pbr/pkg/sampling"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/adrianderstroff/pbr/pkg/view/texture"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// LevelRoughness returns the perceptual roughness that is stored in the
+// specified level of a prefiltered mip chain with the specified number of
+// levels. The roughness increases linearly from 0 to 1, which is the inverse
+// of textureLod(cubemap, r, roughness * maxMip) in the shaders.
+func LevelRoughness(level, levels int) float32 {
+	if levels <= 1 {
+		return 0
+	}
+	return float32(level) / float32(levels-1)
+}
+
+// PrefilterEnvironment convolves the environment with the GGX lobe of the
+// specified perceptual roughness and returns a cube map of the specified size.
+// As in the split-sum approximation the view and normal direction are assumed
+// to be the reflection direction. The source is passed as a complete mip
+// chain, see envmap.Cubemap.MakeMipChain, and each importance sample reads
+// from the mip level whose texel solid angle matches the solid angle of the
+// sample. This removes the fireflies caused by small bright light sources.
+func PrefilterEnvironment(chain []envmap.Cubemap, size int, roughness float32, samples int) (envmap.Cubemap, error) {
+	if len(chain) == 0 {
+		return envmap.Cubemap{}, errors.New("mip chain of the environment is empty")
+	}
+	result, err := envmap.MakeEmptyCubemap(size, 3)
+	if err != nil {
+		return envmap.Cubemap{}, err
+	}
+
+	// a perfect mirror is just a resampling of the environment
+	if roughness == 0 {
+		samples = 1
+	}
+
+	// solid angle of a texel of the most detailed level
+	srcSize := float32(chain[0].GetSize())
+	texelSolidAngle := 4 * math.Pi / (6 * srcSize * srcSize)
+	a := roughness * roughness
+
+	// all rows of all faces are processed in parallel
+	rows := make(chan [2]int, 6*size)
+	for f := 0; f < 6; f++ {
+		for y := 0; y < size; y++ {
+			rows <- [2]int{f, y}
+		}
+	}
+	close(rows)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row := range rows {
+				f, y := row[0], row[1]
+				for x := 0; x < size; x++ {
+					n := result.TexelDirection(f, x, y)
+					if roughness == 0 {
+						result.SetTexel(f, x, y, chain[0].Sample(n))
+						continue
+					}
+					color := prefilterTexel(chain, n, a, samples, texelSolidAngle)
+					result.SetTexel(f, x, y, color)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return result, nil
+}
+
+// prefilterTexel integrates the environment around the direction n with the
+// GGX lobe of the roughness parameter a, weighting each sample by n.l.
+func prefilterTexel(chain []envmap.Cubemap, n mgl32.Vec3, a float32, samples int, texelSolidAngle float32) mgl32.Vec3 {
+	v := n
+	color := mgl32.Vec3{0, 0, 0}
+	var weight float32
+	for s := 0; s < samples; s++ {
+		xi := sampling.HammersleySampling(uint32(s), uint32(samples))
+		h := sampling.ImportanceSamplingGGX(xi, n, a)
+		l := reflect(v.Mul(-1), h)
+
+		nDotL := n.Dot(l)
+		if nDotL <= 0 {
+			continue
+		}
+
+		// with n = v the pdf D * (n.h) / (4 * (v.h)) reduces to D / 4
+		nDotH := cgm.Max32(n.Dot(h), 0)
+		pdf := distributionGGX(nDotH, a)/4 + 1e-4
+		sampleSolidAngle := 1 / (float32(samples) * pdf)
+		lod := 0.5*float32(math.Log2(float64(sampleSolidAngle/texelSolidAngle))) + 1
+
+		color = color.Add(envmap.SampleMipChain(chain, l, lod).Mul(nDotL))
+		weight += nDotL
+	}
+
+	if weight == 0 {
+		return color
+	}
+	return color.Mul(1 / weight)
+}
+
+// distributionGGX is the GGX normal distribution function for the roughness
+// parameter a.
+func distributionGGX(nDotH, a float32) float32 {
+	a2 := a * a
+	denom := nDotH*nDotH*(a2-1) + 1
+	return a2 / (math.Pi * denom * denom)
+}
+
+// MakePrefilteredMipChain bakes the prefiltered specular environment of the
+// specified number of levels. Level i has faces of size size>>i and stores
+// the environment prefiltered with the roughness LevelRoughness(i, levels).
+func MakePrefilteredMipChain(src *envmap.Cubemap, size, levels, samples int) ([]envmap.Cubemap, error) {
+	if levels < 1 || size>>uint(levels-1) < 1 {
+		return nil, fmt.Errorf("can't create %v levels for a size of %v", levels, size)
+	}
+
+	chain, err := src.MakeMipChain()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]envmap.Cubemap, levels)
+	for level := 0; level < levels; level++ {
+		roughness := LevelRoughness(level, levels)
+		result[level], err = PrefilterEnvironment(chain, size>>uint(level), roughness, samples)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// PrefilteredFacePath returns the path of a face of a level of the
+// prefiltered mip chain, e.g. dir/right_0.hdr.
+func PrefilteredFacePath(dir string, face, level int, extension string) string {
+	return fmt.Sprintf("%v%v_%v%v", dir, envmap.FaceNames[face], level, extension)
+}
+
+// SavePrefilteredMipChain saves all faces of all levels as individual images
+// into the directory. The file names are given by PrefilteredFacePath.
+func SavePrefilteredMipChain(levels []envmap.Cubemap, dir, extension string) error {
+	for level := range levels {
+		for f := 0; f < 6; f++ {
+			path := PrefilteredFacePath(dir, f, level, extension)
+			if err := levels[level].GetFace(f).SaveToPath(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadPrefilteredCubeMap loads the specified number of levels that have been
+// saved with SavePrefilteredMipChain and uploads them as the mip levels of a
+// cube map.
+func LoadPrefilteredCubeMap(dir, extension string, levels int) (texture.Texture, error) {
+	images := make([][]image2d.Image2D, levels)
+	for level := 0; level < levels; level++ {
+		images[level] = make([]image2d.Image2D, 6)
+		for f := 0; f < 6; f++ {
+			img, err := image2d.MakeFromPath(PrefilteredFacePath(dir, f, level, extension))
+			if err != nil {
+				return texture.Texture{}, err
+			}
+			images[level][f] = img
+		}
+	}
+	return texture.MakeCubeMapFromMipmaps(images, gl.RGB32F)
+}
+
+// MakePrefilteredCubeMap uploads the levels of MakePrefilteredMipChain as the
+// mip levels of a cube map.
+func MakePrefilteredCubeMap(levels []envmap.Cubemap) (texture.Texture, error) {
+	images := make([][]image2d.Image2D, len(levels))
+	for level := range levels {
+		images[level] = levels[level].GetFaces()
+	}
+	return texture.MakeCubeMapFromMipmaps(images, gl.RGB32F)
+}
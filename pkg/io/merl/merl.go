@@ -0,0 +1,202 @@
+// Package merl reads the measured isotropic BRDFs of the MERL BRDF database
+// by Matusik et al. "A Data-Driven Reflectance Model". The brdfs are stored as
+// tables over the half and difference angles of Rusinkiewicz' parameterization.
+package merl
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// resolution of the tables. due to reciprocity only half of the difference
+// azimuths are stored.
+const (
+	THETA_H_RES int = 90
+	THETA_D_RES int = 90
+	PHI_D_RES   int = 180
+	SAMPLES     int = THETA_H_RES * THETA_D_RES * PHI_D_RES
+)
+
+// the scale of each color channel as specified by the reference implementation
+const (
+	RED_SCALE   float64 = 1.0 / 1500.0
+	GREEN_SCALE float64 = 1.15 / 1500.0
+	BLUE_SCALE  float64 = 1.66 / 1500.0
+)
+
+// BRDF is a measured isotropic brdf. Cells that weren't measured are marked
+// with negative values.
+type BRDF struct {
+	red   []float32
+	green []float32
+	blue  []float32
+}
+
+// Load reads a brdf from a MERL .binary file.
+func Load(path string) (BRDF, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return BRDF{}, err
+	}
+	defer file.Close()
+
+	brdf, err := Read(bufio.NewReader(file))
+	if err != nil {
+		return BRDF{}, fmt.Errorf("%v: %v", path, err)
+	}
+	return brdf, nil
+}
+
+// Read reads a brdf in the MERL binary format. The data starts with the three
+// table dimensions as little endian int32 followed by the red, green and blue
+// tables as little endian float64.
+func Read(r io.Reader) (BRDF, error) {
+	var dims [3]int32
+	if err := binary.Read(r, binary.LittleEndian, &dims); err != nil {
+		return BRDF{}, err
+	}
+	if int(dims[0])*int(dims[1])*int(dims[2]) != SAMPLES {
+		return BRDF{}, fmt.Errorf("dimensions %v x %v x %v don't match the expected %v x %v x %v",
+			dims[0], dims[1], dims[2], THETA_H_RES, THETA_D_RES, PHI_D_RES)
+	}
+
+	data := make([]float64, 3*SAMPLES)
+	if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+		return BRDF{}, err
+	}
+
+	brdf := BRDF{
+		red:   scaleChannel(data[0:SAMPLES], RED_SCALE),
+		green: scaleChannel(data[SAMPLES:2*SAMPLES], GREEN_SCALE),
+		blue:  scaleChannel(data[2*SAMPLES:3*SAMPLES], BLUE_SCALE),
+	}
+	return brdf, nil
+}
+
+// Cell returns the value of the cell with the specified indices. The second
+// return value is false if the cell wasn't measured.
+func (brdf *BRDF) Cell(thetaH, thetaD, phiD int) (mgl32.Vec3, bool) {
+	idx := phiD + thetaD*PHI_D_RES + thetaH*PHI_D_RES*THETA_D_RES
+	value := mgl32.Vec3{brdf.red[idx], brdf.green[idx], brdf.blue[idx]}
+	valid := value.X() >= 0 && value.Y() >= 0 && value.Z() >= 0
+	return value, valid
+}
+
+// Lookup returns the brdf for the half angle thetaH, the difference angle
+// thetaD and the difference azimuth phiD in radians. The lookup uses the
+// nearest cell like the reference implementation.
+func (brdf *BRDF) Lookup(thetaH, thetaD, phiD float32) (mgl32.Vec3, bool) {
+	return brdf.Cell(thetaHIndex(thetaH), thetaDIndex(thetaD), phiDIndex(phiD))
+}
+
+// Evaluate returns the brdf for the light direction l and the view direction
+// v which are given in the local frame of the surface with the normal along
+// the z axis.
+func (brdf *BRDF) Evaluate(l, v mgl32.Vec3) (mgl32.Vec3, bool) {
+	if l.Z() <= 0 || v.Z() <= 0 {
+		return mgl32.Vec3{0, 0, 0}, true
+	}
+	thetaH, _, thetaD, phiD := HalfDiffCoords(l, v)
+	return brdf.Lookup(thetaH, thetaD, phiD)
+}
+
+// CellAngles returns the half angle, difference angle and difference azimuth
+// at the center of the cell with the specified indices.
+func CellAngles(thetaH, thetaD, phiD int) (float32, float32, float32) {
+	// the half angle is stored with a square root mapping to better resolve
+	// the specular peak
+	h := float32(thetaH) + 0.5
+	th := h * h / float32(THETA_H_RES) / 90 * (math.Pi / 2)
+	td := (float32(thetaD) + 0.5) / float32(THETA_D_RES) * (math.Pi / 2)
+	pd := (float32(phiD) + 0.5) / float32(PHI_D_RES) * math.Pi
+	return th, td, pd
+}
+
+// HalfDiffCoords converts the light and view directions in the local frame
+// into the half angle, half azimuth, difference angle and difference azimuth.
+func HalfDiffCoords(l, v mgl32.Vec3) (float32, float32, float32, float32) {
+	h := l.Add(v).Normalize()
+	thetaH := acos(h.Z())
+	phiH := cgm.Atan232(h.Y(), h.X())
+
+	// rotate the light direction such that the half vector is the normal
+	tmp := rotate(l, mgl32.Vec3{0, 0, 1}, -phiH)
+	diff := rotate(tmp, mgl32.Vec3{0, 1, 0}, -thetaH)
+	thetaD := acos(diff.Z())
+	phiD := cgm.Atan232(diff.Y(), diff.X())
+
+	return thetaH, phiH, thetaD, phiD
+}
+
+// StdCoords converts the half and difference angles into the light and view
+// directions in the local frame. It is the inverse of HalfDiffCoords.
+func StdCoords(thetaH, phiH, thetaD, phiD float32) (mgl32.Vec3, mgl32.Vec3) {
+	diff := mgl32.Vec3{
+		cgm.Sin32(thetaD) * cgm.Cos32(phiD),
+		cgm.Sin32(thetaD) * cgm.Sin32(phiD),
+		cgm.Cos32(thetaD),
+	}
+	h := mgl32.Vec3{
+		cgm.Sin32(thetaH) * cgm.Cos32(phiH),
+		cgm.Sin32(thetaH) * cgm.Sin32(phiH),
+		cgm.Cos32(thetaH),
+	}
+
+	tmp := rotate(diff, mgl32.Vec3{0, 1, 0}, thetaH)
+	l := rotate(tmp, mgl32.Vec3{0, 0, 1}, phiH)
+	v := h.Mul(2 * l.Dot(h)).Sub(l)
+	return l, v
+}
+
+// thetaHIndex maps the half angle onto its table index using the square root
+// mapping of the reference implementation.
+func thetaHIndex(thetaH float32) int {
+	if thetaH <= 0 {
+		return 0
+	}
+	deg := thetaH / (math.Pi / 2) * 90
+	idx := int(cgm.Sqrt32(deg * float32(THETA_H_RES)))
+	return cgm.Maxi(0, cgm.Mini(idx, THETA_H_RES-1))
+}
+
+// thetaDIndex maps the difference angle onto its table index.
+func thetaDIndex(thetaD float32) int {
+	idx := int(thetaD / (math.Pi / 2) * float32(THETA_D_RES))
+	return cgm.Maxi(0, cgm.Mini(idx, THETA_D_RES-1))
+}
+
+// phiDIndex maps the difference azimuth onto its table index. due to
+// reciprocity phiD and phiD + pi are the same.
+func phiDIndex(phiD float32) int {
+	if phiD < 0 {
+		phiD += math.Pi
+	}
+	idx := int(phiD / math.Pi * float32(PHI_D_RES))
+	return cgm.Maxi(0, cgm.Mini(idx, PHI_D_RES-1))
+}
+
+// rotate rotates the vector v around the axis by the angle in radians.
+func rotate(v, axis mgl32.Vec3, angle float32) mgl32.Vec3 {
+	c := cgm.Cos32(angle)
+	s := cgm.Sin32(angle)
+	return v.Mul(c).Add(axis.Cross(v).Mul(s)).Add(axis.Mul(axis.Dot(v) * (1 - c)))
+}
+
+func acos(x float32) float32 {
+	return float32(math.Acos(float64(cgm.Clamp(x, -1, 1))))
+}
+
+func scaleChannel(data []float64, scale float64) []float32 {
+	channel := make([]float32, len(data))
+	for i, d := range data {
+		channel[i] = float32(d * scale)
+	}
+	return channel
+}
@@ -0,0 +1,128 @@
+package merl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+)
+
+const (
+	ANGLE_TOLERANCE float32 = 1e-3
+	VALUE_TOLERANCE float32 = 1e-6
+)
+
+// the center of every cell maps back onto the indices of the cell
+func TestIndexRoundTrip(t *testing.T) {
+	for th := 0; th < THETA_H_RES; th++ {
+		for td := 0; td < THETA_D_RES; td++ {
+			for pd := 0; pd < PHI_D_RES; pd++ {
+				thetaH, thetaD, phiD := CellAngles(th, td, pd)
+				if i, j, k := thetaHIndex(thetaH), thetaDIndex(thetaD), phiDIndex(phiD); i != th || j != td || k != pd {
+					t.Fatalf("cell (%v,%v,%v) maps back onto (%v,%v,%v)", th, td, pd, i, j, k)
+				}
+			}
+		}
+	}
+
+	// the difference azimuths phiD and phiD - pi share a cell due to
+	// reciprocity
+	for pd := 0; pd < PHI_D_RES; pd++ {
+		_, _, phiD := CellAngles(0, 0, pd)
+		if k := phiDIndex(phiD - math.Pi); k != pd {
+			t.Errorf("azimuth %v - pi maps onto cell %v instead of %v", phiD, k, pd)
+		}
+	}
+}
+
+// HalfDiffCoords is the inverse of StdCoords
+func TestHalfDiffCoordsRoundTrip(t *testing.T) {
+	for _, thetaH := range []float32{0.05, 0.3, 0.7, 1.2} {
+		for _, phiH := range []float32{-2.5, -0.4, 0, 1, 3} {
+			for _, thetaD := range []float32{0.05, 0.4, 0.9, 1.5} {
+				for _, phiD := range []float32{-3, -1.2, 0.2, 1.6, 2.9} {
+					l, v := StdCoords(thetaH, phiH, thetaD, phiD)
+					if cgm.Abs32(l.Len()-1) > ANGLE_TOLERANCE || cgm.Abs32(v.Len()-1) > ANGLE_TOLERANCE {
+						t.Fatalf("expected unit directions, got %v and %v", l, v)
+					}
+					th, ph, td, pd := HalfDiffCoords(l, v)
+					if cgm.Abs32(th-thetaH) > ANGLE_TOLERANCE || cgm.Abs32(ph-phiH) > ANGLE_TOLERANCE ||
+						cgm.Abs32(td-thetaD) > ANGLE_TOLERANCE || cgm.Abs32(pd-phiD) > ANGLE_TOLERANCE {
+						t.Errorf("(%v,%v,%v,%v) maps back onto (%v,%v,%v,%v)",
+							thetaH, phiH, thetaD, phiD, th, ph, td, pd)
+					}
+				}
+			}
+		}
+	}
+}
+
+// a table that stores the index of each cell is read with the scales of the
+// reference implementation and evaluating the directions of a cell returns
+// the value of the cell
+func TestRead(t *testing.T) {
+	data := makeTable(func(idx int) float64 { return float64(idx) })
+	// the first cell wasn't measured
+	data[0] = -1
+	measured, err := Read(bytes.NewReader(data.encode([3]int32{int32(THETA_H_RES), int32(THETA_D_RES), int32(PHI_D_RES)})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, valid := measured.Cell(0, 0, 0); valid {
+		t.Error("expected the first cell to be invalid")
+	}
+	// the first half angles are too small to be recovered from the
+	// directions in single precision
+	for th := 4; th < THETA_H_RES; th += 7 {
+		for td := 0; td < THETA_D_RES; td += 11 {
+			for pd := 0; pd < PHI_D_RES; pd += 13 {
+				idx := pd + td*PHI_D_RES + th*PHI_D_RES*THETA_D_RES
+				thetaH, thetaD, phiD := CellAngles(th, td, pd)
+				l, v := StdCoords(thetaH, 0.7, thetaD, phiD)
+				if l.Z() <= 0 || v.Z() <= 0 {
+					continue
+				}
+				value, valid := measured.Evaluate(l, v)
+				if !valid {
+					t.Fatalf("cell (%v,%v,%v) is invalid", th, td, pd)
+				}
+				expected := [3]float64{float64(idx) * RED_SCALE, float64(idx) * GREEN_SCALE, float64(idx) * BLUE_SCALE}
+				for c := 0; c < 3; c++ {
+					if cgm.Abs32(value[c]-float32(expected[c])) > VALUE_TOLERANCE*float32(expected[c]) {
+						t.Fatalf("cell (%v,%v,%v) channel %v: expected %v, got %v", th, td, pd, c, expected[c], value[c])
+					}
+				}
+			}
+		}
+	}
+
+	// tables of other sizes are rejected
+	if _, err := Read(bytes.NewReader(data.encode([3]int32{90, 90, 360}))); err == nil {
+		t.Error("expected an error for a table of the wrong size")
+	}
+}
+
+// table holds the three color channels of a brdf in the binary format.
+type table []float64
+
+// makeTable creates the channels with the value f(idx) for every cell.
+func makeTable(f func(idx int) float64) table {
+	data := make(table, 3*SAMPLES)
+	for c := 0; c < 3; c++ {
+		for idx := 0; idx < SAMPLES; idx++ {
+			data[c*SAMPLES+idx] = f(idx)
+		}
+	}
+	return data
+}
+
+// encode writes the dimensions and the channels in the MERL binary format.
+func (data table) encode(dims [3]int32) []byte {
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, dims)
+	binary.Write(&buffer, binary.LittleEndian, []float64(data))
+	return buffer.Bytes()
+}
@@ -23,6 +23,30 @@ type Face struct {
 
 // Load a mesh from an .obj file.
 func Load(filepath string, invert, smooth bool) (mesh.Mesh, error) {
+	geometry, err := LoadGeometry(filepath, invert, smooth)
+	if err != nil {
+		return mesh.Mesh{}, err
+	}
+
+	return mesh.Make(geometry, nil, gl.TRIANGLES), nil
+}
+
+// LoadGeometry loads the geometry of an .obj file without creating any
+// buffers on the GPU. The geometry is a triangle soup with the vertex
+// attributes pos, uv and normal.
+func LoadGeometry(filepath string, invert, smooth bool) (mesh.Geometry, error) {
+	return loadGeometry(filepath, invert, smooth, true)
+}
+
+// LoadRawGeometry loads the geometry like LoadGeometry but keeps the original
+// positions instead of centering and scaling them. Meshes that have to stay
+// aligned to each other, like a high and a low poly version of a model, have
+// to be loaded with it.
+func LoadRawGeometry(filepath string, invert, smooth bool) (mesh.Geometry, error) {
+	return loadGeometry(filepath, invert, smooth, false)
+}
+
+func loadGeometry(filepath string, invert, smooth, centered bool) (mesh.Geometry, error) {
 	// setup temp variables
 	faces := []Face{}
 	tpositions := []float32{}
@@ -32,7 +56,7 @@ func Load(filepath string, invert, smooth bool) (mesh.Mesh, error) {
 	// extract all vertex attributes and faces from the file
 	err := extract(filepath, &faces, &tpositions, &tnormals, &tuvs)
 	if err != nil {
-		return mesh.Mesh{}, err
+		return mesh.Geometry{}, err
 	}
 
 	fmt.Println("#Faces     " + fmt.Sprint(len(faces)))
@@ -49,7 +73,9 @@ func Load(filepath string, invert, smooth bool) (mesh.Mesh, error) {
 	positions, uvs, normals := generateObject(faces, tpositions, tnormals, tuvs, smooth)
 
 	// calc center of gravity
-	positions = center(positions)
+	if centered {
+		positions = center(positions)
+	}
 
 	// invert normals if requested
 	if invert {
@@ -57,8 +83,8 @@ func Load(filepath string, invert, smooth bool) (mesh.Mesh, error) {
 	}
 
 	// setup data
-	mesh := createMesh(positions, uvs, normals)
-	return mesh, nil
+	geometry := createGeometry(positions, uvs, normals)
+	return geometry, nil
 }
 
 func extract(filepath string, faces *[]Face, positions, normals, uvs *[]float32) error {
@@ -367,7 +393,7 @@ func flipNormals(normals *[]float32) {
 	}
 }
 
-func createMesh(positions, uvs, normals []float32) mesh.Mesh {
+func createGeometry(positions, uvs, normals []float32) mesh.Geometry {
 	data := [][]float32{
 		positions,
 		uvs,
@@ -381,9 +407,7 @@ func createMesh(positions, uvs, normals []float32) mesh.Mesh {
 		mesh.MakeVertexAttribute("normal", gl.FLOAT, 3, gl.STATIC_DRAW),
 	}
 
-	// create the mesh
-	geometry := mesh.MakeGeometry(layout, data)
-	return mesh.Make(geometry, nil, gl.TRIANGLES)
+	return mesh.MakeGeometry(layout, data)
 }
 
 func filter(ss []string, test func(string) bool) (ret []string) {
@@ -0,0 +1,157 @@
+// Package ior provides the indices of refraction of common conductors and
+// dielectrics along with functions to derive the base reflectivity F0 used by
+// the fresnel term. The complex indices of refraction of the conductors are
+// sampled at the wavelengths 650nm, 510nm and 440nm for the red, green and
+// blue channel from the measurements collected at refractiveindex.info.
+package ior
+
+import (
+	"fmt"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Conductor has a complex index of refraction N + iK per color channel.
+type Conductor struct {
+	Name string
+	N    mgl32.Vec3
+	K    mgl32.Vec3
+}
+
+// Dielectric has a real index of refraction that is assumed to be constant
+// over the visible spectrum.
+type Dielectric struct {
+	Name string
+	IOR  float32
+}
+
+// CONDUCTORS contains the complex indices of refraction of common metals.
+var CONDUCTORS = []Conductor{
+	{"gold", mgl32.Vec3{0.18299, 0.42108, 1.37340}, mgl32.Vec3{3.42420, 2.34590, 1.77040}},
+	{"silver", mgl32.Vec3{0.15943, 0.14512, 0.13547}, mgl32.Vec3{3.92910, 3.19000, 2.38080}},
+	{"copper", mgl32.Vec3{0.27105, 0.67693, 1.31640}, mgl32.Vec3{3.60920, 2.62480, 2.29210}},
+	{"aluminium", mgl32.Vec3{1.34560, 0.96521, 0.61722}, mgl32.Vec3{7.47460, 6.39950, 5.30310}},
+	{"iron", mgl32.Vec3{2.91140, 2.94970, 2.58450}, mgl32.Vec3{3.08930, 2.93180, 2.76700}},
+	{"chromium", mgl32.Vec3{3.10710, 3.18120, 2.32300}, mgl32.Vec3{3.33140, 3.32910, 3.13500}},
+	{"titanium", mgl32.Vec3{2.74070, 2.54180, 2.26700}, mgl32.Vec3{3.81430, 3.43450, 3.03850}},
+}
+
+// DIELECTRICS contains the indices of refraction of common non-metals.
+var DIELECTRICS = []Dielectric{
+	{"ice", 1.31},
+	{"water", 1.333},
+	{"skin", 1.4},
+	{"acrylic", 1.49},
+	{"glass", 1.5},
+	{"quartz", 1.544},
+	{"plastic", 1.57},
+	{"sapphire", 1.77},
+	{"diamond", 2.418},
+}
+
+// GetConductor returns the conductor with the specified name.
+func GetConductor(name string) (Conductor, error) {
+	for _, c := range CONDUCTORS {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return Conductor{}, fmt.Errorf("unknown conductor %v", name)
+}
+
+// GetDielectric returns the dielectric with the specified name.
+func GetDielectric(name string) (Dielectric, error) {
+	for _, d := range DIELECTRICS {
+		if d.Name == name {
+			return d, nil
+		}
+	}
+	return Dielectric{}, fmt.Errorf("unknown dielectric %v", name)
+}
+
+// ConductorNames returns the names of all conductors.
+func ConductorNames() []string {
+	names := []string{}
+	for _, c := range CONDUCTORS {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// DielectricNames returns the names of all dielectrics.
+func DielectricNames() []string {
+	names := []string{}
+	for _, d := range DIELECTRICS {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// F0 returns the reflectivity of the conductor at normal incidence.
+func (c *Conductor) F0() mgl32.Vec3 {
+	return mgl32.Vec3{
+		conductorF0(c.N.X(), c.K.X()),
+		conductorF0(c.N.Y(), c.K.Y()),
+		conductorF0(c.N.Z(), c.K.Z()),
+	}
+}
+
+// EdgeTint returns the edge tint of the artist friendly metallic fresnel of
+// Gulbrandsen "Artist Friendly Metallic Fresnel". Together with F0 it
+// describes the color of the conductor towards grazing angles.
+func (c *Conductor) EdgeTint() mgl32.Vec3 {
+	f0 := c.F0()
+	return mgl32.Vec3{
+		edgeTint(c.N.X(), f0.X()),
+		edgeTint(c.N.Y(), f0.Y()),
+		edgeTint(c.N.Z(), f0.Z()),
+	}
+}
+
+// F0 returns the reflectivity of the dielectric at normal incidence when
+// surrounded by air.
+func (d *Dielectric) F0() float32 {
+	r := (d.IOR - 1) / (d.IOR + 1)
+	return r * r
+}
+
+// FromReflectivity returns the complex index of refraction for the
+// reflectivity r and the edge tint g. It is the inverse of F0 and EdgeTint.
+func FromReflectivity(r, g mgl32.Vec3) (mgl32.Vec3, mgl32.Vec3) {
+	n := mgl32.Vec3{}
+	k := mgl32.Vec3{}
+	for i := 0; i < 3; i++ {
+		ri := cgm.Clamp(r[i], 0, 0.99)
+		n[i] = g[i]*nMin(ri) + (1-g[i])*nMax(ri)
+
+		num := ri*(n[i]+1)*(n[i]+1) - (n[i]-1)*(n[i]-1)
+		k[i] = cgm.Sqrt32(cgm.Max32(num/(1-ri), 0))
+	}
+	return n, k
+}
+
+func conductorF0(n, k float32) float32 {
+	return ((n-1)*(n-1) + k*k) / ((n+1)*(n+1) + k*k)
+}
+
+// edgeTint inverts the interpolation of the index of refraction between the
+// minimal and maximal index that yield the reflectivity r.
+func edgeTint(n, r float32) float32 {
+	r = cgm.Clamp(r, 0, 0.99)
+	lo, hi := nMin(r), nMax(r)
+	return cgm.Clamp((hi-n)/(hi-lo), 0, 1)
+}
+
+// nMin is the index of refraction with k = 0 that has the reflectivity r and
+// is smaller than 1.
+func nMin(r float32) float32 {
+	return (1 - r) / (1 + r)
+}
+
+// nMax is the index of refraction with k = 0 that has the reflectivity r and
+// is bigger than 1.
+func nMax(r float32) float32 {
+	s := cgm.Sqrt32(r)
+	return (1 + s) / (1 - s)
+}
@@ -0,0 +1,62 @@
+package ior
+
+import (
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const TOLERANCE float32 = 1e-3
+
+// TestFromReflectivity checks that the index of refraction derived from the
+// reflectivity and edge tint of each conductor has the same reflectivity and
+// edge tint.
+func TestFromReflectivity(t *testing.T) {
+	for _, c := range CONDUCTORS {
+		f0, tint := c.F0(), c.EdgeTint()
+		n, k := FromReflectivity(f0, tint)
+		derived := Conductor{Name: c.Name, N: n, K: k}
+		if !approxEqual(derived.F0(), f0) {
+			t.Errorf("%v: F0 is %v instead of %v", c.Name, derived.F0(), f0)
+		}
+		if !approxEqual(derived.EdgeTint(), tint) {
+			t.Errorf("%v: edge tint is %v instead of %v", c.Name, derived.EdgeTint(), tint)
+		}
+	}
+}
+
+// TestFromReflectivityGrid checks the round trip for reflectivities and edge
+// tints covering the whole range.
+func TestFromReflectivityGrid(t *testing.T) {
+	for _, r := range []float32{0.02, 0.2, 0.5, 0.9} {
+		for _, g := range []float32{0, 0.25, 0.5, 1} {
+			f0, tint := mgl32.Vec3{r, r, r}, mgl32.Vec3{g, g, g}
+			n, k := FromReflectivity(f0, tint)
+			c := Conductor{N: n, K: k}
+			if !approxEqual(c.F0(), f0) || !approxEqual(c.EdgeTint(), tint) {
+				t.Errorf("r=%v g=%v: round trip gives F0 %v and edge tint %v", r, g, c.F0(), c.EdgeTint())
+			}
+		}
+	}
+}
+
+// TestDielectricF0 checks the reflectivity of glass.
+func TestDielectricF0(t *testing.T) {
+	glass, err := GetDielectric("glass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f0 := glass.F0(); cgm.Abs32(f0-0.04) > 1e-6 {
+		t.Errorf("F0 of glass is %v", f0)
+	}
+}
+
+func approxEqual(a, b mgl32.Vec3) bool {
+	for i := 0; i < 3; i++ {
+		if cgm.Abs32(a[i]-b[i]) > TOLERANCE {
+			return false
+		}
+	}
+	return true
+}
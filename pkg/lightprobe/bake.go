@@ -0,0 +1,112 @@
+package lightprobe
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+
+	"github.com/adrianderstroff/pbr/pkg/envmap"
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/adrianderstroff/pbr/pkg/pathtracer"
+	"github.com/adrianderstroff/pbr/pkg/sampling"
+	"github.com/adrianderstroff/pbr/pkg/sh"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// BACKFACE_FRACTION is the fraction of rays of a probe hitting back faces
+// above which the probe is considered to be inside of the geometry. Such
+// probes are black and are excluded by the visibility test.
+const BACKFACE_FRACTION = 0.25
+
+// Bake traces samples rays from each probe of the grid into the scene. The
+// radiance along each ray is estimated with the path tracer and projected onto
+// spherical harmonics. The distances to the closest surfaces are limited to
+// the diagonal of a grid cell, since only the visibility between neighboring
+// probes matters. The probes are distributed among all available CPUs and the
+// directions are scrambled sobol points seeded by the probe index, which makes
+// the result independent of the scheduling.
+func Bake(grid *Grid, scene *pathtracer.Scene, options pathtracer.Options, samples int) {
+	// the path tracer is only used for the radiance along single rays
+	options.Width, options.Height = 0, 0
+	pt := pathtracer.Make(scene, pathtracer.Camera{}, options)
+	maxDistance := 1.5 * grid.Spacing().Len()
+
+	probes := make(chan int, grid.Count())
+	for i := 0; i < grid.Count(); i++ {
+		probes <- i
+	}
+	close(probes)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range probes {
+				bakeProbe(grid, index, scene, &pt, samples, maxDistance, options.Seed)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// bakeProbe integrates the radiance and the distance moments around the probe
+// with the specified index.
+func bakeProbe(grid *Grid, index int, scene *pathtracer.Scene, pt *pathtracer.PathTracer,
+	samples int, maxDistance float32, seed int64) {
+
+	radiance, _ := sh.Make(sh.ORDER_3)
+	distance, _ := sh.Make(sh.ORDER_2)
+	rng := rand.New(rand.NewSource(seed + int64(index)))
+	dw := float32(4*math.Pi) / float32(samples)
+
+	origin := grid.Position(grid.Coordinates(index))
+	backfaces := 0
+	for s := 0; s < samples; s++ {
+		xi := sampling.OwenScrambledSobol2D(uint32(s), uint32(seed)+uint32(index))
+		dir := sampling.UniformSphere(xi)
+		ray := geom.Ray{Origin: origin, Direction: dir}
+
+		d := maxDistance
+		if hit, ok := scene.Intersect(&ray, 0, maxDistance); ok {
+			d = hit.T
+			if !hit.FrontFace {
+				backfaces++
+			}
+		}
+
+		radiance.AddSample(dir, pt.Radiance(&ray, rng), dw)
+		distance.AddSample(dir, mgl32.Vec3{d, d * d, 0}, dw)
+	}
+
+	// probes inside of the geometry are black and occlude everything
+	if float32(backfaces) > BACKFACE_FRACTION*float32(samples) {
+		radiance, _ = sh.Make(sh.ORDER_3)
+		distance = makeVisibility(0)
+	}
+	grid.SetProbe(index, &radiance, &distance)
+}
+
+// SetProbeFromCubemaps stores the probe with the specified index from cube
+// maps captured at its position, e.g. rendered with the realtime renderer.
+// The distance cube map holds the distance to the closest surface in the red
+// and the squared distance in the green channel. If it is nil the probe
+// doesn't occlude anything.
+func (grid *Grid) SetProbeFromCubemaps(index int, radiance, distance *envmap.Cubemap) error {
+	r, err := sh.ProjectCubemap(radiance, sh.ORDER_3)
+	if err != nil {
+		return err
+	}
+
+	d := makeVisibility(unoccluded)
+	if distance != nil {
+		d, err = sh.ProjectCubemap(distance, sh.ORDER_2)
+		if err != nil {
+			return err
+		}
+	}
+
+	grid.SetProbe(index, &r, &d)
+	return nil
+}
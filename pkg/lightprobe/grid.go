@@ -0,0 +1,318 @@
+// Package lightprobe provides a volume of irradiance probes that are placed on
+// a regular 3D grid over the bounds of a scene. Each probe stores the
+// irradiance as spherical harmonics of order 3 together with the first two
+// moments of the distance to the surrounding surfaces. The distances are used
+// for visibility aware interpolation between the probes, which prevents light
+// from leaking through walls. The grid is uploaded as a 3D texture that is
+// read by assets/shaders/pbr/shared/probegrid.glsl.
+package lightprobe
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/core/gl"
+	"github.com/adrianderstroff/pbr/pkg/core/shader"
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/adrianderstroff/pbr/pkg/sh"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image3d"
+	"github.com/adrianderstroff/pbr/pkg/view/texture"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Layout of a probe in the 3D texture. Each probe occupies GRID_TEXELS
+// consecutive texels along x, the first IRRADIANCE_TEXELS hold the irradiance
+// coefficients and the remaining VISIBILITY_TEXELS hold the distance moments
+// in the red and green channel. The values match probegrid.glsl.
+const (
+	IRRADIANCE_TEXELS = 9
+	VISIBILITY_TEXELS = 4
+	GRID_TEXELS       = IRRADIANCE_TEXELS + VISIBILITY_TEXELS
+)
+
+// GRID_BINDING is the texture unit of the 3D texture in probegrid.glsl.
+const GRID_BINDING = 12
+
+// VISIBILITY_BIAS is the fraction of the smallest probe spacing that the
+// shading point is moved along the normal before testing the visibility of a
+// probe, which avoids self shadowing.
+const VISIBILITY_BIAS = 0.1
+
+// lower bound of the weight of a probe, such that the weights never sum up
+// to zero
+const minWeight = 1e-6
+
+// distance of probes that don't see any surface. it is finite, such that the
+// moments can be stored as json and squared without overflowing.
+const unoccluded = 1e15
+
+// Grid is a regular grid of probes spanning the bounds. The probes lie on the
+// corners of the bounds and are indexed in x-major order. Irradiance holds
+// the coefficients already convolved with the cosine lobe. Visibility holds
+// the mean distance in x and the mean squared distance in y projected onto
+// spherical harmonics of order 2.
+type Grid struct {
+	Bounds     geom.AABB `json:"bounds"`
+	Resolution [3]int    `json:"resolution"`
+	Irradiance []sh.SH   `json:"irradiance"`
+	Visibility []sh.SH   `json:"visibility"`
+}
+
+// MakeGrid creates a grid with the specified number of probes along each
+// axis. All probes are black and don't occlude anything.
+func MakeGrid(bounds geom.AABB, resolution [3]int) (Grid, error) {
+	if resolution[0] < 1 || resolution[1] < 1 || resolution[2] < 1 {
+		return Grid{}, errors.New("the grid needs at least one probe along each axis")
+	}
+	if bounds.IsEmpty() {
+		return Grid{}, errors.New("the bounds of the grid are empty")
+	}
+
+	count := resolution[0] * resolution[1] * resolution[2]
+	grid := Grid{
+		Bounds:     bounds,
+		Resolution: resolution,
+		Irradiance: make([]sh.SH, count),
+		Visibility: make([]sh.SH, count),
+	}
+	for i := 0; i < count; i++ {
+		grid.Irradiance[i], _ = sh.Make(sh.ORDER_3)
+		grid.Visibility[i] = makeVisibility(unoccluded)
+	}
+	return grid, nil
+}
+
+// Count returns the number of probes.
+func (grid *Grid) Count() int {
+	return grid.Resolution[0] * grid.Resolution[1] * grid.Resolution[2]
+}
+
+// Index returns the index of the probe (x,y,z).
+func (grid *Grid) Index(x, y, z int) int {
+	return (z*grid.Resolution[1]+y)*grid.Resolution[0] + x
+}
+
+// Coordinates returns the grid coordinates (x,y,z) of the probe with the
+// specified index.
+func (grid *Grid) Coordinates(index int) (int, int, int) {
+	x := index % grid.Resolution[0]
+	y := (index / grid.Resolution[0]) % grid.Resolution[1]
+	z := index / (grid.Resolution[0] * grid.Resolution[1])
+	return x, y, z
+}
+
+// Position returns the world space position of the probe (x,y,z). Along axes
+// with a single probe it is centered.
+func (grid *Grid) Position(x, y, z int) mgl32.Vec3 {
+	coords := [3]int{x, y, z}
+	var p mgl32.Vec3
+	for i := 0; i < 3; i++ {
+		t := float32(0.5)
+		if grid.Resolution[i] > 1 {
+			t = float32(coords[i]) / float32(grid.Resolution[i]-1)
+		}
+		p[i] = cgm.Lerp(grid.Bounds.Min[i], grid.Bounds.Max[i], t)
+	}
+	return p
+}
+
+// Spacing returns the distance between neighboring probes along each axis.
+// Axes with a single probe use the size of the bounds.
+func (grid *Grid) Spacing() mgl32.Vec3 {
+	size := grid.Bounds.Size()
+	for i := 0; i < 3; i++ {
+		if grid.Resolution[i] > 1 {
+			size[i] /= float32(grid.Resolution[i] - 1)
+		}
+	}
+	return size
+}
+
+// SetProbe stores the radiance and the distances around the probe with the
+// specified index. The radiance is convolved with the cosine lobe. distance
+// holds the mean distance in x and the mean squared distance in y and is
+// reduced to order 2.
+func (grid *Grid) SetProbe(index int, radiance, distance *sh.SH) {
+	grid.Irradiance[index] = radiance.Convolve()
+
+	visibility, _ := sh.Make(sh.ORDER_2)
+	copy(visibility.Coeffs, distance.Coeffs)
+	grid.Visibility[index] = visibility
+}
+
+// IrradianceAt returns the irradiance at the point p for the normal n by
+// interpolating the 8 surrounding probes. Besides the trilinear weights each
+// probe is weighted by how much it lies in front of the surface and by the
+// chebyshev bound of its distance moments, which is close to 0 if the point
+// is occluded from the probe. It mirrors ProbeGridIrradiance of
+// probegrid.glsl.
+func (grid *Grid) IrradianceAt(p, n mgl32.Vec3) mgl32.Vec3 {
+	spacing := grid.Spacing()
+	bias := VISIBILITY_BIAS * cgm.Min32(spacing.X(), cgm.Min32(spacing.Y(), spacing.Z()))
+	biased := p.Add(n.Mul(bias))
+
+	// find the cell of the grid and the position within the cell
+	var base [3]int
+	var t mgl32.Vec3
+	size := grid.Bounds.Size()
+	for i := 0; i < 3; i++ {
+		if grid.Resolution[i] == 1 {
+			continue
+		}
+		last := float32(grid.Resolution[i] - 1)
+		g := cgm.Clamp((p[i]-grid.Bounds.Min[i])/size[i]*last, 0, last)
+		base[i] = cgm.Maxi(cgm.Mini(int(cgm.Floor32(g)), grid.Resolution[i]-2), 0)
+		t[i] = cgm.Clamp(g-float32(base[i]), 0, 1)
+	}
+
+	var sum mgl32.Vec3
+	var weights float32
+	for corner := 0; corner < 8; corner++ {
+		offset := [3]int{corner & 1, (corner >> 1) & 1, (corner >> 2) & 1}
+		var probe [3]int
+		trilinear := float32(1)
+		for i := 0; i < 3; i++ {
+			probe[i] = cgm.Mini(base[i]+offset[i], grid.Resolution[i]-1)
+			if offset[i] == 1 {
+				trilinear *= t[i]
+			} else {
+				trilinear *= 1 - t[i]
+			}
+		}
+
+		index := grid.Index(probe[0], probe[1], probe[2])
+		position := grid.Position(probe[0], probe[1], probe[2])
+		weight := grid.visibilityWeight(index, position, p, biased, n) * trilinear
+
+		sum = sum.Add(grid.Irradiance[index].Evaluate(n).Mul(weight))
+		weights += weight
+	}
+
+	if weights <= 0 {
+		return mgl32.Vec3{0, 0, 0}
+	}
+	irradiance := sum.Mul(1 / weights)
+	return mgl32.Vec3{
+		cgm.Max32(irradiance.X(), 0),
+		cgm.Max32(irradiance.Y(), 0),
+		cgm.Max32(irradiance.Z(), 0),
+	}
+}
+
+// visibilityWeight returns the weight of the probe at position for the point
+// p with the normal n and the point moved along the normal.
+func (grid *Grid) visibilityWeight(index int, position, p, biased, n mgl32.Vec3) float32 {
+	// smooth backface test
+	toProbe := position.Sub(p)
+	weight := float32(1)
+	if toProbe.Len() > 0 {
+		wrap := (toProbe.Normalize().Dot(n) + 1) / 2
+		weight = wrap*wrap + 0.2
+	}
+
+	// chebyshev test of the distance moments
+	toPoint := biased.Sub(position)
+	distance := toPoint.Len()
+	if distance > 0 {
+		moments := grid.Visibility[index].Evaluate(toPoint.Mul(1 / distance))
+		weight *= chebyshev(moments.X(), moments.Y(), distance)
+	}
+
+	return cgm.Max32(weight, minWeight)
+}
+
+// chebyshev returns the upper bound of the probability that a surface at the
+// specified distance is visible given the mean and mean squared distance.
+func chebyshev(mean, mean2, distance float32) float32 {
+	if distance <= mean {
+		return 1
+	}
+	variance := cgm.Abs32(mean2 - mean*mean)
+	d := distance - mean
+	p := variance / (variance + d*d)
+	return cgm.Max32(p*p*p, 0)
+}
+
+// Image returns the probes as float image with three channels. Each probe
+// occupies GRID_TEXELS texels along x starting at x*GRID_TEXELS of the row y
+// in slice z.
+func (grid *Grid) Image() (image3d.Image3D, error) {
+	img, err := image3d.MakeFloat32(grid.Resolution[0]*GRID_TEXELS, grid.Resolution[1],
+		grid.Resolution[2], 3)
+	if err != nil {
+		return image3d.Image3D{}, err
+	}
+
+	for index := 0; index < grid.Count(); index++ {
+		x, y, z := grid.Coordinates(index)
+		for k, c := range grid.Irradiance[index].Coeffs {
+			setTexel(&img, x*GRID_TEXELS+k, y, z, c)
+		}
+		for k, c := range grid.Visibility[index].Coeffs {
+			setTexel(&img, x*GRID_TEXELS+IRRADIANCE_TEXELS+k, y, z, c)
+		}
+	}
+	return img, nil
+}
+
+// Texture uploads the probes into a 3D texture with the layout of Image. The
+// texels are fetched individually, thus no filtering is applied.
+func (grid *Grid) Texture() (texture.Texture, error) {
+	img, err := grid.Image()
+	if err != nil {
+		return texture.Texture{}, err
+	}
+	return texture.Make3DFromImage(&img, gl.RGB32F, gl.RGB)
+}
+
+// Upload sets the bounds of the grid in the shader, which has to be in use.
+// The resolution is derived from the size of the texture.
+func (grid *Grid) Upload(s *shader.Shader) {
+	s.UpdateVec3("uProbeGridMin", grid.Bounds.Min)
+	s.UpdateVec3("uProbeGridMax", grid.Bounds.Max)
+}
+
+// SaveToPath writes the grid as json to the specified path.
+func (grid *Grid) SaveToPath(path string) error {
+	data, err := json.Marshal(grid)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// LoadFromPath reads a grid that has been written with SaveToPath.
+func LoadFromPath(path string) (Grid, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Grid{}, err
+	}
+
+	var grid Grid
+	if err := json.Unmarshal(data, &grid); err != nil {
+		return Grid{}, err
+	}
+	if len(grid.Irradiance) != grid.Count() || len(grid.Visibility) != grid.Count() {
+		return Grid{}, errors.New("number of probes doesn't match the resolution")
+	}
+	return grid, nil
+}
+
+// makeVisibility returns the distance moments of a probe that sees a surface
+// at the same distance in all directions. Only the constant band is non-zero.
+func makeVisibility(distance float32) sh.SH {
+	visibility, _ := sh.Make(sh.ORDER_2)
+	c0 := sh.Basis(sh.ORDER_2, mgl32.Vec3{0, 0, 1})[0]
+	visibility.Coeffs[0] = mgl32.Vec3{distance, distance * distance, 0}.Mul(4 * math.Pi * c0)
+	return visibility
+}
+
+// setTexel sets the rgb color of the texel (x,y,z).
+func setTexel(img *image3d.Image3D, x, y, z int, c mgl32.Vec3) {
+	for i := 0; i < 3; i++ {
+		img.SetFloat32(x, y, z, i, c[i])
+	}
+}
@@ -0,0 +1,149 @@
+package lightprobe
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/adrianderstroff/pbr/pkg/sh"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	SHADER_PATH = "../../assets/shaders/pbr/shared/probegrid.glsl"
+	TOLERANCE   = 1e-4
+)
+
+// the chebyshev bound is 1 in front of the mean distance and falls off with
+// the cube of the one-tailed bound behind it
+func TestChebyshev(t *testing.T) {
+	cases := []struct {
+		mean, mean2, distance float32
+		p                     float32
+	}{
+		{2, 5, 1, 1},
+		{2, 5, 2, 1},
+		{2, 5, 3, 0.125},
+		{2, 5, 4, 0.008},
+		// without variance everything behind the mean is occluded
+		{2, 4, 2.5, 0},
+	}
+	for _, c := range cases {
+		if p := chebyshev(c.mean, c.mean2, c.distance); cgm.Abs32(p-c.p) > TOLERANCE {
+			t.Errorf("mean %v mean2 %v distance %v: expected %v, got %v", c.mean, c.mean2, c.distance, c.p, p)
+		}
+	}
+}
+
+// all probes of a flat grid lie in the plane z = 0.5. a point in that plane
+// with the normal z is lateral to all probes, thus the backface test weights
+// them equally and the irradiance is interpolated bilinearly. a field that is
+// linear in x and y is reproduced exactly.
+func TestInterpolation(t *testing.T) {
+	bounds := geom.AABB{Min: mgl32.Vec3{0, 0, 0}, Max: mgl32.Vec3{2, 2, 1}}
+	grid, err := MakeGrid(bounds, [3]int{3, 3, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	field := func(p mgl32.Vec3) float32 { return 1 + p.X() + 2*p.Y() }
+	for index := 0; index < grid.Count(); index++ {
+		x, y, z := grid.Coordinates(index)
+		grid.Irradiance[index] = makeConstant(field(grid.Position(x, y, z)))
+	}
+
+	n := mgl32.Vec3{0, 0, 1}
+	points := []mgl32.Vec3{
+		{0, 0, 0.5}, {1, 1, 0.5}, {2, 2, 0.5},
+		{0.25, 0.5, 0.5}, {1.5, 0.75, 0.5}, {0.9, 1.8, 0.5},
+	}
+	for _, p := range points {
+		expected := field(p)
+		if e := grid.IrradianceAt(p, n); cgm.Abs32(e.X()-expected) > TOLERANCE*expected {
+			t.Errorf("point %v: expected %v, got %v", p, expected, e.X())
+		}
+	}
+
+	// points outside of the bounds are clamped to the closest cell
+	p := mgl32.Vec3{-1, 3, 0.5}
+	expected := field(mgl32.Vec3{0, 2, 0.5})
+	if e := grid.IrradianceAt(p, n); cgm.Abs32(e.X()-expected) > TOLERANCE*expected {
+		t.Errorf("point %v: expected %v, got %v", p, expected, e.X())
+	}
+}
+
+// a probe behind a wall sees the wall closer than the shading point and is
+// rejected by the chebyshev test, thus the irradiance comes from the other
+// probe only
+func TestVisibility(t *testing.T) {
+	bounds := geom.AABB{Min: mgl32.Vec3{0, 0, 0}, Max: mgl32.Vec3{2, 1, 1}}
+	grid, err := MakeGrid(bounds, [3]int{2, 1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	grid.Irradiance[0] = makeConstant(1)
+	grid.Irradiance[1] = makeConstant(3)
+
+	p := mgl32.Vec3{1, 0.5, 0.5}
+	n := mgl32.Vec3{0, 1, 0}
+	if e := grid.IrradianceAt(p, n); cgm.Abs32(e.X()-2) > TOLERANCE {
+		t.Errorf("unoccluded: expected the mean of both probes 2, got %v", e.X())
+	}
+
+	grid.Visibility[1] = makeVisibility(0.5)
+	if e := grid.IrradianceAt(p, n); cgm.Abs32(e.X()-1) > TOLERANCE {
+		t.Errorf("occluded: expected the irradiance of the visible probe 1, got %v", e.X())
+	}
+}
+
+// the layout constants have to match the ones of probegrid.glsl, which reads
+// the texture of Grid.Texture
+func TestShaderLayout(t *testing.T) {
+	data, err := ioutil.ReadFile(SHADER_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := string(data)
+
+	defines := map[string]float64{
+		"PROBE_GRID_IRRADIANCE_TEXELS": IRRADIANCE_TEXELS,
+		"PROBE_GRID_VISIBILITY_TEXELS": VISIBILITY_TEXELS,
+		"PROBE_GRID_TEXELS":            GRID_TEXELS,
+		"PROBE_GRID_VISIBILITY_BIAS":   VISIBILITY_BIAS,
+		"PROBE_GRID_MIN_WEIGHT":        minWeight,
+	}
+	for name, expected := range defines {
+		match := regexp.MustCompile(`#define ` + name + ` (\S+)`).FindStringSubmatch(source)
+		if match == nil {
+			t.Errorf("%v is not defined", name)
+			continue
+		}
+		value, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			t.Errorf("%v: %v", name, err)
+			continue
+		}
+		if value != expected {
+			t.Errorf("%v: expected %v, got %v", name, expected, value)
+		}
+	}
+
+	match := regexp.MustCompile(`layout\(binding=(\d+)\) uniform sampler3D probeGrid`).FindStringSubmatch(source)
+	if match == nil {
+		t.Fatal("probeGrid is not declared")
+	}
+	if binding, _ := strconv.Atoi(match[1]); binding != GRID_BINDING {
+		t.Errorf("expected the binding %v, got %v", GRID_BINDING, binding)
+	}
+}
+
+// makeConstant returns the coefficients of an irradiance that is the same
+// for all normals.
+func makeConstant(irradiance float32) sh.SH {
+	coeffs, _ := sh.Make(sh.ORDER_3)
+	c0 := sh.Basis(sh.ORDER_3, mgl32.Vec3{0, 0, 1})[0]
+	coeffs.Coeffs[0] = mgl32.Vec3{irradiance, irradiance, irradiance}.Mul(1 / c0)
+	return coeffs
+}
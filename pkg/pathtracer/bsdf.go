@@ -0,0 +1,126 @@
+package pathtracer
+
+import (
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/brdf"
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/sampling"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// lower bound of the roughness to keep the GGX distribution finite
+const minRoughness = 0.02
+
+// lower bound of the probability of picking either lobe when sampling
+const minLobeProbability = 0.05
+
+// BSDF is the Cook-Torrance model of ibl/pbr.glsl evaluated as a proper BRDF.
+// It consists of a Lambertian diffuse lobe weighted by (1-F)(1-metallic) and
+// the GGX specular lobe of brdf.Specular with the geometry term used for image
+// based lighting. Unlike Brdf of pbr.glsl the specular lobe isn't weighted by
+// the metalness, since the Fresnel term with f0 already accounts for it.
+type BSDF struct {
+	N        mgl32.Vec3
+	Albedo   mgl32.Vec3
+	F0       mgl32.Vec3
+	Metallic float32
+	A        float32 // roughness^2
+	K        float32
+	Weight   float32 // scales the whole BSDF, e.g. by the ambient occlusion
+}
+
+// MakeBSDF creates the BSDF of the shading point.
+func MakeBSDF(sp *ShadingPoint) BSDF {
+	roughness := cgm.Max32(sp.Roughness, minRoughness)
+	a := roughness * roughness
+	return BSDF{
+		N:        sp.N,
+		Albedo:   sp.Albedo,
+		F0:       brdf.F0(sp.Albedo, sp.Metallic),
+		Metallic: sp.Metallic,
+		A:        a,
+		K:        brdf.KIBL(a),
+		Weight:   1,
+	}
+}
+
+// Evaluate returns the value of the BSDF for the light direction l and the
+// view direction v. Both have to lie in the upper hemisphere of the normal.
+func (bsdf *BSDF) Evaluate(l, v mgl32.Vec3) mgl32.Vec3 {
+	if bsdf.N.Dot(l) <= 0 || bsdf.N.Dot(v) <= 0 {
+		return mgl32.Vec3{0, 0, 0}
+	}
+
+	F := brdf.FresnelSchlick(v, bsdf.N, bsdf.F0)
+	kD := mgl32.Vec3{1, 1, 1}.Sub(F).Mul(1 - bsdf.Metallic)
+	diffuse := mgl32.Vec3{
+		kD.X() * bsdf.Albedo.X(),
+		kD.Y() * bsdf.Albedo.Y(),
+		kD.Z() * bsdf.Albedo.Z(),
+	}.Mul(1 / math.Pi)
+	specular := brdf.Specular(l, v, bsdf.N, bsdf.F0, bsdf.A, bsdf.K)
+
+	return diffuse.Add(specular).Mul(bsdf.Weight)
+}
+
+// Sample chooses a light direction for the view direction v based on the
+// uniform random numbers xi. Either the diffuse lobe is sampled with a cosine
+// distribution or the specular lobe with the GGX distribution of normals. It
+// returns the direction and the pdf of choosing it with respect to the solid
+// angle, which is 0 if the direction lies below the surface.
+func (bsdf *BSDF) Sample(xi mgl32.Vec2, v mgl32.Vec3) (mgl32.Vec3, float32) {
+	ps := bsdf.specularProbability(v)
+
+	// reuse the first random number for choosing the lobe
+	var l mgl32.Vec3
+	if xi.X() < ps {
+		xi[0] = xi.X() / ps
+		h := sampling.ImportanceSamplingGGX(xi, bsdf.N, bsdf.A)
+		l = h.Mul(2 * v.Dot(h)).Sub(v)
+	} else {
+		xi[0] = (xi.X() - ps) / (1 - ps)
+		l = sampling.TangentToWorld(sampling.CosineHemisphere(xi), bsdf.N)
+	}
+
+	if bsdf.N.Dot(l) <= 0 {
+		return l, 0
+	}
+	return l, bsdf.Pdf(l, v)
+}
+
+// Pdf returns the pdf of Sample choosing the light direction l for the view
+// direction v with respect to the solid angle.
+func (bsdf *BSDF) Pdf(l, v mgl32.Vec3) float32 {
+	nDotL := bsdf.N.Dot(l)
+	if nDotL <= 0 || bsdf.N.Dot(v) <= 0 {
+		return 0
+	}
+	ps := bsdf.specularProbability(v)
+
+	h := l.Add(v).Normalize()
+	nDotH := cgm.Max32(bsdf.N.Dot(h), 0)
+	vDotH := cgm.Max32(v.Dot(h), 1e-6)
+	pdfSpecular := brdf.NormalDistributionGGX(bsdf.N, h, bsdf.A) * nDotH / (4 * vDotH)
+	pdfDiffuse := nDotL / math.Pi
+
+	return ps*pdfSpecular + (1-ps)*pdfDiffuse
+}
+
+// specularProbability returns the probability of sampling the specular lobe,
+// which is proportional to the estimated energy of both lobes.
+func (bsdf *BSDF) specularProbability(v mgl32.Vec3) float32 {
+	F := brdf.FresnelSchlick(v, bsdf.N, bsdf.F0)
+	specular := luminance(F)
+	diffuse := luminance(bsdf.Albedo) * (1 - luminance(F)) * (1 - bsdf.Metallic)
+	if specular+diffuse <= 0 {
+		return 0.5
+	}
+	return cgm.Clamp(specular/(specular+diffuse), minLobeProbability, 1-minLobeProbability)
+}
+
+// luminance returns the relative luminance of the linear rgb color using the
+// Rec. 709 primaries.
+func luminance(c mgl32.Vec3) float32 {
+	return 0.2126*c.X() + 0.7152*c.Y() + 0.0722*c.Z()
+}
@@ -0,0 +1,38 @@
+package pathtracer
+
+import (
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Camera generates primary rays by unprojecting points of the image plane
+// with the inverse view and projection matrices. This way the path tracer
+// uses exactly the same camera as the realtime renderer.
+type Camera struct {
+	pos   mgl32.Vec3
+	invvp mgl32.Mat4
+}
+
+// MakeCamera creates a camera from the view and perspective projection
+// matrix, e.g. from camera.Camera.
+func MakeCamera(view, perspective mgl32.Mat4) Camera {
+	pos := view.Inv().Mul4x1(mgl32.Vec4{0, 0, 0, 1})
+	return Camera{
+		pos:   pos.Vec3().Mul(1 / pos.W()),
+		invvp: perspective.Mul4(view).Inv(),
+	}
+}
+
+// GetPos returns the position of the camera.
+func (camera *Camera) GetPos() mgl32.Vec3 {
+	return camera.pos
+}
+
+// GenerateRay returns the ray through the point (x,y) of the image plane
+// where (0,0) is the upper left and (1,1) the lower right corner.
+func (camera *Camera) GenerateRay(x, y float32) geom.Ray {
+	ndc := mgl32.Vec4{2*x - 1, 1 - 2*y, 1, 1}
+	far := camera.invvp.Mul4x1(ndc)
+	target := far.Vec3().Mul(1 / far.W())
+	return geom.MakeRay(camera.pos, target.Sub(camera.pos))
+}
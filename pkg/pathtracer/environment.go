@@ -0,0 +1,52 @@
+package pathtracer
+
+import (
+	"github.com/adrianderstroff/pbr/pkg/envmap"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Environment is the infinitely distant light surrounding the scene. Besides
+// returning the radiance in a direction it has to be able to sample
+// directions for next event estimation and to return the pdf of a direction
+// for multiple importance sampling with the BSDF.
+type Environment interface {
+	Radiance(dir mgl32.Vec3) mgl32.Vec3
+	Sample(xi mgl32.Vec2) (mgl32.Vec3, float32)
+	Pdf(dir mgl32.Vec3) float32
+}
+
+// CubemapEnvironment is an environment given by a cube map. Directions are
+// sampled proportional to the luminance of the cube map. The radiance is
+// scaled by Intensity, which doesn't change the sampling distribution.
+type CubemapEnvironment struct {
+	Cubemap   *envmap.Cubemap
+	Sampler   envmap.CubemapSampler
+	Intensity float32
+}
+
+// MakeCubemapEnvironment creates an environment from the cube map and builds
+// its sampling distribution.
+func MakeCubemapEnvironment(cubemap *envmap.Cubemap) CubemapEnvironment {
+	return CubemapEnvironment{
+		Cubemap:   cubemap,
+		Sampler:   envmap.MakeCubemapSampler(cubemap),
+		Intensity: 1,
+	}
+}
+
+// Radiance returns the bilinearly filtered radiance of the cube map in the
+// direction dir.
+func (env *CubemapEnvironment) Radiance(dir mgl32.Vec3) mgl32.Vec3 {
+	return env.Cubemap.Sample(dir).Mul(env.Intensity)
+}
+
+// Sample returns a direction distributed according to the luminance of the
+// cube map and its pdf.
+func (env *CubemapEnvironment) Sample(xi mgl32.Vec2) (mgl32.Vec3, float32) {
+	return env.Sampler.Sample(xi)
+}
+
+// Pdf returns the pdf of sampling the direction dir.
+func (env *CubemapEnvironment) Pdf(dir mgl32.Vec3) float32 {
+	return env.Sampler.Pdf(dir)
+}
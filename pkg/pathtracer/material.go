@@ -0,0 +1,151 @@
+package pathtracer
+
+import (
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// gamma of the sRGB approximation used by InvGamma in tonemapping.glsl
+const gamma = 2.2
+
+// Material holds the textures of the PBR material used by cmd/pbr. Textures
+// that are nil are replaced by the constant values Albedo, Metallic,
+// Roughness and AO. GlobalRoughness is a lower bound of the roughness like
+// uGlobalRoughness of ibl/main.frag.
+type Material struct {
+	AlbedoMap    *image2d.Image2D
+	NormalMap    *image2d.Image2D
+	MetallicMap  *image2d.Image2D
+	RoughnessMap *image2d.Image2D
+	AOMap        *image2d.Image2D
+
+	Albedo          mgl32.Vec3
+	Metallic        float32
+	Roughness       float32
+	AO              float32
+	GlobalRoughness float32
+}
+
+// MakeMaterial creates a material without textures with the specified albedo,
+// metalness and roughness.
+func MakeMaterial(albedo mgl32.Vec3, metallic, roughness float32) Material {
+	return Material{
+		Albedo:    albedo,
+		Metallic:  metallic,
+		Roughness: roughness,
+		AO:        1,
+	}
+}
+
+// LoadMaterial loads the textures albedo.png, normal.png, metallic.png,
+// roughness.png and ao.png from the directory like cmd/pbr does.
+func LoadMaterial(dir string) (Material, error) {
+	mat := MakeMaterial(mgl32.Vec3{1, 1, 1}, 0, 1)
+	maps := []**image2d.Image2D{
+		&mat.AlbedoMap, &mat.NormalMap, &mat.MetallicMap, &mat.RoughnessMap, &mat.AOMap,
+	}
+	names := []string{"albedo", "normal", "metallic", "roughness", "ao"}
+	for i, name := range names {
+		img, err := image2d.MakeFromPath(dir + name + ".png")
+		if err != nil {
+			return Material{}, err
+		}
+		*maps[i] = &img
+	}
+	return mat, nil
+}
+
+// ShadingPoint holds the material parameters of a surface point after all
+// textures have been looked up. N is the shading normal after applying the
+// normal map.
+type ShadingPoint struct {
+	Albedo    mgl32.Vec3
+	Metallic  float32
+	Roughness float32
+	AO        float32
+	N         mgl32.Vec3
+}
+
+// Shade looks up all textures at the texture coordinates uv and applies the
+// normal map to the interpolated vertex normal n. The albedo is converted
+// from sRGB into linear space like MakePbrMaterial of ibl/pbr.glsl does.
+func (mat *Material) Shade(uv mgl32.Vec2, n mgl32.Vec3) ShadingPoint {
+	sp := ShadingPoint{
+		Albedo:    mat.Albedo,
+		Metallic:  mat.Metallic,
+		Roughness: mat.Roughness,
+		AO:        mat.AO,
+		N:         n,
+	}
+	if mat.AlbedoMap != nil {
+		c := sampleTexture(mat.AlbedoMap, uv)
+		sp.Albedo = mgl32.Vec3{
+			cgm.Pow32(c.X(), gamma),
+			cgm.Pow32(c.Y(), gamma),
+			cgm.Pow32(c.Z(), gamma),
+		}
+	}
+	if mat.MetallicMap != nil {
+		sp.Metallic = sampleTexture(mat.MetallicMap, uv).X()
+	}
+	if mat.RoughnessMap != nil {
+		sp.Roughness = sampleTexture(mat.RoughnessMap, uv).X()
+	}
+	if mat.AOMap != nil {
+		sp.AO = sampleTexture(mat.AOMap, uv).X()
+	}
+	if mat.NormalMap != nil {
+		sp.N = geom.NormalMapping(n, sampleTexture(mat.NormalMap, uv))
+	}
+	sp.Roughness = cgm.Max32(sp.Roughness, mat.GlobalRoughness)
+
+	return sp
+}
+
+// sampleTexture returns the bilinearly filtered color of the image at the
+// texture coordinates uv with repeating wrap mode. Images are uploaded upside
+// down by the texture package, thus v = 0 is the last row of the image.
+func sampleTexture(img *image2d.Image2D, uv mgl32.Vec2) mgl32.Vec3 {
+	w, h := img.GetWidth(), img.GetHeight()
+	x := uv.X()*float32(w) - 0.5
+	y := (1-uv.Y())*float32(h) - 0.5
+
+	fx, fy := cgm.Floor32(x), cgm.Floor32(y)
+	tx, ty := x-fx, y-fy
+	x0, y0 := wrap(int(fx), w), wrap(int(fy), h)
+	x1, y1 := wrap(x0+1, w), wrap(y0+1, h)
+
+	c00 := texel(img, x0, y0)
+	c10 := texel(img, x1, y0)
+	c01 := texel(img, x0, y1)
+	c11 := texel(img, x1, y1)
+
+	top := c00.Mul(1 - tx).Add(c10.Mul(tx))
+	bottom := c01.Mul(1 - tx).Add(c11.Mul(tx))
+	return top.Mul(1 - ty).Add(bottom.Mul(ty))
+}
+
+// texel returns the rgb color of the pixel (x,y). Images with less than three
+// channels are treated as gray scale.
+func texel(img *image2d.Image2D, x, y int) mgl32.Vec3 {
+	if img.GetChannels() < 3 {
+		v := img.GetFloat32(x, y, 0)
+		return mgl32.Vec3{v, v, v}
+	}
+	return mgl32.Vec3{
+		img.GetFloat32(x, y, 0),
+		img.GetFloat32(x, y, 1),
+		img.GetFloat32(x, y, 2),
+	}
+}
+
+// wrap maps the index i into the range [0,n) by repeating.
+func wrap(i, n int) int {
+	i %= n
+	if i < 0 {
+		i += n
+	}
+	return i
+}
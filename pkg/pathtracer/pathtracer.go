@@ -0,0 +1,269 @@
+// Package pathtracer provides a multi-threaded CPU path tracer that serves as
+// the ground truth for the realtime image based lighting of cmd/pbr. It
+// renders a triangle mesh with the same PBR material textures lit by the same
+// environment cube map. Direct lighting from the environment is estimated with
+// next event estimation and combined with BSDF sampling using multiple
+// importance sampling. Samples are accumulated progressively, such that the
+// current estimate can be saved at any time.
+package pathtracer
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// offset of secondary rays along the geometric normal to avoid self
+// intersections
+const rayEpsilon = 1e-4
+
+// Options of the path tracer. MaxDepth is the maximum number of bounces and
+// paths are terminated by russian roulette from the bounce RouletteDepth on.
+// Each sample is clamped to MaxRadiance to suppress fireflies, which is
+// disabled for values of 0. If AO is true the BSDF is scaled by the ambient
+// occlusion texture like the realtime renderer does.
+type Options struct {
+	Width         int
+	Height        int
+	MaxDepth      int
+	RouletteDepth int
+	MaxRadiance   float32
+	AO            bool
+	Seed          int64
+}
+
+// MakeDefaultOptions returns the options for an image of the specified size
+// with up to 8 bounces and russian roulette after the third bounce.
+func MakeDefaultOptions(width, height int) Options {
+	return Options{
+		Width:         width,
+		Height:        height,
+		MaxDepth:      8,
+		RouletteDepth: 3,
+		AO:            true,
+	}
+}
+
+// PathTracer accumulates the samples of the rendered image.
+type PathTracer struct {
+	scene   *Scene
+	camera  Camera
+	options Options
+	sum     []float64
+	samples int
+}
+
+// Make creates a path tracer that renders the scene from the camera.
+func Make(scene *Scene, camera Camera, options Options) PathTracer {
+	return PathTracer{
+		scene:   scene,
+		camera:  camera,
+		options: options,
+		sum:     make([]float64, 3*options.Width*options.Height),
+	}
+}
+
+// GetSamples returns the number of samples per pixel accumulated so far.
+func (pt *PathTracer) GetSamples() int {
+	return pt.samples
+}
+
+// RenderSample adds one sample to each pixel. The rows of the image are
+// distributed among all available CPUs. Each row uses its own random number
+// generator seeded by the row and the sample index, which makes the result
+// independent of the scheduling.
+func (pt *PathTracer) RenderSample() {
+	rows := make(chan int, pt.options.Height)
+	for y := 0; y < pt.options.Height; y++ {
+		rows <- y
+	}
+	close(rows)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := range rows {
+				pt.renderRow(y)
+			}
+		}()
+	}
+	wg.Wait()
+
+	pt.samples++
+}
+
+// renderRow traces one jittered path through each pixel of row y.
+func (pt *PathTracer) renderRow(y int) {
+	seed := pt.options.Seed + int64(pt.samples)*int64(pt.options.Height) + int64(y)
+	rng := rand.New(rand.NewSource(seed))
+
+	w, h := float32(pt.options.Width), float32(pt.options.Height)
+	for x := 0; x < pt.options.Width; x++ {
+		px := (float32(x) + rng.Float32()) / w
+		py := (float32(y) + rng.Float32()) / h
+		ray := pt.camera.GenerateRay(px, py)
+		L := pt.Radiance(&ray, rng)
+
+		// clamp the sample to suppress fireflies
+		if limit := pt.options.MaxRadiance; limit > 0 {
+			if m := maxComponent(L); m > limit {
+				L = L.Mul(limit / m)
+			}
+		}
+
+		idx := 3 * (y*pt.options.Width + x)
+		for c := 0; c < 3; c++ {
+			if !math.IsNaN(float64(L[c])) && !math.IsInf(float64(L[c]), 0) {
+				pt.sum[idx+c] += float64(L[c])
+			}
+		}
+	}
+}
+
+// Radiance estimates the radiance arriving along the ray.
+func (pt *PathTracer) Radiance(camray *geom.Ray, rng *rand.Rand) mgl32.Vec3 {
+	env := pt.scene.Environment
+	ray := *camray
+	L := mgl32.Vec3{0, 0, 0}
+	beta := mgl32.Vec3{1, 1, 1}
+	var bsdfPdf float32
+
+	for depth := 0; ; depth++ {
+		hit, ok := pt.scene.Intersect(&ray, 0, float32(math.Inf(1)))
+
+		// the environment has been hit by sampling the bsdf, which has to be
+		// weighted against next event estimation. camera rays see the
+		// environment directly.
+		if !ok {
+			Le := env.Radiance(ray.Direction)
+			if depth > 0 {
+				Le = Le.Mul(powerHeuristic(bsdfPdf, env.Pdf(ray.Direction)))
+			}
+			L = L.Add(mul(beta, Le))
+			break
+		}
+		if depth >= pt.options.MaxDepth {
+			break
+		}
+
+		// build the bsdf at the hit point. normal maps may tilt the shading
+		// normal away from the viewer in which case the geometric normal is
+		// used instead.
+		v := ray.Direction.Mul(-1)
+		sp := hit.Shading
+		if sp.N.Dot(v) <= 0 {
+			sp.N = hit.Ng
+		}
+		bsdf := MakeBSDF(&sp)
+		if pt.options.AO {
+			bsdf.Weight = sp.AO
+		}
+		origin := hit.P.Add(hit.Ng.Mul(rayEpsilon))
+
+		// next event estimation by sampling the environment
+		l, lightPdf := env.Sample(mgl32.Vec2{rng.Float32(), rng.Float32()})
+		if lightPdf > 0 && hit.Ng.Dot(l) > 0 {
+			f := bsdf.Evaluate(l, v)
+			if f != (mgl32.Vec3{0, 0, 0}) {
+				shadow := geom.Ray{Origin: origin, Direction: l}
+				if !pt.scene.Occluded(&shadow, 0, float32(math.Inf(1))) {
+					weight := powerHeuristic(lightPdf, bsdf.Pdf(l, v))
+					cos := bsdf.N.Dot(l)
+					Le := env.Radiance(l)
+					L = L.Add(mul(beta, mul(f, Le)).Mul(cos * weight / lightPdf))
+				}
+			}
+		}
+
+		// continue the path by sampling the bsdf
+		l, pdf := bsdf.Sample(mgl32.Vec2{rng.Float32(), rng.Float32()}, v)
+		if pdf <= 0 || hit.Ng.Dot(l) <= 0 {
+			break
+		}
+		f := bsdf.Evaluate(l, v)
+		beta = mul(beta, f).Mul(bsdf.N.Dot(l) / pdf)
+		bsdfPdf = pdf
+		ray = geom.Ray{Origin: origin, Direction: l}
+
+		// russian roulette
+		if depth+1 >= pt.options.RouletteDepth {
+			q := float32(math.Min(float64(maxComponent(beta)), 0.95))
+			if rng.Float32() >= q {
+				break
+			}
+			beta = beta.Mul(1 / q)
+		}
+	}
+
+	return L
+}
+
+// Image returns the current estimate of the image as a float image with
+// three channels.
+func (pt *PathTracer) Image() (image2d.Image2D, error) {
+	img, err := image2d.MakeFloat32(pt.options.Width, pt.options.Height, 3)
+	if err != nil {
+		return image2d.Image2D{}, err
+	}
+	if pt.samples == 0 {
+		return img, nil
+	}
+
+	inv := 1 / float64(pt.samples)
+	for y := 0; y < pt.options.Height; y++ {
+		for x := 0; x < pt.options.Width; x++ {
+			idx := 3 * (y*pt.options.Width + x)
+			for c := 0; c < 3; c++ {
+				img.SetFloat32(x, y, c, float32(pt.sum[idx+c]*inv))
+			}
+		}
+	}
+	return img, nil
+}
+
+// Tonemap maps the hdr image to an 8 bit image with reinhard tone mapping and
+// gamma correction like main.frag of ibl does, such that it can be compared
+// to screenshots of the realtime renderer.
+func Tonemap(hdr *image2d.Image2D) (image2d.Image2D, error) {
+	ldr, err := image2d.Make(hdr.GetWidth(), hdr.GetHeight(), 3)
+	if err != nil {
+		return image2d.Image2D{}, err
+	}
+	for y := 0; y < hdr.GetHeight(); y++ {
+		for x := 0; x < hdr.GetWidth(); x++ {
+			for c := 0; c < 3; c++ {
+				v := math.Max(float64(hdr.GetFloat32(x, y, c)), 0)
+				v = math.Pow(v/(1+v), 1/gamma)
+				ldr.SetFloat32(x, y, c, float32(v))
+			}
+		}
+	}
+	return ldr, nil
+}
+
+// powerHeuristic weights the sample of a strategy with the pdf pdfa against
+// another strategy with the pdf pdfb.
+func powerHeuristic(pdfa, pdfb float32) float32 {
+	a, b := pdfa*pdfa, pdfb*pdfb
+	if a+b == 0 {
+		return 0
+	}
+	return a / (a + b)
+}
+
+// mul multiplies two colors componentwise.
+func mul(a, b mgl32.Vec3) mgl32.Vec3 {
+	return mgl32.Vec3{a.X() * b.X(), a.Y() * b.Y(), a.Z() * b.Z()}
+}
+
+// maxComponent returns the largest component of the color.
+func maxComponent(c mgl32.Vec3) float32 {
+	return float32(math.Max(float64(c.X()), math.Max(float64(c.Y()), float64(c.Z()))))
+}
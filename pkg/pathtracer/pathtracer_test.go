@@ -0,0 +1,198 @@
+package pathtracer
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/core/gl"
+	"github.com/adrianderstroff/pbr/pkg/envmap"
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/adrianderstroff/pbr/pkg/sampling"
+	"github.com/adrianderstroff/pbr/pkg/view/mesh"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	PATHS      int     = 100000
+	QUADRATURE int     = 1000
+	TOLERANCE  float32 = 0.03
+)
+
+// materials covering the diffuse and the specular lobe
+var materials = []Material{
+	MakeMaterial(mgl32.Vec3{0.8, 0.8, 0.8}, 0, 1),
+	MakeMaterial(mgl32.Vec3{0.5, 0.3, 0.1}, 0, 0.4),
+	MakeMaterial(mgl32.Vec3{1, 0.8, 0.5}, 1, 0.3),
+}
+
+// view directions relative to the normal of the quad
+var views = []mgl32.Vec3{
+	{0, 0, 1},
+	mgl32.Vec3{0.7, 0.2, 0.6}.Normalize(),
+}
+
+// constantEnvironment emits the same radiance in all directions and samples
+// directions uniformly on the sphere.
+type constantEnvironment struct {
+	radiance mgl32.Vec3
+}
+
+func (env *constantEnvironment) Radiance(dir mgl32.Vec3) mgl32.Vec3 {
+	return env.radiance
+}
+
+func (env *constantEnvironment) Sample(xi mgl32.Vec2) (mgl32.Vec3, float32) {
+	return sampling.UniformSphere(xi), sampling.UniformSpherePdf()
+}
+
+func (env *constantEnvironment) Pdf(dir mgl32.Vec3) float32 {
+	return sampling.UniformSpherePdf()
+}
+
+// makeQuad returns a scene of a large quad in the xy-plane, which is convex,
+// thus all light reflected by it comes directly from the environment.
+func makeQuad(t *testing.T, material Material, environment Environment) Scene {
+	positions := []float32{
+		-10, -10, 0, 10, -10, 0, 10, 10, 0,
+		-10, -10, 0, 10, 10, 0, -10, 10, 0,
+	}
+	layout := []mesh.VertexAttribute{mesh.MakeVertexAttribute("pos", gl.FLOAT, 3, gl.STATIC_DRAW)}
+	geometry := mesh.MakeGeometry(layout, [][]float32{positions})
+	scene, err := MakeScene(&geometry, material, environment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scene
+}
+
+// makeSkyEnvironment returns a cube map environment with a dim sky and a
+// bright region, such that the environment sampling differs a lot from the
+// bsdf sampling.
+func makeSkyEnvironment(t *testing.T) *CubemapEnvironment {
+	cubemap, err := envmap.MakeEmptyCubemap(16, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sun := mgl32.Vec3{0.5, -0.3, 0.8}.Normalize()
+	for f := 0; f < 6; f++ {
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				color := mgl32.Vec3{0.2, 0.3, 0.5}
+				if cubemap.TexelDirection(f, x, y).Dot(sun) > 0.9 {
+					color = mgl32.Vec3{20, 18, 15}
+				}
+				cubemap.SetTexel(f, x, y, color)
+			}
+		}
+	}
+	env := MakeCubemapEnvironment(&cubemap)
+	return &env
+}
+
+// reflected integrates the bsdf times the radiance of the environment and the
+// cosine over the hemisphere with the midpoint rule in (cos theta, phi), which
+// doesn't depend on any of the sampling routines.
+func reflected(bsdf *BSDF, env Environment, v mgl32.Vec3) mgl32.Vec3 {
+	sum := mgl32.Vec3{0, 0, 0}
+	for i := 0; i < QUADRATURE; i++ {
+		cosTheta := (float32(i) + 0.5) / float32(QUADRATURE)
+		sinTheta := cgm.Sqrt32(1 - cosTheta*cosTheta)
+		for j := 0; j < QUADRATURE; j++ {
+			phi := 2 * math.Pi * (float32(j) + 0.5) / float32(QUADRATURE)
+			l := mgl32.Vec3{sinTheta * cgm.Cos32(phi), sinTheta * cgm.Sin32(phi), cosTheta}
+			sum = sum.Add(mul(bsdf.Evaluate(l, v), env.Radiance(l)).Mul(cosTheta))
+		}
+	}
+	return sum.Mul(2 * math.Pi / float32(QUADRATURE*QUADRATURE))
+}
+
+// radiance averages the radiance of the paths that hit the center of the quad
+// from the view direction v.
+func radiance(pt *PathTracer, v mgl32.Vec3, seed int64) mgl32.Vec3 {
+	rng := rand.New(rand.NewSource(seed))
+	ray := geom.MakeRay(v.Mul(2), v.Mul(-1))
+	sum := mgl32.Vec3{0, 0, 0}
+	for i := 0; i < PATHS; i++ {
+		sum = sum.Add(pt.Radiance(&ray, rng))
+	}
+	return sum.Mul(1 / float32(PATHS))
+}
+
+// shadingBSDF returns the bsdf at the center of the quad.
+func shadingBSDF(scene *Scene) BSDF {
+	sp := scene.Material.Shade(mgl32.Vec2{0.5, 0.5}, mgl32.Vec3{0, 0, 1})
+	return MakeBSDF(&sp)
+}
+
+func approxEqual(a, b mgl32.Vec3, tolerance float32) bool {
+	for c := 0; c < 3; c++ {
+		if cgm.Abs32(a[c]-b[c]) > tolerance*cgm.Max32(cgm.Abs32(b[c]), 0.01) {
+			return false
+		}
+	}
+	return true
+}
+
+// in a constant environment the path tracer converges to the directional
+// albedo of the bsdf times the radiance of the environment
+func TestConstantEnvironment(t *testing.T) {
+	env := &constantEnvironment{radiance: mgl32.Vec3{1, 1, 1}}
+	for m, material := range materials {
+		scene := makeQuad(t, material, env)
+		options := MakeDefaultOptions(1, 1)
+		options.AO = false
+		pt := Make(&scene, Camera{}, options)
+		bsdf := shadingBSDF(&scene)
+		for _, v := range views {
+			expected := reflected(&bsdf, env, v)
+			if got := radiance(&pt, v, 1); !approxEqual(got, expected, TOLERANCE) {
+				t.Errorf("material %v view %v: radiance %v instead of %v", m, v, got, expected)
+			}
+		}
+	}
+}
+
+// next event estimation and bsdf sampling are both unbiased on their own, the
+// path tracer combines them with multiple importance sampling, thus all three
+// estimates have to agree
+func TestMultipleImportanceSampling(t *testing.T) {
+	env := makeSkyEnvironment(t)
+	for m, material := range materials {
+		scene := makeQuad(t, material, env)
+		options := MakeDefaultOptions(1, 1)
+		options.AO = false
+		pt := Make(&scene, Camera{}, options)
+		bsdf := shadingBSDF(&scene)
+
+		for _, v := range views {
+			// stratified samples reduce the variance of the single strategies
+			light, brdf := mgl32.Vec3{0, 0, 0}, mgl32.Vec3{0, 0, 0}
+			for i := 0; i < PATHS; i++ {
+				xi := sampling.HammersleySampling(uint32(i), uint32(PATHS))
+				l, pdf := env.Sample(xi)
+				if pdf > 0 && l.Z() > 0 {
+					light = light.Add(mul(bsdf.Evaluate(l, v), env.Radiance(l)).Mul(l.Z() / pdf))
+				}
+				l, pdf = bsdf.Sample(xi, v)
+				if pdf > 0 {
+					brdf = brdf.Add(mul(bsdf.Evaluate(l, v), env.Radiance(l)).Mul(l.Z() / pdf))
+				}
+			}
+			light = light.Mul(1 / float32(PATHS))
+			brdf = brdf.Mul(1 / float32(PATHS))
+
+			expected := reflected(&bsdf, env, v)
+			if !approxEqual(light, expected, TOLERANCE) {
+				t.Errorf("material %v view %v: next event estimation %v instead of %v", m, v, light, expected)
+			}
+			if !approxEqual(brdf, expected, TOLERANCE) {
+				t.Errorf("material %v view %v: bsdf sampling %v instead of %v", m, v, brdf, expected)
+			}
+			if got := radiance(&pt, v, 3); !approxEqual(got, expected, TOLERANCE) {
+				t.Errorf("material %v view %v: multiple importance sampling %v instead of %v", m, v, got, expected)
+			}
+		}
+	}
+}
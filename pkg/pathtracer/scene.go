@@ -0,0 +1,92 @@
+package pathtracer
+
+import (
+	"github.com/adrianderstroff/pbr/pkg/bvh"
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/adrianderstroff/pbr/pkg/view/mesh"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Scene consists of a triangle mesh with a single material that is lit by an
+// environment. Normals holds the three vertex normals of each triangle of the
+// original triangle soup and is empty if the mesh has no normals.
+type Scene struct {
+	BVH         bvh.BVH
+	Normals     []mgl32.Vec3
+	Material    Material
+	Environment Environment
+}
+
+// SurfaceHit is the closest intersection of a ray with the scene. Ng is the
+// geometric normal and the shading point holds the material parameters with
+// the shading normal. Both normals face against the ray.
+type SurfaceHit struct {
+	geom.Hit
+	Ng      mgl32.Vec3
+	Shading ShadingPoint
+}
+
+// MakeScene builds the BVH over the triangles of the geometry, which needs a
+// pos and optionally an uv and a normal vertex attribute like the meshes of
+// obj.LoadGeometry.
+func MakeScene(geometry *mesh.Geometry, material Material, environment Environment) (Scene, error) {
+	hierarchy, err := bvh.MakeFromGeometry(geometry)
+	if err != nil {
+		return Scene{}, err
+	}
+
+	// vertex normals are optional
+	var normals []mgl32.Vec3
+	data, _, err := geometry.Attribute("normal")
+	if err == nil && len(data)/3 == 3*len(hierarchy.Triangles) {
+		normals = make([]mgl32.Vec3, len(data)/3)
+		for i := range normals {
+			normals[i] = mgl32.Vec3{data[3*i], data[3*i+1], data[3*i+2]}
+		}
+	}
+
+	return Scene{
+		BVH:         hierarchy,
+		Normals:     normals,
+		Material:    material,
+		Environment: environment,
+	}, nil
+}
+
+// Intersect returns the closest intersection of the ray with the scene with a
+// ray parameter in [tmin,tmax] and looks up the material at that point.
+func (scene *Scene) Intersect(ray *geom.Ray, tmin, tmax float32) (SurfaceHit, bool) {
+	hit, index, ok := scene.BVH.ClosestHit(ray, tmin, tmax)
+	if !ok {
+		return SurfaceHit{}, false
+	}
+
+	// interpolate the vertex normals and let them face the same side as the
+	// geometric normal
+	n := hit.N
+	if scene.Normals != nil {
+		w := hit.Barycentric
+		n = scene.Normals[3*index].Mul(w.X()).
+			Add(scene.Normals[3*index+1].Mul(w.Y())).
+			Add(scene.Normals[3*index+2].Mul(w.Z()))
+		if n.Len() == 0 {
+			n = hit.N
+		}
+		n = n.Normalize()
+		if n.Dot(hit.N) < 0 {
+			n = n.Mul(-1)
+		}
+	}
+
+	return SurfaceHit{
+		Hit:     hit,
+		Ng:      hit.N,
+		Shading: scene.Material.Shade(hit.UV, n),
+	}, true
+}
+
+// Occluded returns true if anything blocks the ray with a ray parameter in
+// [tmin,tmax].
+func (scene *Scene) Occluded(ray *geom.Ray, tmin, tmax float32) bool {
+	return scene.BVH.AnyHit(ray, tmin, tmax)
+}
@@ -0,0 +1,61 @@
+package raster
+
+import (
+	"github.com/adrianderstroff/pbr/pkg/view/mesh"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Fragment is a pixel covered by a triangle. X and Y are the pixel
+// coordinates in the attached images, Depth is the window space depth in
+// [0,1] and Primitive the index of the triangle within the draw call.
+// FrontFacing is true if the triangle faces the viewer according to the
+// FrontFace of the rasterizer. The interpolated vertex attributes are
+// accessed by their id.
+type Fragment struct {
+	X, Y        int
+	Depth       float32
+	Primitive   int
+	FrontFacing bool
+
+	layout     []mesh.VertexAttribute
+	attributes []float32
+}
+
+// Attribute returns the interpolated values of the vertex attribute with the
+// specified id or nil if the geometry has no such attribute. The slice is
+// reused for the next fragment, thus it must not be stored.
+func (fragment *Fragment) Attribute(id string) []float32 {
+	offset := 0
+	for _, attrib := range fragment.layout {
+		count := int(attrib.Count)
+		if attrib.ID == id {
+			return fragment.attributes[offset : offset+count]
+		}
+		offset += count
+	}
+	return nil
+}
+
+// Vec2 returns the first two components of the vertex attribute with the
+// specified id. Missing components are zero.
+func (fragment *Fragment) Vec2(id string) mgl32.Vec2 {
+	var v mgl32.Vec2
+	copy(v[:], fragment.Attribute(id))
+	return v
+}
+
+// Vec3 returns the first three components of the vertex attribute with the
+// specified id. Missing components are zero.
+func (fragment *Fragment) Vec3(id string) mgl32.Vec3 {
+	var v mgl32.Vec3
+	copy(v[:], fragment.Attribute(id))
+	return v
+}
+
+// Vec4 returns the first four components of the vertex attribute with the
+// specified id. Missing components are zero.
+func (fragment *Fragment) Vec4(id string) mgl32.Vec4 {
+	var v mgl32.Vec4
+	copy(v[:], fragment.Attribute(id))
+	return v
+}
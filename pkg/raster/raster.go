@@ -0,0 +1,246 @@
+// Package raster provides a software rasterizer that renders geometry into
+// images on the CPU, such that meshes can be rendered without an OpenGL
+// context, e.g. for producing reference images on machines without a GPU.
+// It mirrors the fixed function stages of OpenGL: the triangles are clipped
+// against the near and far plane, culled depending on their winding order,
+// rasterized with perspective correct interpolation of all vertex attributes
+// and depth tested. Shading is done by a Go function that is called for each
+// fragment and writes into the attached color images.
+package raster
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/core/gl"
+	"github.com/adrianderstroff/pbr/pkg/scene/camera"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/adrianderstroff/pbr/pkg/view/mesh"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Shader is called for each fragment that passes the depth test. It writes
+// the color of each attached color image into out, whose entries are
+// initialized with zero. Returning false discards the fragment, thus neither
+// the color images nor the depth image are written.
+type Shader func(fragment *Fragment, out []mgl32.Vec4) bool
+
+// Rasterizer renders into color images and a depth image of the same size,
+// similar to a frame buffer object. The exported fields correspond to the
+// OpenGL state and are initialized with the values that gl.Init sets.
+// DepthFunc is one of gl.NEVER, gl.LESS, gl.EQUAL, gl.LEQUAL, gl.GREATER,
+// gl.NOTEQUAL, gl.GEQUAL or gl.ALWAYS, CullMode one of gl.FRONT, gl.BACK or
+// gl.FRONT_AND_BACK and FrontFace either gl.CCW or gl.CW.
+type Rasterizer struct {
+	width  int
+	height int
+	colors []*image2d.Image2D
+	depth  *image2d.Image2D
+
+	ClearColor mgl32.Vec4
+	ClearDepth float32
+	DepthTest  bool
+	DepthMask  bool
+	DepthFunc  uint32
+	CullFace   bool
+	CullMode   uint32
+	FrontFace  uint32
+}
+
+// Make creates a Rasterizer with a viewport of the specified size without
+// any images attached. Depth testing and back face culling of clockwise
+// triangles are enabled like by gl.Init.
+func Make(width, height int) Rasterizer {
+	return Rasterizer{
+		width:      width,
+		height:     height,
+		ClearColor: mgl32.Vec4{0.0, 0.0, 0.0, 1.0},
+		ClearDepth: 1.0,
+		DepthTest:  true,
+		DepthMask:  true,
+		DepthFunc:  gl.LESS,
+		CullFace:   true,
+		CullMode:   gl.BACK,
+		FrontFace:  gl.CCW,
+	}
+}
+
+// New creates a reference to a Rasterizer with a viewport of the specified
+// size.
+func New(width, height int) *Rasterizer {
+	rasterizer := Make(width, height)
+	return &rasterizer
+}
+
+// AttachColor attaches the image as the color image with the specified index.
+// It receives out[index] of the shader, of which as many components are
+// written as the image has channels. Images with a byte depth of 1 clamp the
+// values to [0,1]. Like the textures of a frame buffer object the first row
+// of the image is the top of the viewport.
+func (rasterizer *Rasterizer) AttachColor(img *image2d.Image2D, index int) error {
+	if err := rasterizer.checkSize(img); err != nil {
+		return err
+	}
+	if index < 0 {
+		return fmt.Errorf("invalid color attachment %v", index)
+	}
+	for len(rasterizer.colors) <= index {
+		rasterizer.colors = append(rasterizer.colors, nil)
+	}
+	rasterizer.colors[index] = img
+	return nil
+}
+
+// AttachDepth attaches the image with one channel as depth image, which
+// stores the window space depth in [0,1]. Without a depth image all fragments
+// pass the depth test.
+func (rasterizer *Rasterizer) AttachDepth(img *image2d.Image2D) error {
+	if err := rasterizer.checkSize(img); err != nil {
+		return err
+	}
+	if img.GetChannels() != 1 {
+		return errors.New("depth image needs exactly one channel")
+	}
+	rasterizer.depth = img
+	return nil
+}
+
+func (rasterizer *Rasterizer) checkSize(img *image2d.Image2D) error {
+	if img.GetWidth() != rasterizer.width || img.GetHeight() != rasterizer.height {
+		return fmt.Errorf("image of size %vx%v doesn't match the viewport of size %vx%v",
+			img.GetWidth(), img.GetHeight(), rasterizer.width, rasterizer.height)
+	}
+	return nil
+}
+
+// Clear sets all attached color images to ClearColor and the depth image to
+// ClearDepth.
+func (rasterizer *Rasterizer) Clear() {
+	for y := 0; y < rasterizer.height; y++ {
+		for x := 0; x < rasterizer.width; x++ {
+			for _, color := range rasterizer.colors {
+				if color == nil {
+					continue
+				}
+				for c := 0; c < cgm.Mini(color.GetChannels(), 4); c++ {
+					color.SetFloat32(x, y, c, rasterizer.ClearColor[c])
+				}
+			}
+			if rasterizer.depth != nil {
+				rasterizer.depth.SetFloat32(x, y, 0, rasterizer.ClearDepth)
+			}
+		}
+	}
+}
+
+// Render draws the geometry with the model matrix as seen by the camera.
+func (rasterizer *Rasterizer) Render(geometry *mesh.Geometry, mode uint32, camera camera.Camera, model mgl32.Mat4, shader Shader) error {
+	mvp := camera.GetPerspective().Mul4(camera.GetView()).Mul4(model)
+	return rasterizer.Draw(geometry, mode, mvp, shader)
+}
+
+// Draw transforms the pos attribute of the geometry with the model view
+// projection matrix mvp into clip space and rasterizes the resulting
+// triangles. The mode can be gl.TRIANGLES, gl.TRIANGLE_STRIP or
+// gl.TRIANGLE_FAN. All vertex attributes of the geometry are interpolated
+// perspective correctly and passed to the shader with each fragment.
+func (rasterizer *Rasterizer) Draw(geometry *mesh.Geometry, mode uint32, mvp mgl32.Mat4, shader Shader) error {
+	vertices, layout, err := makeVertices(geometry, mvp)
+	if err != nil {
+		return err
+	}
+
+	var indices [][3]int
+	switch mode {
+	case gl.TRIANGLES:
+		for i := 0; i+2 < len(vertices); i += 3 {
+			indices = append(indices, [3]int{i, i + 1, i + 2})
+		}
+	case gl.TRIANGLE_STRIP:
+		// every second triangle is flipped to keep the winding order
+		for i := 0; i+2 < len(vertices); i++ {
+			if i%2 == 0 {
+				indices = append(indices, [3]int{i, i + 1, i + 2})
+			} else {
+				indices = append(indices, [3]int{i + 1, i, i + 2})
+			}
+		}
+	case gl.TRIANGLE_FAN:
+		for i := 1; i+1 < len(vertices); i++ {
+			indices = append(indices, [3]int{0, i, i + 1})
+		}
+	default:
+		return fmt.Errorf("mode %v is not supported", mode)
+	}
+
+	fragment := Fragment{layout: layout}
+	out := make([]mgl32.Vec4, len(rasterizer.colors))
+	for primitive, idx := range indices {
+		polygon := clip([]vertex{vertices[idx[0]], vertices[idx[1]], vertices[idx[2]]})
+		if len(polygon) < 3 {
+			continue
+		}
+
+		screen := make([]screenVertex, len(polygon))
+		for i, v := range polygon {
+			screen[i] = rasterizer.toScreen(v)
+		}
+
+		// the winding order is determined in normalized device coordinates
+		// whose y-axis points up, unlike the rows of the images
+		area := signedArea(screen)
+		if area == 0 {
+			continue
+		}
+		front := (area > 0) == (rasterizer.FrontFace == gl.CCW)
+		if rasterizer.culled(front) {
+			continue
+		}
+
+		fragment.Primitive = primitive
+		fragment.FrontFacing = front
+		for i := 1; i+1 < len(screen); i++ {
+			rasterizer.rasterize(screen[0], screen[i], screen[i+1], &fragment, out, shader)
+		}
+	}
+
+	return nil
+}
+
+// culled returns true if triangles with the specified facing are culled.
+func (rasterizer *Rasterizer) culled(front bool) bool {
+	if !rasterizer.CullFace {
+		return false
+	}
+	switch rasterizer.CullMode {
+	case gl.FRONT:
+		return front
+	case gl.BACK:
+		return !front
+	case gl.FRONT_AND_BACK:
+		return true
+	}
+	return false
+}
+
+// depthTest compares the depth of a fragment with the stored depth.
+func (rasterizer *Rasterizer) depthTest(depth, stored float32) bool {
+	switch rasterizer.DepthFunc {
+	case gl.NEVER:
+		return false
+	case gl.LESS:
+		return depth < stored
+	case gl.EQUAL:
+		return depth == stored
+	case gl.LEQUAL:
+		return depth <= stored
+	case gl.GREATER:
+		return depth > stored
+	case gl.NOTEQUAL:
+		return depth != stored
+	case gl.GEQUAL:
+		return depth >= stored
+	}
+	return true
+}
@@ -0,0 +1,229 @@
+package raster
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/core/gl"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/adrianderstroff/pbr/pkg/view/mesh"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	WIDTH  int = 32
+	HEIGHT int = 32
+	NEAR       = 0.1
+	FAR        = 100
+)
+
+// each pixel of the viewport has to be shaded exactly once by triangles that
+// share edges and vertices, even if the edges pass through pixel centers
+func TestTopLeftRule(t *testing.T) {
+	// a quad split along its diagonal, which passes through pixel centers
+	quad := []float32{
+		-1, -1, 0, 1, -1, 0, 1, 1, 0,
+		-1, -1, 0, 1, 1, 0, -1, 1, 0,
+	}
+
+	// a fan around the center of the viewport, which is a pixel corner
+	var fan []float32
+	corners := [][2]float32{{-1, -1}, {0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}}
+	for i := range corners {
+		a, b := corners[i], corners[(i+1)%len(corners)]
+		fan = append(fan, 0, 0, 0, a[0], a[1], 0, b[0], b[1], 0)
+	}
+
+	for name, positions := range map[string][]float32{"quad": quad, "fan": fan} {
+		rasterizer := Make(WIDTH, HEIGHT)
+		counts := make([]int, WIDTH*HEIGHT)
+		geometry := makeGeometry(positions)
+		err := rasterizer.Draw(&geometry, gl.TRIANGLES, mgl32.Ident4(), func(fragment *Fragment, out []mgl32.Vec4) bool {
+			counts[fragment.X+fragment.Y*WIDTH]++
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, count := range counts {
+			if count != 1 {
+				t.Fatalf("%v: pixel (%v,%v) has been shaded %v times", name, i%WIDTH, i/WIDTH, count)
+			}
+		}
+	}
+}
+
+// the world space position of a floor seen in perspective has to match the
+// intersection of the view ray through the pixel center with the floor
+func TestPerspectiveCorrectInterpolation(t *testing.T) {
+	floor := []float32{
+		-10, -1, -1, 10, -1, -1, 10, -1, -50,
+		-10, -1, -1, 10, -1, -50, -10, -1, -50,
+	}
+	geometry := makeGeometry(floor)
+	mvp := mgl32.Perspective(math.Pi/2, 1, NEAR, FAR)
+
+	rasterizer := Make(WIDTH, HEIGHT)
+	shaded := 0
+	err := rasterizer.Draw(&geometry, gl.TRIANGLES, mvp, func(fragment *Fragment, out []mgl32.Vec4) bool {
+		shaded++
+		// with a field of view of 90 degrees the view ray is (ndc.x, ndc.y, -1)
+		nx := 2*(float32(fragment.X)+0.5)/float32(WIDTH) - 1
+		ny := 1 - 2*(float32(fragment.Y)+0.5)/float32(HEIGHT)
+		s := -1 / ny
+		expected := mgl32.Vec3{nx * s, -1, -s}
+
+		p := fragment.Vec3("pos")
+		if p.Sub(expected).Len() > 1e-3*expected.Len() {
+			t.Fatalf("pixel (%v,%v): expected %v, got %v", fragment.X, fragment.Y, expected, p)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shaded == 0 {
+		t.Fatal("the floor hasn't been rasterized")
+	}
+}
+
+// Make sets up the state of gl.Init, which culls clockwise triangles
+func TestBackFaceCulling(t *testing.T) {
+	ccw := []float32{-1, -1, 0, 1, -1, 0, 0, 1, 0}
+	cw := []float32{-1, -1, 0, 0, 1, 0, 1, -1, 0}
+
+	render := func(rasterizer *Rasterizer, positions []float32) (int, bool) {
+		geometry := makeGeometry(positions)
+		shaded, front := 0, false
+		err := rasterizer.Draw(&geometry, gl.TRIANGLES, mgl32.Ident4(), func(fragment *Fragment, out []mgl32.Vec4) bool {
+			shaded++
+			front = fragment.FrontFacing
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return shaded, front
+	}
+
+	rasterizer := Make(WIDTH, HEIGHT)
+	if shaded, front := render(&rasterizer, ccw); shaded == 0 || !front {
+		t.Errorf("expected the counter clockwise triangle to be front facing and visible")
+	}
+	if shaded, _ := render(&rasterizer, cw); shaded != 0 {
+		t.Errorf("expected the clockwise triangle to be culled, got %v fragments", shaded)
+	}
+
+	rasterizer.CullFace = false
+	if shaded, front := render(&rasterizer, cw); shaded == 0 || front {
+		t.Errorf("expected the clockwise triangle to be back facing and visible")
+	}
+}
+
+// a triangle on the floor with one vertex behind the camera is clipped at the
+// near plane, without clipping it would be mirrored into the upper half of
+// the viewport
+func TestNearPlaneClipping(t *testing.T) {
+	triangle := []float32{-1, -1, -2, 1, -1, -2, 0, -1, 5}
+	geometry := makeGeometry(triangle)
+	mvp := mgl32.Perspective(math.Pi/2, 1, NEAR, FAR)
+
+	rasterizer := Make(WIDTH, HEIGHT)
+	rasterizer.CullFace = false
+	shaded := 0
+	err := rasterizer.Draw(&geometry, gl.TRIANGLES, mvp, func(fragment *Fragment, out []mgl32.Vec4) bool {
+		shaded++
+		if fragment.Y < HEIGHT/2 {
+			t.Fatalf("pixel (%v,%v) lies above the horizon", fragment.X, fragment.Y)
+		}
+		if z := fragment.Vec3("pos").Z(); z > -NEAR+1e-4 {
+			t.Fatalf("pixel (%v,%v) lies in front of the near plane at z=%v", fragment.X, fragment.Y, z)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shaded == 0 {
+		t.Fatal("the clipped triangle hasn't been rasterized")
+	}
+}
+
+// two overlapping triangles with the nearer one drawn first, thus the depth
+// test has to keep it in front
+var golden = []string{
+	"................",
+	"................",
+	"................",
+	"................",
+	".......22.......",
+	"......2222......",
+	"......2222......",
+	".....222222.....",
+	"....22222222....",
+	"....222222222...",
+	"...2222222222...",
+	"1122222222222211",
+	"1122222222222221",
+	"1111111111111111",
+	"1111111111111111",
+	"1111111111111111",
+}
+
+func TestGolden(t *testing.T) {
+	size := len(golden)
+	color, err := image2d.MakeFloat32(size, size, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	depth, err := image2d.MakeFloat32(size, size, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rasterizer := Make(size, size)
+	if err := rasterizer.AttachColor(&color, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := rasterizer.AttachDepth(&depth); err != nil {
+		t.Fatal(err)
+	}
+	rasterizer.Clear()
+
+	near := makeGeometry([]float32{-0.8, -0.6, -0.5, 0.9, -0.6, -0.5, 0, 0.6, -0.5})
+	far := makeGeometry([]float32{-1, -1, 0.5, 1, -1, 0.5, 1, -0.4, 0.5, -1, -1, 0.5, 1, -0.4, 0.5, -1, -0.4, 0.5})
+	for i, geometry := range []mesh.Geometry{near, far} {
+		value := float32(2 - i)
+		err := rasterizer.Draw(&geometry, gl.TRIANGLES, mgl32.Ident4(), func(fragment *Fragment, out []mgl32.Vec4) bool {
+			out[0] = mgl32.Vec4{value, 0, 0, 0}
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var rendered []string
+	for y := 0; y < size; y++ {
+		var row strings.Builder
+		for x := 0; x < size; x++ {
+			if v := color.GetFloat32(x, y, 0); v == 0 {
+				row.WriteByte('.')
+			} else {
+				row.WriteByte('0' + byte(cgm.Clamp(v, 0, 9)))
+			}
+		}
+		rendered = append(rendered, row.String())
+	}
+	if strings.Join(rendered, "\n") != strings.Join(golden, "\n") {
+		t.Errorf("expected\n%v\ngot\n%v", strings.Join(golden, "\n"), strings.Join(rendered, "\n"))
+	}
+}
+
+// makeGeometry creates a geometry with the pos attribute only.
+func makeGeometry(positions []float32) mesh.Geometry {
+	layout := []mesh.VertexAttribute{mesh.MakeVertexAttribute("pos", gl.FLOAT, 3, gl.STATIC_DRAW)}
+	return mesh.MakeGeometry(layout, [][]float32{positions})
+}
@@ -0,0 +1,103 @@
+package raster
+
+import (
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// rasterize shades all pixels whose centers are covered by the triangle.
+// Pixel centers on an edge shared by two triangles belong to exactly one of
+// them following the top left rule. The depth is interpolated linearly in
+// screen space, the attributes are interpolated perspective correctly.
+func (rasterizer *Rasterizer) rasterize(v0, v1, v2 screenVertex, fragment *Fragment, out []mgl32.Vec4, shader Shader) {
+	area := edge(v0, v1, v2.x, v2.y)
+	if area == 0 {
+		return
+	}
+	// orient the triangle such that the edge functions are positive inside
+	if area < 0 {
+		v1, v2 = v2, v1
+		area = -area
+	}
+
+	// pixels within the bounding box of the triangle and the viewport
+	x0 := int(cgm.Clamp(cgm.Floor32(cgm.Min32(v0.x, cgm.Min32(v1.x, v2.x))), 0, float32(rasterizer.width-1)))
+	x1 := int(cgm.Clamp(cgm.Floor32(cgm.Max32(v0.x, cgm.Max32(v1.x, v2.x))), 0, float32(rasterizer.width-1)))
+	y0 := int(cgm.Clamp(cgm.Floor32(cgm.Min32(v0.y, cgm.Min32(v1.y, v2.y))), 0, float32(rasterizer.height-1)))
+	y1 := int(cgm.Clamp(cgm.Floor32(cgm.Max32(v0.y, cgm.Max32(v1.y, v2.y))), 0, float32(rasterizer.height-1)))
+
+	if cap(fragment.attributes) < len(v0.attributes) {
+		fragment.attributes = make([]float32, len(v0.attributes))
+	}
+	fragment.attributes = fragment.attributes[:len(v0.attributes)]
+
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			px, py := float32(x)+0.5, float32(y)+0.5
+			w0 := edge(v1, v2, px, py)
+			w1 := edge(v2, v0, px, py)
+			w2 := edge(v0, v1, px, py)
+			if !inside(w0, v1, v2) || !inside(w1, v2, v0) || !inside(w2, v0, v1) {
+				continue
+			}
+			b0, b1, b2 := w0/area, w1/area, w2/area
+
+			// depth test
+			depth := cgm.Clamp(b0*v0.z+b1*v1.z+b2*v2.z, 0, 1)
+			if rasterizer.DepthTest && rasterizer.depth != nil {
+				if !rasterizer.depthTest(depth, rasterizer.depth.GetFloat32(x, y, 0)) {
+					continue
+				}
+			}
+
+			// perspective correct interpolation of the attributes
+			p0, p1, p2 := b0*v0.invW, b1*v1.invW, b2*v2.invW
+			norm := 1 / (p0 + p1 + p2)
+			p0, p1, p2 = p0*norm, p1*norm, p2*norm
+			for i := range fragment.attributes {
+				fragment.attributes[i] = p0*v0.attributes[i] + p1*v1.attributes[i] + p2*v2.attributes[i]
+			}
+
+			fragment.X, fragment.Y = x, y
+			fragment.Depth = depth
+			for i := range out {
+				out[i] = mgl32.Vec4{}
+			}
+			if !shader(fragment, out) {
+				continue
+			}
+
+			// like in OpenGL the depth is only written if the depth test is
+			// enabled
+			if rasterizer.DepthTest && rasterizer.DepthMask && rasterizer.depth != nil {
+				rasterizer.depth.SetFloat32(x, y, 0, depth)
+			}
+			for i, color := range rasterizer.colors {
+				if color == nil {
+					continue
+				}
+				for c := 0; c < cgm.Mini(color.GetChannels(), 4); c++ {
+					color.SetFloat32(x, y, c, out[i][c])
+				}
+			}
+		}
+	}
+}
+
+// edge returns twice the signed area of the triangle (a,b,p), which is
+// positive if p lies on the inner side of the edge from a to b.
+func edge(a, b screenVertex, px, py float32) float32 {
+	return (b.x-a.x)*(py-a.y) - (b.y-a.y)*(px-a.x)
+}
+
+// inside returns true if the pixel center with the edge function value w lies
+// inside the triangle with respect to the edge from a to b. Centers exactly
+// on the edge are only inside for top and left edges. Since the y-axis points
+// down and the triangle is oriented clockwise on the screen, left edges point
+// up and top edges point right.
+func inside(w float32, a, b screenVertex) bool {
+	if w != 0 {
+		return w > 0
+	}
+	return b.y < a.y || (b.y == a.y && b.x > a.x)
+}
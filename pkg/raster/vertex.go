@@ -0,0 +1,131 @@
+package raster
+
+import (
+	"github.com/adrianderstroff/pbr/pkg/view/mesh"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// vertex in clip space with the values of all vertex attributes in the order
+// of the layout of the geometry.
+type vertex struct {
+	clip       mgl32.Vec4
+	attributes []float32
+}
+
+// screenVertex is a vertex after the perspective division and the viewport
+// transformation. x and y are in pixels with the origin at the top left
+// corner of the viewport, z is the window space depth and invW the
+// reciprocal of the clip space w, which is used for perspective correct
+// interpolation.
+type screenVertex struct {
+	x, y, z    float32
+	ndcX, ndcY float32
+	invW       float32
+	attributes []float32
+}
+
+// makeVertices transforms the pos attribute of the geometry into clip space
+// and collects the values of all attributes of each vertex.
+func makeVertices(geometry *mesh.Geometry, mvp mgl32.Mat4) ([]vertex, []mesh.VertexAttribute, error) {
+	positions, count, err := geometry.Attribute("pos")
+	if err != nil {
+		return nil, nil, err
+	}
+	vertices := make([]vertex, len(positions)/count)
+	stride := 0
+	for _, attrib := range geometry.Layout {
+		stride += int(attrib.Count)
+	}
+	for i := range vertices {
+		vertices[i].attributes = make([]float32, 0, stride)
+	}
+
+	for _, attrib := range geometry.Layout {
+		data, count, err := geometry.Attribute(attrib.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := range vertices {
+			if (i+1)*count <= len(data) {
+				vertices[i].attributes = append(vertices[i].attributes, data[i*count:(i+1)*count]...)
+			} else {
+				vertices[i].attributes = append(vertices[i].attributes, make([]float32, count)...)
+			}
+		}
+	}
+
+	for i := range vertices {
+		var p mgl32.Vec3
+		copy(p[:], positions[i*count:(i+1)*count])
+		vertices[i].clip = mvp.Mul4x1(p.Vec4(1))
+	}
+
+	return vertices, geometry.Layout, nil
+}
+
+// clip clips the polygon against the near plane z = -w and the far plane
+// z = w in clip space. The attributes of new vertices are interpolated
+// linearly, which is correct in clip space. Clipping against the other planes
+// isn't necessary since the rasterized pixels are limited to the viewport.
+func clip(polygon []vertex) []vertex {
+	near := func(v vertex) float32 { return v.clip.Z() + v.clip.W() }
+	far := func(v vertex) float32 { return v.clip.W() - v.clip.Z() }
+	polygon = clipPlane(polygon, near)
+	return clipPlane(polygon, far)
+}
+
+// clipPlane keeps the part of the polygon where distance is not negative
+// using the algorithm of Sutherland and Hodgman.
+func clipPlane(polygon []vertex, distance func(v vertex) float32) []vertex {
+	var result []vertex
+	for i := range polygon {
+		a, b := polygon[i], polygon[(i+1)%len(polygon)]
+		da, db := distance(a), distance(b)
+		if da >= 0 {
+			result = append(result, a)
+		}
+		if (da >= 0) != (db >= 0) {
+			result = append(result, lerp(a, b, da/(da-db)))
+		}
+	}
+	return result
+}
+
+// lerp interpolates the clip space position and the attributes of a and b.
+func lerp(a, b vertex, t float32) vertex {
+	v := vertex{
+		clip:       a.clip.Add(b.clip.Sub(a.clip).Mul(t)),
+		attributes: make([]float32, len(a.attributes)),
+	}
+	for i := range v.attributes {
+		v.attributes[i] = a.attributes[i] + (b.attributes[i]-a.attributes[i])*t
+	}
+	return v
+}
+
+// toScreen applies the perspective division and the viewport transformation
+// with the default depth range [0,1].
+func (rasterizer *Rasterizer) toScreen(v vertex) screenVertex {
+	invW := 1 / v.clip.W()
+	ndc := v.clip.Vec3().Mul(invW)
+	return screenVertex{
+		x:          (ndc.X() + 1) / 2 * float32(rasterizer.width),
+		y:          (1 - ndc.Y()) / 2 * float32(rasterizer.height),
+		z:          (ndc.Z() + 1) / 2,
+		ndcX:       ndc.X(),
+		ndcY:       ndc.Y(),
+		invW:       invW,
+		attributes: v.attributes,
+	}
+}
+
+// signedArea returns twice the area of the polygon in normalized device
+// coordinates, which is positive for counter clockwise polygons.
+func signedArea(polygon []screenVertex) float32 {
+	var area float32
+	for i := range polygon {
+		a, b := polygon[i], polygon[(i+1)%len(polygon)]
+		area += a.ndcX*b.ndcY - b.ndcX*a.ndcY
+	}
+	return area
+}
@@ -0,0 +1,154 @@
+package sampling
+
+import (
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+)
+
+// BLUE_NOISE_SIGMA is the standard deviation of the gaussian filter that
+// measures the clustering of the pixels, as proposed by Ulichney.
+const BLUE_NOISE_SIGMA = 1.5
+
+// fraction of the pixels that are set in the initial binary pattern
+const initialDensity = 0.1
+
+// MakeBlueNoise creates a tileable size x size blue noise threshold map with
+// the void-and-cluster method of Ulichney "The void-and-cluster method for
+// dither array generation". Each pixel gets a unique rank which is returned
+// as a value in [0,1) in row-major order. The seed determines the initial
+// random pattern.
+func MakeBlueNoise(size int, seed uint64) []float32 {
+	vc := makeVoidAndCluster(size)
+	n := size * size
+
+	// place the initial points at random positions
+	rng := MakeDefaultPCG(seed)
+	ones := int(math.Max(1, math.Floor(initialDensity*float64(n))))
+	for count := 0; count < ones; {
+		p := rng.Intn(n)
+		if !vc.pattern[p] {
+			vc.set(p, true)
+			count++
+		}
+	}
+
+	// move points from the tightest clusters into the largest voids until the
+	// pattern is evenly distributed
+	for {
+		cluster := vc.tightestCluster()
+		vc.set(cluster, false)
+		void := vc.largestVoid()
+		if void == cluster {
+			vc.set(cluster, true)
+			break
+		}
+		vc.set(void, true)
+	}
+	prototype := vc.copy()
+	ranks := make([]int, n)
+
+	// phase 1: rank the initial points by removing the tightest clusters
+	for rank := ones - 1; rank >= 0; rank-- {
+		cluster := vc.tightestCluster()
+		vc.set(cluster, false)
+		ranks[cluster] = rank
+	}
+
+	// phase 2 and 3: rank the remaining pixels by filling the largest voids.
+	// since the filter sums up to the same value everywhere, the tightest
+	// cluster of the unset pixels is the largest void of the set pixels.
+	vc = prototype
+	for rank := ones; rank < n; rank++ {
+		void := vc.largestVoid()
+		vc.set(void, true)
+		ranks[void] = rank
+	}
+
+	values := make([]float32, n)
+	for i, rank := range ranks {
+		values[i] = (float32(rank) + 0.5) / float32(n)
+	}
+	return values
+}
+
+// voidAndCluster holds the binary pattern and the energy of each pixel,
+// which is the sum of the gaussian filter of all set pixels with toroidal
+// wrap around.
+type voidAndCluster struct {
+	size    int
+	pattern []bool
+	energy  []float64
+	kernel  []float64
+}
+
+// makeVoidAndCluster creates an empty pattern and precomputes the filter for
+// all toroidal offsets.
+func makeVoidAndCluster(size int) voidAndCluster {
+	kernel := make([]float64, size*size)
+	for dy := 0; dy < size; dy++ {
+		for dx := 0; dx < size; dx++ {
+			x := float64(cgm.Mini(dx, size-dx))
+			y := float64(cgm.Mini(dy, size-dy))
+			kernel[dy*size+dx] = math.Exp(-(x*x + y*y) / (2 * BLUE_NOISE_SIGMA * BLUE_NOISE_SIGMA))
+		}
+	}
+
+	return voidAndCluster{
+		size:    size,
+		pattern: make([]bool, size*size),
+		energy:  make([]float64, size*size),
+		kernel:  kernel,
+	}
+}
+
+// set sets or clears the pixel p and updates the energy of all pixels.
+func (vc *voidAndCluster) set(p int, value bool) {
+	if vc.pattern[p] == value {
+		return
+	}
+	vc.pattern[p] = value
+	sign := 1.0
+	if !value {
+		sign = -1.0
+	}
+
+	px, py := p%vc.size, p/vc.size
+	for y := 0; y < vc.size; y++ {
+		dy := (y - py + vc.size) % vc.size
+		for x := 0; x < vc.size; x++ {
+			dx := (x - px + vc.size) % vc.size
+			vc.energy[y*vc.size+x] += sign * vc.kernel[dy*vc.size+dx]
+		}
+	}
+}
+
+// tightestCluster returns the set pixel with the highest energy.
+func (vc *voidAndCluster) tightestCluster() int {
+	best, energy := -1, math.Inf(-1)
+	for p, set := range vc.pattern {
+		if set && vc.energy[p] > energy {
+			best, energy = p, vc.energy[p]
+		}
+	}
+	return best
+}
+
+// largestVoid returns the unset pixel with the lowest energy.
+func (vc *voidAndCluster) largestVoid() int {
+	best, energy := -1, math.Inf(1)
+	for p, set := range vc.pattern {
+		if !set && vc.energy[p] < energy {
+			best, energy = p, vc.energy[p]
+		}
+	}
+	return best
+}
+
+// copy returns a deep copy of the pattern and the energy.
+func (vc *voidAndCluster) copy() voidAndCluster {
+	c := *vc
+	c.pattern = append([]bool(nil), vc.pattern...)
+	c.energy = append([]float64(nil), vc.energy...)
+	return c
+}
@@ -0,0 +1,83 @@
+package sampling
+
+import (
+	"fmt"
+
+	"github.com/adrianderstroff/pbr/pkg/buffer/ssbo"
+	"github.com/adrianderstroff/pbr/pkg/core/gl"
+	"github.com/adrianderstroff/pbr/pkg/view/texture"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// byte size of a vec2 in a shader storage buffer with std430 layout
+const VEC2_SIZE = 8
+
+// texture formats by number of channels
+var formats = []uint32{gl.RED, gl.RG, gl.RGB, gl.RGBA}
+
+// MakeWhiteNoiseTexture creates a texture of the specified dimensions with
+// uniformly distributed random values in each of the channels.
+func MakeWhiteNoiseTexture(width, height, channels int, rng *PCG) (texture.Texture, error) {
+	if channels < 1 || channels > 4 {
+		return texture.Texture{}, fmt.Errorf("number of channels has to be in [1,4], got %v", channels)
+	}
+
+	data := make([]uint8, width*height*channels)
+	for i := range data {
+		data[i] = uint8(rng.Intn(256))
+	}
+
+	return texture.MakeFromData(data, width, height, int32(formats[channels-1]), formats[channels-1])
+}
+
+// MakeBlueNoiseTexture creates a tileable size x size blue noise texture.
+// Each channel is an independent blue noise threshold map of MakeBlueNoise
+// seeded with seed plus the channel index.
+func MakeBlueNoiseTexture(size, channels int, seed uint64) (texture.Texture, error) {
+	if channels < 1 || channels > 4 {
+		return texture.Texture{}, fmt.Errorf("number of channels has to be in [1,4], got %v", channels)
+	}
+
+	data := make([]uint8, size*size*channels)
+	for c := 0; c < channels; c++ {
+		values := MakeBlueNoise(size, seed+uint64(c))
+		for i, v := range values {
+			data[i*channels+c] = uint8(v * 256)
+		}
+	}
+
+	tex, err := texture.MakeFromData(data, size, size, int32(formats[channels-1]), formats[channels-1])
+	if err != nil {
+		return texture.Texture{}, err
+	}
+	tex.SetWrap2D(gl.REPEAT, gl.REPEAT)
+	return tex, nil
+}
+
+// MakePoints returns the first n points of the two dimensional sequence as
+// interleaved x and y coordinates, e.g. MakePoints(64, R2).
+func MakePoints(n int, sequence func(i uint32) mgl32.Vec2) []float32 {
+	data := make([]float32, 2*n)
+	for i := 0; i < n; i++ {
+		p := sequence(uint32(i))
+		data[2*i] = p.X()
+		data[2*i+1] = p.Y()
+	}
+	return data
+}
+
+// MakeHammersleyPoints returns the n points of the Hammersley set as
+// interleaved x and y coordinates.
+func MakeHammersleyPoints(n int) []float32 {
+	return MakePoints(n, func(i uint32) mgl32.Vec2 {
+		return HammersleySampling(i, uint32(n))
+	})
+}
+
+// MakePointsSSBO uploads the interleaved points into a shader storage buffer
+// that can be read as an array of vec2.
+func MakePointsSSBO(points []float32) ssbo.SSBO {
+	buffer := ssbo.Make(VEC2_SIZE, len(points)/2)
+	buffer.UploadArray(points)
+	return buffer
+}
@@ -0,0 +1,92 @@
+// Package sampling provides deterministic random number generators,
+// low-discrepancy sequences, blue noise and warping functions that map
+// uniform samples onto the distributions used for Monte Carlo integration.
+// The sequences can be uploaded as textures or shader storage buffers such
+// that the shaders use the same samples as the CPU side.
+package sampling
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// constants of the PCG-XSH-RR generator
+const (
+	pcgMultiplier uint64 = 6364136223846793005
+	pcgIncrement  uint64 = 1442695040888963407
+)
+
+// PCG is the PCG-XSH-RR random number generator of O'Neill "PCG: A Family of
+// Simple Fast Space-Efficient Statistically Good Algorithms for Random Number
+// Generation". It has 64 bits of state and produces 32 bit numbers. Different
+// streams of the same seed are independent of each other.
+type PCG struct {
+	state uint64
+	inc   uint64
+}
+
+// MakePCG creates a generator with the specified seed and stream.
+func MakePCG(seed, stream uint64) PCG {
+	pcg := PCG{
+		state: 0,
+		inc:   (stream << 1) | 1,
+	}
+	pcg.Uint32()
+	pcg.state += seed
+	pcg.Uint32()
+	return pcg
+}
+
+// MakeDefaultPCG creates a generator with the specified seed on the default
+// stream.
+func MakeDefaultPCG(seed uint64) PCG {
+	return MakePCG(seed, pcgIncrement>>1)
+}
+
+// Uint32 returns the next uniformly distributed 32 bit number.
+func (pcg *PCG) Uint32() uint32 {
+	old := pcg.state
+	pcg.state = old*pcgMultiplier + pcg.inc
+	xorshifted := uint32(((old >> 18) ^ old) >> 27)
+	rot := uint32(old >> 59)
+	return (xorshifted >> rot) | (xorshifted << ((-rot) & 31))
+}
+
+// Intn returns a uniformly distributed number in [0,n) without modulo bias.
+func (pcg *PCG) Intn(n int) int {
+	bound := uint32(n)
+	threshold := -bound % bound
+	for {
+		r := pcg.Uint32()
+		if r >= threshold {
+			return int(r % bound)
+		}
+	}
+}
+
+// Float32 returns a uniformly distributed number in [0,1).
+func (pcg *PCG) Float32() float32 {
+	// use the upper 24 bits to be exactly representable
+	return float32(pcg.Uint32()>>8) * (1.0 / (1 << 24))
+}
+
+// Vec2 returns two uniformly distributed numbers in [0,1).
+func (pcg *PCG) Vec2() mgl32.Vec2 {
+	return mgl32.Vec2{pcg.Float32(), pcg.Float32()}
+}
+
+// Float32Slice returns a slice of n uniformly distributed numbers in [0,1).
+func (pcg *PCG) Float32Slice(n int) []float32 {
+	data := make([]float32, n)
+	for i := range data {
+		data[i] = pcg.Float32()
+	}
+	return data
+}
+
+// Hash mirrors PcgHash of random.glsl. It is a stateless hash with the
+// quality of a single PCG step, which is useful to seed generators per pixel.
+func Hash(v uint32) uint32 {
+	state := v*747796405 + 2891336453
+	word := ((state >> ((state >> 28) + 4)) ^ state) * 277803737
+	return (word >> 22) ^ word
+}
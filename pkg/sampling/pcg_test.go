@@ -0,0 +1,68 @@
+package sampling
+
+import "testing"
+
+const (
+	PCG_SAMPLES = 10000
+	PCG_BOUND   = 7
+)
+
+// the generator matches the reference implementation pcg32_srandom_r of
+// O'Neill for the seed 42 and the stream 54
+func TestPCGReference(t *testing.T) {
+	expected := []uint32{0xa15c02b7, 0x7b47f409, 0xba1d3330, 0x83d2f293, 0xbfa4784b, 0xcbed606e}
+	pcg := MakePCG(42, 54)
+	for i, e := range expected {
+		if r := pcg.Uint32(); r != e {
+			t.Errorf("number %v: expected %#x, got %#x", i, e, r)
+		}
+	}
+}
+
+// the same seed and stream reproduce the same numbers while other seeds or
+// streams don't
+func TestPCGDeterminism(t *testing.T) {
+	a, b := MakeDefaultPCG(7), MakeDefaultPCG(7)
+	otherSeed, otherStream := MakeDefaultPCG(8), MakePCG(7, 1)
+	sameSeed, sameStream := 0, 0
+	for i := 0; i < PCG_SAMPLES; i++ {
+		r := a.Uint32()
+		if r != b.Uint32() {
+			t.Fatalf("number %v differs for the same seed", i)
+		}
+		if r == otherSeed.Uint32() {
+			sameSeed++
+		}
+		if r == otherStream.Uint32() {
+			sameStream++
+		}
+	}
+	if sameSeed > 1 || sameStream > 1 {
+		t.Errorf("expected different sequences, got %v equal numbers for another seed and %v for another stream",
+			sameSeed, sameStream)
+	}
+}
+
+// the floats lie in [0,1) and the integers in [0,n)
+func TestPCGRange(t *testing.T) {
+	pcg := MakeDefaultPCG(1)
+	counts := make([]int, PCG_BOUND)
+	for i := 0; i < PCG_SAMPLES; i++ {
+		if f := pcg.Float32(); f < 0 || f >= 1 {
+			t.Fatalf("float %v lies outside of [0,1)", f)
+		}
+		n := pcg.Intn(PCG_BOUND)
+		if n < 0 || n >= PCG_BOUND {
+			t.Fatalf("integer %v lies outside of [0,%v)", n, PCG_BOUND)
+		}
+		counts[n]++
+	}
+
+	// each integer is drawn roughly equally often
+	expected := PCG_SAMPLES / PCG_BOUND
+	for n, c := range counts {
+		if c < expected*9/10 || c > expected*11/10 {
+			t.Errorf("integer %v was drawn %v times, expected about %v", n, c, expected)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package sampling
+
+import (
+	"math"
+	"math/bits"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// first prime numbers used as the bases of the halton sequence
+var primes = []uint32{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53}
+
+// HALTON_DIMENSIONS is the number of supported dimensions of Halton.
+var HALTON_DIMENSIONS = len(primes)
+
+// the plastic number which is the basis of the R2 sequence
+const plastic = 1.32471795724474602596
+
+// largest float32 smaller than 1
+const oneMinusEpsilon float32 = 0x1.fffffep-1
+
+// RadicalInverseVanDerCorpus is an efficient implementation that computes a
+// one-dimensional low discrepancy sequence over the unit interval. It mirrors
+// the function of the same name in random.glsl.
+func RadicalInverseVanDerCorpus(bits uint32) float32 {
+	bits = (bits << 16) | (bits >> 16)
+	bits = ((bits & 0x55555555) << 1) | ((bits & 0xAAAAAAAA) >> 1)
+	bits = ((bits & 0x33333333) << 2) | ((bits & 0xCCCCCCCC) >> 2)
+	bits = ((bits & 0x0F0F0F0F) << 4) | ((bits & 0xF0F0F0F0) >> 4)
+	bits = ((bits & 0x00FF00FF) << 8) | ((bits & 0xFF00FF00) >> 8)
+	return float32(float64(bits) * 2.3283064365386963e-10)
+}
+
+// HammersleySampling returns the i-th low discrepancy sample from a set of N
+// samples. It mirrors the function of the same name in random.glsl.
+func HammersleySampling(i, N uint32) mgl32.Vec2 {
+	return mgl32.Vec2{float32(i) / float32(N), RadicalInverseVanDerCorpus(i)}
+}
+
+// RadicalInverse mirrors the digits of i in the specified base at the
+// decimal point.
+func RadicalInverse(i, base uint32) float32 {
+	inv := 1 / float64(base)
+	factor := inv
+	result := float64(0)
+	for i > 0 {
+		result += float64(i%base) * factor
+		i /= base
+		factor *= inv
+	}
+	return float32(math.Min(result, float64(oneMinusEpsilon)))
+}
+
+// Halton returns the dimension dim of the i-th point of the Halton sequence,
+// which uses the radical inverse in the dim-th prime base. dim has to be
+// smaller than HALTON_DIMENSIONS.
+func Halton(i uint32, dim int) float32 {
+	return RadicalInverse(i, primes[dim])
+}
+
+// Halton2D returns the first two dimensions of the i-th point of the Halton
+// sequence.
+func Halton2D(i uint32) mgl32.Vec2 {
+	return mgl32.Vec2{Halton(i, 0), Halton(i, 1)}
+}
+
+// R2 returns the i-th point of the additive recurrence of Roberts "The
+// Unreasonable Effectiveness of Quasirandom Sequences" based on the plastic
+// number. It mirrors R2Sequence of random.glsl.
+func R2(i uint32) mgl32.Vec2 {
+	a1 := 1 / plastic
+	a2 := 1 / (plastic * plastic)
+	x := math.Mod(0.5+a1*float64(i), 1)
+	y := math.Mod(0.5+a2*float64(i), 1)
+	return mgl32.Vec2{float32(x), float32(y)}
+}
+
+// sobolParameters holds the degree s, the coefficients a of the primitive
+// polynomial and the initial direction numbers m of each dimension of the
+// sobol sequence after the first, taken from Joe and Kuo "Constructing Sobol
+// Sequences with Better Two-Dimensional Projections".
+var sobolParameters = []struct {
+	s uint
+	a uint32
+	m []uint32
+}{
+	{1, 0, []uint32{1}},
+	{2, 1, []uint32{1, 3}},
+	{3, 1, []uint32{1, 3, 1}},
+	{3, 2, []uint32{1, 1, 1}},
+	{4, 1, []uint32{1, 1, 3, 3}},
+	{4, 4, []uint32{1, 3, 5, 13}},
+	{5, 2, []uint32{1, 1, 5, 5, 17}},
+}
+
+// SOBOL_DIMENSIONS is the number of supported dimensions of Sobol.
+var SOBOL_DIMENSIONS = len(sobolParameters) + 1
+
+// direction numbers of each dimension
+var sobolDirections = makeSobolDirections()
+
+// makeSobolDirections calculates the 32 direction numbers of each dimension.
+// The first dimension is the van der corput sequence.
+func makeSobolDirections() [][32]uint32 {
+	directions := make([][32]uint32, SOBOL_DIMENSIONS)
+	for k := 0; k < 32; k++ {
+		directions[0][k] = 1 << uint(31-k)
+	}
+
+	for d, params := range sobolParameters {
+		v := &directions[d+1]
+		s := int(params.s)
+		for k := 0; k < 32; k++ {
+			if k < s {
+				v[k] = params.m[k] << uint(31-k)
+				continue
+			}
+			v[k] = v[k-s] ^ (v[k-s] >> uint(s))
+			for j := 1; j < s; j++ {
+				if (params.a>>uint(s-1-j))&1 == 1 {
+					v[k] ^= v[k-j]
+				}
+			}
+		}
+	}
+	return directions
+}
+
+// sobolBits returns the dimension dim of the i-th point of the sobol
+// sequence as a 32 bit fixed point number.
+func sobolBits(i uint32, dim int) uint32 {
+	result := uint32(0)
+	for k := 0; i != 0; i, k = i>>1, k+1 {
+		if i&1 == 1 {
+			result ^= sobolDirections[dim][k]
+		}
+	}
+	return result
+}
+
+// Sobol returns the dimension dim of the i-th point of the Sobol sequence.
+// dim has to be smaller than SOBOL_DIMENSIONS.
+func Sobol(i uint32, dim int) float32 {
+	return bitsToFloat(sobolBits(i, dim))
+}
+
+// Sobol2D returns the first two dimensions of the i-th point of the Sobol
+// sequence, which form a (0,2)-sequence in base 2.
+func Sobol2D(i uint32) mgl32.Vec2 {
+	return mgl32.Vec2{Sobol(i, 0), Sobol(i, 1)}
+}
+
+// OwenScrambledSobol returns the dimension dim of the i-th point of the Sobol
+// sequence with nested uniform scrambling following Burley "Practical
+// Hash-based Owen Scrambling". The index is shuffled as well, thus each seed
+// yields a different but equally well distributed sequence.
+func OwenScrambledSobol(i uint32, dim int, seed uint32) float32 {
+	index := nestedUniformScramble(i, Hash(seed))
+	x := sobolBits(index, dim)
+	return bitsToFloat(nestedUniformScramble(x, Hash(seed^Hash(uint32(dim)+1))))
+}
+
+// OwenScrambledSobol2D returns the first two dimensions of the i-th point of
+// the scrambled Sobol sequence.
+func OwenScrambledSobol2D(i, seed uint32) mgl32.Vec2 {
+	return mgl32.Vec2{OwenScrambledSobol(i, 0, seed), OwenScrambledSobol(i, 1, seed)}
+}
+
+// laineKarrasPermutation is a hash that only lets lower bits affect higher
+// bits, which turns it into an owen scramble when applied to reversed bits.
+func laineKarrasPermutation(x, seed uint32) uint32 {
+	x += seed
+	x ^= x * 0x6c50b47c
+	x ^= x * 0xb82f1e52
+	x ^= x * 0xc7afe638
+	x ^= x * 0x8d22f6e6
+	return x
+}
+
+// nestedUniformScramble applies an owen scramble to the 32 bit fixed point
+// number x.
+func nestedUniformScramble(x, seed uint32) uint32 {
+	return bits.Reverse32(laineKarrasPermutation(bits.Reverse32(x), seed))
+}
+
+// bitsToFloat maps the 32 bit fixed point number onto [0,1).
+func bitsToFloat(x uint32) float32 {
+	return float32(math.Min(float64(x)*2.3283064365386963e-10, float64(oneMinusEpsilon)))
+}
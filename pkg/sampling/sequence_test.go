@@ -0,0 +1,86 @@
+package sampling
+
+import (
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	NET_LOG2 = 8
+	NET_SIZE = 1 << NET_LOG2
+)
+
+// the first 2^m points of every dimension of the sobol sequence hit each of
+// the 2^m intervals of length 2^-m exactly once, which is preserved by the
+// owen scrambling
+func TestSobolStratification1D(t *testing.T) {
+	for dim := 0; dim < SOBOL_DIMENSIONS; dim++ {
+		checkStrata1D(t, "sobol", dim, func(i uint32) float32 { return Sobol(i, dim) })
+		checkStrata1D(t, "owen", dim, func(i uint32) float32 { return OwenScrambledSobol(i, dim, 3) })
+	}
+}
+
+// the first 2^m points of the first two dimensions of the sobol sequence form
+// a (0,m,2)-net, thus every elementary interval of area 2^-m contains exactly
+// one point
+func TestSobolStratification2D(t *testing.T) {
+	checkNet(t, "sobol", Sobol2D)
+	for _, seed := range []uint32{0, 1, 1234} {
+		checkNet(t, "owen", func(i uint32) mgl32.Vec2 { return OwenScrambledSobol2D(i, seed) })
+	}
+}
+
+// different seeds of the owen scrambling yield different points
+func TestOwenScrambling(t *testing.T) {
+	same := 0
+	for i := uint32(0); i < NET_SIZE; i++ {
+		if OwenScrambledSobol2D(i, 1) == OwenScrambledSobol2D(i, 2) {
+			same++
+		}
+	}
+	if same > 1 {
+		t.Errorf("expected different points for different seeds, got %v equal points", same)
+	}
+}
+
+// checkStrata1D checks that the first NET_SIZE values of the sequence lie in
+// different intervals of length 1/NET_SIZE.
+func checkStrata1D(t *testing.T, name string, dim int, sequence func(i uint32) float32) {
+	hit := make([]bool, NET_SIZE)
+	for i := uint32(0); i < NET_SIZE; i++ {
+		x := sequence(i)
+		if x < 0 || x >= 1 {
+			t.Errorf("%v dimension %v: value %v lies outside of [0,1)", name, dim, x)
+			return
+		}
+		cell := int(x * NET_SIZE)
+		if hit[cell] {
+			t.Errorf("%v dimension %v: interval %v contains more than one point", name, dim, cell)
+			return
+		}
+		hit[cell] = true
+	}
+}
+
+// checkNet checks that the first NET_SIZE points of the sequence form a
+// (0,NET_LOG2,2)-net.
+func checkNet(t *testing.T, name string, sequence func(i uint32) mgl32.Vec2) {
+	points := make([]mgl32.Vec2, NET_SIZE)
+	for i := range points {
+		points[i] = sequence(uint32(i))
+	}
+
+	for j := 0; j <= NET_LOG2; j++ {
+		cols, rows := 1<<uint(j), 1<<uint(NET_LOG2-j)
+		hit := make([]bool, NET_SIZE)
+		for _, p := range points {
+			cell := int(p.Y()*float32(rows))*cols + int(p.X()*float32(cols))
+			if hit[cell] {
+				t.Errorf("%v: elementary interval %v of %vx%v contains more than one point", name, cell, cols, rows)
+				return
+			}
+			hit[cell] = true
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package sampling
+
+import (
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// UniformDisk maps the sample xi onto a uniformly distributed point on the
+// unit disk using the concentric mapping of Shirley and Chiu, which preserves
+// the stratification of the samples.
+func UniformDisk(xi mgl32.Vec2) mgl32.Vec2 {
+	// map to [-1,1]^2
+	x := 2*xi.X() - 1
+	y := 2*xi.Y() - 1
+	if x == 0 && y == 0 {
+		return mgl32.Vec2{0, 0}
+	}
+
+	var r, theta float32
+	if cgm.Abs32(x) > cgm.Abs32(y) {
+		r, theta = x, math.Pi/4*(y/x)
+	} else {
+		r, theta = y, math.Pi/2-math.Pi/4*(x/y)
+	}
+	return mgl32.Vec2{r * cgm.Cos32(theta), r * cgm.Sin32(theta)}
+}
+
+// UniformDiskPdf returns the pdf of UniformDisk with respect to the area.
+func UniformDiskPdf() float32 {
+	return 1 / math.Pi
+}
+
+// UniformSphere maps the sample xi onto a uniformly distributed direction on
+// the unit sphere.
+func UniformSphere(xi mgl32.Vec2) mgl32.Vec3 {
+	z := 1 - 2*xi.Y()
+	r := cgm.Sqrt32(cgm.Max32(1-z*z, 0))
+	phi := 2 * math.Pi * xi.X()
+	return mgl32.Vec3{r * cgm.Cos32(phi), r * cgm.Sin32(phi), z}
+}
+
+// UniformSpherePdf returns the pdf of UniformSphere with respect to the solid
+// angle.
+func UniformSpherePdf() float32 {
+	return 1 / (4 * math.Pi)
+}
+
+// UniformHemisphere maps the sample xi onto a uniformly distributed direction
+// on the hemisphere around the z-axis.
+func UniformHemisphere(xi mgl32.Vec2) mgl32.Vec3 {
+	z := xi.Y()
+	r := cgm.Sqrt32(cgm.Max32(1-z*z, 0))
+	phi := 2 * math.Pi * xi.X()
+	return mgl32.Vec3{r * cgm.Cos32(phi), r * cgm.Sin32(phi), z}
+}
+
+// UniformHemispherePdf returns the pdf of UniformHemisphere with respect to
+// the solid angle.
+func UniformHemispherePdf() float32 {
+	return 1 / (2 * math.Pi)
+}
+
+// CosineHemisphere maps the sample xi onto a direction on the hemisphere
+// around the z-axis that is distributed according to the cosine of the angle
+// to the z-axis, by projecting a uniform point of the disk onto the
+// hemisphere.
+func CosineHemisphere(xi mgl32.Vec2) mgl32.Vec3 {
+	d := UniformDisk(xi)
+	z := cgm.Sqrt32(cgm.Max32(1-d.X()*d.X()-d.Y()*d.Y(), 0))
+	return mgl32.Vec3{d.X(), d.Y(), z}
+}
+
+// CosineHemispherePdf returns the pdf of CosineHemisphere for a direction
+// with the cosine cosTheta to the z-axis.
+func CosineHemispherePdf(cosTheta float32) float32 {
+	return cgm.Max32(cosTheta, 0) / math.Pi
+}
+
+// ImportanceSamplingGGX turns the sample xi into a half vector around the
+// normal n that is distributed according to the GGX normal distribution with
+// the roughness parameter a. It mirrors the function in random.glsl.
+func ImportanceSamplingGGX(xi mgl32.Vec2, n mgl32.Vec3, a float32) mgl32.Vec3 {
+	phi := 2 * math.Pi * xi.X()
+	cosTheta := cgm.Sqrt32((1 - xi.Y()) / (1 + (a*a-1)*xi.Y()))
+	sinTheta := cgm.Sqrt32(1 - cosTheta*cosTheta)
+
+	// spherical to cartesian coordinates
+	pos := mgl32.Vec3{
+		cgm.Cos32(phi) * sinTheta,
+		cgm.Sin32(phi) * sinTheta,
+		cosTheta,
+	}
+
+	return TangentToWorld(pos, n)
+}
+
+// GGXPdf returns the pdf of ImportanceSamplingGGX choosing the half vector
+// with the cosine nDotH to the normal with respect to the solid angle of the
+// half vector. Divide it by 4 (v.h) to get the pdf of the reflected direction.
+func GGXPdf(nDotH, a float32) float32 {
+	nDotH = cgm.Max32(nDotH, 0)
+	a2 := a * a
+	d := nDotH*nDotH*(a2-1) + 1
+	return a2 / (math.Pi * d * d) * nDotH
+}
+
+// TangentToWorld transforms the direction v from the tangent space around the
+// z-axis into the tangent space around the normal n. The tangent frame is the
+// one of ImportanceSamplingGGX in random.glsl.
+func TangentToWorld(v, n mgl32.Vec3) mgl32.Vec3 {
+	up := mgl32.Vec3{1, 0, 0}
+	if cgm.Abs32(n.Z()) < 0.999 {
+		up = mgl32.Vec3{0, 0, 1}
+	}
+	tangent := up.Cross(n).Normalize()
+	bitangent := n.Cross(tangent)
+
+	// calculate resulting direction
+	dir := tangent.Mul(v.X()).Add(bitangent.Mul(v.Y())).Add(n.Mul(v.Z()))
+	return dir.Normalize()
+}
@@ -0,0 +1,142 @@
+package sampling
+
+import (
+	"math"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	WARP_SAMPLES      = 1 << 18
+	Z_BINS            = 16
+	PHI_BINS          = 16
+	QUADRATURE_STEPS  = 64
+	HISTOGRAM_EPS     = 5e-2
+	NORMALIZATION_EPS = 1e-3
+	DIRECTION_EPS     = 1e-4
+)
+
+// the uniform disk covers the disk uniformly, thus the squared radius and the
+// angle are uniformly distributed
+func TestUniformDisk(t *testing.T) {
+	histogram := make([]float32, Z_BINS*PHI_BINS)
+	for i := uint32(0); i < WARP_SAMPLES; i++ {
+		p := UniformDisk(Sobol2D(i))
+		r2 := p.Dot(p)
+		if r2 > 1+DIRECTION_EPS {
+			t.Fatalf("point %v lies outside of the unit disk", p)
+		}
+		histogram[bin(r2, angle(p.X(), p.Y()))] += 1.0 / WARP_SAMPLES
+	}
+
+	// the pdf with respect to the area is 1/pi, thus each bin of the squared
+	// radius and the angle covers the same area pi/(Z_BINS*PHI_BINS)
+	expected := UniformDiskPdf() * math.Pi / (Z_BINS * PHI_BINS)
+	for i, p := range histogram {
+		if cgm.Abs32(p-expected) > HISTOGRAM_EPS*expected {
+			t.Errorf("bin %v: expected a probability of %v, got %v", i, expected, p)
+		}
+	}
+}
+
+func TestUniformSphere(t *testing.T) {
+	checkWarp(t, "uniform sphere", -1, UniformSphere, func(mgl32.Vec3) float32 {
+		return UniformSpherePdf()
+	})
+}
+
+func TestUniformHemisphere(t *testing.T) {
+	checkWarp(t, "uniform hemisphere", 0, UniformHemisphere, func(mgl32.Vec3) float32 {
+		return UniformHemispherePdf()
+	})
+}
+
+func TestCosineHemisphere(t *testing.T) {
+	checkWarp(t, "cosine hemisphere", 0, CosineHemisphere, func(dir mgl32.Vec3) float32 {
+		return CosineHemispherePdf(dir.Z())
+	})
+}
+
+func TestImportanceSamplingGGX(t *testing.T) {
+	n := mgl32.Vec3{0, 0, 1}
+	for _, a := range []float32{0.3, 0.5, 1} {
+		warp := func(xi mgl32.Vec2) mgl32.Vec3 { return ImportanceSamplingGGX(xi, n, a) }
+		checkWarp(t, "ggx", 0, warp, func(h mgl32.Vec3) float32 {
+			return GGXPdf(h.Z(), a)
+		})
+	}
+
+	// a tilted normal rotates the half vectors, which keeps their cosines to
+	// the normal
+	tilted := mgl32.Vec3{0.3, -0.5, 0.8}.Normalize()
+	for i := uint32(0); i < Z_BINS*PHI_BINS; i++ {
+		xi := Sobol2D(i)
+		expected := ImportanceSamplingGGX(xi, n, 0.5).Z()
+		h := ImportanceSamplingGGX(xi, tilted, 0.5)
+		if cgm.Abs32(h.Len()-1) > DIRECTION_EPS || cgm.Abs32(h.Dot(tilted)-expected) > DIRECTION_EPS {
+			t.Errorf("xi %v: expected a unit half vector with n.h = %v, got %v with n.h = %v", xi, expected, h, h.Dot(tilted))
+		}
+	}
+}
+
+// checkWarp bins the directions of the warp of sobol points by their z
+// coordinate in [zMin,1] and their angle around the z-axis and compares the
+// histogram with the probabilities of the bins, which are integrated from the
+// pdf with the midpoint rule using the solid angle dz dphi. The integrated
+// probabilities have to sum to 1.
+func checkWarp(t *testing.T, name string, zMin float32, warp func(xi mgl32.Vec2) mgl32.Vec3, pdf func(dir mgl32.Vec3) float32) {
+	histogram := make([]float32, Z_BINS*PHI_BINS)
+	for i := uint32(0); i < WARP_SAMPLES; i++ {
+		dir := warp(Sobol2D(i))
+		if cgm.Abs32(dir.Len()-1) > DIRECTION_EPS || dir.Z() < zMin-DIRECTION_EPS {
+			t.Errorf("%v: direction %v is not a unit vector of the domain", name, dir)
+			return
+		}
+		z := (dir.Z() - zMin) / (1 - zMin)
+		histogram[bin(z, angle(dir.X(), dir.Y()))] += 1.0 / WARP_SAMPLES
+	}
+
+	dz := (1 - zMin) / (Z_BINS * QUADRATURE_STEPS)
+	dphi := float32(2 * math.Pi / (PHI_BINS * QUADRATURE_STEPS))
+	total := float32(0)
+	for i := range histogram {
+		zBin, phiBin := i/PHI_BINS, i%PHI_BINS
+		expected := float32(0)
+		for s := 0; s < QUADRATURE_STEPS; s++ {
+			z := zMin + (float32(zBin*QUADRATURE_STEPS+s)+0.5)*dz
+			r := cgm.Sqrt32(1 - z*z)
+			for u := 0; u < QUADRATURE_STEPS; u++ {
+				phi := (float32(phiBin*QUADRATURE_STEPS+u) + 0.5) * dphi
+				expected += pdf(mgl32.Vec3{r * cgm.Cos32(phi), r * cgm.Sin32(phi), z}) * dz * dphi
+			}
+		}
+		total += expected
+
+		// bins with few samples are dominated by the discrepancy of the points
+		if cgm.Abs32(histogram[i]-expected) > HISTOGRAM_EPS*expected+2.0/WARP_SAMPLES {
+			t.Errorf("%v bin (%v,%v): expected a probability of %v, got %v", name, zBin, phiBin, expected, histogram[i])
+		}
+	}
+	if cgm.Abs32(total-1) > NORMALIZATION_EPS {
+		t.Errorf("%v: expected the pdf to integrate to 1, got %v", name, total)
+	}
+}
+
+// bin returns the index of the histogram bin of the value x in [0,1] and the
+// angle phi in [0,2pi).
+func bin(x, phi float32) int {
+	zBin := cgm.Mini(int(x*Z_BINS), Z_BINS-1)
+	phiBin := cgm.Mini(int(phi/(2*math.Pi)*PHI_BINS), PHI_BINS-1)
+	return cgm.Maxi(zBin, 0)*PHI_BINS + cgm.Maxi(phiBin, 0)
+}
+
+// angle returns the angle of the point (x,y) around the origin in [0,2pi).
+func angle(x, y float32) float32 {
+	phi := float32(math.Atan2(float64(y), float64(x)))
+	if phi < 0 {
+		phi += 2 * math.Pi
+	}
+	return phi
+}
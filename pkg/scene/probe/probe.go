@@ -0,0 +1,136 @@
+// Package probe provides reflection probes for image based lighting. A probe
+// is a cube map captured at a position in the scene. Reflections are
+// parallax corrected by projecting them onto a proxy box or sphere around the
+// capture position, and several probes are blended by their region of
+// influence. The probes are passed to the shaders as uniforms, see
+// assets/shaders/pbr/shared/probes.glsl.
+package probe
+
+import (
+	"fmt"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/core/shader"
+	"github.com/adrianderstroff/pbr/pkg/view/texture"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// MAX_PROBES is the number of probes that a shader supports. It matches
+// MAX_PROBES of probes.glsl.
+const MAX_PROBES = 4
+
+// CUBEMAP_BINDING is the texture unit of the cube map of the first probe. The
+// other probes use the consecutive units.
+const CUBEMAP_BINDING = 8
+
+// Probe is a reflection probe with the cube map captured at Position. The
+// weight of the probe is 1 inside of the influence volume shrunk by Blend and
+// fades to 0 towards the border of the influence volume. The reflections are
+// projected onto the proxy volume, which should approximate the surrounding
+// geometry.
+type Probe struct {
+	Position  mgl32.Vec3
+	Influence Volume
+	Proxy     Volume
+	Blend     float32
+	Cubemap   *texture.Texture
+}
+
+// Make creates a probe whose proxy is the same as its influence volume.
+func Make(position mgl32.Vec3, influence Volume, blend float32, cubemap *texture.Texture) Probe {
+	return Probe{
+		Position:  position,
+		Influence: influence,
+		Proxy:     influence,
+		Blend:     blend,
+		Cubemap:   cubemap,
+	}
+}
+
+// Weight returns the influence of the probe at the point p in [0,1].
+func (probe *Probe) Weight(p mgl32.Vec3) float32 {
+	d := probe.Influence.Distance(p)
+	if probe.Blend <= 0 {
+		if d >= 0 {
+			return 1
+		}
+		return 0
+	}
+	return cgm.Clamp(d/probe.Blend, 0, 1)
+}
+
+// LookupDirection returns the parallax corrected direction for looking up the
+// cube map of the probe when reflecting into direction dir at the point p. If
+// the ray misses the proxy volume the direction isn't corrected.
+func (probe *Probe) LookupDirection(p, dir mgl32.Vec3) mgl32.Vec3 {
+	t, hit := probe.Proxy.Intersect(p, dir)
+	if !hit {
+		return dir
+	}
+
+	lookup := p.Add(dir.Mul(t)).Sub(probe.Position)
+	if lookup.Len() == 0 {
+		return dir
+	}
+	return lookup.Normalize()
+}
+
+// Weights returns the blend weight of each probe at the point p. If the
+// weights sum up to more than 1 they are normalized, otherwise the remaining
+// weight belongs to the distant environment. It mirrors the blending of
+// probes.glsl.
+func Weights(probes []Probe, p mgl32.Vec3) []float32 {
+	weights := make([]float32, len(probes))
+	var sum float32
+	for i := range probes {
+		weights[i] = probes[i].Weight(p)
+		sum += weights[i]
+	}
+
+	if sum > 1 {
+		for i := range weights {
+			weights[i] /= sum
+		}
+	}
+	return weights
+}
+
+// Upload sets the uniforms of all probes in the shader, which has to be in
+// use. At most MAX_PROBES probes are supported.
+func Upload(s *shader.Shader, probes []Probe) error {
+	if len(probes) > MAX_PROBES {
+		return fmt.Errorf("too many probes, at most %v are supported", MAX_PROBES)
+	}
+
+	s.UpdateInt32("uProbeCount", int32(len(probes)))
+	for i, probe := range probes {
+		name := fmt.Sprintf("uProbes[%v].", i)
+		s.UpdateVec3(name+"position", probe.Position)
+		s.UpdateFloat32(name+"blend", probe.Blend)
+		uploadVolume(s, name+"influence.", &probe.Influence)
+		uploadVolume(s, name+"proxy.", &probe.Proxy)
+	}
+	return nil
+}
+
+// uploadVolume sets the uniforms of a ProbeVolume struct.
+func uploadVolume(s *shader.Shader, name string, volume *Volume) {
+	s.UpdateInt32(name+"shape", int32(volume.Shape))
+	s.UpdateVec3(name+"center", volume.Center)
+	s.UpdateVec3(name+"extent", volume.Extent)
+}
+
+// Bind binds the cube maps of the probes to consecutive texture units
+// starting at CUBEMAP_BINDING.
+func Bind(probes []Probe) {
+	for i := range probes {
+		probes[i].Cubemap.Bind(uint32(CUBEMAP_BINDING + i))
+	}
+}
+
+// Unbind unbinds the cube maps of the probes.
+func Unbind(probes []Probe) {
+	for i := range probes {
+		probes[i].Cubemap.Unbind()
+	}
+}
@@ -0,0 +1,130 @@
+package probe
+
+import (
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const TOLERANCE float32 = 1e-5
+
+func TestIntersectBox(t *testing.T) {
+	box := MakeBox(mgl32.Vec3{-1, -2, -3}, mgl32.Vec3{1, 2, 3})
+	cases := []struct {
+		name string
+		o    mgl32.Vec3
+		dir  mgl32.Vec3
+		t    float32
+		hit  bool
+	}{
+		{"inside x", mgl32.Vec3{0, 0, 0}, mgl32.Vec3{1, 0, 0}, 1, true},
+		{"inside -y", mgl32.Vec3{0, 0, 0}, mgl32.Vec3{0, -1, 0}, 2, true},
+		{"inside z", mgl32.Vec3{0, 0, 1}, mgl32.Vec3{0, 0, 1}, 2, true},
+		{"inside diagonal", mgl32.Vec3{0, 0, 0}, mgl32.Vec3{1, 1, 0}.Normalize(), cgm.Sqrt32(2), true},
+		{"outside towards", mgl32.Vec3{-5, 0, 0}, mgl32.Vec3{1, 0, 0}, 4, true},
+		{"outside away", mgl32.Vec3{-5, 0, 0}, mgl32.Vec3{-1, 0, 0}, 0, false},
+		{"outside miss", mgl32.Vec3{-5, 3, 0}, mgl32.Vec3{1, 0, 0}, 0, false},
+	}
+	for _, c := range cases {
+		d, hit := box.Intersect(c.o, c.dir)
+		if hit != c.hit {
+			t.Errorf("%v: expected hit %v, got %v", c.name, c.hit, hit)
+			continue
+		}
+		if hit && cgm.Abs32(d-c.t) > TOLERANCE {
+			t.Errorf("%v: expected a distance of %v, got %v", c.name, c.t, d)
+		}
+	}
+}
+
+func TestIntersectSphere(t *testing.T) {
+	sphere := MakeSphere(mgl32.Vec3{1, 0, 0}, 2)
+	cases := []struct {
+		name string
+		o    mgl32.Vec3
+		dir  mgl32.Vec3
+		t    float32
+		hit  bool
+	}{
+		{"center", mgl32.Vec3{1, 0, 0}, mgl32.Vec3{0, 1, 0}, 2, true},
+		{"inside", mgl32.Vec3{0, 0, 0}, mgl32.Vec3{1, 0, 0}, 3, true},
+		{"inside backwards", mgl32.Vec3{0, 0, 0}, mgl32.Vec3{-1, 0, 0}, 1, true},
+		{"outside towards", mgl32.Vec3{1, 0, -5}, mgl32.Vec3{0, 0, 1}, 3, true},
+		{"outside away", mgl32.Vec3{1, 0, -5}, mgl32.Vec3{0, 0, -1}, 0, false},
+		{"outside miss", mgl32.Vec3{1, 3, -5}, mgl32.Vec3{0, 0, 1}, 0, false},
+	}
+	for _, c := range cases {
+		d, hit := sphere.Intersect(c.o, c.dir)
+		if hit != c.hit {
+			t.Errorf("%v: expected hit %v, got %v", c.name, c.hit, hit)
+			continue
+		}
+		if hit && cgm.Abs32(d-c.t) > TOLERANCE {
+			t.Errorf("%v: expected a distance of %v, got %v", c.name, c.t, d)
+		}
+	}
+}
+
+// the weight is 1 deep inside of the influence volume and fades linearly to 0
+// within the blend distance to its border
+func TestWeight(t *testing.T) {
+	box := MakeBox(mgl32.Vec3{-2, -2, -2}, mgl32.Vec3{2, 2, 2})
+	probe := Make(mgl32.Vec3{0, 0, 0}, box, 1, nil)
+	cases := []struct {
+		p mgl32.Vec3
+		w float32
+	}{
+		{mgl32.Vec3{0, 0, 0}, 1},
+		{mgl32.Vec3{0.5, 0, 0}, 1},
+		{mgl32.Vec3{1.5, 0, 0}, 0.5},
+		{mgl32.Vec3{0, -1.75, 0}, 0.25},
+		{mgl32.Vec3{0, 0, 2}, 0},
+		{mgl32.Vec3{3, 0, 0}, 0},
+	}
+	for _, c := range cases {
+		if w := probe.Weight(c.p); cgm.Abs32(w-c.w) > TOLERANCE {
+			t.Errorf("point %v: expected a weight of %v, got %v", c.p, c.w, w)
+		}
+	}
+
+	// without blending the weight is a step at the border
+	probe.Blend = 0
+	if w := probe.Weight(mgl32.Vec3{1.9, 0, 0}); w != 1 {
+		t.Errorf("expected a weight of 1 inside, got %v", w)
+	}
+	if w := probe.Weight(mgl32.Vec3{2.1, 0, 0}); w != 0 {
+		t.Errorf("expected a weight of 0 outside, got %v", w)
+	}
+}
+
+// overlapping probes are normalized while a partial weight leaves the rest to
+// the distant environment
+func TestWeights(t *testing.T) {
+	left := Make(mgl32.Vec3{-1, 0, 0}, MakeSphere(mgl32.Vec3{-1, 0, 0}, 2), 1, nil)
+	right := Make(mgl32.Vec3{1, 0, 0}, MakeSphere(mgl32.Vec3{1, 0, 0}, 2), 1, nil)
+	probes := []Probe{left, right}
+
+	cases := []struct {
+		p       mgl32.Vec3
+		weights []float32
+	}{
+		// both probes have a weight of 1 and are normalized
+		{mgl32.Vec3{0, 0, 0}, []float32{0.5, 0.5}},
+		// left has a weight of 1 and right 0.5
+		{mgl32.Vec3{-0.5, 0, 0}, []float32{2.0 / 3.0, 1.0 / 3.0}},
+		// only right with a partial weight of 0.5, which isn't normalized
+		{mgl32.Vec3{2.5, 0, 0}, []float32{0, 0.5}},
+		// outside of both probes
+		{mgl32.Vec3{0, 5, 0}, []float32{0, 0}},
+	}
+	for _, c := range cases {
+		weights := Weights(probes, c.p)
+		for i := range weights {
+			if cgm.Abs32(weights[i]-c.weights[i]) > TOLERANCE {
+				t.Errorf("point %v: expected weights %v, got %v", c.p, c.weights, weights)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package probe
+
+import (
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Shapes of a volume. The values match PROBE_SHAPE_* of probes.glsl.
+const (
+	SHAPE_BOX    = 0
+	SHAPE_SPHERE = 1
+)
+
+// Volume is either an axis aligned box or a sphere. It is used for the region
+// of influence of a probe as well as the proxy geometry that the reflections
+// are projected onto.
+type Volume struct {
+	Shape  int
+	Center mgl32.Vec3
+	Extent mgl32.Vec3 // half size of the box or the radius of the sphere in x
+}
+
+// MakeBox creates an axis aligned box between min and max.
+func MakeBox(min, max mgl32.Vec3) Volume {
+	return Volume{
+		Shape:  SHAPE_BOX,
+		Center: min.Add(max).Mul(0.5),
+		Extent: max.Sub(min).Mul(0.5),
+	}
+}
+
+// MakeSphere creates a sphere with the specified center and radius.
+func MakeSphere(center mgl32.Vec3, radius float32) Volume {
+	return Volume{
+		Shape:  SHAPE_SPHERE,
+		Center: center,
+		Extent: mgl32.Vec3{radius, radius, radius},
+	}
+}
+
+// Distance returns the distance of the point p to the border of the volume.
+// It is positive inside and negative outside of the volume. For boxes the
+// distance outside is only a lower bound.
+func (volume *Volume) Distance(p mgl32.Vec3) float32 {
+	d := p.Sub(volume.Center)
+	if volume.Shape == SHAPE_SPHERE {
+		return volume.Extent.X() - d.Len()
+	}
+
+	dx := volume.Extent.X() - cgm.Abs32(d.X())
+	dy := volume.Extent.Y() - cgm.Abs32(d.Y())
+	dz := volume.Extent.Z() - cgm.Abs32(d.Z())
+	return cgm.Min32(dx, cgm.Min32(dy, dz))
+}
+
+// Contains returns true if the point p is inside of the volume.
+func (volume *Volume) Contains(p mgl32.Vec3) bool {
+	return volume.Distance(p) >= 0
+}
+
+// Intersect returns the distance along the ray with origin o and normalized
+// direction dir to the border of the volume. For rays starting inside of the
+// volume it is the distance to the exit point. The second return value is
+// false if the ray misses the volume or the volume lies behind the ray.
+func (volume *Volume) Intersect(o, dir mgl32.Vec3) (float32, bool) {
+	if volume.Shape == SHAPE_SPHERE {
+		return intersectSphere(volume.Center, volume.Extent.X(), o, dir)
+	}
+	return intersectBox(volume.Center.Sub(volume.Extent), volume.Center.Add(volume.Extent), o, dir)
+}
+
+// intersectBox intersects the ray with the slabs of the box. Divisions by zero
+// components of the direction yield infinities which the comparisons handle.
+func intersectBox(min, max, o, dir mgl32.Vec3) (float32, bool) {
+	tNear := float32(math.Inf(-1))
+	tFar := float32(math.Inf(1))
+	for i := 0; i < 3; i++ {
+		t0 := (min[i] - o[i]) / dir[i]
+		t1 := (max[i] - o[i]) / dir[i]
+		tNear = cgm.Max32(tNear, cgm.Min32(t0, t1))
+		tFar = cgm.Min32(tFar, cgm.Max32(t0, t1))
+	}
+
+	if tNear > tFar || tFar < 0 {
+		return 0, false
+	}
+	if tNear >= 0 {
+		return tNear, true
+	}
+	return tFar, true
+}
+
+// intersectSphere solves the quadratic equation of the ray and the sphere.
+func intersectSphere(center mgl32.Vec3, radius float32, o, dir mgl32.Vec3) (float32, bool) {
+	oc := o.Sub(center)
+	b := oc.Dot(dir)
+	c := oc.Dot(oc) - radius*radius
+	discriminant := b*b - c
+	if discriminant < 0 {
+		return 0, false
+	}
+
+	sq := cgm.Sqrt32(discriminant)
+	tNear, tFar := -b-sq, -b+sq
+	if tFar < 0 {
+		return 0, false
+	}
+	if tNear >= 0 {
+		return tNear, true
+	}
+	return tFar, true
+}
@@ -0,0 +1,115 @@
+package sh
+
+import (
+	"math"
+	"sync"
+
+	"github.com/adrianderstroff/pbr/pkg/envmap"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// ProjectCubemap projects the radiance of the cube map onto spherical
+// harmonics of the specified order. Each texel is weighted by its solid angle.
+func ProjectCubemap(cubemap *envmap.Cubemap, order int) (SH, error) {
+	result, err := Make(order)
+	if err != nil {
+		return SH{}, err
+	}
+
+	// project each face in parallel
+	faces := make([]SH, 6)
+	weights := make([]float64, 6)
+	var wg sync.WaitGroup
+	for f := 0; f < 6; f++ {
+		faces[f], _ = Make(order)
+		wg.Add(1)
+		go func(f int) {
+			defer wg.Done()
+			size := cubemap.GetSize()
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					dir := cubemap.TexelDirection(f, x, y)
+					solidAngle := cubemap.TexelSolidAngle(x, y)
+					faces[f].AddSample(dir, cubemap.GetTexel(f, x, y), solidAngle)
+					weights[f] += float64(solidAngle)
+				}
+			}
+		}(f)
+	}
+	wg.Wait()
+
+	var weight float64
+	for f := 0; f < 6; f++ {
+		result.Add(&faces[f])
+		weight += weights[f]
+	}
+
+	// compensate the numerical error of the solid angles
+	result.Scale(float32(4 * math.Pi / weight))
+	return result, nil
+}
+
+// ProjectEquirect projects the radiance of the equirectangular image onto
+// spherical harmonics of the specified order. Each pixel is weighted by its
+// solid angle.
+func ProjectEquirect(img *image2d.Image2D, order int) (SH, error) {
+	result, err := Make(order)
+	if err != nil {
+		return SH{}, err
+	}
+
+	w, h := img.GetWidth(), img.GetHeight()
+	var weight float64
+	for y := 0; y < h; y++ {
+		solidAngle := envmap.EquirectPixelSolidAngle(y, w, h)
+		for x := 0; x < w; x++ {
+			dir := envmap.EquirectPixelDirection(x, y, w, h)
+			result.AddSample(dir, pixelColor(img, x, y), solidAngle)
+			weight += float64(solidAngle)
+		}
+	}
+
+	result.Scale(float32(4 * math.Pi / weight))
+	return result, nil
+}
+
+// pixelColor returns the rgb color of the pixel, treating images with less
+// than 3 channels as gray scale.
+func pixelColor(img *image2d.Image2D, x, y int) mgl32.Vec3 {
+	if img.GetChannels() < 3 {
+		v := img.GetFloat32(x, y, 0)
+		return mgl32.Vec3{v, v, v}
+	}
+	return mgl32.Vec3{
+		img.GetFloat32(x, y, 0),
+		img.GetFloat32(x, y, 1),
+		img.GetFloat32(x, y, 2),
+	}
+}
+
+// MakeIrradianceCubemap evaluates the irradiance of the radiance coefficients
+// for the direction of each texel of a cube map with the specified size.
+func MakeIrradianceCubemap(radiance *SH, size int) (envmap.Cubemap, error) {
+	cubemap, err := envmap.MakeEmptyCubemap(size, 3)
+	if err != nil {
+		return envmap.Cubemap{}, err
+	}
+
+	irradiance := radiance.Convolve()
+	for f := 0; f < 6; f++ {
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				e := irradiance.Evaluate(cubemap.TexelDirection(f, x, y))
+				e = mgl32.Vec3{
+					float32(math.Max(float64(e.X()), 0)),
+					float32(math.Max(float64(e.Y()), 0)),
+					float32(math.Max(float64(e.Z()), 0)),
+				}
+				cubemap.SetTexel(f, x, y, e)
+			}
+		}
+	}
+
+	return cubemap, nil
+}
@@ -0,0 +1,160 @@
+// Package sh provides real spherical harmonics of up to order 3 that are used
+// to represent the diffuse irradiance of an environment map with only a few
+// coefficients.
+package sh
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// the order is the number of bands, thus order 3 contains the bands l=0,1,2
+const (
+	ORDER_2 = 2
+	ORDER_3 = 3
+)
+
+// convolution factors of the clamped cosine lobe for each band
+var cosineLobe = []float32{math.Pi, 2 * math.Pi / 3, math.Pi / 4}
+
+// SH stores the rgb coefficients of spherical harmonics of a specific order.
+// An order of n results in n*n coefficients.
+type SH struct {
+	Order  int          `json:"order"`
+	Coeffs []mgl32.Vec3 `json:"coefficients"`
+}
+
+// Make constructs spherical harmonics of the specified order with all
+// coefficients being zero.
+func Make(order int) (SH, error) {
+	if order != ORDER_2 && order != ORDER_3 {
+		return SH{}, errors.New("only spherical harmonics of order 2 and 3 are supported")
+	}
+	return SH{
+		Order:  order,
+		Coeffs: make([]mgl32.Vec3, order*order),
+	}, nil
+}
+
+// Basis evaluates the real spherical harmonics basis functions of the
+// specified order for the normalized direction dir.
+func Basis(order int, dir mgl32.Vec3) []float32 {
+	x, y, z := dir.X(), dir.Y(), dir.Z()
+
+	basis := make([]float32, order*order)
+	basis[0] = 0.282095
+	if order >= ORDER_2 {
+		basis[1] = 0.488603 * y
+		basis[2] = 0.488603 * z
+		basis[3] = 0.488603 * x
+	}
+	if order >= ORDER_3 {
+		basis[4] = 1.092548 * x * y
+		basis[5] = 1.092548 * y * z
+		basis[6] = 0.315392 * (3*z*z - 1)
+		basis[7] = 1.092548 * x * z
+		basis[8] = 0.546274 * (x*x - y*y)
+	}
+	return basis
+}
+
+// AddSample adds the radiance coming from the direction dir weighted by the
+// solid angle to the coefficients.
+func (sh *SH) AddSample(dir, radiance mgl32.Vec3, solidAngle float32) {
+	basis := Basis(sh.Order, dir)
+	for i, b := range basis {
+		sh.Coeffs[i] = sh.Coeffs[i].Add(radiance.Mul(b * solidAngle))
+	}
+}
+
+// Add adds the coefficients of other to the coefficients of sh. Both need to
+// be of the same order.
+func (sh *SH) Add(other *SH) {
+	for i := range sh.Coeffs {
+		sh.Coeffs[i] = sh.Coeffs[i].Add(other.Coeffs[i])
+	}
+}
+
+// Scale multiplies all coefficients with s.
+func (sh *SH) Scale(s float32) {
+	for i := range sh.Coeffs {
+		sh.Coeffs[i] = sh.Coeffs[i].Mul(s)
+	}
+}
+
+// Evaluate reconstructs the radiance in the direction dir.
+func (sh *SH) Evaluate(dir mgl32.Vec3) mgl32.Vec3 {
+	basis := Basis(sh.Order, dir)
+	result := mgl32.Vec3{0, 0, 0}
+	for i, b := range basis {
+		result = result.Add(sh.Coeffs[i].Mul(b))
+	}
+	return result
+}
+
+// Convolve returns the coefficients of the irradiance by convolving the
+// radiance with the clamped cosine lobe. Evaluating the result for a normal n
+// yields the irradiance E(n).
+func (sh *SH) Convolve() SH {
+	result := SH{
+		Order:  sh.Order,
+		Coeffs: make([]mgl32.Vec3, len(sh.Coeffs)),
+	}
+	for l := 0; l < sh.Order; l++ {
+		for m := -l; m <= l; m++ {
+			i := l*(l+1) + m
+			result.Coeffs[i] = sh.Coeffs[i].Mul(cosineLobe[l])
+		}
+	}
+	return result
+}
+
+// Irradiance returns the irradiance E(n) for the normalized normal n.
+func (sh *SH) Irradiance(n mgl32.Vec3) mgl32.Vec3 {
+	irradiance := sh.Convolve()
+	return irradiance.Evaluate(n)
+}
+
+// Float32Slice returns the coefficients as a flat slice of floats which can be
+// uploaded as a vec3 array uniform.
+func (sh *SH) Float32Slice() []float32 {
+	data := make([]float32, 0, len(sh.Coeffs)*3)
+	for _, c := range sh.Coeffs {
+		data = append(data, c.X(), c.Y(), c.Z())
+	}
+	return data
+}
+
+// SaveToPath writes the coefficients as json to the specified path.
+func (sh *SH) SaveToPath(path string) error {
+	data, err := json.MarshalIndent(sh, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// LoadFromPath reads coefficients that have been written with SaveToPath.
+func LoadFromPath(path string) (SH, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return SH{}, err
+	}
+
+	var sh SH
+	if err := json.Unmarshal(data, &sh); err != nil {
+		return SH{}, err
+	}
+	if sh.Order != ORDER_2 && sh.Order != ORDER_3 {
+		return SH{}, errors.New("only spherical harmonics of order 2 and 3 are supported")
+	}
+	if len(sh.Coeffs) != sh.Order*sh.Order {
+		return SH{}, errors.New("number of coefficients doesn't match the order")
+	}
+
+	return sh, nil
+}
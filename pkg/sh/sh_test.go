@@ -0,0 +1,215 @@
+package sh
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/envmap"
+	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	EQUIRECT_WIDTH  int     = 256
+	EQUIRECT_HEIGHT int     = 128
+	CUBEMAP_SIZE    int     = 32
+	TOLERANCE       float32 = 0.02
+)
+
+var normals = []mgl32.Vec3{
+	{0, 0, 1}, {0, 0, -1}, {1, 0, 0}, {0, -1, 0},
+	mgl32.Vec3{1, 1, 1}.Normalize(), mgl32.Vec3{-1, 0.5, -0.3}.Normalize(),
+}
+
+// a constant radiance of 1 results in an irradiance of pi for every normal
+func TestConstantEnvironment(t *testing.T) {
+	env := makeEquirect(t, func(dir mgl32.Vec3) float32 { return 1 })
+	for _, order := range []int{ORDER_2, ORDER_3} {
+		radiance, err := ProjectEquirect(&env, order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range normals {
+			e := radiance.Irradiance(n)
+			if cgm.Abs32(e.X()-math.Pi) > TOLERANCE*math.Pi {
+				t.Errorf("order %v normal %v: expected an irradiance of pi, got %v", order, n, e.X())
+			}
+		}
+	}
+}
+
+// the radiance max(0,z) results in an irradiance of 2pi/3 for the normal z, 2/3
+// for x and 0 for -z, which order 3 reconstructs up to the error of the
+// missing bands
+func TestCosineLobeEnvironment(t *testing.T) {
+	env := makeEquirect(t, func(dir mgl32.Vec3) float32 { return cgm.Max32(dir.Z(), 0) })
+	radiance, err := ProjectEquirect(&env, ORDER_3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the lobe is rotationally symmetric around z thus only the zonal
+	// coefficients are non-zero
+	expected := map[int]float32{
+		0: 0.282095 * math.Pi,
+		2: 0.488603 * 2 * math.Pi / 3,
+		6: 0.315392 * math.Pi / 2,
+	}
+	for i, c := range radiance.Coeffs {
+		if cgm.Abs32(c.X()-expected[i]) > 1e-2 {
+			t.Errorf("coefficient %v: expected %v, got %v", i, expected[i], c.X())
+		}
+	}
+
+	cases := []struct {
+		n mgl32.Vec3
+		e float32
+	}{
+		{mgl32.Vec3{0, 0, 1}, 2 * math.Pi / 3},
+		{mgl32.Vec3{0, 0, -1}, 0},
+		{mgl32.Vec3{1, 0, 0}, 2.0 / 3.0},
+	}
+	for _, c := range cases {
+		e := radiance.Irradiance(c.n)
+		if cgm.Abs32(e.X()-c.e) > 0.05 {
+			t.Errorf("normal %v: expected an irradiance of %v, got %v", c.n, c.e, e.X())
+		}
+	}
+}
+
+// a constant radiance of 1 projected from a cube map results in an irradiance
+// of pi for every normal
+func TestConstantCubemap(t *testing.T) {
+	env := makeCubemap(t, func(dir mgl32.Vec3) float32 { return 1 })
+	for _, order := range []int{ORDER_2, ORDER_3} {
+		radiance, err := ProjectCubemap(&env, order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range normals {
+			e := radiance.Irradiance(n)
+			if cgm.Abs32(e.X()-math.Pi) > TOLERANCE*math.Pi {
+				t.Errorf("order %v normal %v: expected an irradiance of pi, got %v", order, n, e.X())
+			}
+		}
+	}
+}
+
+// a radiance that is a single basis function of the first or second band
+// results in exactly one non-zero coefficient. since the texels of a cube map
+// cover different solid angles this only holds if each texel is weighted by
+// its solid angle.
+func TestSingleBandCubemap(t *testing.T) {
+	for i := 1; i < ORDER_3*ORDER_3; i++ {
+		env := makeCubemap(t, func(dir mgl32.Vec3) float32 { return Basis(ORDER_3, dir)[i] })
+		radiance, err := ProjectCubemap(&env, ORDER_3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, c := range radiance.Coeffs {
+			expected := float32(0)
+			if k == i {
+				expected = 1
+			}
+			if cgm.Abs32(c.X()-expected) > TOLERANCE {
+				t.Errorf("basis function %v: expected coefficient %v to be %v, got %v", i, k, expected, c.X())
+			}
+		}
+	}
+}
+
+// the cosine lobe projected from a cube map has the same zonal coefficients
+// as the one projected from an equirectangular image
+func TestCosineLobeCubemap(t *testing.T) {
+	lobe := func(dir mgl32.Vec3) float32 { return cgm.Max32(dir.Z(), 0) }
+	equirect := makeEquirect(t, lobe)
+	expected, err := ProjectEquirect(&equirect, ORDER_3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cubemap := makeCubemap(t, lobe)
+	radiance, err := ProjectCubemap(&cubemap, ORDER_3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range radiance.Coeffs {
+		if cgm.Abs32(radiance.Coeffs[i].X()-expected.Coeffs[i].X()) > 1e-2 {
+			t.Errorf("coefficient %v: expected %v, got %v", i, expected.Coeffs[i].X(), radiance.Coeffs[i].X())
+		}
+	}
+}
+
+func TestLoadFromPath(t *testing.T) {
+	dir := t.TempDir()
+
+	radiance, err := Make(ORDER_3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range radiance.Coeffs {
+		radiance.Coeffs[i] = mgl32.Vec3{float32(i), 1, 2}
+	}
+	path := filepath.Join(dir, "sh.json")
+	if err := radiance.SaveToPath(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFromPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Order != radiance.Order || len(loaded.Coeffs) != len(radiance.Coeffs) {
+		t.Fatalf("expected order %v, got %v", radiance.Order, loaded.Order)
+	}
+	for i := range loaded.Coeffs {
+		if loaded.Coeffs[i] != radiance.Coeffs[i] {
+			t.Errorf("coefficient %v: expected %v, got %v", i, radiance.Coeffs[i], loaded.Coeffs[i])
+		}
+	}
+
+	// orders without convolution factors are rejected
+	unsupported := SH{Order: 4, Coeffs: make([]mgl32.Vec3, 16)}
+	path = filepath.Join(dir, "unsupported.json")
+	if err := unsupported.SaveToPath(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFromPath(path); err == nil {
+		t.Error("expected an error for order 4")
+	}
+}
+
+// makeEquirect creates an equirectangular image with the specified radiance
+// per direction.
+func makeEquirect(t *testing.T, radiance func(dir mgl32.Vec3) float32) image2d.Image2D {
+	img, err := image2d.MakeFloat32(EQUIRECT_WIDTH, EQUIRECT_HEIGHT, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < EQUIRECT_HEIGHT; y++ {
+		for x := 0; x < EQUIRECT_WIDTH; x++ {
+			l := radiance(envmap.EquirectPixelDirection(x, y, EQUIRECT_WIDTH, EQUIRECT_HEIGHT))
+			for c := 0; c < 3; c++ {
+				img.SetFloat32(x, y, c, l)
+			}
+		}
+	}
+	return img
+}
+
+// makeCubemap creates a cube map with the specified radiance per direction.
+func makeCubemap(t *testing.T, radiance func(dir mgl32.Vec3) float32) envmap.Cubemap {
+	cubemap, err := envmap.MakeEmptyCubemap(CUBEMAP_SIZE, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for f := 0; f < 6; f++ {
+		for y := 0; y < CUBEMAP_SIZE; y++ {
+			for x := 0; x < CUBEMAP_SIZE; x++ {
+				l := radiance(cubemap.TexelDirection(f, x, y))
+				cubemap.SetTexel(f, x, y, mgl32.Vec3{l, l, l})
+			}
+		}
+	}
+	return cubemap
+}
@@ -0,0 +1,145 @@
+package unwrap
+
+import (
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// chart is a connected set of triangles that is flattened as a whole. uvs
+// holds the texture coordinates of the three vertices of each triangle in the
+// same order as triangles. area is the surface area of the chart.
+type chart struct {
+	triangles []int
+	normal    mgl32.Vec3
+	uvs       [][3]mgl32.Vec2
+	area      float32
+	flipped   int
+}
+
+// segment splits the triangles into charts by growing each chart from a seed
+// triangle over adjacent triangles as long as their normals deviate at most
+// maxAngle degrees from the average normal of the chart. Triangles without
+// area join any adjacent chart. The remaining ones, which are only adjacent to
+// other triangles without area, are collected in one chart since they don't
+// cover any texels.
+func segment(topo *topology, maxAngle float32) []chart {
+	limit := cgm.Cos32(maxAngle * math.Pi / 180)
+	assigned := make([]bool, len(topo.triangles))
+
+	var charts []chart
+	for seed := range topo.triangles {
+		if assigned[seed] || topo.areas[seed] == 0 {
+			continue
+		}
+
+		assigned[seed] = true
+		c := chart{triangles: []int{seed}}
+		sum := topo.normals[seed].Mul(topo.areas[seed])
+		for i := 0; i < len(c.triangles); i++ {
+			normal := sum.Normalize()
+			for _, n := range topo.neighbors[c.triangles[i]] {
+				if n < 0 || assigned[n] {
+					continue
+				}
+				if topo.areas[n] > 0 && topo.normals[n].Dot(normal) < limit {
+					continue
+				}
+				assigned[n] = true
+				c.triangles = append(c.triangles, n)
+				sum = sum.Add(topo.normals[n].Mul(topo.areas[n]))
+			}
+		}
+
+		c.normal = sum.Normalize()
+		for _, t := range c.triangles {
+			c.area += topo.areas[t]
+		}
+		charts = append(charts, c)
+	}
+
+	degenerate := chart{normal: mgl32.Vec3{0, 0, 1}}
+	for t := range topo.triangles {
+		if !assigned[t] {
+			degenerate.triangles = append(degenerate.triangles, t)
+		}
+	}
+	if len(degenerate.triangles) > 0 {
+		charts = append(charts, degenerate)
+	}
+	return charts
+}
+
+// bounds returns the smallest and largest texture coordinates of the chart.
+func (c *chart) bounds() (mgl32.Vec2, mgl32.Vec2) {
+	inf := float32(math.Inf(1))
+	lo, hi := mgl32.Vec2{inf, inf}, mgl32.Vec2{-inf, -inf}
+	for _, tri := range c.uvs {
+		for _, uv := range tri {
+			lo = mgl32.Vec2{cgm.Min32(lo.X(), uv.X()), cgm.Min32(lo.Y(), uv.Y())}
+			hi = mgl32.Vec2{cgm.Max32(hi.X(), uv.X()), cgm.Max32(hi.Y(), uv.Y())}
+		}
+	}
+	return lo, hi
+}
+
+// transform applies f to all texture coordinates of the chart.
+func (c *chart) transform(f func(uv mgl32.Vec2) mgl32.Vec2) {
+	for i := range c.uvs {
+		for k := range c.uvs[i] {
+			c.uvs[i][k] = f(c.uvs[i][k])
+		}
+	}
+}
+
+// uvArea returns the area of the chart in texture space.
+func (c *chart) uvArea() float32 {
+	var area float32
+	for _, tri := range c.uvs {
+		area += cgm.Abs32(signedArea(tri[0], tri[1], tri[2]))
+	}
+	return area
+}
+
+// normalize rotates the chart such that its bounding box is as small as
+// possible, scales it such that its area in texture space matches its surface
+// area and moves it to the origin.
+func (c *chart) normalize() {
+	// try rotations in steps of 5 degrees
+	best, bestArea := float32(0), float32(math.Inf(1))
+	for step := 0; step < 18; step++ {
+		angle := float32(step) * 5 * math.Pi / 180
+		rotated := *c
+		rotated.uvs = append([][3]mgl32.Vec2(nil), c.uvs...)
+		rotated.transform(rotation(angle))
+		lo, hi := rotated.bounds()
+		if area := (hi.X() - lo.X()) * (hi.Y() - lo.Y()); area < bestArea {
+			best, bestArea = angle, area
+		}
+	}
+	c.transform(rotation(best))
+
+	scale := float32(1)
+	if uvArea := c.uvArea(); uvArea > 0 && c.area > 0 {
+		scale = cgm.Sqrt32(c.area / uvArea)
+	}
+	lo, _ := c.bounds()
+	c.transform(func(uv mgl32.Vec2) mgl32.Vec2 {
+		return uv.Sub(lo).Mul(scale)
+	})
+}
+
+// rotation returns a function rotating texture coordinates by angle radians.
+func rotation(angle float32) func(uv mgl32.Vec2) mgl32.Vec2 {
+	s, c := cgm.Sin32(angle), cgm.Cos32(angle)
+	return func(uv mgl32.Vec2) mgl32.Vec2 {
+		return mgl32.Vec2{c*uv.X() - s*uv.Y(), s*uv.X() + c*uv.Y()}
+	}
+}
+
+// signedArea returns the signed area of the triangle (a,b,c) which is
+// positive for counter clockwise triangles.
+func signedArea(a, b, c mgl32.Vec2) float32 {
+	return ((b.X()-a.X())*(c.Y()-a.Y()) - (b.Y()-a.Y())*(c.X()-a.X())) / 2
+}
@@ -0,0 +1,336 @@
+package unwrap
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// relative residual at which the least squares solver stops
+const solverTolerance = 1e-6
+
+// parameterize flattens the chart with least squares conformal maps as
+// described by Lévy et al. "Least Squares Conformal Maps for Automatic
+// Texture Atlas Generation". Two vertices far apart are pinned and the
+// texture coordinates of the other vertices are chosen such that the
+// Cauchy-Riemann equations hold as well as possible on each triangle, which
+// preserves the angles of the triangles. The solver starts from the
+// projection onto the plane of the chart normal. If the conformal map folds
+// over more triangles than the projection, the projection is used instead.
+// Charts without area are collapsed to a point.
+func parameterize(topo *topology, c *chart) {
+	if c.area == 0 {
+		c.uvs = make([][3]mgl32.Vec2, len(c.triangles))
+		return
+	}
+
+	// local indices of the vertices of the chart
+	local := map[int]int{}
+	var vertices []int
+	for _, t := range c.triangles {
+		for _, v := range topo.triangles[t] {
+			if _, ok := local[v]; !ok {
+				local[v] = len(vertices)
+				vertices = append(vertices, v)
+			}
+		}
+	}
+
+	pin0, pin1 := pinVertices(topo, vertices)
+	projected := project(topo, vertices, c.normal, pin0, pin1)
+	c.uvs = chartUVs(topo, c, local, projected)
+	projectedFlips := countFlips(c.uvs)
+	if len(vertices) <= 3 || pin0 == pin1 {
+		c.flipped = projectedFlips
+		return
+	}
+
+	uvs := solveLSCM(topo, c, local, projected, pin0, pin1)
+	if uvs == nil {
+		c.flipped = projectedFlips
+		return
+	}
+	conformal := chartUVs(topo, c, local, uvs)
+	if flips := countFlips(conformal); flips <= projectedFlips {
+		c.uvs, c.flipped = conformal, flips
+	} else {
+		c.flipped = projectedFlips
+	}
+}
+
+// pinVertices returns the local indices of the vertices with the smallest and
+// largest coordinate along the longest axis of the bounding box.
+func pinVertices(topo *topology, vertices []int) (int, int) {
+	lo, hi := topo.positions[vertices[0]], topo.positions[vertices[0]]
+	for _, v := range vertices {
+		p := topo.positions[v]
+		for i := 0; i < 3; i++ {
+			lo[i] = float32(math.Min(float64(lo[i]), float64(p[i])))
+			hi[i] = float32(math.Max(float64(hi[i]), float64(p[i])))
+		}
+	}
+	size := hi.Sub(lo)
+	axis := 0
+	if size.Y() > size[axis] {
+		axis = 1
+	}
+	if size.Z() > size[axis] {
+		axis = 2
+	}
+
+	pin0, pin1 := 0, 0
+	for i, v := range vertices {
+		p := topo.positions[v]
+		if p[axis] < topo.positions[vertices[pin0]][axis] {
+			pin0 = i
+		}
+		if p[axis] > topo.positions[vertices[pin1]][axis] {
+			pin1 = i
+		}
+	}
+	return pin0, pin1
+}
+
+// project projects the vertices onto the plane with the normal n. The first
+// axis of the plane points from the vertex pin0 to the vertex pin1.
+func project(topo *topology, vertices []int, n mgl32.Vec3, pin0, pin1 int) []mgl32.Vec2 {
+	origin := topo.positions[vertices[pin0]]
+	d := topo.positions[vertices[pin1]].Sub(origin)
+	e1 := d.Sub(n.Mul(d.Dot(n)))
+	if e1.Len() < 1e-12 {
+		// use any axis perpendicular to the normal
+		e1 = mgl32.Vec3{1, 0, 0}.Cross(n)
+		if e1.Len() < 1e-6 {
+			e1 = mgl32.Vec3{0, 1, 0}.Cross(n)
+		}
+	}
+	e1 = e1.Normalize()
+	e2 := n.Cross(e1)
+
+	uvs := make([]mgl32.Vec2, len(vertices))
+	for i, v := range vertices {
+		p := topo.positions[v].Sub(origin)
+		uvs[i] = mgl32.Vec2{p.Dot(e1), p.Dot(e2)}
+	}
+	return uvs
+}
+
+// row of the sparse least squares system
+type row struct {
+	cols []int
+	vals []float64
+}
+
+// solveLSCM sets up the conformal energy of the chart and minimizes it with
+// the texture coordinates of initial as starting point. The texture
+// coordinates of the pinned vertices keep their initial values. Returns nil if
+// the solver diverges.
+func solveLSCM(topo *topology, c *chart, local map[int]int, initial []mgl32.Vec2, pin0, pin1 int) []mgl32.Vec2 {
+	n := len(initial)
+
+	// the u and v coordinate of vertex i are the variables 2i and 2i+1. the
+	// pinned variables are moved to the right hand side.
+	free := make([]int, 2*n)
+	count := 0
+	for i := 0; i < n; i++ {
+		for k := 0; k < 2; k++ {
+			if i == pin0 || i == pin1 {
+				free[2*i+k] = -1
+			} else {
+				free[2*i+k] = count
+				count++
+			}
+		}
+	}
+
+	var rows []row
+	var rhs []float64
+	for _, t := range c.triangles {
+		if topo.areas[t] == 0 {
+			continue
+		}
+
+		// triangle in its own orthonormal frame
+		tri := topo.triangles[t]
+		p0, p1, p2 := topo.positions[tri[0]], topo.positions[tri[1]], topo.positions[tri[2]]
+		e1 := p1.Sub(p0).Normalize()
+		e2 := topo.normals[t].Cross(e1)
+		q := [3][2]float64{
+			{0, 0},
+			{float64(p1.Sub(p0).Len()), 0},
+			{float64(p2.Sub(p0).Dot(e1)), float64(p2.Sub(p0).Dot(e2))},
+		}
+		area := 0.5 * q[1][0] * q[2][1]
+		if area <= 0 {
+			continue
+		}
+
+		// gradients of the barycentric basis functions, the edge opposite of
+		// each vertex rotated by 90 degrees
+		var g [3][2]float64
+		for j := 0; j < 3; j++ {
+			a, b := q[(j+1)%3], q[(j+2)%3]
+			g[j] = [2]float64{-(b[1] - a[1]) / (2 * area), (b[0] - a[0]) / (2 * area)}
+		}
+
+		// cauchy-riemann equations dv/dx + du/dy = 0 and dv/dy - du/dx = 0
+		// weighted by the square root of the area
+		w := math.Sqrt(area)
+		for eq := 0; eq < 2; eq++ {
+			r := row{}
+			b := 0.0
+			for j := 0; j < 3; j++ {
+				i := local[tri[j]]
+				cu, cv := g[j][1], g[j][0]
+				if eq == 1 {
+					cu, cv = -g[j][0], g[j][1]
+				}
+				for k, coeff := range [2]float64{cu * w, cv * w} {
+					if col := free[2*i+k]; col >= 0 {
+						r.cols = append(r.cols, col)
+						r.vals = append(r.vals, coeff)
+					} else {
+						b -= coeff * float64(initial[i][k])
+					}
+				}
+			}
+			rows = append(rows, r)
+			rhs = append(rhs, b)
+		}
+	}
+
+	x := make([]float64, count)
+	for i := 0; i < n; i++ {
+		for k := 0; k < 2; k++ {
+			if col := free[2*i+k]; col >= 0 {
+				x[col] = float64(initial[i][k])
+			}
+		}
+	}
+	if !cgls(rows, rhs, x, 4*count+100) {
+		return nil
+	}
+
+	uvs := make([]mgl32.Vec2, n)
+	for i := 0; i < n; i++ {
+		uvs[i] = initial[i]
+		for k := 0; k < 2; k++ {
+			if col := free[2*i+k]; col >= 0 {
+				uvs[i][k] = float32(x[col])
+			}
+		}
+	}
+	return uvs
+}
+
+// cgls minimizes |A x - b| with the conjugate gradient method applied to the
+// normal equations, starting from the initial values of x. Returns false if
+// the result isn't finite.
+func cgls(rows []row, b, x []float64, iterations int) bool {
+	// r = b - A x
+	r := make([]float64, len(rows))
+	for i, row := range rows {
+		r[i] = b[i]
+		for k, col := range row.cols {
+			r[i] -= row.vals[k] * x[col]
+		}
+	}
+
+	s := make([]float64, len(x))
+	transposed := func(r []float64) {
+		for i := range s {
+			s[i] = 0
+		}
+		for i, row := range rows {
+			for k, col := range row.cols {
+				s[col] += row.vals[k] * r[i]
+			}
+		}
+	}
+	transposed(r)
+
+	p := append([]float64(nil), s...)
+	q := make([]float64, len(rows))
+	gamma := dot(s, s)
+	initial := gamma
+	for it := 0; it < iterations && gamma > solverTolerance*solverTolerance*initial && gamma > 0; it++ {
+		// q = A p
+		for i, row := range rows {
+			q[i] = 0
+			for k, col := range row.cols {
+				q[i] += row.vals[k] * p[col]
+			}
+		}
+		qq := dot(q, q)
+		if qq == 0 {
+			break
+		}
+		alpha := gamma / qq
+		for i := range x {
+			x[i] += alpha * p[i]
+		}
+		for i := range r {
+			r[i] -= alpha * q[i]
+		}
+
+		transposed(r)
+		next := dot(s, s)
+		beta := next / gamma
+		gamma = next
+		for i := range p {
+			p[i] = s[i] + beta*p[i]
+		}
+	}
+
+	for _, v := range x {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// chartUVs returns the texture coordinates of the vertices of each triangle
+// of the chart given the texture coordinates of its vertices.
+func chartUVs(topo *topology, c *chart, local map[int]int, uvs []mgl32.Vec2) [][3]mgl32.Vec2 {
+	result := make([][3]mgl32.Vec2, len(c.triangles))
+	for i, t := range c.triangles {
+		for k, v := range topo.triangles[t] {
+			result[i][k] = uvs[local[v]]
+		}
+	}
+	return result
+}
+
+// countFlips returns the number of triangles whose orientation in texture
+// space differs from the orientation of the majority. The texture coordinates
+// are mirrored if most triangles are oriented clockwise.
+func countFlips(uvs [][3]mgl32.Vec2) int {
+	positive, negative := 0, 0
+	for _, tri := range uvs {
+		a := signedArea(tri[0], tri[1], tri[2])
+		if a > 0 {
+			positive++
+		} else if a < 0 {
+			negative++
+		}
+	}
+
+	if negative > positive {
+		for i := range uvs {
+			for k := range uvs[i] {
+				uvs[i][k][0] = -uvs[i][k][0]
+			}
+		}
+		return positive
+	}
+	return negative
+}
@@ -0,0 +1,100 @@
+package unwrap
+
+import (
+	"sort"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// number of times the scale of the atlas is refined, since the padding in
+// chart units depends on the scale
+const packIterations = 8
+
+// pack places the normalized charts into the unit square with at least
+// padding between them and to the border of the square. The charts are
+// sorted by height and placed on shelves, which are filled from left to
+// right. All charts are scaled uniformly, thus the texel density is the same
+// for the whole mesh.
+func pack(charts []chart, padding float32) {
+	if len(charts) == 0 {
+		return
+	}
+
+	sizes := make([]mgl32.Vec2, len(charts))
+	var area float32
+	for i := range charts {
+		_, hi := charts[i].bounds()
+		sizes[i] = hi
+		area += hi.X() * hi.Y()
+	}
+	order := make([]int, len(charts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return sizes[order[a]].Y() > sizes[order[b]].Y()
+	})
+
+	// the padding is specified in texture space, thus the scale of the atlas
+	// is refined until the padding in chart units is consistent with it
+	scale := 1 / cgm.Sqrt32(cgm.Max32(area, 1e-12))
+	var offsets []mgl32.Vec2
+	for it := 0; it < packIterations; it++ {
+		margin := padding / scale
+		var size float32
+		offsets, size = packShelves(sizes, order, margin)
+		scale = 1 / size
+	}
+
+	for i := range charts {
+		offset := offsets[i]
+		charts[i].transform(func(uv mgl32.Vec2) mgl32.Vec2 {
+			return uv.Add(offset).Mul(scale)
+		})
+	}
+}
+
+// packShelves places boxes of the specified sizes in the specified order on
+// shelves with the margin around each box. Several shelf widths are tried and
+// the one resulting in the smallest square is used. Returns the offset of
+// each box and the side length of the square.
+func packShelves(sizes []mgl32.Vec2, order []int, margin float32) ([]mgl32.Vec2, float32) {
+	var area, widest float32
+	for _, s := range sizes {
+		area += (s.X() + margin) * (s.Y() + margin)
+		widest = cgm.Max32(widest, s.X()+margin)
+	}
+	side := cgm.Sqrt32(area)
+
+	var best []mgl32.Vec2
+	bestSize := float32(0)
+	for step := 0; step <= 10; step++ {
+		width := cgm.Max32(side*(1+float32(step)*0.05), widest) + margin
+		offsets, w, h := shelves(sizes, order, margin, width)
+		if size := cgm.Max32(w, h); best == nil || size < bestSize {
+			best, bestSize = offsets, size
+		}
+	}
+	return best, bestSize
+}
+
+// shelves places the boxes on shelves of the specified width. Returns the
+// offsets and the used width and height.
+func shelves(sizes []mgl32.Vec2, order []int, margin, width float32) ([]mgl32.Vec2, float32, float32) {
+	offsets := make([]mgl32.Vec2, len(sizes))
+	x, y, shelf := margin, margin, float32(0)
+	var used float32
+	for _, i := range order {
+		s := sizes[i]
+		if x > margin && x+s.X()+margin > width {
+			x, y = margin, y+shelf+margin
+			shelf = 0
+		}
+		offsets[i] = mgl32.Vec2{x, y}
+		x += s.X() + margin
+		used = cgm.Max32(used, x)
+		shelf = cgm.Max32(shelf, s.Y())
+	}
+	return offsets, used, y + shelf + margin
+}
@@ -0,0 +1,118 @@
+package unwrap
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/adrianderstroff/pbr/pkg/geom"
+	"github.com/adrianderstroff/pbr/pkg/view/mesh"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// relative distance below which vertices of the triangle soup are welded
+const weldEpsilon = 1e-6
+
+// topology is the triangle soup of a geometry with coincident vertices welded
+// together, such that adjacent triangles share their vertex indices.
+// neighbors[t][k] is the triangle across the edge from vertex k to vertex k+1
+// of triangle t or -1 for border and non-manifold edges.
+type topology struct {
+	positions []mgl32.Vec3
+	triangles [][3]int
+	normals   []mgl32.Vec3
+	areas     []float32
+	neighbors [][3]int
+}
+
+// makeTopology welds the vertices of the pos attribute of the geometry, whose
+// each three consecutive vertices form a triangle.
+func makeTopology(geometry *mesh.Geometry) (topology, error) {
+	data, _, err := geometry.Attribute("pos")
+	if err != nil {
+		return topology{}, err
+	}
+	if len(data)%9 != 0 {
+		return topology{}, fmt.Errorf("pos attribute has %v values, which isn't a triangle soup", len(data))
+	}
+	count := len(data) / 9
+	if count == 0 {
+		return topology{}, errors.New("geometry has no triangles")
+	}
+
+	// quantize the positions relative to the size of the mesh
+	bounds := geom.MakeEmptyAABB()
+	for i := 0; i < len(data)/3; i++ {
+		bounds.Extend(mgl32.Vec3{data[3*i], data[3*i+1], data[3*i+2]})
+	}
+	cell := float64(bounds.Size().Len()) * weldEpsilon
+	if cell == 0 {
+		cell = weldEpsilon
+	}
+
+	topo := topology{
+		triangles: make([][3]int, count),
+		normals:   make([]mgl32.Vec3, count),
+		areas:     make([]float32, count),
+		neighbors: make([][3]int, count),
+	}
+	welded := map[[3]int64]int{}
+	for v := 0; v < 3*count; v++ {
+		p := mgl32.Vec3{data[3*v], data[3*v+1], data[3*v+2]}
+		key := [3]int64{
+			int64(math.Round(float64(p.X()) / cell)),
+			int64(math.Round(float64(p.Y()) / cell)),
+			int64(math.Round(float64(p.Z()) / cell)),
+		}
+		idx, ok := welded[key]
+		if !ok {
+			idx = len(topo.positions)
+			welded[key] = idx
+			topo.positions = append(topo.positions, p)
+		}
+		topo.triangles[v/3][v%3] = idx
+	}
+
+	for t, tri := range topo.triangles {
+		p0, p1, p2 := topo.positions[tri[0]], topo.positions[tri[1]], topo.positions[tri[2]]
+		n := p1.Sub(p0).Cross(p2.Sub(p0))
+		topo.areas[t] = n.Len() / 2
+		if topo.areas[t] > 0 {
+			topo.normals[t] = n.Normalize()
+		}
+	}
+
+	// connect triangles that share an edge with exactly one other triangle
+	edges := map[[2]int][]int{}
+	for t, tri := range topo.triangles {
+		for k := 0; k < 3; k++ {
+			key := edgeKey(tri[k], tri[(k+1)%3])
+			edges[key] = append(edges[key], 3*t+k)
+		}
+	}
+	for t, tri := range topo.triangles {
+		for k := 0; k < 3; k++ {
+			topo.neighbors[t][k] = -1
+			shared := edges[edgeKey(tri[k], tri[(k+1)%3])]
+			if len(shared) != 2 {
+				continue
+			}
+			for _, e := range shared {
+				if e/3 != t {
+					topo.neighbors[t][k] = e / 3
+				}
+			}
+		}
+	}
+
+	return topo, nil
+}
+
+// edgeKey returns the key of the edge between the vertices a and b
+// independent of their order.
+func edgeKey(a, b int) [2]int {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]int{a, b}
+}
@@ -0,0 +1,163 @@
+// Package unwrap provides automatic texture coordinates for meshes whose
+// texture coordinates overlap or are missing, like a second set of texture
+// coordinates for baking ambient occlusion or light maps. The mesh is split
+// into charts of triangles facing similar directions, each chart is flattened
+// with least squares conformal maps and all charts are packed into the unit
+// square with padding between them.
+package unwrap
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/core/gl"
+	"github.com/adrianderstroff/pbr/pkg/view/mesh"
+)
+
+// ATTRIBUTE is the id of the vertex attribute of the texture coordinates.
+const ATTRIBUTE = "uv2"
+
+// Options of the unwrapper. MaxAngle is the largest angle in degrees between
+// the normal of a triangle and the average normal of its chart. Padding is the
+// number of texels kept free around each chart for a texture of the specified
+// resolution.
+type Options struct {
+	MaxAngle   float32
+	Resolution int
+	Padding    int
+}
+
+// MakeDefaultOptions returns the options for a texture with 1024x1024 texels.
+func MakeDefaultOptions() Options {
+	return Options{
+		MaxAngle:   60,
+		Resolution: 1024,
+		Padding:    4,
+	}
+}
+
+// Stats measure the quality of the texture coordinates. The stretch metrics
+// are those of Sander et al. "Texture Mapping Progressive Meshes" normalized
+// by the ratio of surface area to texture area, such that 1 is optimal.
+// L2Stretch is the root mean square stretch weighted by the surface area and
+// LInfStretch the largest stretch of any triangle. Usage is the fraction of
+// the unit square covered by charts. Flipped counts the triangles whose
+// orientation in texture space is reversed, which means that the chart
+// overlaps itself.
+type Stats struct {
+	Charts      int
+	Triangles   int
+	L2Stretch   float32
+	LInfStretch float32
+	Usage       float32
+	Flipped     int
+}
+
+// Unwrap computes new texture coordinates for the triangle soup of the
+// geometry, which needs a pos attribute like the meshes of obj.LoadGeometry.
+// The geometry must not be indexed, each three consecutive vertices form a
+// triangle. Coincident vertices are welded to find adjacent triangles. The
+// texture coordinates are stored as the vertex attribute ATTRIBUTE.
+func Unwrap(geometry *mesh.Geometry, options Options) (Stats, error) {
+	topo, err := makeTopology(geometry)
+	if err != nil {
+		return Stats{}, err
+	}
+	charts := segment(&topo, options.MaxAngle)
+
+	// flatten the charts in parallel
+	indices := make(chan int, len(charts))
+	for i := range charts {
+		indices <- i
+	}
+	close(indices)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				parameterize(&topo, &charts[i])
+				charts[i].normalize()
+			}
+		}()
+	}
+	wg.Wait()
+
+	padding := float32(0)
+	if options.Resolution > 0 {
+		padding = float32(options.Padding) / float32(options.Resolution)
+	}
+	pack(charts, padding)
+
+	// texture coordinates of each vertex of the triangle soup
+	uvs := make([]float32, 6*len(topo.triangles))
+	for _, c := range charts {
+		for i, t := range c.triangles {
+			for k := 0; k < 3; k++ {
+				uvs[6*t+2*k] = c.uvs[i][k].X()
+				uvs[6*t+2*k+1] = c.uvs[i][k].Y()
+			}
+		}
+	}
+	attrib := mesh.MakeVertexAttribute(ATTRIBUTE, gl.FLOAT, 2, gl.STATIC_DRAW)
+	if err := geometry.SetAttribute(attrib, uvs); err != nil {
+		return Stats{}, err
+	}
+
+	return calcStats(&topo, charts), nil
+}
+
+// calcStats measures the stretch of the texture coordinates of all charts.
+func calcStats(topo *topology, charts []chart) Stats {
+	stats := Stats{
+		Charts:    len(charts),
+		Triangles: len(topo.triangles),
+	}
+
+	var surfaceArea, uvArea, sum, worst float64
+	for _, c := range charts {
+		stats.Flipped += c.flipped
+		for i, t := range c.triangles {
+			tri := topo.triangles[t]
+			q0, q1, q2 := topo.positions[tri[0]], topo.positions[tri[1]], topo.positions[tri[2]]
+			p0, p1, p2 := c.uvs[i][0], c.uvs[i][1], c.uvs[i][2]
+			a := float64(signedArea(p0, p1, p2))
+			surfaceArea += float64(topo.areas[t])
+			uvArea += math.Abs(a)
+			if a == 0 || topo.areas[t] == 0 {
+				continue
+			}
+
+			// partial derivatives of the surface with respect to u and v
+			ss := q0.Mul(p1.Y() - p2.Y()).Add(q1.Mul(p2.Y() - p0.Y())).Add(q2.Mul(p0.Y() - p1.Y())).Mul(float32(1 / (2 * a)))
+			st := q0.Mul(p2.X() - p1.X()).Add(q1.Mul(p0.X() - p2.X())).Add(q2.Mul(p1.X() - p0.X())).Mul(float32(1 / (2 * a)))
+			e, f, g := float64(ss.Dot(ss)), float64(ss.Dot(st)), float64(st.Dot(st))
+
+			sum += (e + g) / 2 * float64(topo.areas[t])
+			largest := math.Sqrt(((e + g) + math.Sqrt((e-g)*(e-g)+4*f*f)) / 2)
+			worst = math.Max(worst, largest)
+		}
+	}
+
+	stats.Usage = cgm.Clamp(float32(uvArea), 0, 1)
+	if surfaceArea > 0 {
+		normalization := math.Sqrt(uvArea / surfaceArea)
+		stats.L2Stretch = float32(math.Sqrt(sum/surfaceArea) * normalization)
+		stats.LInfStretch = float32(worst * normalization)
+	}
+	return stats
+}
+
+func (stats Stats) String() string {
+	s := fmt.Sprintf("charts       %v\n", stats.Charts)
+	s += fmt.Sprintf("triangles    %v\n", stats.Triangles)
+	s += fmt.Sprintf("L2 stretch   %.4f\n", stats.L2Stretch)
+	s += fmt.Sprintf("Linf stretch %.4f\n", stats.LInfStretch)
+	s += fmt.Sprintf("usage        %.1f%%\n", 100*stats.Usage)
+	s += fmt.Sprintf("flipped      %v", stats.Flipped)
+	return s
+}
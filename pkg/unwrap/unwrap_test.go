@@ -0,0 +1,131 @@
+package unwrap
+
+import (
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+	"github.com/adrianderstroff/pbr/pkg/core/gl"
+	"github.com/adrianderstroff/pbr/pkg/view/mesh"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	TEXELS            int     = 256
+	STRETCH_TOLERANCE float32 = 0.01
+)
+
+// makeCube returns a unit cube as a non-indexed triangle soup.
+func makeCube() mesh.Geometry {
+	v1 := []float32{-0.5, 0.5, 0.5}
+	v2 := []float32{-0.5, -0.5, 0.5}
+	v3 := []float32{0.5, 0.5, 0.5}
+	v4 := []float32{0.5, -0.5, 0.5}
+	v5 := []float32{-0.5, 0.5, -0.5}
+	v6 := []float32{-0.5, -0.5, -0.5}
+	v7 := []float32{0.5, 0.5, -0.5}
+	v8 := []float32{0.5, -0.5, -0.5}
+	positions := mesh.Combine(
+		v3, v4, v7, v7, v4, v8,
+		v5, v6, v1, v1, v6, v2,
+		v5, v1, v7, v7, v1, v3,
+		v2, v6, v4, v4, v6, v8,
+		v1, v2, v3, v3, v2, v4,
+		v7, v8, v5, v5, v8, v6,
+	)
+	layout := []mesh.VertexAttribute{mesh.MakeVertexAttribute("pos", gl.FLOAT, 3, gl.STATIC_DRAW)}
+	return mesh.MakeGeometry(layout, [][]float32{positions})
+}
+
+// unwrapCube unwraps the cube and returns its stats and texture coordinates.
+func unwrapCube(t *testing.T) (Stats, []float32) {
+	geometry := makeCube()
+	options := MakeDefaultOptions()
+	options.Resolution = TEXELS
+	stats, err := Unwrap(&geometry, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uvs, count, err := geometry.Attribute(ATTRIBUTE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || len(uvs) != 2*36 {
+		t.Fatalf("unwrapped %v texture coordinates with %v elements", len(uvs), count)
+	}
+	return stats, uvs
+}
+
+// TestUnitSquare checks that all texture coordinates lie in the unit square.
+func TestUnitSquare(t *testing.T) {
+	_, uvs := unwrapCube(t)
+	for i, c := range uvs {
+		if c < 0 || c > 1 {
+			t.Errorf("texture coordinate %v of vertex %v is %v", i%2, i/2, c)
+		}
+	}
+}
+
+// TestStretch checks that the flat faces of the cube are mapped without any
+// distortion.
+func TestStretch(t *testing.T) {
+	stats, _ := unwrapCube(t)
+	if stats.Triangles != 12 || stats.Flipped != 0 {
+		t.Errorf("%v triangles with %v flipped", stats.Triangles, stats.Flipped)
+	}
+	if cgm.Abs32(stats.L2Stretch-1) > STRETCH_TOLERANCE {
+		t.Errorf("L2 stretch is %v", stats.L2Stretch)
+	}
+	if cgm.Abs32(stats.LInfStretch-1) > STRETCH_TOLERANCE {
+		t.Errorf("Linf stretch is %v", stats.LInfStretch)
+	}
+}
+
+// TestNoOverlap checks that no texel center is covered by more than one
+// triangle. Centers on an edge count for neither triangle.
+func TestNoOverlap(t *testing.T) {
+	_, uvs := unwrapCube(t)
+	covered := make([]int, TEXELS*TEXELS)
+	for tri := 0; tri < len(uvs)/6; tri++ {
+		a := mgl32.Vec2{uvs[6*tri], uvs[6*tri+1]}
+		b := mgl32.Vec2{uvs[6*tri+2], uvs[6*tri+3]}
+		c := mgl32.Vec2{uvs[6*tri+4], uvs[6*tri+5]}
+		area := signedArea(a, b, c)
+		if area == 0 {
+			t.Fatalf("triangle %v has no area in texture space", tri)
+		}
+		for y := 0; y < TEXELS; y++ {
+			for x := 0; x < TEXELS; x++ {
+				p := mgl32.Vec2{(float32(x) + 0.5) / float32(TEXELS), (float32(y) + 0.5) / float32(TEXELS)}
+				w0 := signedArea(b, c, p) / area
+				w1 := signedArea(c, a, p) / area
+				w2 := signedArea(a, b, p) / area
+				if w0 > 0 && w1 > 0 && w2 > 0 {
+					covered[x+y*TEXELS]++
+				}
+			}
+		}
+	}
+
+	texels := 0
+	for i, n := range covered {
+		if n > 1 {
+			t.Errorf("texel (%v,%v) is covered by %v triangles", i%TEXELS, i/TEXELS, n)
+		}
+		if n > 0 {
+			texels++
+		}
+	}
+	if texels == 0 {
+		t.Error("no texel is covered")
+	}
+}
+
+// TestNoTriangleSoup checks that a pos attribute that can't be split into
+// triangles is rejected.
+func TestNoTriangleSoup(t *testing.T) {
+	geometry := makeCube()
+	geometry.Data[0] = geometry.Data[0][:len(geometry.Data[0])-3]
+	if _, err := Unwrap(&geometry, MakeDefaultOptions()); err == nil {
+		t.Error("unwrapped a pos attribute with an incomplete triangle")
+	}
+}
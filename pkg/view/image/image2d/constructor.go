@@ -3,6 +3,7 @@ package image2d
 import (
 	"image"
 	"os"
+	"path/filepath"
 
 	// import for side effects
 	gl "github.com/adrianderstroff/pbr/pkg/core/gl"
@@ -35,6 +36,25 @@ func Make(width, height, channels int) (Image2D, error) {
 	}, nil
 }
 
+// MakeFloat32 constructs a black image of the specified width, height and
+// number of channels where each channel is stored as a 32bit float.
+func MakeFloat32(width, height, channels int) (Image2D, error) {
+	// early return if invalid dimensions had been specified
+	err := checkDimensions(width, height, channels)
+	if err != nil {
+		return Image2D{}, err
+	}
+
+	return Image2D{
+		pixelType: uint32(gl.FLOAT),
+		width:     width,
+		height:    height,
+		channels:  channels,
+		bytedepth: 4,
+		data:      make([]uint8, width*height*channels*4),
+	}, nil
+}
+
 // MakeFromData constructs an image of the specified width and height and the specified data.
 func MakeFromData(width, height, channels int, data []uint8) (Image2D, error) {
 	// data is stored as rgba value even if data is one channel only
@@ -113,7 +133,8 @@ func MakeFromPathFixedChannels(path string, channels int) (Image2D, error) {
 	}, nil
 }
 
-// MakeFromPath constructs the image data from the specified path.
+// MakeFromPath constructs the image data from the specified path. Portable
+// float maps with the extension .pfm are supported as well.
 // If there is no image at the specified path an error is returned instead.
 func MakeFromPath(path string) (Image2D, error) {
 	// load image file
@@ -123,6 +144,11 @@ func MakeFromPath(path string) (Image2D, error) {
 	}
 	defer file.Close()
 
+	// the portable float map isn't supported by the image package
+	if filepath.Ext(path) == ".pfm" {
+		return makeFromPFM(file)
+	}
+
 	// decode image
 	img, fname, err := image.Decode(file)
 	if err != nil {
@@ -32,7 +32,9 @@ type Image2D struct {
 }
 
 // SaveToPath saves the image at the specified path in the png format.
-// The specified image path has to have the fileextension .png.
+// The specified image path has to have the fileextension .png. Images with
+// the extension .hdr are saved in the radiance format and images with the
+// extension .pfm as portable float map, which keeps negative values.
 // An error is thrown if the path is not valid or any of the specified
 // directories don't exist.
 func (img *Image2D) SaveToPath(path string) error {
@@ -45,6 +47,10 @@ func (img *Image2D) SaveToPath(path string) error {
 	// grab file extension
 	extension := filepath.Ext(path)
 	ishdr := extension == ".hdr"
+	if extension == ".pfm" {
+		defer file.Close()
+		return img.savePFM(file)
+	}
 
 	// extract image.Image from the Image2D
 	// write data back into the golang image format
@@ -58,15 +64,16 @@ func (img *Image2D) SaveToPath(path string) error {
 			return errors.New("hdr image has to have a byte depth of 4")
 		}
 
-		// make sure the image has 3 channels
-		if img.channels != 3 {
-			return errors.New("hdr image has to have 3 color channels")
+		// make sure the image has at most 3 channels. images with less
+		// channels get their remaining color channels filled with zeros.
+		if img.channels > 3 {
+			return errors.New("hdr image can have at most 3 color channels")
 		}
 
 		// fill hdr image data
 		for y := 0; y < img.height; y++ {
 			for x := 0; x < img.width; x++ {
-				oidx := img.getOIdx(x, y)
+				oidx := (x + y*img.width) * 3
 				idx := img.getIdx(x, y)
 
 				for c := 0; c < img.channels; c++ {
@@ -105,7 +112,7 @@ func (img *Image2D) SaveToPath(path string) error {
 			for x := 0; x < img.width; x++ {
 				idxsrc := img.getIdx(x, y)
 				offsrc := img.bytedepth
-				idxdst := img.getOIdx(x, y)
+				idxdst := out.PixOffset(x, y)
 				out.Pix[idxdst] = img.data[idxsrc]
 				out.Pix[idxdst+1] = img.data[idxsrc+offsrc]
 				out.Pix[idxdst+2] = 0
@@ -120,7 +127,7 @@ func (img *Image2D) SaveToPath(path string) error {
 			for x := 0; x < img.width; x++ {
 				idxsrc := img.getIdx(x, y)
 				offsrc := img.bytedepth
-				idxdst := img.getOIdx(x, y)
+				idxdst := out.PixOffset(x, y)
 				out.Pix[idxdst] = img.data[idxsrc]
 				out.Pix[idxdst+1] = img.data[idxsrc+offsrc]
 				out.Pix[idxdst+2] = img.data[idxsrc+2*offsrc]
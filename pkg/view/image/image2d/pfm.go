@@ -0,0 +1,94 @@
+package image2d
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// savePFM writes the image in the portable float map format, which stores
+// each channel as a 32bit float without clamping or quantization, thus
+// negative values are preserved. Images with one channel are written as
+// grayscale, images with two or three channels as rgb where missing channels
+// are zero. Like the format demands the rows are written from bottom to top.
+func (img *Image2D) savePFM(w io.Writer) error {
+	if img.channels > 3 {
+		return errors.New("pfm image can have at most 3 color channels")
+	}
+	magic, channels := "PF", 3
+	if img.channels == 1 {
+		magic, channels = "Pf", 1
+	}
+
+	// a negative scale marks little endian data
+	out := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(out, "%v\n%v %v\n-1.0\n", magic, img.width, img.height); err != nil {
+		return err
+	}
+	bytes := make([]byte, 4)
+	for y := img.height - 1; y >= 0; y-- {
+		for x := 0; x < img.width; x++ {
+			for c := 0; c < channels; c++ {
+				var val float32
+				if c < img.channels {
+					val = img.GetFloat32(x, y, c)
+				}
+				binary.LittleEndian.PutUint32(bytes, math.Float32bits(val))
+				if _, err := out.Write(bytes); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return out.Flush()
+}
+
+// makeFromPFM reads an image in the portable float map format. The resulting
+// image has a byte depth of 4 and either one or three channels.
+func makeFromPFM(r io.Reader) (Image2D, error) {
+	in := bufio.NewReader(r)
+
+	var magic string
+	var width, height int
+	var scale float32
+	if _, err := fmt.Fscan(in, &magic, &width, &height, &scale); err != nil {
+		return Image2D{}, err
+	}
+	// a single whitespace character separates the header from the data
+	if _, err := in.ReadByte(); err != nil {
+		return Image2D{}, err
+	}
+
+	channels := 3
+	switch magic {
+	case "PF":
+	case "Pf":
+		channels = 1
+	default:
+		return Image2D{}, fmt.Errorf("invalid pfm identifier %v", magic)
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if scale < 0 {
+		order = binary.LittleEndian
+	}
+
+	img, err := MakeFloat32(width, height, channels)
+	if err != nil {
+		return Image2D{}, err
+	}
+	bytes := make([]byte, 4)
+	for y := height - 1; y >= 0; y-- {
+		for x := 0; x < width; x++ {
+			for c := 0; c < channels; c++ {
+				if _, err := io.ReadFull(in, bytes); err != nil {
+					return Image2D{}, err
+				}
+				img.SetFloat32(x, y, c, math.Float32frombits(order.Uint32(bytes)))
+			}
+		}
+	}
+	return img, nil
+}
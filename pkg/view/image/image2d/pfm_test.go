@@ -0,0 +1,56 @@
+package image2d
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestPFMRoundTrip checks that float values including negative ones survive
+// saving and loading a portable float map unchanged.
+func TestPFMRoundTrip(t *testing.T) {
+	for _, channels := range []int{1, 2, 3} {
+		img, err := MakeFloat32(5, 3, channels)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < img.GetHeight(); y++ {
+			for x := 0; x < img.GetWidth(); x++ {
+				for c := 0; c < channels; c++ {
+					img.SetFloat32(x, y, c, float32(x)-2.5*float32(y)+0.125*float32(c))
+				}
+			}
+		}
+
+		path := filepath.Join(t.TempDir(), "img.pfm")
+		if err := img.SaveToPath(path); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := MakeFromPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// two channels are padded to rgb with a zero blue channel
+		expected := 3
+		if channels == 1 {
+			expected = 1
+		}
+		if loaded.GetChannels() != expected || loaded.GetByteDepth() != 4 ||
+			loaded.GetWidth() != img.GetWidth() || loaded.GetHeight() != img.GetHeight() {
+			t.Fatalf("channels %v: loaded %v", channels, loaded)
+		}
+		for y := 0; y < img.GetHeight(); y++ {
+			for x := 0; x < img.GetWidth(); x++ {
+				for c := 0; c < expected; c++ {
+					var want float32
+					if c < channels {
+						want = img.GetFloat32(x, y, c)
+					}
+					if got := loaded.GetFloat32(x, y, c); got != want {
+						t.Errorf("channels %v: pixel (%v,%v,%v) is %v instead of %v", channels, x, y, c, got, want)
+					}
+				}
+			}
+		}
+	}
+}
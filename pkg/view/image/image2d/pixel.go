@@ -1,5 +1,7 @@
 package image2d
 
+import "github.com/adrianderstroff/pbr/pkg/cgm"
+
 // GetR returns the red value of the pixel at (x,y).
 func (img *Image2D) GetR(x, y int) uint8 {
 	idx := img.getIdx(x, y)
@@ -81,3 +83,24 @@ func (img *Image2D) SetRGBA(x, y int, r, g, b, a uint8) {
 	img.data[idx+2] = b
 	img.data[idx+3] = a
 }
+
+// GetFloat32 returns the value of channel c of the pixel at (x,y) as a float.
+// Values of images with a byte depth of 1 are mapped to the range [0,1].
+func (img *Image2D) GetFloat32(x, y, c int) float32 {
+	idx := img.getIdx(x, y) + c*img.bytedepth
+	if img.bytedepth == 4 {
+		return bytesToFloat32(img.data[idx : idx+4])
+	}
+	return float32(img.data[idx]) / 255.0
+}
+
+// SetFloat32 sets the value of channel c of the pixel at (x,y). For images
+// with a byte depth of 1 the value is clamped to [0,1] and mapped to [0,255].
+func (img *Image2D) SetFloat32(x, y, c int, val float32) {
+	idx := img.getIdx(x, y) + c*img.bytedepth
+	if img.bytedepth == 4 {
+		copy(img.data[idx:idx+4], float32ToBytes(val))
+		return
+	}
+	img.data[idx] = uint8(cgm.Clamp(val, 0, 1)*255.0 + 0.5)
+}
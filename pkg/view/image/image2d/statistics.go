@@ -0,0 +1,283 @@
+package image2d
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// CHANNEL_LUMINANCE can be used instead of a channel index to operate on the
+// luminance of the pixels instead of a single color channel.
+const CHANNEL_LUMINANCE = -1
+
+// minimum luminance used to avoid taking the logarithm of zero
+const minLuminance = 1e-6
+
+// Histogram stores the number of pixel values that fall into each of the
+// equally sized bins between Min and Max. If Log is true the bins are equally
+// sized in log2 space, with Min and Max still being stored in linear space.
+type Histogram struct {
+	Min  float32
+	Max  float32
+	Log  bool
+	Bins []int
+}
+
+// BinRange returns the linear range of values that fall into the bin with the
+// index i.
+func (hist *Histogram) BinRange(i int) (float32, float32) {
+	if hist.Log {
+		lmin := math.Log2(float64(hist.Min))
+		lmax := math.Log2(float64(hist.Max))
+		step := (lmax - lmin) / float64(len(hist.Bins))
+		lo := math.Exp2(lmin + float64(i)*step)
+		hi := math.Exp2(lmin + float64(i+1)*step)
+		return float32(lo), float32(hi)
+	}
+
+	step := (hist.Max - hist.Min) / float32(len(hist.Bins))
+	return hist.Min + float32(i)*step, hist.Min + float32(i+1)*step
+}
+
+// ChannelStatistics summarizes the values of one channel or the luminance of
+// an image.
+type ChannelStatistics struct {
+	Min    float32
+	Max    float32
+	Mean   float32
+	P01    float32 // 1st percentile
+	Median float32
+	P99    float32 // 99th percentile
+}
+
+// Statistics summarizes the pixel values of an image. Besides the statistics
+// of each color channel it also contains the statistics of the luminance.
+type Statistics struct {
+	Channels            []ChannelStatistics
+	Luminance           ChannelStatistics
+	AverageLogLuminance float32
+	DynamicRange        float32 // in stops between the 1st and 99th percentile
+}
+
+// Luminance returns the relative luminance of the pixel at (x,y) using the
+// Rec. 709 primaries. Images with less than 3 channels use the first channel.
+func (img *Image2D) Luminance(x, y int) float32 {
+	if img.channels < 3 {
+		return img.GetFloat32(x, y, 0)
+	}
+	r := img.GetFloat32(x, y, 0)
+	g := img.GetFloat32(x, y, 1)
+	b := img.GetFloat32(x, y, 2)
+	return 0.2126*r + 0.7152*g + 0.0722*b
+}
+
+// Histogram calculates a histogram with the specified number of bins for the
+// specified channel between the minimum and maximum value of that channel.
+// Use CHANNEL_LUMINANCE as the channel to get a luminance histogram. If log is
+// true the bins are spaced logarithmically, ignoring values of zero and below.
+func (img *Image2D) Histogram(channel, bins int, log bool) (Histogram, error) {
+	if bins < 1 {
+		return Histogram{}, fmt.Errorf("number of bins must be bigger than 0")
+	}
+	values, err := img.channelValues(channel)
+	if err != nil {
+		return Histogram{}, err
+	}
+
+	// the logarithmic histogram only considers positive values
+	if log {
+		positive := values[:0]
+		for _, v := range values {
+			if v > 0 {
+				positive = append(positive, v)
+			}
+		}
+		values = positive
+	}
+
+	hist := Histogram{
+		Min:  float32(math.Inf(1)),
+		Max:  float32(math.Inf(-1)),
+		Log:  log,
+		Bins: make([]int, bins),
+	}
+	if len(values) == 0 {
+		hist.Min, hist.Max = 0, 0
+		return hist, nil
+	}
+	for _, v := range values {
+		hist.Min = float32(math.Min(float64(hist.Min), float64(v)))
+		hist.Max = float32(math.Max(float64(hist.Max), float64(v)))
+	}
+
+	// determine the range that gets mapped onto the bins
+	lo, hi := float64(hist.Min), float64(hist.Max)
+	if log {
+		lo, hi = math.Log2(lo), math.Log2(hi)
+	}
+
+	for _, v := range values {
+		val := float64(v)
+		if log {
+			val = math.Log2(val)
+		}
+
+		idx := bins - 1
+		if hi > lo {
+			idx = int((val - lo) / (hi - lo) * float64(bins))
+		}
+		if idx >= bins {
+			idx = bins - 1
+		}
+		hist.Bins[idx]++
+	}
+
+	return hist, nil
+}
+
+// Percentile returns the value below which p percent of the values of the
+// specified channel fall. p has to be in the range [0,100]. Use
+// CHANNEL_LUMINANCE as the channel to get the luminance percentile.
+func (img *Image2D) Percentile(channel int, p float32) (float32, error) {
+	values, err := img.channelValues(channel)
+	if err != nil {
+		return 0, err
+	}
+	sortFloat32(values)
+	return percentile(values, p), nil
+}
+
+// AverageLogLuminance returns the geometric mean of the luminance of all
+// pixels, which is the usual measure for the overall brightness of a scene.
+func (img *Image2D) AverageLogLuminance() float32 {
+	var sum float64
+	for y := 0; y < img.height; y++ {
+		for x := 0; x < img.width; x++ {
+			l := math.Max(float64(img.Luminance(x, y)), minLuminance)
+			sum += math.Log(l)
+		}
+	}
+	return float32(math.Exp(sum / float64(img.width*img.height)))
+}
+
+// Statistics calculates the minimum, maximum, mean and percentiles of each
+// channel and of the luminance of the image.
+func (img *Image2D) Statistics() Statistics {
+	stats := Statistics{}
+
+	for c := 0; c < img.channels; c++ {
+		values, _ := img.channelValues(c)
+		stats.Channels = append(stats.Channels, calcChannelStatistics(values))
+	}
+
+	values, _ := img.channelValues(CHANNEL_LUMINANCE)
+	stats.Luminance = calcChannelStatistics(values)
+	stats.AverageLogLuminance = img.AverageLogLuminance()
+
+	// dynamic range between the dark and bright end of the luminance
+	lo := math.Max(float64(stats.Luminance.P01), minLuminance)
+	hi := math.Max(float64(stats.Luminance.P99), minLuminance)
+	stats.DynamicRange = float32(math.Log2(hi / lo))
+
+	return stats
+}
+
+// AutoKeyValue estimates the key value, the target middle gray, based on the
+// average log luminance. Dark scenes get a lower key value than bright ones.
+// The estimation follows Krawczyk et al. "Lightness Perception in Tone
+// Reproduction for High Dynamic Range Images".
+func (stats *Statistics) AutoKeyValue() float32 {
+	lavg := float64(stats.AverageLogLuminance)
+	key := 1.03 - 2.0/(2.0+math.Log10(lavg+1))
+	return float32(math.Max(key, 0.05))
+}
+
+// AutoExposure returns the exposure that scales the average log luminance to
+// the automatically estimated key value.
+func (stats *Statistics) AutoExposure() float32 {
+	lavg := math.Max(float64(stats.AverageLogLuminance), minLuminance)
+	return float32(float64(stats.AutoKeyValue()) / lavg)
+}
+
+func (stats Statistics) String() string {
+	names := []string{"R", "G", "B", "A"}
+	if len(stats.Channels) == 1 {
+		names = []string{"L"}
+	}
+
+	format := "%-9v %12.6g %12.6g %12.6g %12.6g %12.6g %12.6g\n"
+	s := fmt.Sprintf("%-9v %12v %12v %12v %12v %12v %12v\n", "channel",
+		"min", "max", "mean", "p01", "median", "p99")
+	for i, c := range stats.Channels {
+		s += fmt.Sprintf(format, names[i], c.Min, c.Max, c.Mean, c.P01, c.Median, c.P99)
+	}
+	l := stats.Luminance
+	s += fmt.Sprintf(format, "luminance", l.Min, l.Max, l.Mean, l.P01, l.Median, l.P99)
+	s += fmt.Sprintf("average log luminance %.6g\n", stats.AverageLogLuminance)
+	s += fmt.Sprintf("dynamic range         %.2f stops\n", stats.DynamicRange)
+	s += fmt.Sprintf("auto key value        %.4f\n", stats.AutoKeyValue())
+	s += fmt.Sprintf("auto exposure         %.6g", stats.AutoExposure())
+	return s
+}
+
+// channelValues collects all values of the specified channel in one slice.
+func (img *Image2D) channelValues(channel int) ([]float32, error) {
+	if channel != CHANNEL_LUMINANCE && (channel < 0 || channel >= img.channels) {
+		return nil, fmt.Errorf("channel %v is out of range", channel)
+	}
+
+	values := make([]float32, 0, img.width*img.height)
+	for y := 0; y < img.height; y++ {
+		for x := 0; x < img.width; x++ {
+			if channel == CHANNEL_LUMINANCE {
+				values = append(values, img.Luminance(x, y))
+			} else {
+				values = append(values, img.GetFloat32(x, y, channel))
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// calcChannelStatistics calculates the statistics of the values. The values
+// will be sorted afterwards.
+func calcChannelStatistics(values []float32) ChannelStatistics {
+	if len(values) == 0 {
+		return ChannelStatistics{}
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += float64(v)
+	}
+
+	sortFloat32(values)
+	return ChannelStatistics{
+		Min:    values[0],
+		Max:    values[len(values)-1],
+		Mean:   float32(sum / float64(len(values))),
+		P01:    percentile(values, 1),
+		Median: percentile(values, 50),
+		P99:    percentile(values, 99),
+	}
+}
+
+// percentile returns the p-th percentile of the sorted values by linearly
+// interpolating between the two closest ranks.
+func percentile(sorted []float32, p float32) float32 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	pos := float64(p) / 100.0 * float64(len(sorted)-1)
+	pos = math.Max(0, math.Min(pos, float64(len(sorted)-1)))
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	t := float32(pos - float64(lo))
+	return (1-t)*sorted[lo] + t*sorted[hi]
+}
+
+func sortFloat32(values []float32) {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+}
@@ -0,0 +1,205 @@
+package image2d
+
+import (
+	"math"
+	"testing"
+
+	"github.com/adrianderstroff/pbr/pkg/cgm"
+)
+
+// the test images have N = STATS_WIDTH*STATS_HEIGHT pixels whose values are
+// spaced evenly in linear or log2 space. the pixels are shuffled such that the
+// statistics have to sort them.
+const (
+	STATS_WIDTH     = 41
+	STATS_HEIGHT    = 25
+	STATS_BINS      = 7
+	STATS_STOPS     = 16
+	STATS_SHUFFLE   = 383 // coprime to the number of pixels
+	STATS_TOLERANCE = 1e-5
+)
+
+// a linear histogram of values spaced evenly between their minimum and
+// maximum puts sample i into the bin i*bins/(N-1)
+func TestHistogram(t *testing.T) {
+	img := makeStatsImage(1, linearValue)
+	hist, err := img.Histogram(0, STATS_BINS, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hist.Min != linearValue(0) || hist.Max != linearValue(statsPixels()-1) {
+		t.Errorf("expected the range [%v,%v], got [%v,%v]", linearValue(0), linearValue(statsPixels()-1), hist.Min, hist.Max)
+	}
+	checkBins(t, "linear", hist.Bins)
+
+	// the bins cover the range without gaps
+	lo, _ := hist.BinRange(0)
+	_, hi := hist.BinRange(STATS_BINS - 1)
+	if math.Abs(float64(lo-hist.Min)) > STATS_TOLERANCE || math.Abs(float64(hi-hist.Max)) > STATS_TOLERANCE {
+		t.Errorf("expected the bins to cover [%v,%v], got [%v,%v]", hist.Min, hist.Max, lo, hi)
+	}
+
+	if _, err := img.Histogram(0, 0, false); err == nil {
+		t.Error("expected an error for zero bins")
+	}
+	if _, err := img.Histogram(1, STATS_BINS, false); err == nil {
+		t.Error("expected an error for a channel out of range")
+	}
+}
+
+// a log histogram of luminances spaced evenly in log2 space distributes them
+// like the linear histogram and ignores values that aren't positive
+func TestLogHistogram(t *testing.T) {
+	img := makeStatsImage(3, logValue)
+	hist, err := img.Histogram(CHANNEL_LUMINANCE, STATS_BINS, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBins(t, "log", hist.Bins)
+
+	// the bins are equally sized in log2 space
+	for i := 0; i < STATS_BINS; i++ {
+		lo, hi := hist.BinRange(i)
+		stops := math.Log2(float64(hi / lo))
+		expected := math.Log2(float64(hist.Max/hist.Min)) / STATS_BINS
+		if math.Abs(stops-expected) > STATS_TOLERANCE {
+			t.Errorf("bin %v: expected %v stops, got %v", i, expected, stops)
+		}
+	}
+
+	img.SetFloat32(0, 0, 0, 0)
+	img.SetFloat32(0, 0, 1, 0)
+	img.SetFloat32(0, 0, 2, 0)
+	hist, err = img.Histogram(CHANNEL_LUMINANCE, STATS_BINS, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for _, b := range hist.Bins {
+		count += b
+	}
+	if count != statsPixels()-1 {
+		t.Errorf("expected %v positive values, got %v", statsPixels()-1, count)
+	}
+}
+
+// the percentiles interpolate linearly between the closest ranks, which are
+// the p/100*(N-1)-th values
+func TestPercentile(t *testing.T) {
+	img := makeStatsImage(1, linearValue)
+	for _, p := range []float32{0, 1, 10, 25, 50, 75, 99, 100} {
+		rank := float64(p) / 100 * float64(statsPixels()-1)
+		expected := (rank + 0.5) / float64(statsPixels())
+		got, err := img.Percentile(0, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(float64(got)-expected) > STATS_TOLERANCE {
+			t.Errorf("percentile %v: expected %v, got %v", p, expected, got)
+		}
+	}
+}
+
+// luminances spaced evenly over STATS_STOPS stops around 1 have a geometric
+// mean of 1, which is mapped onto the key value, and span 98% of the stops
+// between the 1st and 99th percentile
+func TestAutoExposure(t *testing.T) {
+	img := makeStatsImage(3, logValue)
+	stats := img.Statistics()
+	if len(stats.Channels) != 3 {
+		t.Fatalf("expected the statistics of 3 channels, got %v", len(stats.Channels))
+	}
+
+	// the channels are equal to the luminance of a gray image
+	for c, channel := range stats.Channels {
+		l := stats.Luminance
+		for _, v := range [][2]float32{{channel.Min, l.Min}, {channel.Max, l.Max}, {channel.Mean, l.Mean}} {
+			if math.Abs(float64(v[0]-v[1])) > STATS_TOLERANCE*float64(v[1]) {
+				t.Errorf("channel %v: expected the statistics of the luminance %+v, got %+v", c, l, channel)
+				break
+			}
+		}
+	}
+	if l := stats.Luminance; math.Abs(float64(l.Median)-1) > STATS_TOLERANCE {
+		t.Errorf("expected a median luminance of 1, got %v", l.Median)
+	}
+	if math.Abs(float64(stats.AverageLogLuminance)-1) > STATS_TOLERANCE {
+		t.Errorf("expected an average log luminance of 1, got %v", stats.AverageLogLuminance)
+	}
+
+	// the percentiles lie between two samples whose log2 differ by
+	// STATS_STOPS/N
+	expected := 0.98 * STATS_STOPS
+	if tolerance := 2.0 * STATS_STOPS / float64(statsPixels()); math.Abs(float64(stats.DynamicRange)-expected) > tolerance {
+		t.Errorf("expected a dynamic range of %v stops, got %v", expected, stats.DynamicRange)
+	}
+
+	key := 1.03 - 2/(2+math.Log10(2))
+	if math.Abs(float64(stats.AutoKeyValue())-key) > STATS_TOLERANCE {
+		t.Errorf("expected a key value of %v, got %v", key, stats.AutoKeyValue())
+	}
+	if math.Abs(float64(stats.AutoExposure())-key) > STATS_TOLERANCE {
+		t.Errorf("expected an exposure of %v, got %v", key, stats.AutoExposure())
+	}
+
+	// scaling the image by 4 lowers the exposure by at least 4 as the key
+	// value increases with the brightness
+	bright := makeStatsImage(3, func(i int) float32 { return 4 * logValue(i) })
+	brightStats := bright.Statistics()
+	if math.Abs(float64(brightStats.AverageLogLuminance)-4) > 4*STATS_TOLERANCE {
+		t.Errorf("expected an average log luminance of 4, got %v", brightStats.AverageLogLuminance)
+	}
+	if brightStats.AutoKeyValue() <= stats.AutoKeyValue() {
+		t.Errorf("expected a bigger key value than %v, got %v", stats.AutoKeyValue(), brightStats.AutoKeyValue())
+	}
+	if e := brightStats.AutoExposure() * brightStats.AverageLogLuminance; math.Abs(float64(e-brightStats.AutoKeyValue())) > STATS_TOLERANCE {
+		t.Errorf("expected the exposed average log luminance to be the key value %v, got %v", brightStats.AutoKeyValue(), e)
+	}
+}
+
+// checkBins compares the bins with the expected count of samples i that fall
+// into the bin i*STATS_BINS/(N-1), where the last sample is clamped into the
+// last bin.
+func checkBins(t *testing.T, name string, bins []int) {
+	expected := make([]int, STATS_BINS)
+	for i := 0; i < statsPixels(); i++ {
+		expected[cgm.Mini(i*STATS_BINS/(statsPixels()-1), STATS_BINS-1)]++
+	}
+	for i := range bins {
+		if bins[i] != expected[i] {
+			t.Errorf("%v: expected the bins %v, got %v", name, expected, bins)
+			return
+		}
+	}
+}
+
+// makeStatsImage creates a float image whose channels all hold the value f(i)
+// of the i-th sample of the shuffled pixels.
+func makeStatsImage(channels int, f func(i int) float32) Image2D {
+	img, err := MakeFloat32(STATS_WIDTH, STATS_HEIGHT, channels)
+	if err != nil {
+		panic(err)
+	}
+	for p := 0; p < statsPixels(); p++ {
+		i := p * STATS_SHUFFLE % statsPixels()
+		for c := 0; c < channels; c++ {
+			img.SetFloat32(p%STATS_WIDTH, p/STATS_WIDTH, c, f(i))
+		}
+	}
+	return img
+}
+
+// linearValue returns the i-th of N values spaced evenly in [0,1].
+func linearValue(i int) float32 {
+	return (float32(i) + 0.5) / float32(statsPixels())
+}
+
+// logValue returns the i-th of N values spaced evenly in log2 space over
+// STATS_STOPS stops around 1.
+func logValue(i int) float32 {
+	return float32(math.Exp2(STATS_STOPS * ((float64(i)+0.5)/float64(statsPixels()) - 0.5)))
+}
+
+func statsPixels() int {
+	return STATS_WIDTH * STATS_HEIGHT
+}
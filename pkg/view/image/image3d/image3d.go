@@ -49,6 +49,30 @@ func Make(width, height, slices, channels int) (Image3D, error) {
 	}, nil
 }
 
+// MakeFloat32 constructs a black image of the specified width, height, slices
+// and number of channels where each channel is stored as a 32bit float.
+func MakeFloat32(width, height, slices, channels int) (Image3D, error) {
+	// create image data
+	var data []image2d.Image2D
+	for i := 0; i < slices; i++ {
+		image, err := image2d.MakeFloat32(width, height, channels)
+		if err != nil {
+			return Image3D{}, err
+		}
+		data = append(data, image)
+	}
+
+	return Image3D{
+		width:     width,
+		height:    height,
+		slices:    slices,
+		channels:  channels,
+		bytedepth: 4,
+		pixelType: data[0].GetPixelType(),
+		data:      data,
+	}, nil
+}
+
 // MakeFromData constructs an image of the specified width, height, slices and
 // the specified data.
 func MakeFromData(width, height, slices, channels int, data []uint8) (Image3D, error) {
@@ -57,7 +81,7 @@ func MakeFromData(width, height, slices, channels int, data []uint8) (Image3D, e
 
 	// create the individual images
 	var images []image2d.Image2D
-	size := width * height * channels
+	size := width * height * channels * bytedepth
 	for i := 0; i < slices; i++ {
 		s, e := i*size, (i+1)*size
 		image, err := image2d.MakeFromData(width, height, channels, data[s:e])
@@ -269,6 +293,17 @@ func (image *Image3D) SetRGBA(x, y, z int, r, g, b, a uint8) {
 	image.data[z].SetRGBA(x, y, r, g, b, a)
 }
 
+// GetFloat32 returns the value of channel c of the pixel at (x,y) in slice z
+// as a float.
+func (image *Image3D) GetFloat32(x, y, z, c int) float32 {
+	return image.data[z].GetFloat32(x, y, c)
+}
+
+// SetFloat32 sets the value of channel c of the pixel at (x,y) in slice z.
+func (image *Image3D) SetFloat32(x, y, z, c int, val float32) {
+	image.data[z].SetFloat32(x, y, c, val)
+}
+
 // String pretty prints information about the image.
 func (image Image3D) String() string {
 	c := getChannelsName(image.channels)
@@ -1,5 +1,7 @@
 package mesh
 
+import "fmt"
+
 // Alignment options for different vertex attribute layouts
 const (
 	ALIGN_MULTI_BATCH  = 0 // having each attribute in a different slice (1111)(2222)(3333)
@@ -44,6 +46,85 @@ func NewGeometry(layout []VertexAttribute, data [][]float32) *Geometry {
 	return &geometry
 }
 
+// Attribute returns the data of the vertex attribute with the specified id as
+// one slice independent of the alignment of the geometry, along with the
+// number of elements per vertex.
+func (geometry *Geometry) Attribute(id string) ([]float32, int, error) {
+	// find the attribute and its offset within an interleaved vertex
+	idx, offset, stride := -1, 0, 0
+	for i, attrib := range geometry.Layout {
+		if attrib.ID == id {
+			idx = i
+			offset = stride
+		}
+		stride += int(attrib.Count)
+	}
+	if idx == -1 {
+		return nil, 0, fmt.Errorf("geometry has no vertex attribute %v", id)
+	}
+	count := int(geometry.Layout[idx].Count)
+
+	switch geometry.Alignment {
+	case ALIGN_MULTI_BATCH:
+		return geometry.Data[idx], count, nil
+	case ALIGN_INTERLEAVED:
+		data := geometry.Data[0]
+		values := make([]float32, 0, len(data)/stride*count)
+		for v := 0; v+stride <= len(data); v += stride {
+			values = append(values, data[v+offset:v+offset+count]...)
+		}
+		return values, count, nil
+	}
+
+	return nil, 0, fmt.Errorf("alignment %v is not supported", geometry.Alignment)
+}
+
+// SetAttribute sets the data of the vertex attribute with the id of attrib.
+// An existing attribute with the same id is replaced, otherwise the attribute
+// is appended to the layout. The data needs count elements for each vertex of
+// the geometry. Interleaved geometries are split into one slice per attribute
+// first.
+func (geometry *Geometry) SetAttribute(attrib VertexAttribute, data []float32) error {
+	if len(geometry.Layout) > 0 {
+		positions, count, err := geometry.Attribute(geometry.Layout[0].ID)
+		if err != nil {
+			return err
+		}
+		if len(data)/int(attrib.Count) != len(positions)/count {
+			return fmt.Errorf("vertex attribute %v has %v instead of %v vertices",
+				attrib.ID, len(data)/int(attrib.Count), len(positions)/count)
+		}
+	}
+
+	// split interleaved attributes into separate slices
+	if geometry.Alignment == ALIGN_INTERLEAVED {
+		batches := make([][]float32, len(geometry.Layout))
+		for i, a := range geometry.Layout {
+			values, _, err := geometry.Attribute(a.ID)
+			if err != nil {
+				return err
+			}
+			batches[i] = values
+		}
+		geometry.Data = batches
+		geometry.Alignment = ALIGN_MULTI_BATCH
+	}
+	if geometry.Alignment != ALIGN_MULTI_BATCH {
+		return fmt.Errorf("alignment %v is not supported", geometry.Alignment)
+	}
+
+	for i, a := range geometry.Layout {
+		if a.ID == attrib.ID {
+			geometry.Layout[i] = attrib
+			geometry.Data[i] = data
+			return nil
+		}
+	}
+	geometry.Layout = append(geometry.Layout, attrib)
+	geometry.Data = append(geometry.Data, data)
+	return nil
+}
+
 // VertexAttribute specifies the layout of one vertex attribute.
 // The id has to match the name of the vertex attribute used in the shader.
 // The glType is the type of one element of the vertex attribute to specify.
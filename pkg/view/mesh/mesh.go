@@ -119,6 +119,11 @@ func (mesh *Mesh) AddTexture(texture tex.Texture) {
 	mesh.textures = append(mesh.textures, texture)
 }
 
+// GetGeometry returns a pointer to the geometry of the mesh.
+func (mesh *Mesh) GetGeometry() *Geometry {
+	return &mesh.geometry
+}
+
 // GetVAO returns a pointer to the VAO.
 func (mesh *Mesh) GetVAO() *vao.VAO {
 	return &mesh.vao
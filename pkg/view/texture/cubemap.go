@@ -2,6 +2,8 @@
 package texture
 
 import (
+	"errors"
+
 	gl "github.com/adrianderstroff/pbr/pkg/core/gl"
 	"github.com/adrianderstroff/pbr/pkg/view/image/image2d"
 )
@@ -93,3 +95,51 @@ func MakeCubeMap(right, left, top, bottom, front, back string, inside bool,
 
 	return tex, nil
 }
+
+// MakeCubeMapFromMipmaps creates a cube map from already loaded images. The
+// first index of images is the mip level and the second index is the side of
+// the cube map in the order right, left, top, bottom, front and back. Each
+// level has to be half the size of the previous level.
+func MakeCubeMapFromMipmaps(images [][]image2d.Image2D, internalformat int32) (Texture, error) {
+	if len(images) == 0 {
+		return Texture{}, errors.New("no mip levels specified")
+	}
+
+	tex := Texture{0, gl.TEXTURE_CUBE_MAP, 0}
+
+	// generate cube map texture
+	gl.GenTextures(1, &tex.handle)
+	tex.Bind(0)
+
+	// upload all sides of all levels
+	for level, sides := range images {
+		if len(sides) != 6 {
+			tex.Unbind()
+			tex.Delete()
+			return Texture{}, errors.New("each mip level needs exactly 6 sides")
+		}
+
+		for i, img := range sides {
+			target := gl.TEXTURE_CUBE_MAP_POSITIVE_X + uint32(i)
+			format := determineFormat(img.GetChannels())
+
+			gl.TexImage2D(target, int32(level), internalformat,
+				int32(img.GetWidth()), int32(img.GetHeight()), 0, uint32(format),
+				img.GetPixelType(), img.GetDataPointer())
+		}
+	}
+
+	// format texture
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_BASE_LEVEL, 0)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_MAX_LEVEL, int32(len(images)-1))
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_R, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+
+	// unset active texture
+	tex.Unbind()
+
+	return tex, nil
+}
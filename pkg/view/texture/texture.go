@@ -75,8 +75,12 @@ func (tex *Texture) Bind(index uint32) {
 	gl.BindTexture(tex.target, tex.handle)
 }
 
-// Unbind makes the texture unavailable for reading.
+// Unbind makes the texture unavailable for reading at the position it was
+// bound to.
 func (tex *Texture) Unbind() {
+	if tex.texPos != 0 {
+		gl.ActiveTexture(tex.texPos)
+	}
 	tex.texPos = 0
 	gl.BindTexture(tex.target, 0)
 }